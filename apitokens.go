@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==========================================
+// TOKENS DE API PESSOAIS (Scripts e Integrações)
+// ==========================================
+//
+// Enviados como "Authorization: Bearer cgt_...". O token só é mostrado na criação;
+// o banco guarda o hash. Permissões efetivas = permissões do perfil do dono
+// limitadas aos escopos do token; tokens somente leitura aceitam apenas GET.
+// Negação por padrão: o token só alcança as rotas de apiTokenRouteScopes, cada uma
+// com o escopo exigido. Rotas de conta e credenciais (/auth/*, sessões, 2FA,
+// personificação) e rotas novas ficam de fora até serem declaradas ali.
+
+const (
+	apiTokenPrefix        = "cgt_"
+	apiTokenAuditInterval = 5 * time.Minute // Leituras seguidas do mesmo token geram um único registro de auditoria
+)
+
+// apiScopeTickets é o escopo de uso básico dos chamados (listar, abrir, comentar, acompanhar).
+// Não é uma permissão de perfil: todo usuário pode concedê-lo aos próprios tokens, e os
+// handlers continuam aplicando as regras de visibilidade de cada chamado.
+const apiScopeTickets = "ticket.use"
+
+var errAPITokenReadOnly = errors.New("Token de API somente leitura")
+
+// apiTokenRouteScopes lista as rotas liberadas para tokens de API ("MÉTODO caminho") e os
+// escopos aceitos em cada uma (basta um). Rotas fora da lista são recusadas.
+var apiTokenRouteScopes = map[string][]string{
+	// Chamados (visibilidade verificada nos handlers)
+	"GET /api/v1/tickets":                         {apiScopeTickets},
+	"POST /api/v1/tickets":                        {apiScopeTickets},
+	"GET /api/v1/tickets/:id":                     {apiScopeTickets},
+	"GET /api/v1/tickets/:id/timeline":            {apiScopeTickets},
+	"GET /api/v1/tickets/:id/attachments":         {apiScopeTickets},
+	"GET /api/v1/tickets/:id/transitions":         {apiScopeTickets},
+	"PATCH /api/v1/tickets/:id/status":            {apiScopeTickets},
+	"POST /api/v1/tickets/:id/comments":           {apiScopeTickets},
+	"GET /api/v1/tickets/:id/watchers":            {apiScopeTickets},
+	"DELETE /api/v1/tickets/:id/watchers/:userId": {apiScopeTickets},
+	"POST /api/v1/tickets/:id/watch":              {apiScopeTickets},
+	"DELETE /api/v1/tickets/:id/watch":            {apiScopeTickets},
+	"PATCH /api/v1/comments/:id":                  {apiScopeTickets},
+	"DELETE /api/v1/comments/:id":                 {apiScopeTickets},
+	"GET /api/v1/attachments/:id":                 {apiScopeTickets},
+	"DELETE /api/v1/attachments/:id":              {apiScopeTickets},
+	"GET /api/v1/workflow":                        {apiScopeTickets},
+	"GET /api/v1/categories":                      {apiScopeTickets},
+	"GET /api/v1/users/techs":                     {apiScopeTickets},
+	"GET /api/v1/events":                          {apiScopeTickets},
+	"PATCH /api/v1/tickets/:id":                   {"ticket.assign"},
+	"PATCH /api/v1/tickets/:id/assign":            {"ticket.assign"},
+	"POST /api/v1/tickets/:id/watchers":           {"ticket.assign"},
+	"DELETE /api/v1/tickets/:id":                  {"ticket.delete"},
+	"GET /api/v1/tickets/:id/comment-revisions":   {"comment.history"},
+	"GET /api/v1/comments/:id/revisions":          {"comment.history"},
+	"PUT /api/v1/workflow":                        {"workflow.manage"},
+
+	// Ativos
+	"GET /api/v1/assets":             {"asset.view"},
+	"GET /api/v1/assets/:id/history": {"asset.view"},
+	"POST /api/v1/assets":            {"asset.manage"},
+	"PUT /api/v1/assets/:id":         {"asset.manage"},
+	"POST /api/v1/import/assets":     {"asset.manage"},
+	"DELETE /api/v1/assets/:id":      {"asset.delete"},
+
+	// Categorias, relatórios e indicadores
+	"POST /api/v1/categories/":      {"category.manage"},
+	"PUT /api/v1/categories/:id":    {"category.manage"},
+	"DELETE /api/v1/categories/:id": {"category.manage"},
+	"GET /api/v1/reports":           {"report.view"},
+	"GET /api/v1/audit":             {"audit.view"},
+	"GET /api/v1/dashboard/kpis":    {"dashboard.view"},
+
+	// Usuários (a própria conta não é editável por token: ver UpdateUser)
+	"GET /api/v1/users/list":            {"user.list", "user.manage"},
+	"GET /api/v1/users/":                {"user.manage"},
+	"GET /api/v1/users/:id":             {"user.manage"},
+	"POST /api/v1/users":                {"user.manage"},
+	"POST /api/v1/users/":               {"user.manage"},
+	"PUT /api/v1/users/:id":             {"user.manage"},
+	"DELETE /api/v1/users/:id":          {"user.manage"},
+	"GET /api/v1/users/:id/open-work":   {"user.manage"},
+	"POST /api/v1/users/:id/deactivate": {"user.manage"},
+	"POST /api/v1/users/:id/reactivate": {"user.manage"},
+	"POST /api/v1/users/:id/reassign":   {"user.manage"},
+	"POST /api/v1/import/users":         {"user.manage"},
+}
+
+// apiTokenRouteAllowed verifica se a rota foi declarada para tokens e se o escopo do token
+// (limitado às permissões do perfil) cobre algum dos escopos exigidos
+func apiTokenRouteAllowed(c *gin.Context, scopes []string, role string) (bool, []string) {
+	required, declared := apiTokenRouteScopes[c.Request.Method+" "+c.FullPath()]
+	if !declared {
+		return false, nil
+	}
+	for _, scope := range required {
+		if tokenScopeAllows(scopes, scope) && (scope == apiScopeTickets || roleHasPermission(role, scope)) {
+			return true, required
+		}
+	}
+	return false, required
+}
+
+// APIToken é um token de longa duração vinculado a um usuário
+type APIToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	Name       string     `gorm:"not null" json:"name"`
+	Prefix     string     `json:"prefix"` // Início do token, para identificação
+	TokenHash  string     `gorm:"uniqueIndex;not null" json:"-"`
+	Scopes     string     `json:"scopes"` // Permissões separadas por vírgula ("*" = todas as do perfil)
+	ReadOnly   bool       `json:"read_only"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// IsActive indica se o token ainda pode ser usado
+func (t *APIToken) IsActive() bool {
+	return t.RevokedAt == nil && time.Now().Before(t.ExpiresAt)
+}
+
+// ScopeList devolve os escopos como lista
+func (t *APIToken) ScopeList() []string {
+	if t.Scopes == "" {
+		return nil
+	}
+	return strings.Split(t.Scopes, ",")
+}
+
+// tokenScopeAllows verifica se o escopo do token cobre a permissão
+func tokenScopeAllows(scopes []string, permission string) bool {
+	for _, s := range scopes {
+		if s == "*" || s == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticateAPIToken valida um token de API e registra o uso
+func authenticateAPIToken(c *gin.Context, raw string) (*APIToken, *User, error) {
+	var token APIToken
+	if err := db.Where("token_hash = ?", hashToken(raw)).First(&token).Error; err != nil {
+		return nil, nil, fmt.Errorf("Token de API inválido")
+	}
+	if !token.IsActive() {
+		return nil, nil, fmt.Errorf("Token de API expirado ou revogado")
+	}
+	var user User
+	if err := db.First(&user, token.UserID).Error; err != nil || !user.Active {
+		return nil, nil, fmt.Errorf("Usuário do token desativado")
+	}
+	if token.ReadOnly && c.Request.Method != http.MethodGet {
+		return nil, nil, errAPITokenReadOnly
+	}
+
+	now := time.Now()
+	audit := c.Request.Method != http.MethodGet || token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > apiTokenAuditInterval
+	db.Model(&token).Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": c.ClientIP()})
+	if audit {
+		logAction(user.ID, "API_TOKEN_USE", "APIToken", token.ID, fmt.Sprintf("Token '%s' usado: %s %s (IP %s)", token.Name, c.Request.Method, c.Request.URL.Path, c.ClientIP()))
+	}
+	return &token, &user, nil
+}
+
+// GetMyAPITokens lista os tokens do usuário autenticado
+func GetMyAPITokens(c *gin.Context) {
+	listAPITokens(c, getCurrentUserID(c))
+}
+
+// GetUserAPITokens lista os tokens de um usuário (user.manage)
+func GetUserAPITokens(c *gin.Context) {
+	var user User
+	if err := db.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+		return
+	}
+	listAPITokens(c, user.ID)
+}
+
+func listAPITokens(c *gin.Context, userID uint) {
+	var tokens []APIToken
+	if err := db.Where("user_id = ?", userID).Order("created_at desc").Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar tokens"})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// CreateAPIToken gera um token para o próprio usuário (mostrado uma única vez)
+func CreateAPIToken(c *gin.Context) {
+	var input struct {
+		Name          string   `json:"name" binding:"required"`
+		Scopes        []string `json:"scopes" binding:"required"`
+		ReadOnly      bool     `json:"read_only"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Escopos: permissões do catálogo que o próprio perfil possui
+	role := c.GetString("role")
+	if len(input.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Informe ao menos um escopo"})
+		return
+	}
+	for _, scope := range input.Scopes {
+		if scope == "*" || scope == apiScopeTickets {
+			continue
+		}
+		if _, err := resolvePermissions([]string{scope}); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !roleHasPermission(role, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Seu perfil não possui a permissão " + scope})
+			return
+		}
+	}
+
+	maxDays := getSettingInt("api_token_max_days", 365)
+	if input.ExpiresInDays <= 0 {
+		input.ExpiresInDays = 90
+	}
+	if maxDays > 0 && input.ExpiresInDays > maxDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Validade máxima de %d dias", maxDays)})
+		return
+	}
+
+	secret, err := generateRandomToken(24)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gerar token"})
+		return
+	}
+	raw := apiTokenPrefix + secret
+
+	token := APIToken{
+		UserID:    getCurrentUserID(c),
+		Name:      input.Name,
+		Prefix:    raw[:len(apiTokenPrefix)+6],
+		TokenHash: hashToken(raw),
+		Scopes:    strings.Join(input.Scopes, ","),
+		ReadOnly:  input.ReadOnly,
+		ExpiresAt: time.Now().AddDate(0, 0, input.ExpiresInDays),
+	}
+	if err := db.Create(&token).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar token"})
+		return
+	}
+
+	logAction(token.UserID, "API_TOKEN_CREATE", "APIToken", token.ID, fmt.Sprintf("Token '%s' criado (escopos: %s, somente leitura: %t, expira em %s)", token.Name, token.Scopes, token.ReadOnly, token.ExpiresAt.Format("02/01/2006")))
+	c.JSON(http.StatusCreated, gin.H{
+		"token":     raw,
+		"api_token": token,
+		"message":   "Copie o token agora: ele não será exibido novamente.",
+	})
+}
+
+// RevokeMyAPIToken revoga um token do próprio usuário
+func RevokeMyAPIToken(c *gin.Context) {
+	revokeAPIToken(c, getCurrentUserID(c), c.Param("id"))
+}
+
+// RevokeUserAPIToken revoga um token de outro usuário (user.manage)
+func RevokeUserAPIToken(c *gin.Context) {
+	var user User
+	if err := db.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+		return
+	}
+	revokeAPIToken(c, user.ID, c.Param("tid"))
+}
+
+func revokeAPIToken(c *gin.Context, userID uint, tokenID string) {
+	var token APIToken
+	if err := db.Where("id = ? AND user_id = ?", tokenID, userID).First(&token).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token não encontrado"})
+		return
+	}
+	if token.RevokedAt == nil {
+		now := time.Now()
+		token.RevokedAt = &now
+		db.Save(&token)
+	}
+
+	logRequestAction(c, "API_TOKEN_REVOKE", "APIToken", token.ID, fmt.Sprintf("Token '%s' do usuário %d revogado", token.Name, token.UserID))
+	c.JSON(http.StatusOK, gin.H{"message": "Token revogado"})
+}
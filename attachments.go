@@ -0,0 +1,382 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==========================================
+// ANEXOS (Chamados e Comentários)
+// ==========================================
+//
+// POST /tickets e POST /tickets/:id/comments aceitam multipart/form-data com os
+// arquivos no campo "files". Tamanho, quantidade e extensões permitidas são
+// configuráveis (attachment_*). O download passa pela mesma verificação de
+// acesso do chamado e os arquivos entram no backup automático.
+
+const attachmentFormField = "files"
+
+// Attachment é um arquivo enviado em um chamado ou comentário
+type Attachment struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	TicketID    uint      `gorm:"index;not null" json:"ticket_id"`
+	CommentID   *uint     `gorm:"index" json:"comment_id"`
+	UploaderID  uint      `json:"uploader_id"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	Backend     string    `json:"-"` // local ou s3 (ver storage.go)
+	StorageKey  string    `gorm:"uniqueIndex" json:"-"`
+}
+
+// Tipos de imagem: o conteúdo precisa confirmar a extensão
+var imageExtensions = map[string]bool{".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true, ".bmp": true}
+
+// attachmentLimits reúne as regras de upload configuradas
+type attachmentLimits struct {
+	MaxBytes   int64
+	MaxFiles   int
+	Extensions map[string]bool
+}
+
+func loadAttachmentLimits() attachmentLimits {
+	limits := attachmentLimits{
+		MaxBytes:   int64(getSettingInt("attachment_max_mb", 10)) << 20,
+		MaxFiles:   getSettingInt("attachment_max_files", 5),
+		Extensions: map[string]bool{},
+	}
+	for _, ext := range splitList(strings.ToLower(getSettingValue("attachment_allowed_extensions", ""))) {
+		limits.Extensions["."+strings.TrimPrefix(ext, ".")] = true
+	}
+	return limits
+}
+
+// isMultipart indica se a requisição traz arquivos (multipart/form-data)
+func isMultipart(c *gin.Context) bool {
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	return mediaType == "multipart/form-data"
+}
+
+// pendingUpload é um arquivo já validado, aguardando o chamado/comentário ser criado
+type pendingUpload struct {
+	FileName    string
+	ContentType string
+	Data        []byte
+}
+
+// collectUploads lê e valida os arquivos enviados, antes de qualquer gravação
+func collectUploads(c *gin.Context) ([]pendingUpload, error) {
+	if !isMultipart(c) {
+		return nil, nil
+	}
+	limits := loadAttachmentLimits()
+	// Corta envios muito acima do permitido antes de ler o corpo inteiro
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(limits.MaxFiles)*limits.MaxBytes+(1<<20))
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, fmt.Errorf("Envio inválido ou acima do limite de %d arquivo(s) de %d MB", limits.MaxFiles, limits.MaxBytes>>20)
+	}
+	files := form.File[attachmentFormField]
+	if len(files) == 0 {
+		return nil, nil
+	}
+	if len(files) > limits.MaxFiles {
+		return nil, fmt.Errorf("Máximo de %d anexos por envio", limits.MaxFiles)
+	}
+
+	uploads := make([]pendingUpload, 0, len(files))
+	for _, fh := range files {
+		upload, err := readUpload(fh, limits)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, nil
+}
+
+func readUpload(fh *multipart.FileHeader, limits attachmentLimits) (pendingUpload, error) {
+	name := sanitizeFileName(fh.Filename)
+	if !limits.Extensions[strings.ToLower(filepath.Ext(name))] {
+		return pendingUpload{}, fmt.Errorf("Tipo de arquivo não permitido: %s", name)
+	}
+	if fh.Size > limits.MaxBytes {
+		return pendingUpload{}, fmt.Errorf("Arquivo %s excede o limite de %d MB", name, limits.MaxBytes>>20)
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return pendingUpload{}, fmt.Errorf("Erro ao ler %s", name)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, limits.MaxBytes+1))
+	if err != nil {
+		return pendingUpload{}, fmt.Errorf("Erro ao ler %s", name)
+	}
+	return validateUpload(name, data, limits)
+}
+
+// validateUpload aplica as regras de tipo e tamanho ao conteúdo de um arquivo
+func validateUpload(name string, data []byte, limits attachmentLimits) (pendingUpload, error) {
+	name = sanitizeFileName(name)
+	ext := strings.ToLower(filepath.Ext(name))
+	if !limits.Extensions[ext] {
+		return pendingUpload{}, fmt.Errorf("Tipo de arquivo não permitido: %s", name)
+	}
+	if int64(len(data)) > limits.MaxBytes {
+		return pendingUpload{}, fmt.Errorf("Arquivo %s excede o limite de %d MB", name, limits.MaxBytes>>20)
+	}
+	if len(data) == 0 {
+		return pendingUpload{}, fmt.Errorf("Arquivo vazio: %s", name)
+	}
+
+	// O tipo é detectado pelo conteúdo, não pelo que o navegador informou
+	detected := http.DetectContentType(data)
+	if imageExtensions[ext] && !strings.HasPrefix(detected, "image/") {
+		return pendingUpload{}, fmt.Errorf("O conteúdo de %s não é uma imagem válida", name)
+	}
+	contentType := mime.TypeByExtension(ext)
+	if contentType == "" || imageExtensions[ext] {
+		contentType = detected
+	}
+	return pendingUpload{FileName: name, ContentType: contentType, Data: data}, nil
+}
+
+// sanitizeFileName mantém só o nome do arquivo, sem caminho nem caracteres de controle
+func sanitizeFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 32 || r == 127 || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == "/" {
+		name = "anexo"
+	}
+	if len(name) > 200 {
+		ext := filepath.Ext(name)
+		name = name[:200-len(ext)] + ext
+	}
+	return name
+}
+
+// saveAttachments grava os arquivos enviados na requisição e registra os anexos
+func saveAttachments(c *gin.Context, ticketID uint, commentID *uint, uploads []pendingUpload) ([]Attachment, error) {
+	if len(uploads) == 0 {
+		return nil, nil
+	}
+	saved, err := storeAttachments(getCurrentUserID(c), ticketID, commentID, uploads)
+	if err != nil {
+		return saved, err
+	}
+	logRequestAction(c, "ATTACHMENT_UPLOAD", "Ticket", ticketID, fmt.Sprintf("%d anexo(s) enviados", len(saved)))
+	return saved, nil
+}
+
+// storeAttachments grava os arquivos no armazenamento ativo em nome de uploaderID
+func storeAttachments(uploaderID, ticketID uint, commentID *uint, uploads []pendingUpload) ([]Attachment, error) {
+	store, err := activeFileStore()
+	if err != nil {
+		return nil, err
+	}
+
+	saved := make([]Attachment, 0, len(uploads))
+	for _, up := range uploads {
+		random, err := generateRandomToken(16)
+		if err != nil {
+			return saved, err
+		}
+		sum := sha256.Sum256(up.Data)
+		att := Attachment{
+			TicketID:    ticketID,
+			CommentID:   commentID,
+			UploaderID:  uploaderID,
+			FileName:    up.FileName,
+			ContentType: up.ContentType,
+			Size:        int64(len(up.Data)),
+			SHA256:      hex.EncodeToString(sum[:]),
+			Backend:     store.Name(),
+			// Chave sem dados do usuário: evita colisões e caminhos maliciosos
+			StorageKey: time.Now().Format("2006/01/") + random,
+		}
+		if err := store.Put(att.StorageKey, up.Data, up.ContentType); err != nil {
+			return saved, fmt.Errorf("falha ao gravar %s: %w", up.FileName, err)
+		}
+		if err := db.Create(&att).Error; err != nil {
+			store.Delete(att.StorageKey)
+			return saved, err
+		}
+		saved = append(saved, att)
+	}
+	return saved, nil
+}
+
+// discardAttachments desfaz uma gravação que falhou no meio: apaga os registros e os arquivos já gravados
+func discardAttachments(saved []Attachment) {
+	for _, att := range saved {
+		db.Delete(&Attachment{}, att.ID)
+		if store, err := fileStoreByName(att.Backend); err == nil {
+			if err := store.Delete(att.StorageKey); err != nil {
+				fmt.Printf("[ANEXOS] Erro ao apagar arquivo %s: %v\n", att.StorageKey, err)
+			}
+		}
+	}
+}
+
+// loadAttachmentForRequest busca o anexo e confere o acesso ao chamado
+func loadAttachmentForRequest(c *gin.Context) (*Attachment, *Ticket, bool) {
+	var att Attachment
+	if err := db.First(&att, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Anexo não encontrado"})
+		return nil, nil, false
+	}
+	var ticket Ticket
+	if err := db.First(&ticket, att.TicketID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Anexo não encontrado"})
+		return nil, nil, false
+	}
+	if !canViewTicket(c, ticket) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Você não tem permissão para ver este anexo"})
+		return nil, nil, false
+	}
+	// Anexo de nota interna: inexistente para quem não vê notas internas
+	if att.CommentID != nil && !canSeeInternalNotes(c) {
+		var internal int64
+		db.Model(&Comment{}).Where("id = ? AND internal = ?", *att.CommentID, true).Count(&internal)
+		if internal > 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Anexo não encontrado"})
+			return nil, nil, false
+		}
+	}
+	return &att, &ticket, true
+}
+
+// --- Handlers ---
+
+// GetTicketAttachments lista os anexos do chamado (inclusive dos comentários)
+func GetTicketAttachments(c *gin.Context) {
+	var ticket Ticket
+	if err := db.First(&ticket, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		return
+	}
+	if !canViewTicket(c, ticket) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Você não tem permissão para ver este chamado"})
+		return
+	}
+	var attachments []Attachment
+	query := db.Where("ticket_id = ?", ticket.ID)
+	if !canSeeInternalNotes(c) {
+		query = query.Where("comment_id IS NULL OR comment_id NOT IN (?)", internalCommentIDs())
+	}
+	query.Order("created_at").Find(&attachments)
+	c.JSON(http.StatusOK, attachments)
+}
+
+// DownloadAttachment envia o arquivo, se o usuário puder ver o chamado
+func DownloadAttachment(c *gin.Context) {
+	att, _, ok := loadAttachmentForRequest(c)
+	if !ok {
+		return
+	}
+	store, err := fileStoreByName(att.Backend)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	reader, err := store.Get(att.StorageKey)
+	if err != nil {
+		fmt.Printf("[ANEXOS] Erro ao ler anexo %d: %v\n", att.ID, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo indisponível no armazenamento"})
+		return
+	}
+	defer reader.Close()
+
+	// Imagens podem ser exibidas no navegador; o resto sempre baixa
+	disposition := "attachment"
+	if strings.HasPrefix(att.ContentType, "image/") && att.ContentType != "image/svg+xml" {
+		disposition = "inline"
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": att.FileName}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "default-src 'none'; sandbox")
+	c.DataFromReader(http.StatusOK, att.Size, att.ContentType, reader, nil)
+}
+
+// DeleteAttachment remove um anexo (quem enviou ou ticket.delete)
+func DeleteAttachment(c *gin.Context) {
+	att, _, ok := loadAttachmentForRequest(c)
+	if !ok {
+		return
+	}
+	if att.UploaderID != getCurrentUserID(c) && !hasPermission(c, "ticket.delete") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Apenas quem enviou pode remover o anexo"})
+		return
+	}
+	if err := db.Delete(att).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao remover anexo"})
+		return
+	}
+	// A cópia do backup é mantida: backups antigos do banco ainda a referenciam
+	if store, err := fileStoreByName(att.Backend); err == nil {
+		if err := store.Delete(att.StorageKey); err != nil {
+			fmt.Printf("[ANEXOS] Erro ao apagar arquivo do anexo %d: %v\n", att.ID, err)
+		}
+	}
+	logRequestAction(c, "ATTACHMENT_DELETE", "Ticket", att.TicketID, fmt.Sprintf("Anexo removido: %s", att.FileName))
+	c.JSON(http.StatusOK, gin.H{"message": "Anexo removido"})
+}
+
+// backupAttachments copia para o backup os anexos que ainda não estão lá.
+// Os arquivos nunca mudam depois de enviados, então a cópia é incremental.
+func backupAttachments(dir string) {
+	var attachments []Attachment
+	db.Find(&attachments)
+
+	target := localFileStore{dir: filepath.Join(dir, "attachments")}
+	copied, failed := 0, 0
+	for _, att := range attachments {
+		path, err := target.path(att.StorageKey)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		store, err := fileStoreByName(att.Backend)
+		if err != nil {
+			failed++
+			continue
+		}
+		reader, err := store.Get(att.StorageKey)
+		if err != nil {
+			failed++
+			continue
+		}
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil || target.Put(att.StorageKey, data, att.ContentType) != nil {
+			failed++
+			continue
+		}
+		copied++
+	}
+	if copied > 0 || failed > 0 {
+		fmt.Printf("[Backup] Anexos: %d copiados, %d com erro\n", copied, failed)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==========================================
+// AUTORIA E EDIÇÃO DE COMENTÁRIOS
+// ==========================================
+//
+// O autor do comentário vem sempre do token (AuthorID); o campo Author guarda
+// apenas o nome exibido no momento da escrita. Mensagens automáticas (SLA,
+// redistribuições) usam AuthorType "system". O autor pode editar ou excluir o
+// próprio comentário por comment_edit_window_minutes; cada versão anterior fica
+// em CommentRevision, visível a quem tem comment.history.
+
+const (
+	commentAuthorUser   = "user"
+	commentAuthorSystem = "system"
+	systemCommentAuthor = "System Bot"
+)
+
+// CommentRevision guarda a versão de um comentário antes de uma edição ou exclusão
+type CommentRevision struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	CommentID  uint      `gorm:"index;not null" json:"comment_id"`
+	Action     string    `json:"action"` // edit ou delete
+	Content    string    `json:"content"`
+	Internal   bool      `json:"internal"`
+	EditedByID uint      `json:"edited_by_id"`
+	EditedBy   *User     `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"edited_by,omitempty"`
+}
+
+// newUserComment monta um comentário do usuário autenticado
+func newUserComment(c *gin.Context, ticketID uint, content string) Comment {
+	uid := getCurrentUserID(c)
+	return Comment{
+		TicketID:   ticketID,
+		AuthorID:   &uid,
+		Author:     currentUserDisplayName(c),
+		AuthorType: commentAuthorUser,
+		Content:    content,
+	}
+}
+
+// createSystemComment registra uma mensagem automática no chamado
+func createSystemComment(tx *gorm.DB, ticketID uint, content string) error {
+	return tx.Create(&Comment{
+		TicketID:   ticketID,
+		Author:     systemCommentAuthor,
+		AuthorType: commentAuthorSystem,
+		Content:    content,
+	}).Error
+}
+
+// migrateCommentAuthors marca como sistema os comentários automáticos antigos
+func migrateCommentAuthors() {
+	db.Model(&Comment{}).Where("author = ? AND author_id IS NULL AND author_type <> ?", systemCommentAuthor, commentAuthorSystem).
+		Update("author_type", commentAuthorSystem)
+}
+
+// loadOwnComment busca o comentário e confere se o usuário ainda pode alterá-lo
+func loadOwnComment(c *gin.Context) (*Comment, bool) {
+	var comment Comment
+	if err := db.First(&comment, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comentário não encontrado"})
+		return nil, false
+	}
+	var ticket Ticket
+	if err := db.First(&ticket, comment.TicketID).Error; err != nil || !canViewTicket(c, ticket) ||
+		(comment.Internal && !canSeeInternalNotes(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comentário não encontrado"})
+		return nil, false
+	}
+	if comment.AuthorType == commentAuthorSystem || comment.AuthorID == nil || *comment.AuthorID != getCurrentUserID(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Apenas o autor pode alterar o comentário"})
+		return nil, false
+	}
+	window := getSettingInt("comment_edit_window_minutes", 15)
+	if time.Since(comment.CreatedAt) > time.Duration(window)*time.Minute {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Comentários só podem ser alterados até %d minutos após o envio", window)})
+		return nil, false
+	}
+	return &comment, true
+}
+
+// UpdateComment edita o próprio comentário, guardando a versão anterior
+func UpdateComment(c *gin.Context) {
+	var input struct {
+		Content string `json:"content" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || strings.TrimSpace(input.Content) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Informe o novo texto do comentário"})
+		return
+	}
+
+	comment, ok := loadOwnComment(c)
+	if !ok {
+		return
+	}
+	if comment.Content == input.Content {
+		c.JSON(http.StatusOK, comment)
+		return
+	}
+
+	now := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&CommentRevision{
+			CommentID:  comment.ID,
+			Action:     "edit",
+			Content:    comment.Content,
+			Internal:   comment.Internal,
+			EditedByID: getCurrentUserID(c),
+		}).Error; err != nil {
+			return err
+		}
+		comment.Content = input.Content
+		comment.EditedAt = &now
+		return tx.Save(comment).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar comentário"})
+		return
+	}
+
+	logRequestAction(c, "COMMENT_EDIT", "Ticket", comment.TicketID, fmt.Sprintf("Comentário %d editado", comment.ID))
+	c.JSON(http.StatusOK, comment)
+}
+
+// DeleteComment exclui o próprio comentário (o conteúdo fica no histórico)
+func DeleteComment(c *gin.Context) {
+	comment, ok := loadOwnComment(c)
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&CommentRevision{
+			CommentID:  comment.ID,
+			Action:     "delete",
+			Content:    comment.Content,
+			Internal:   comment.Internal,
+			EditedByID: getCurrentUserID(c),
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(comment).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao excluir comentário"})
+		return
+	}
+
+	logRequestAction(c, "COMMENT_DELETE", "Ticket", comment.TicketID, fmt.Sprintf("Comentário %d excluído", comment.ID))
+	c.JSON(http.StatusOK, gin.H{"message": "Comentário excluído"})
+}
+
+// GetCommentRevisions lista as versões anteriores de um comentário, inclusive excluído (comment.history)
+func GetCommentRevisions(c *gin.Context) {
+	var comment Comment
+	if err := db.Unscoped().First(&comment, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comentário não encontrado"})
+		return
+	}
+	var ticket Ticket
+	if err := db.First(&ticket, comment.TicketID).Error; err != nil || !canViewTicket(c, ticket) ||
+		(comment.Internal && !canSeeInternalNotes(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comentário não encontrado"})
+		return
+	}
+
+	query := db.Preload("EditedBy").Where("comment_id = ?", comment.ID)
+	if !canSeeInternalNotes(c) {
+		query = query.Where("internal = ?", false)
+	}
+	var revisions []CommentRevision
+	query.Order("created_at, id").Find(&revisions)
+	c.JSON(http.StatusOK, gin.H{
+		"comment":   comment,
+		"deleted":   comment.DeletedAt.Valid,
+		"revisions": revisions,
+	})
+}
+
+// GetTicketCommentRevisions lista edições e exclusões de comentários do chamado (comment.history)
+func GetTicketCommentRevisions(c *gin.Context) {
+	var ticket Ticket
+	if err := db.First(&ticket, c.Param("id")).Error; err != nil || !canViewTicket(c, ticket) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chamado não encontrado"})
+		return
+	}
+
+	comments := db.Unscoped().Model(&Comment{}).Select("id").Where("ticket_id = ?", ticket.ID)
+	query := db.Preload("EditedBy")
+	if !canSeeInternalNotes(c) {
+		// Sem revisões internas nem qualquer revisão de comentários que hoje são notas internas
+		comments = comments.Where("internal = ?", false)
+		query = query.Where("internal = ?", false)
+	}
+	var revisions []CommentRevision
+	query.Where("comment_id IN (?)", comments).Order("created_at, id").Find(&revisions)
+	c.JSON(http.StatusOK, revisions)
+}
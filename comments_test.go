@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// commentHistoryRouter expõe as rotas de revisões autenticadas como o usuário informado
+func commentHistoryRouter(user User) *gin.Engine {
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("userID", user.ID)
+		c.Set("role", user.Role)
+	})
+	r.GET("/tickets/:id/comment-revisions", GetTicketCommentRevisions)
+	r.GET("/comments/:id/revisions", GetCommentRevisions)
+	return r
+}
+
+func getJSON(t *testing.T, r *gin.Engine, path string, out interface{}) int {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	if w.Code == http.StatusOK && out != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s: resposta inválida: %v", path, err)
+		}
+	}
+	return w.Code
+}
+
+func TestCommentRevisionsRespectTicketVisibility(t *testing.T) {
+	setupTestDB(t)
+	var history Permission
+	db.First(&history, "key = ?", "comment.history")
+	db.Create(&Role{Name: "Auditor", Permissions: []Permission{history}})
+
+	requester := createTestUser(t, "joana", "User", "")
+	auditor := createTestUser(t, "auditor", "Auditor", "")
+	supervisor := createTestUser(t, "chefe", "Supervisor", "")
+	var supervisorRole Role
+	db.First(&supervisorRole, "name = ?", "Supervisor")
+	db.Model(&supervisorRole).Association("Permissions").Append(&history)
+	loadRolePermissions()
+
+	ticket := createTestTicket(t, "Impressora", "Novo", requester.ID)
+	public := Comment{TicketID: ticket.ID, Content: "Trocado o toner", Author: "chefe"}
+	internal := Comment{TicketID: ticket.ID, Content: "Usuário quebrou de novo", Author: "chefe", Internal: true}
+	db.Create(&public)
+	db.Create(&internal)
+	db.Create(&CommentRevision{CommentID: public.ID, Action: "edit", Content: "Trocado o tonner", EditedByID: supervisor.ID})
+	db.Create(&CommentRevision{CommentID: internal.ID, Action: "edit", Content: "Usuário quebrou", Internal: true, EditedByID: supervisor.ID})
+
+	// comment.history sem acesso ao chamado: nada é exposto
+	r := commentHistoryRouter(auditor)
+	if code := getJSON(t, r, fmt.Sprintf("/tickets/%d/comment-revisions", ticket.ID), nil); code != http.StatusNotFound {
+		t.Errorf("revisões de chamado alheio: status %d", code)
+	}
+	if code := getJSON(t, r, fmt.Sprintf("/comments/%d/revisions", public.ID), nil); code != http.StatusNotFound {
+		t.Errorf("revisões de comentário de chamado alheio: status %d", code)
+	}
+
+	// Acompanhando o chamado, mas sem ticket.internal_notes: só as revisões públicas
+	db.Create(&TicketWatcher{TicketID: ticket.ID, UserID: auditor.ID})
+	var revisions []CommentRevision
+	if code := getJSON(t, r, fmt.Sprintf("/tickets/%d/comment-revisions", ticket.ID), &revisions); code != http.StatusOK {
+		t.Fatalf("revisões do chamado acompanhado: status %d", code)
+	}
+	if len(revisions) != 1 || revisions[0].CommentID != public.ID {
+		t.Errorf("revisões visíveis sem notas internas: %+v", revisions)
+	}
+	if code := getJSON(t, r, fmt.Sprintf("/comments/%d/revisions", internal.ID), nil); code != http.StatusNotFound {
+		t.Errorf("revisões de nota interna: status %d", code)
+	}
+
+	// Com ticket.internal_notes vê tudo
+	revisions = nil
+	getJSON(t, commentHistoryRouter(supervisor), fmt.Sprintf("/tickets/%d/comment-revisions", ticket.ID), &revisions)
+	if len(revisions) != 2 {
+		t.Errorf("supervisor deveria ver 2 revisões, viu %d", len(revisions))
+	}
+}
+
+func TestAddCommentAttachmentFailureLeavesTicketUntouched(t *testing.T) {
+	setupTestDB(t)
+	// S3 que aceita o primeiro arquivo e recusa o segundo
+	backend := &fakeS3{objects: map[string]string{}}
+	var puts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && puts.Add(1) > 1 {
+			http.Error(w, "<Error><Code>InternalError</Code></Error>", http.StatusInternalServerError)
+			return
+		}
+		backend.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	setTestSetting(t, "storage_backend", storageBackendS3)
+	setTestSetting(t, "s3_endpoint", server.URL)
+	setTestSetting(t, "s3_bucket", "anexos")
+	setTestSetting(t, "s3_access_key", "minio")
+	setTestSetting(t, "s3_secret_key", "minio-secret")
+
+	requester := createTestUser(t, "joana", "User", "")
+	tech := createTestUser(t, "mauro", "Tech", "")
+	ticket := createTestTicket(t, "Impressora", "Novo", requester.ID)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("content", "Vou verificar")
+	for _, name := range []string{"erro.log", "log.txt"} {
+		part, _ := form.CreateFormFile("files", name)
+		part.Write([]byte("conteúdo de " + name))
+	}
+	form.Close()
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("userID", tech.ID)
+		c.Set("role", tech.Role)
+	})
+	r.POST("/tickets/:id/comments", AddComment)
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/tickets/%d/comments", ticket.ID), &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+
+	// Sem comentário, o chamado não muda de status nem de responsável
+	var stored Ticket
+	db.First(&stored, ticket.ID)
+	if stored.Status != "Novo" || stored.AssignedToID != nil {
+		t.Errorf("chamado alterado apesar da falha: status %s, responsável %v", stored.Status, stored.AssignedToID)
+	}
+	var comments, attachments, events int64
+	db.Unscoped().Model(&Comment{}).Count(&comments)
+	db.Model(&Attachment{}).Count(&attachments)
+	db.Model(&TicketEvent{}).Where("ticket_id = ?", ticket.ID).Count(&events)
+	if comments != 0 || attachments != 0 || events != 0 {
+		t.Errorf("restaram %d comentário(s), %d anexo(s) e %d evento(s)", comments, attachments, events)
+	}
+	// O arquivo que chegou a ser gravado é apagado do armazenamento
+	if len(backend.objects) != 0 {
+		t.Errorf("objetos órfãos no S3: %v", backend.objects)
+	}
+}
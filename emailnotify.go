@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==========================================
+// NOTIFICAÇÕES POR E-MAIL
+// ==========================================
+//
+// Avisos de chamados (abertura, atribuição, comentário, status, SLA e menções)
+// viram e-mails na fila EmailOutbox; runEmailOutbox envia em segundo plano e
+// tenta de novo com intervalos crescentes, então uma queda do SMTP nunca trava
+// uma requisição. Os textos são modelos editáveis (text/template) e cada usuário
+// pode desligar os tipos de aviso que não quer receber.
+
+const notificationChannelEmail = "email"
+
+// Situação dos e-mails na fila
+const (
+	outboxPending = "pending"
+	outboxSent    = "sent"
+	outboxFailed  = "failed"
+)
+
+// Espera antes de cada nova tentativa (a última se repete até email_max_attempts)
+var outboxRetryDelays = []time.Duration{1 * time.Minute, 5 * time.Minute, 15 * time.Minute, 1 * time.Hour, 4 * time.Hour}
+
+// EmailOutbox é um e-mail aguardando envio (ou já enviado/desistido)
+type EmailOutbox struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	Kind          string     `json:"kind"`
+	TicketID      *uint      `gorm:"index" json:"ticket_id"`
+	UserID        *uint      `gorm:"index" json:"user_id"`
+	To            string     `json:"to"`
+	Subject       string     `json:"subject"`
+	Body          string     `json:"body"`
+	Status        string     `gorm:"index;default:'pending'" json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"index" json:"next_attempt_at"`
+	LastError     string     `json:"last_error"`
+	SentAt        *time.Time `json:"sent_at"`
+}
+
+// NotificationTemplate é o modelo de e-mail de um tipo de aviso
+type NotificationTemplate struct {
+	Kind      string    `gorm:"primaryKey" json:"kind"`
+	Subject   string    `json:"subject"`
+	Body      string    `json:"body"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NotificationOptOut registra um tipo de aviso que o usuário não quer receber num canal
+type NotificationOptOut struct {
+	ID      uint   `gorm:"primaryKey" json:"id"`
+	UserID  uint   `gorm:"uniqueIndex:idx_notification_optout;not null" json:"user_id"`
+	Kind    string `gorm:"uniqueIndex:idx_notification_optout;not null" json:"kind"`
+	Channel string `gorm:"uniqueIndex:idx_notification_optout;not null" json:"channel"`
+}
+
+// noticeTemplateData são as variáveis disponíveis nos modelos
+type noticeTemplateData struct {
+	Recipient  string // Nome de quem recebe
+	TicketID   uint
+	Title      string // Título do chamado
+	Status     string
+	Priority   string
+	Category   string
+	AssignedTo string
+	Requester  string
+	Actor      string // Quem fez a ação ("Sistema" para ações automáticas)
+	Message    string // Comentário, nota de resolução ou motivo
+	OldValue   string
+	NewValue   string
+	Link       string
+}
+
+// O assunto começa com [Chamado #id]: respostas ao e-mail são associadas ao chamado
+var defaultNotificationTemplates = []NotificationTemplate{
+	{Kind: noticeTicketCreated, Subject: "[Chamado #{{.TicketID}}] Aberto: {{.Title}}",
+		Body: "Olá, {{.Recipient}}.\n\nO chamado #{{.TicketID}} foi aberto por {{.Actor}}.\n\nTítulo: {{.Title}}\nSolicitante: {{.Requester}}\nCategoria: {{.Category}}\nResponsável: {{.AssignedTo}}\n\n{{.Message}}\n{{if .Link}}\nAcompanhe em: {{.Link}}\n{{end}}"},
+	{Kind: noticeTicketAssigned, Subject: "[Chamado #{{.TicketID}}] Atribuído a você: {{.Title}}",
+		Body: "Olá, {{.Recipient}}.\n\n{{.Actor}} atribuiu a você o chamado #{{.TicketID}} (antes com {{.OldValue}}).\n\nTítulo: {{.Title}}\nSolicitante: {{.Requester}}\nPrioridade: {{.Priority}}\nStatus: {{.Status}}\n{{if .Link}}\nAbrir chamado: {{.Link}}\n{{end}}"},
+	{Kind: noticeTicketComment, Subject: "[Chamado #{{.TicketID}}] Novo comentário: {{.Title}}",
+		Body: "Olá, {{.Recipient}}.\n\n{{.Actor}} comentou no chamado #{{.TicketID}}:\n\n{{.Message}}\n{{if .Link}}\nResponder: {{.Link}}\n{{end}}"},
+	{Kind: noticeTicketStatus, Subject: "[Chamado #{{.TicketID}}] {{.NewValue}}: {{.Title}}",
+		Body: "Olá, {{.Recipient}}.\n\nO chamado #{{.TicketID}} mudou de \"{{.OldValue}}\" para \"{{.NewValue}}\" por {{.Actor}}.\n{{if .Message}}\n{{.Message}}\n{{end}}{{if .Link}}\nDetalhes: {{.Link}}\n{{end}}"},
+	{Kind: noticeSLAWarning, Subject: "[Chamado #{{.TicketID}}] SLA vence em breve: {{.Title}}",
+		Body: "Olá, {{.Recipient}}.\n\n{{.Message}} (prazo: {{.NewValue}}).\n\nTítulo: {{.Title}}\nSolicitante: {{.Requester}}\nPrioridade: {{.Priority}}\nStatus: {{.Status}}\n{{if .Link}}\nAbrir chamado: {{.Link}}\n{{end}}"},
+	{Kind: noticeSLAEscalation, Subject: "[Chamado #{{.TicketID}}] SLA violado: {{.Title}}",
+		Body: "Olá, {{.Recipient}}.\n\n{{.Message}}. O chamado #{{.TicketID}} foi reatribuído de {{.OldValue}} para {{.NewValue}}.\n\nTítulo: {{.Title}}\nSolicitante: {{.Requester}}\nPrioridade: {{.Priority}}\n{{if .Link}}\nAbrir chamado: {{.Link}}\n{{end}}"},
+	{Kind: noticeMention, Subject: "[Chamado #{{.TicketID}}] {{.Actor}} mencionou você",
+		Body: "Olá, {{.Recipient}}.\n\n{{.Actor}} mencionou você no chamado #{{.TicketID}} ({{.Title}}):\n\n{{.Message}}\n{{if .Link}}\nResponder: {{.Link}}\n{{end}}"},
+}
+
+func defaultNotificationTemplate(kind string) (NotificationTemplate, bool) {
+	for _, t := range defaultNotificationTemplates {
+		if t.Kind == kind {
+			return t, true
+		}
+	}
+	return NotificationTemplate{}, false
+}
+
+// seedNotificationTemplates cria os modelos que ainda não existem (os editados são preservados)
+func seedNotificationTemplates() {
+	for _, t := range defaultNotificationTemplates {
+		var count int64
+		db.Model(&NotificationTemplate{}).Where("kind = ?", t.Kind).Count(&count)
+		if count == 0 {
+			db.Create(&t)
+		}
+	}
+}
+
+// renderNotificationTemplate preenche assunto e corpo do modelo
+func renderNotificationTemplate(t NotificationTemplate, data noticeTemplateData) (string, string, error) {
+	subjectTmpl, err := template.New("subject").Option("missingkey=error").Parse(t.Subject)
+	if err != nil {
+		return "", "", fmt.Errorf("assunto inválido: %w", err)
+	}
+	bodyTmpl, err := template.New("body").Option("missingkey=error").Parse(t.Body)
+	if err != nil {
+		return "", "", fmt.Errorf("corpo inválido: %w", err)
+	}
+	var subject, body bytes.Buffer
+	if err := subjectTmpl.Execute(&subject, data); err != nil {
+		return "", "", fmt.Errorf("assunto inválido: %w", err)
+	}
+	if err := bodyTmpl.Execute(&body, data); err != nil {
+		return "", "", fmt.Errorf("corpo inválido: %w", err)
+	}
+	// Assunto em uma linha só (evita injeção de cabeçalhos)
+	return strings.Join(strings.Fields(subject.String()), " "), strings.TrimSpace(body.String()) + "\n", nil
+}
+
+// ticketLink devolve o endereço do chamado no sistema (vazio se app_base_url não estiver configurado)
+func ticketLink(ticketID uint) string {
+	base := appBaseURL()
+	if base == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/tickets?id=%d", base, ticketID)
+}
+
+// notificationOptOuts indica quais destinatários desligaram o tipo de aviso no canal
+func notificationOptOuts(userIDs []uint, kind, channel string) map[uint]bool {
+	var ids []uint
+	db.Model(&NotificationOptOut{}).Where("user_id IN ? AND kind = ? AND channel = ?", userIDs, kind, channel).Pluck("user_id", &ids)
+	result := map[uint]bool{}
+	for _, id := range ids {
+		result[id] = true
+	}
+	return result
+}
+
+// queueNoticeEmails transforma o aviso em e-mails na fila (canal registrado em main)
+func queueNoticeEmails(n ticketNotice) {
+	if getSettingValue("smtp_enabled", "false") != "true" || getSettingValue("email_notifications_enabled", "true") != "true" {
+		return
+	}
+
+	var ticket Ticket
+	if err := db.Preload("Creator").Preload("Category").Preload("AssignedTo").First(&ticket, n.TicketID).Error; err != nil {
+		return
+	}
+	var tmpl NotificationTemplate
+	if err := db.First(&tmpl, "kind = ?", n.Kind).Error; err != nil {
+		var ok bool
+		if tmpl, ok = defaultNotificationTemplate(n.Kind); !ok {
+			return
+		}
+	}
+
+	var users []User
+	db.Where("id IN ? AND active = ? AND email <> ''", n.Recipients, true).Find(&users)
+	optOuts := notificationOptOuts(n.Recipients, n.Kind, notificationChannelEmail)
+
+	data := noticeTemplateData{
+		TicketID:   ticket.ID,
+		Title:      ticket.Title,
+		Status:     ticket.Status,
+		Priority:   ticket.Priority,
+		Category:   "Sem Categoria",
+		AssignedTo: "Ninguém",
+		Actor:      n.ActorName,
+		Message:    n.Message,
+		OldValue:   n.OldValue,
+		NewValue:   n.NewValue,
+		Link:       ticketLink(ticket.ID),
+	}
+	if ticket.Category != nil {
+		data.Category = ticket.Category.Name
+	}
+	if ticket.AssignedTo != nil {
+		data.AssignedTo = displayName(*ticket.AssignedTo)
+	}
+	if ticket.Creator != nil {
+		data.Requester = displayName(*ticket.Creator)
+	}
+
+	queued := 0
+	for _, u := range users {
+		if optOuts[u.ID] {
+			continue
+		}
+		data.Recipient = displayName(u)
+		subject, body, err := renderNotificationTemplate(tmpl, data)
+		if err != nil {
+			fmt.Printf("[EMAIL] Modelo %s inválido: %v\n", n.Kind, err)
+			return
+		}
+		userID, ticketID := u.ID, ticket.ID
+		if err := db.Create(&EmailOutbox{
+			Kind:          n.Kind,
+			TicketID:      &ticketID,
+			UserID:        &userID,
+			To:            u.Email,
+			Subject:       subject,
+			Body:          body,
+			Status:        outboxPending,
+			NextAttemptAt: time.Now(),
+		}).Error; err != nil {
+			fmt.Printf("[EMAIL] Erro ao enfileirar e-mail para %s: %v\n", u.Email, err)
+			continue
+		}
+		queued++
+	}
+	if queued > 0 {
+		wakeEmailOutbox()
+	}
+}
+
+// --- Envio em segundo plano ---
+
+var emailOutboxWake = make(chan struct{}, 1)
+
+// wakeEmailOutbox pede o processamento imediato da fila (sem bloquear)
+func wakeEmailOutbox() {
+	select {
+	case emailOutboxWake <- struct{}{}:
+	default:
+	}
+}
+
+// runEmailOutbox processa a fila a cada minuto ou quando novos e-mails chegam
+func runEmailOutbox() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		processEmailOutbox()
+		select {
+		case <-ticker.C:
+		case <-emailOutboxWake:
+		}
+	}
+}
+
+// processEmailOutbox envia os e-mails vencidos; só roda na goroutine de runEmailOutbox
+func processEmailOutbox() {
+	if getSettingValue("smtp_enabled", "false") != "true" {
+		return
+	}
+	maxAttempts := getSettingInt("email_max_attempts", 5)
+
+	var batch []EmailOutbox
+	db.Where("status = ? AND next_attempt_at <= ?", outboxPending, time.Now()).Order("id").Limit(50).Find(&batch)
+	for _, item := range batch {
+		headers := map[string]string{"Auto-Submitted": "auto-generated"}
+		if item.TicketID != nil {
+			headers["X-Chamado-ID"] = fmt.Sprintf("%d", *item.TicketID)
+		}
+		err := sendMail(mailMessage{To: []string{item.To}, Subject: item.Subject, Body: item.Body, Headers: headers})
+
+		item.Attempts++
+		if err == nil {
+			now := time.Now()
+			item.Status = outboxSent
+			item.SentAt = &now
+			item.LastError = ""
+		} else {
+			item.LastError = err.Error()
+			if item.Attempts >= maxAttempts {
+				item.Status = outboxFailed
+				fmt.Printf("[EMAIL] Desistindo do e-mail %d para %s após %d tentativas: %v\n", item.ID, item.To, item.Attempts, err)
+			} else {
+				delay := outboxRetryDelays[len(outboxRetryDelays)-1]
+				if item.Attempts-1 < len(outboxRetryDelays) {
+					delay = outboxRetryDelays[item.Attempts-1]
+				}
+				item.NextAttemptAt = time.Now().Add(delay)
+			}
+		}
+		db.Select("attempts", "status", "sent_at", "last_error", "next_attempt_at").Save(&item)
+	}
+}
+
+// --- Handlers: modelos (settings.manage) ---
+
+// GetNotificationTemplates lista os modelos e as variáveis disponíveis
+func GetNotificationTemplates(c *gin.Context) {
+	var templates []NotificationTemplate
+	db.Find(&templates)
+	c.JSON(http.StatusOK, gin.H{
+		"templates": templates,
+		"kinds":     noticeKinds,
+		"variables": []string{"Recipient", "TicketID", "Title", "Status", "Priority", "Category", "AssignedTo", "Requester", "Actor", "Message", "OldValue", "NewValue", "Link"},
+	})
+}
+
+// UpdateNotificationTemplate altera o modelo de um tipo de aviso (validado antes de salvar)
+func UpdateNotificationTemplate(c *gin.Context) {
+	kind := c.Param("kind")
+	if !isNoticeKind(kind) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tipo de aviso desconhecido: " + kind})
+		return
+	}
+	var input struct {
+		Subject string `json:"subject" binding:"required"`
+		Body    string `json:"body" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tmpl := NotificationTemplate{Kind: kind, Subject: input.Subject, Body: input.Body}
+	sample := noticeTemplateData{Recipient: "Maria", TicketID: 1, Title: "Impressora sem toner", Status: "Novo", Actor: "João"}
+	if _, _, err := renderNotificationTemplate(tmpl, sample); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := db.Save(&tmpl).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar modelo"})
+		return
+	}
+	logRequestAction(c, "UPDATE", "NotificationTemplate", 0, "Modelo de e-mail alterado: "+kind)
+	c.JSON(http.StatusOK, tmpl)
+}
+
+// ResetNotificationTemplate restaura o modelo padrão
+func ResetNotificationTemplate(c *gin.Context) {
+	tmpl, ok := defaultNotificationTemplate(c.Param("kind"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tipo de aviso desconhecido: " + c.Param("kind")})
+		return
+	}
+	db.Save(&tmpl)
+	logRequestAction(c, "UPDATE", "NotificationTemplate", 0, "Modelo de e-mail restaurado: "+tmpl.Kind)
+	c.JSON(http.StatusOK, tmpl)
+}
+
+// --- Handlers: fila de envio (settings.manage) ---
+
+// GetEmailOutbox lista os e-mails da fila (filtro opcional ?status=)
+func GetEmailOutbox(c *gin.Context) {
+	query := db.Order("id desc").Limit(200)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var items []EmailOutbox
+	query.Find(&items)
+	c.JSON(http.StatusOK, items)
+}
+
+// RetryEmailOutbox recoloca um e-mail com falha na fila para envio imediato
+func RetryEmailOutbox(c *gin.Context) {
+	var item EmailOutbox
+	if err := db.First(&item, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "E-mail não encontrado"})
+		return
+	}
+	if item.Status == outboxSent {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "E-mail já enviado"})
+		return
+	}
+	db.Model(&item).Updates(map[string]interface{}{"status": outboxPending, "attempts": 0, "next_attempt_at": time.Now()})
+	wakeEmailOutbox()
+	logRequestAction(c, "EMAIL_RETRY", "EmailOutbox", item.ID, "Reenvio solicitado para "+item.To)
+	c.JSON(http.StatusOK, gin.H{"message": "E-mail recolocado na fila"})
+}
+
+// --- Handlers: preferências do usuário ---
+
+type notificationPreference struct {
+	Kind  string `json:"kind"`
+	Label string `json:"label"`
+	Email bool   `json:"email"`
+	App   bool   `json:"app"`
+}
+
+// GetMyNotificationPreferences lista os avisos e se o usuário os recebe por e-mail e no sistema
+func GetMyNotificationPreferences(c *gin.Context) {
+	uid := getCurrentUserID(c)
+	var optOuts []NotificationOptOut
+	db.Where("user_id = ?", uid).Find(&optOuts)
+	disabled := map[string]bool{}
+	for _, o := range optOuts {
+		disabled[o.Channel+":"+o.Kind] = true
+	}
+
+	prefs := make([]notificationPreference, 0, len(noticeKinds))
+	for _, k := range noticeKinds {
+		prefs = append(prefs, notificationPreference{
+			Kind:  k.Kind,
+			Label: k.Label,
+			Email: !disabled[notificationChannelEmail+":"+k.Kind],
+			App:   !disabled[notificationChannelApp+":"+k.Kind],
+		})
+	}
+	c.JSON(http.StatusOK, prefs)
+}
+
+// UpdateMyNotificationPreferences liga ou desliga tipos de aviso por canal (canal omitido = sem alteração)
+func UpdateMyNotificationPreferences(c *gin.Context) {
+	var input []struct {
+		Kind  string `json:"kind"`
+		Email *bool  `json:"email"`
+		App   *bool  `json:"app"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, p := range input {
+		if !isNoticeKind(p.Kind) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tipo de aviso desconhecido: " + p.Kind})
+			return
+		}
+	}
+
+	uid := getCurrentUserID(c)
+	off := map[string][]string{}
+	for _, p := range input {
+		for channel, enabled := range map[string]*bool{notificationChannelEmail: p.Email, notificationChannelApp: p.App} {
+			if enabled == nil {
+				continue
+			}
+			optOut := NotificationOptOut{UserID: uid, Kind: p.Kind, Channel: channel}
+			if *enabled {
+				db.Where(&optOut).Delete(&NotificationOptOut{})
+			} else {
+				db.Where(&optOut).FirstOrCreate(&optOut)
+				off[channel] = append(off[channel], p.Kind)
+			}
+		}
+	}
+	logRequestAction(c, "UPDATE", "User", uid, fmt.Sprintf("Preferências de notificação: e-mail desligado para [%s], sistema desligado para [%s]",
+		strings.Join(off[notificationChannelEmail], ", "), strings.Join(off[notificationChannelApp], ", ")))
+	GetMyNotificationPreferences(c)
+}
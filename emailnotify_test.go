@@ -0,0 +1,128 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderNotificationTemplate(t *testing.T) {
+	tmpl, _ := defaultNotificationTemplate(noticeTicketComment)
+	data := noticeTemplateData{Recipient: "Joana", TicketID: 12, Title: "Impressora sem toner", Actor: "Mauro", Message: "Toner trocado."}
+
+	subject, body, err := renderNotificationTemplate(tmpl, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "[Chamado #12] Novo comentário: Impressora sem toner" {
+		t.Errorf("assunto = %q", subject)
+	}
+	if !strings.HasPrefix(body, "Olá, Joana.") || !strings.Contains(body, "Toner trocado.") || strings.Contains(body, "Responder:") {
+		t.Errorf("corpo sem link = %q", body)
+	}
+
+	data.Link = "https://chamados.camara.local/tickets?id=12"
+	if _, body, _ = renderNotificationTemplate(tmpl, data); !strings.Contains(body, "Responder: "+data.Link) {
+		t.Errorf("corpo com link = %q", body)
+	}
+
+	// Título com quebra de linha não pode injetar cabeçalhos no e-mail
+	data.Title = "Ajuda\r\nBcc: todos@camara.local"
+	if subject, _, _ = renderNotificationTemplate(tmpl, data); strings.ContainsAny(subject, "\r\n") {
+		t.Errorf("assunto com quebra de linha: %q", subject)
+	}
+
+	if _, _, err := renderNotificationTemplate(NotificationTemplate{Subject: "{{.Inexistente}}", Body: "x"}, data); err == nil {
+		t.Error("variável inexistente aceita no modelo")
+	}
+	if _, _, err := renderNotificationTemplate(NotificationTemplate{Subject: "ok", Body: "{{if .Link}}"}, data); err == nil {
+		t.Error("modelo malformado aceito")
+	}
+}
+
+func TestQueueNoticeEmailsSkipsOptOutsAndInactiveUsers(t *testing.T) {
+	setupTestDB(t)
+	setTestSetting(t, "smtp_enabled", "true")
+	setTestSetting(t, "app_base_url", "https://chamados.camara.local")
+
+	requester := createTestUser(t, "joana", "User", "joana@camara.local")
+	tech := createTestUser(t, "mauro", "Tech", "mauro@camara.local")
+	optedOut := createTestUser(t, "andre", "Tech", "andre@camara.local")
+	inactive := createTestUser(t, "carlos", "Tech", "carlos@camara.local")
+	noEmail := createTestUser(t, "supervisor", "Supervisor", "")
+	db.Model(&inactive).Update("active", false)
+	db.Create(&NotificationOptOut{UserID: optedOut.ID, Kind: noticeTicketComment, Channel: notificationChannelEmail})
+	ticket := createTestTicket(t, "Impressora sem toner", "Novo", requester.ID)
+
+	queueNoticeEmails(ticketNotice{
+		Kind:       noticeTicketComment,
+		TicketID:   ticket.ID,
+		ActorName:  "Mauro",
+		Recipients: []uint{requester.ID, tech.ID, optedOut.ID, inactive.ID, noEmail.ID},
+		Message:    "Toner trocado.",
+	})
+
+	var queued []EmailOutbox
+	db.Order("\"to\"").Find(&queued)
+	if len(queued) != 2 || queued[0].To != "joana@camara.local" || queued[1].To != "mauro@camara.local" {
+		t.Fatalf("fila = %+v", queued)
+	}
+	for _, item := range queued {
+		if item.Status != outboxPending || item.TicketID == nil || *item.TicketID != ticket.ID {
+			t.Errorf("item da fila incorreto: %+v", item)
+		}
+		if !strings.Contains(item.Body, "https://chamados.camara.local/tickets?id=") {
+			t.Errorf("e-mail sem link do chamado: %q", item.Body)
+		}
+	}
+}
+
+func TestProcessEmailOutboxSendsAndRetries(t *testing.T) {
+	setupTestDB(t)
+	catcher := setupSMTPCatcher(t)
+	ticketID := uint(7)
+	sent := EmailOutbox{Kind: noticeTicketStatus, TicketID: &ticketID, To: "joana@camara.local", Subject: "[Chamado #7] Resolvido", Body: "Resolvido.", Status: outboxPending, NextAttemptAt: time.Now()}
+	later := EmailOutbox{Kind: noticeTicketStatus, To: "mauro@camara.local", Subject: "depois", Body: "x", Status: outboxPending, NextAttemptAt: time.Now().Add(time.Hour)}
+	db.Create(&sent)
+	db.Create(&later)
+
+	processEmailOutbox()
+	db.First(&sent, sent.ID)
+	db.First(&later, later.ID)
+	if sent.Status != outboxSent || sent.SentAt == nil || sent.Attempts != 1 {
+		t.Errorf("e-mail não marcado como enviado: %+v", sent)
+	}
+	if later.Status != outboxPending || later.Attempts != 0 {
+		t.Errorf("e-mail agendado foi processado antes da hora: %+v", later)
+	}
+	caught := catcher.caught()
+	if len(caught) != 1 {
+		t.Fatalf("%d e-mails entregues, esperado 1", len(caught))
+	}
+	msg, subject, _ := readCaughtMail(t, caught[0])
+	if subject != "[Chamado #7] Resolvido" || msg.Header.Get("X-Chamado-ID") != "7" {
+		t.Errorf("e-mail entregue incorreto: %q %v", subject, msg.Header)
+	}
+
+	// SMTP fora do ar: nova tentativa com espera crescente até email_max_attempts
+	catcher.listener.Close()
+	setTestSetting(t, "email_max_attempts", "2")
+	failing := EmailOutbox{Kind: noticeTicketStatus, To: "andre@camara.local", Subject: "x", Body: "x", Status: outboxPending, NextAttemptAt: time.Now()}
+	db.Create(&failing)
+
+	processEmailOutbox()
+	db.First(&failing, failing.ID)
+	if failing.Status != outboxPending || failing.Attempts != 1 || failing.LastError == "" {
+		t.Fatalf("falha de envio não reagendada: %+v", failing)
+	}
+	if wait := time.Until(failing.NextAttemptAt); wait < 50*time.Second || wait > outboxRetryDelays[0] {
+		t.Errorf("próxima tentativa em %v, esperado %v", wait, outboxRetryDelays[0])
+	}
+
+	db.Model(&failing).Update("next_attempt_at", time.Now())
+	processEmailOutbox()
+	db.First(&failing, failing.ID)
+	if failing.Status != outboxFailed || failing.Attempts != 2 {
+		t.Errorf("e-mail deveria ser abandonado após 2 tentativas: %+v", failing)
+	}
+}
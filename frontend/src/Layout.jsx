@@ -2,7 +2,7 @@ import React, { useState, useEffect } from 'react';
 import { NavLink, Outlet, useLocation, Link, useNavigate } from 'react-router-dom';
 import {
     LayoutDashboard, Ticket, Monitor, Users, Settings, Menu, X, LogOut, Moon, Sun, FileText,
-    Shield, Tv, Camera, PieChart
+    Shield, Tv, Camera, PieChart, Bell
 } from 'lucide-react';
 import clsx from 'clsx';
 import { api } from './services/api';
@@ -25,24 +25,114 @@ const SidebarItem = ({ to, icon: Icon, label, collapsed }) => (
     </NavLink>
 );
 
+// Sino do cabeçalho: contador de não lidas (consultado periodicamente) e lista ao abrir
+const NotificationBell = () => {
+    const navigate = useNavigate();
+    const [open, setOpen] = useState(false);
+    const [unread, setUnread] = useState(0);
+    const [items, setItems] = useState([]);
+
+    const refreshCount = () => api.getUnreadNotificationCount().then(r => setUnread(r.count)).catch(() => { });
+
+    useEffect(() => {
+        refreshCount();
+        const timer = setInterval(refreshCount, 30000);
+        return () => clearInterval(timer);
+    }, []);
+
+    const toggle = async () => {
+        if (!open) {
+            setItems(await api.getNotifications().catch(() => []));
+        }
+        setOpen(!open);
+    };
+
+    const handleOpen = async (item) => {
+        if (!item.read_at) {
+            await api.markNotificationRead(item.id).catch(() => { });
+            refreshCount();
+        }
+        setOpen(false);
+        navigate(`/tickets?id=${item.ticket_id}`);
+    };
+
+    const handleReadAll = async () => {
+        await api.markAllNotificationsRead().catch(() => { });
+        setItems(items.map(i => ({ ...i, read_at: i.read_at || new Date().toISOString() })));
+        setUnread(0);
+    };
+
+    return (
+        <div className="relative ml-auto">
+            <button onClick={toggle} className="relative p-2 rounded-lg hover:bg-slate-100 dark:hover:bg-slate-800 text-slate-600 dark:text-slate-300" title="Notificações">
+                <Bell className="w-5 h-5" />
+                {unread > 0 && (
+                    <span className="absolute -top-0.5 -right-0.5 min-w-[1.1rem] h-[1.1rem] px-1 rounded-full bg-red-500 text-white text-[10px] font-bold flex items-center justify-center">
+                        {unread > 99 ? '99+' : unread}
+                    </span>
+                )}
+            </button>
+            {open && (
+                <div className="absolute right-0 mt-2 w-80 max-h-96 overflow-y-auto bg-white dark:bg-slate-950 border border-slate-200 dark:border-slate-800 rounded-xl shadow-xl z-40">
+                    <div className="flex items-center justify-between px-4 py-3 border-b border-slate-100 dark:border-slate-800">
+                        <span className="font-semibold text-slate-800 dark:text-white text-sm">Notificações</span>
+                        {unread > 0 && (
+                            <button onClick={handleReadAll} className="text-xs text-blue-600 hover:underline">Marcar todas como lidas</button>
+                        )}
+                    </div>
+                    {items.length === 0 && <p className="px-4 py-6 text-sm text-slate-500 text-center">Nenhuma notificação.</p>}
+                    {items.map(item => (
+                        <button
+                            key={item.id}
+                            onClick={() => handleOpen(item)}
+                            className={clsx(
+                                'w-full text-left px-4 py-3 border-b border-slate-50 dark:border-slate-900 hover:bg-slate-50 dark:hover:bg-slate-900 transition',
+                                !item.read_at && 'bg-blue-50/60 dark:bg-blue-900/10'
+                            )}
+                        >
+                            <div className={clsx('text-sm text-slate-800 dark:text-slate-200', !item.read_at && 'font-semibold')}>{item.title}</div>
+                            {item.message && <div className="text-xs text-slate-500 line-clamp-2">{item.message}</div>}
+                            <div className="text-[11px] text-slate-400 mt-1">{new Date(item.created_at).toLocaleString()}</div>
+                        </button>
+                    ))}
+                </div>
+            )}
+        </div>
+    );
+};
+
 export default function Layout() {
     const [collapsed, setCollapsed] = useState(false);
     const [mobileMenuOpen, setMobileMenuOpen] = useState(false);
     const location = useLocation();
     const [user, setUser] = useState({ username: '', role: '' });
+    const impersonation = JSON.parse(localStorage.getItem('impersonation') || 'null');
 
     useEffect(() => {
         const storedUser = JSON.parse(localStorage.getItem('user') || '{}');
         setUser(storedUser);
     }, []);
 
+    // Encerrar personificação: revoga a sessão temporária e volta à sessão do administrador
+    const stopImpersonation = async () => {
+        await api.stopImpersonation().catch(() => { });
+        const original = JSON.parse(localStorage.getItem('impersonator_session') || '{}');
+        localStorage.removeItem('impersonation');
+        localStorage.removeItem('impersonator_session');
+        localStorage.setItem('token', original.token || '');
+        localStorage.setItem('refresh_token', original.refresh_token || '');
+        localStorage.setItem('user', original.user || '{}');
+        window.location.href = '/users';
+    };
+
     // Fecha o menu mobile ao navegar
     useEffect(() => {
         setMobileMenuOpen(false);
     }, [location]);
 
     const [isProfileModalOpen, setIsProfileModalOpen] = useState(false);
-    const [profileData, setProfileData] = useState({ fullName: '', avatar: '', password: '' });
+    const [profileData, setProfileData] = useState({ fullName: '', avatar: '', password: '', currentPassword: '', email: '' });
+    const [notificationPrefs, setNotificationPrefs] = useState([]); // Avisos por e-mail e no sistema (opt-out por tipo)
 
     const handleOpenProfile = async () => {
         // Pegar ID do usuário do localStorage (mais simples e confiável)
@@ -58,8 +148,11 @@ export default function Layout() {
                 id: user.id,
                 fullName: userData.full_name || '',
                 avatar: userData.avatar || '',
-                password: ''
+                email: userData.email || '',
+                password: '',
+                currentPassword: ''
             });
+            setNotificationPrefs(await api.getNotificationPreferences().catch(() => []));
             setIsProfileModalOpen(true);
         } catch (e) {
             console.error("Erro ao carregar perfil", e);
@@ -73,8 +166,13 @@ export default function Layout() {
             await api.updateUser(profileData.id, {
                 full_name: profileData.fullName,
                 avatar: profileData.avatar,
-                password: profileData.password // opcional
+                email: profileData.email,
+                password: profileData.password, // opcional
+                current_password: profileData.currentPassword // exigida junto com a nova senha
             });
+            if (notificationPrefs.length > 0) {
+                await api.updateNotificationPreferences(notificationPrefs);
+            }
             setIsProfileModalOpen(false);
             alert("Perfil atualizado com sucesso!");
 
@@ -200,8 +298,9 @@ export default function Layout() {
 
                 {/* Botão de Logout */}
                 <button
-                    onClick={() => {
+                    onClick={async () => {
                         if (window.confirm('Deseja realmente sair do sistema?')) {
+                            await api.logout().catch(() => { });
                             localStorage.clear();
                             window.location.href = '/login';
                         }
@@ -217,6 +316,16 @@ export default function Layout() {
 
             {/* Main Content */}
             <main className="flex-1 overflow-auto relative flex flex-col w-full">
+                {impersonation && (
+                    <div className="bg-amber-500 text-white text-sm px-4 py-2 flex items-center justify-between gap-4">
+                        <span>
+                            Você ({impersonation.impersonator}) está vendo o sistema como <strong>{impersonation.user}</strong> até {new Date(impersonation.expires_at).toLocaleTimeString()}. Todas as ações são auditadas.
+                        </span>
+                        <button onClick={stopImpersonation} className="px-3 py-1 bg-white/20 hover:bg-white/30 rounded-lg font-medium transition">
+                            Encerrar
+                        </button>
+                    </div>
+                )}
                 {/* Header */}
                 <header className="h-16 sticky top-0 bg-white/80 dark:bg-slate-900/80 backdrop-blur-sm border-b border-slate-200 dark:border-slate-800 px-4 md:px-8 flex items-center gap-4 z-10">
                     {/* Botão Abrir Mobile */}
@@ -230,6 +339,8 @@ export default function Layout() {
                     <h1 className="text-lg font-semibold text-slate-800 dark:text-slate-100">
                         Painel de Controle
                     </h1>
+
+                    <NotificationBell />
                 </header>
 
                 <div className="p-4 md:p-8 flex-1">
@@ -279,6 +390,42 @@ export default function Layout() {
                                         />
                                     </div>
 
+                                    <div>
+                                        <label className="block text-sm font-medium text-slate-700 dark:text-slate-300 mb-1">E-mail</label>
+                                        <input
+                                            type="email"
+                                            value={profileData.email}
+                                            onChange={e => setProfileData({ ...profileData, email: e.target.value })}
+                                            className="w-full px-4 py-2 bg-slate-50 dark:bg-slate-900 border border-slate-200 dark:border-slate-800 rounded-lg outline-none focus:ring-2 focus:ring-indigo-500 text-slate-900 dark:text-white"
+                                            placeholder="Para receber avisos dos chamados"
+                                        />
+                                    </div>
+
+                                    {notificationPrefs.length > 0 && (
+                                        <div>
+                                            <label className="block text-sm font-medium text-slate-700 dark:text-slate-300 mb-1">Avisos</label>
+                                            <div className="grid grid-cols-[1fr_auto_auto] gap-x-3 gap-y-1 text-sm text-slate-600 dark:text-slate-400">
+                                                <span />
+                                                <span className="text-xs text-slate-500">E-mail</span>
+                                                <span className="text-xs text-slate-500">Sistema</span>
+                                                {notificationPrefs.map(pref => (
+                                                    <React.Fragment key={pref.kind}>
+                                                        <span>{pref.label}</span>
+                                                        {['email', 'app'].map(channel => (
+                                                            <input
+                                                                key={channel}
+                                                                type="checkbox"
+                                                                className="justify-self-center"
+                                                                checked={pref[channel]}
+                                                                onChange={e => setNotificationPrefs(notificationPrefs.map(p => p.kind === pref.kind ? { ...p, [channel]: e.target.checked } : p))}
+                                                            />
+                                                        ))}
+                                                    </React.Fragment>
+                                                ))}
+                                            </div>
+                                        </div>
+                                    )}
+
                                     <div>
                                         <label className="block text-sm font-medium text-slate-700 dark:text-slate-300 mb-1">Nova Senha (Opcional)</label>
                                         <input
@@ -289,6 +436,20 @@ export default function Layout() {
                                             placeholder="Deixe em branco para manter"
                                         />
                                     </div>
+
+                                    {profileData.password && (
+                                        <div>
+                                            <label className="block text-sm font-medium text-slate-700 dark:text-slate-300 mb-1">Senha Atual</label>
+                                            <input
+                                                type="password"
+                                                required
+                                                value={profileData.currentPassword}
+                                                onChange={e => setProfileData({ ...profileData, currentPassword: e.target.value })}
+                                                className="w-full px-4 py-2 bg-slate-50 dark:bg-slate-900 border border-slate-200 dark:border-slate-800 rounded-lg outline-none focus:ring-2 focus:ring-indigo-500 text-slate-900 dark:text-white"
+                                                autoComplete="current-password"
+                                            />
+                                        </div>
+                                    )}
                                 </div>
 
                                 <div className="pt-2 flex gap-3">
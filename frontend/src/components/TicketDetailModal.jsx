@@ -28,6 +28,56 @@ export const StatusBadge = ({ status }) => {
     );
 };
 
+// Cores dos botões de transição (status fora do padrão usam o estilo neutro)
+const transitionStyle = (status) => ({
+    'Em Andamento': 'bg-blue-100 text-blue-700 hover:bg-blue-200',
+    'Resolvido': 'bg-emerald-100 text-emerald-700 hover:bg-emerald-200',
+    'Fechado': 'bg-slate-100 text-slate-700 hover:bg-slate-200',
+}[status] || 'bg-amber-100 text-amber-700 hover:bg-amber-200');
+
+// Abre o anexo em nova aba (o download exige o token, por isso via blob)
+const openAttachment = async (attachment) => {
+    try {
+        const blob = await api.downloadAttachment(attachment.id);
+        const url = URL.createObjectURL(blob);
+        const link = document.createElement('a');
+        link.href = url;
+        if (!attachment.content_type?.startsWith('image/')) link.download = attachment.file_name;
+        link.target = '_blank';
+        link.click();
+        setTimeout(() => URL.revokeObjectURL(url), 60000);
+    } catch (e) {
+        alert(e.message || 'Erro ao baixar anexo');
+    }
+};
+
+const AttachmentList = ({ attachments }) => {
+    if (!attachments || attachments.length === 0) return null;
+    return (
+        <div className="mt-2 flex flex-wrap gap-2">
+            {attachments.map(a => (
+                <button key={a.id} type="button" onClick={() => openAttachment(a)} className="text-xs px-2 py-1 rounded-lg bg-slate-100 dark:bg-slate-800 text-indigo-600 dark:text-indigo-400 hover:bg-slate-200 dark:hover:bg-slate-700 transition">
+                    📎 {a.file_name} <span className="opacity-60">({Math.max(1, Math.round(a.size / 1024))} KB)</span>
+                </button>
+            ))}
+        </div>
+    );
+};
+
+// Texto dos eventos da linha do tempo
+const describeEvent = (event) => {
+    switch (event.type) {
+        case 'created': return `abriu o chamado (${event.new_value})`;
+        case 'status': return `alterou o status: ${event.old_value} → ${event.new_value}`;
+        case 'assignment': return `alterou o responsável: ${event.old_value} → ${event.new_value}`;
+        case 'priority': return `alterou a prioridade: ${event.old_value} → ${event.new_value}`;
+        case 'category': return `alterou a categoria: ${event.old_value} → ${event.new_value}`;
+        case 'sla_warning': return `avisou que o SLA vence em ${event.new_value}`;
+        case 'sla_escalation': return `escalonou por SLA: ${event.old_value} → ${event.new_value}`;
+        default: return `${event.type}: ${event.old_value} → ${event.new_value}`;
+    }
+};
+
 const TicketDetailModal = ({ ticket, onClose, onUpdate, currentUserRole }) => {
     const [newComment, setNewComment] = useState('');
     const [statusLoading, setStatusLoading] = useState(false);
@@ -37,6 +87,38 @@ const TicketDetailModal = ({ ticket, onClose, onUpdate, currentUserRole }) => {
     const [techs, setTechs] = useState([]);
     const [selectedTech, setSelectedTech] = useState('');
 
+    // Transições permitidas pelo fluxo para o usuário atual
+    const [transitions, setTransitions] = useState([]);
+
+    useEffect(() => {
+        api.getTicketTransitions(ticket.id).then(setTransitions).catch(() => setTransitions([]));
+    }, [ticket.id, ticket.status]);
+
+    // Anexos da abertura do chamado (os dos comentários vêm na linha do tempo)
+    const [attachments, setAttachments] = useState([]);
+    const [commentFiles, setCommentFiles] = useState([]);
+    const [internalNote, setInternalNote] = useState(false); // Nota interna (não visível ao solicitante)
+
+    useEffect(() => {
+        api.getTicketAttachments(ticket.id).then(list => setAttachments(list.filter(a => !a.comment_id))).catch(() => setAttachments([]));
+    }, [ticket.id]);
+
+    // Linha do tempo: eventos (status, responsável, classificação, SLA) + comentários
+    const [timeline, setTimeline] = useState(null);
+
+    useEffect(() => {
+        api.getTicketTimeline(ticket.id).then(setTimeline).catch(() => setTimeline(null));
+    }, [ticket.id, ticket.status, ticket.assigned_to_id, ticket.comments?.length]);
+
+    // Observadores (solicitante, responsáveis, mencionados e inscritos)
+    const [watchers, setWatchers] = useState([]);
+
+    const loadWatchers = () => {
+        api.getTicketWatchers(ticket.id).then(setWatchers).catch(() => setWatchers([]));
+    };
+
+    useEffect(loadWatchers, [ticket.id, ticket.assigned_to_id, ticket.comments?.length]);
+
     useEffect(() => {
         if (isAssigning && currentUserRole !== 'User') {
             api.getTechs().then(setTechs).catch(() => { });
@@ -58,16 +140,27 @@ const TicketDetailModal = ({ ticket, onClose, onUpdate, currentUserRole }) => {
         }
     };
 
-    const handleStatusChange = async (newStatus) => {
-        if (!confirm(`Alterar status para ${newStatus}?`)) return;
+    const handleStatusChange = async (transition) => {
+        const fields = {};
+        const required = (transition.required_fields || '').split(',').map(f => f.trim()).filter(Boolean);
+        if (required.includes('resolution_note')) {
+            const note = prompt('Descreva a solução aplicada:');
+            if (!note || !note.trim()) return;
+            fields.resolution_note = note.trim();
+        }
+        if (required.includes('comment')) {
+            const comment = prompt(`Justificativa para "${transition.label || transition.to_status}":`);
+            if (!comment || !comment.trim()) return;
+            fields.comment = comment.trim();
+        }
+        if (required.length === 0 && !confirm(`Alterar status para ${transition.to_status}?`)) return;
         setStatusLoading(true);
         try {
-            await api.updateTicketStatus(ticket.id, newStatus);
-            // Se encerrar, pode pedir solução obrigatória aqui (future enhancement)
+            await api.updateTicketStatus(ticket.id, transition.to_status, fields);
             onUpdate();
             onClose();
         } catch (e) {
-            alert("Erro ao atualizar status");
+            alert(e.message || "Erro ao atualizar status");
         } finally {
             setStatusLoading(false);
         }
@@ -75,20 +168,70 @@ const TicketDetailModal = ({ ticket, onClose, onUpdate, currentUserRole }) => {
 
     const handleSendComment = async (e) => {
         e.preventDefault();
-        if (!newComment.trim()) return;
+        if (!newComment.trim() && commentFiles.length === 0) return;
         try {
-            await api.addTicketComment(ticket.id, newComment);
+            await api.addTicketComment(ticket.id, newComment, commentFiles, internalNote);
             setNewComment('');
+            setInternalNote(false);
+            setCommentFiles([]);
             onUpdate(); // Reload to see new comment (could optimize to just push local)
             // onClose(); // Comentado para manter o usuário no chat após enviar
         } catch (e) {
-            alert("Erro ao enviar comentário");
+            alert(e.message || "Erro ao enviar comentário");
         }
     };
 
-    // Ordenar comentários do mais antigo para novo ou vice versa? Chat usually newest at bottom.
-    // Backend retorna na ordem que foi salvo? Normalmente sim.
-    const comments = ticket.comments || [];
+    // Autor pode editar/excluir o próprio comentário dentro do prazo (validado no servidor)
+    const currentUserId = JSON.parse(localStorage.getItem('user') || '{}').id;
+    const isWatching = watchers.some(w => w.user_id === currentUserId);
+
+    const toggleWatch = async () => {
+        try {
+            if (isWatching) {
+                await api.unwatchTicket(ticket.id);
+            } else {
+                await api.watchTicket(ticket.id);
+            }
+            loadWatchers();
+        } catch (e) {
+            alert(e.message || "Erro ao atualizar acompanhamento");
+        }
+    };
+
+    const reloadTimeline = () => api.getTicketTimeline(ticket.id).then(setTimeline).catch(() => { });
+
+    const handleEditComment = async (comment) => {
+        const content = prompt('Editar comentário:', comment.content);
+        if (content === null || !content.trim() || content === comment.content) return;
+        try {
+            await api.updateComment(comment.id, content);
+            reloadTimeline();
+        } catch (e) {
+            alert(e.message || 'Erro ao editar comentário');
+        }
+    };
+
+    const handleDeleteComment = async (comment) => {
+        if (!confirm('Excluir este comentário?')) return;
+        try {
+            await api.deleteComment(comment.id);
+            reloadTimeline();
+        } catch (e) {
+            alert(e.message || 'Erro ao excluir comentário');
+        }
+    };
+
+    const showRevisions = async (comment) => {
+        try {
+            const { revisions } = await api.getCommentRevisions(comment.id);
+            alert(revisions.map(r => `${new Date(r.created_at).toLocaleString()} (${r.action === 'delete' ? 'excluído' : 'editado'} por ${r.edited_by?.username || r.edited_by_id}):\n${r.content}`).join('\n\n') || 'Sem versões anteriores');
+        } catch (e) {
+            alert(e.message || 'Erro ao carregar histórico');
+        }
+    };
+
+    // Sem a linha do tempo (erro de rede), mostra só os comentários do chamado
+    const entries = timeline || (ticket.comments || []).map(comment => ({ kind: 'comment', comment }));
 
     return (
         <div className="fixed inset-0 bg-black/50 backdrop-blur-sm z-50 flex items-center justify-center p-4">
@@ -106,9 +249,24 @@ const TicketDetailModal = ({ ticket, onClose, onUpdate, currentUserRole }) => {
                             <span>📅 {new Date(ticket.created_at).toLocaleString()}</span>
                             {ticket.category && <span>📂 {ticket.category.name}</span>}
                             {ticket.assigned_to && <span>👤 {ticket.assigned_to.full_name || ticket.assigned_to.username}</span>}
+                            {watchers.length > 0 && (
+                                <span title={watchers.map(w => w.user?.full_name || w.user?.username).join(', ')}>
+                                    👁 {watchers.length} acompanhando
+                                </span>
+                            )}
                         </div>
                     </div>
-                    <button onClick={onClose} className="text-slate-400 hover:text-slate-600 p-2">✕</button>
+                    <div className="flex items-center gap-2">
+                        <button
+                            onClick={toggleWatch}
+                            className={`text-xs px-3 py-1.5 rounded-lg border ${isWatching
+                                ? 'border-blue-200 bg-blue-50 text-blue-700 dark:border-blue-800 dark:bg-blue-900/30 dark:text-blue-300'
+                                : 'border-slate-200 text-slate-600 hover:bg-slate-100 dark:border-slate-700 dark:text-slate-300 dark:hover:bg-slate-800'}`}
+                        >
+                            {isWatching ? 'Deixar de seguir' : 'Seguir'}
+                        </button>
+                        <button onClick={onClose} className="text-slate-400 hover:text-slate-600 p-2">✕</button>
+                    </div>
                 </div>
 
                 {/* Body - Scrollable */}
@@ -122,6 +280,7 @@ const TicketDetailModal = ({ ticket, onClose, onUpdate, currentUserRole }) => {
                                 Ativo Vinculado: <span className="font-medium text-slate-700 dark:text-slate-300">{ticket.asset.hostname}</span> ({ticket.asset.ip_address})
                             </div>
                         )}
+                        <AttachmentList attachments={attachments} />
                         <div className="mt-2 text-xs text-slate-500">
                             Aberto por: <span className="font-medium">{ticket.creator?.full_name || 'Usuário'}</span> • {ticket.sector}
                         </div>
@@ -130,25 +289,45 @@ const TicketDetailModal = ({ ticket, onClose, onUpdate, currentUserRole }) => {
                     {/* Timeline / Comments */}
                     <div className="space-y-4">
                         <h4 className="text-sm font-semibold text-slate-700 dark:text-slate-300">Histórico de Atendimento</h4>
-                        {comments.length === 0 ? (
+                        {entries.length === 0 ? (
                             <p className="text-center text-slate-500 text-sm py-4 italic">Nenhum comentário ou atualização ainda.</p>
                         ) : (
-                            comments.map((comment, idx) => (
-                                <div key={idx} className={`flex gap-3 ${comment.author === 'System Bot' ? 'justify-center' : ''}`}>
-                                    {comment.author !== 'System Bot' && (
+                            entries.map(({ kind, event, comment }, idx) => kind === 'event' ? (
+                                <div key={idx} className="text-center text-xs text-slate-500 dark:text-slate-400">
+                                    <span className="font-medium">{event.actor_name}</span> {describeEvent(event)}
+                                    {event.details && <span className="italic"> ({event.details})</span>}
+                                    <span className="opacity-70"> • {new Date(event.created_at).toLocaleString()}</span>
+                                </div>
+                            ) : (
+                                <div key={idx} className={`flex gap-3 ${comment.author_type === 'system' ? 'justify-center' : ''}`}>
+                                    {comment.author_type !== 'system' && (
                                         <div className="w-8 h-8 rounded-full bg-indigo-100 dark:bg-indigo-900/50 flex items-center justify-center text-xs font-bold text-indigo-600 dark:text-indigo-400 shrink-0">
                                             {comment.author ? comment.author.substring(0, 2).toUpperCase() : 'US'}
                                         </div>
                                     )}
-                                    <div className={`p-3 rounded-xl text-sm max-w-[80%] ${comment.author === 'System Bot'
+                                    <div className={`p-3 rounded-xl text-sm max-w-[80%] ${comment.author_type === 'system'
                                         ? 'bg-amber-50 dark:bg-amber-900/20 text-amber-700 dark:text-amber-400 text-xs border border-amber-100 dark:border-amber-800'
+                                        : comment.internal
+                                        ? 'bg-yellow-50 dark:bg-yellow-900/20 border border-dashed border-yellow-300 dark:border-yellow-700 text-slate-700 dark:text-slate-300'
                                         : 'bg-white dark:bg-slate-900 border border-slate-100 dark:border-slate-800 text-slate-700 dark:text-slate-300 shadow-sm'
                                         }`}>
                                         <div className="flex justify-between items-baseline gap-4 mb-1">
-                                            <span className="font-semibold">{comment.author}</span>
-                                            <span className="text-[10px] opacity-70">{new Date(comment.created_at).toLocaleString()}</span>
+                                            <span className="font-semibold">{comment.author}{comment.internal && <span className="ml-2 text-[10px] font-medium text-yellow-700 dark:text-yellow-400">🔒 Nota interna</span>}</span>
+                                            <span className="text-[10px] opacity-70">
+                                                {new Date(comment.created_at).toLocaleString()}
+                                                {comment.edited_at && (currentUserRole === 'Admin'
+                                                    ? <button type="button" onClick={() => showRevisions(comment)} className="ml-1 underline">(editado)</button>
+                                                    : ' (editado)')}
+                                            </span>
                                         </div>
                                         <p className="whitespace-pre-wrap">{comment.content}</p>
+                                        {comment.author_id === currentUserId && comment.author_type !== 'system' && (
+                                            <div className="flex gap-3 mt-1 text-[10px] text-slate-400">
+                                                <button type="button" onClick={() => handleEditComment(comment)} className="hover:text-indigo-600">Editar</button>
+                                                <button type="button" onClick={() => handleDeleteComment(comment)} className="hover:text-red-600">Excluir</button>
+                                            </div>
+                                        )}
+                                        <AttachmentList attachments={comment.attachments} />
                                     </div>
                                 </div>
                             ))
@@ -180,38 +359,32 @@ const TicketDetailModal = ({ ticket, onClose, onUpdate, currentUserRole }) => {
                                     👤 Transferir
                                 </button>
                             )}
-                            {currentUserRole !== 'User' && ticket.status === 'Novo' && (
-                                <button disabled={statusLoading} onClick={() => handleStatusChange('Em Andamento')} className="px-3 py-1.5 bg-blue-100 text-blue-700 rounded-lg text-sm font-medium hover:bg-blue-200 transition whitespace-nowrap">
-                                    ▶ Iniciar Atendimento
-                                </button>
-                            )}
-                            {currentUserRole !== 'User' && (ticket.status === 'Em Andamento' || ticket.status === 'Novo') && (
-                                <button disabled={statusLoading} onClick={() => handleStatusChange('Resolvido')} className="px-3 py-1.5 bg-emerald-100 text-emerald-700 rounded-lg text-sm font-medium hover:bg-emerald-200 transition whitespace-nowrap">
-                                    ✅ Resolver
-                                </button>
-                            )}
-                            {ticket.status === 'Resolvido' && (
-                                // User ou Tech pode fechar/reabrir? Geralmente user fecha.
-                                <button disabled={statusLoading} onClick={() => handleStatusChange('Fechado')} className="px-3 py-1.5 bg-slate-100 text-slate-700 rounded-lg text-sm font-medium hover:bg-slate-200 transition whitespace-nowrap">
-                                    🔒 Fechar Chamado
+                            {transitions.map(t => (
+                                <button key={t.id} disabled={statusLoading} onClick={() => handleStatusChange(t)} className={`px-3 py-1.5 rounded-lg text-sm font-medium transition whitespace-nowrap ${transitionStyle(t.to_status)}`}>
+                                    {t.label || t.to_status}
                                 </button>
-                            )}
-                            {ticket.status === 'Resolvido' && (
-                                <button disabled={statusLoading} onClick={() => handleStatusChange('Em Andamento')} className="px-3 py-1.5 bg-amber-100 text-amber-700 rounded-lg text-sm font-medium hover:bg-amber-200 transition whitespace-nowrap">
-                                    ↩ Reabrir
-                                </button>
-                            )}
+                            ))}
                         </div>
                     )}
 
                     {/* Comment Input */}
-                    <form onSubmit={handleSendComment} className="flex gap-2">
+                    <form onSubmit={handleSendComment} className="flex gap-2 items-center">
+                        <label className="cursor-pointer px-3 py-2 text-slate-500 hover:text-indigo-600 rounded-xl hover:bg-slate-100 dark:hover:bg-slate-800 transition" title="Anexar arquivos">
+                            📎{commentFiles.length > 0 && <span className="text-xs ml-1">{commentFiles.length}</span>}
+                            <input type="file" multiple className="hidden" onChange={e => setCommentFiles(Array.from(e.target.files))} />
+                        </label>
                         <input
                             value={newComment}
                             onChange={e => setNewComment(e.target.value)}
-                            placeholder="Escreva uma atualização ou solução..."
+                            placeholder={internalNote ? "Nota interna (o solicitante não verá)..." : "Escreva uma atualização ou solução... (@usuario menciona alguém)"}
                             className="flex-1 px-4 py-2 bg-slate-50 dark:bg-slate-800 border border-slate-200 dark:border-slate-700 rounded-xl outline-none focus:ring-2 focus:ring-indigo-500 text-slate-800 dark:text-gray-100 placeholder:text-slate-400"
                         />
+                        {currentUserRole !== 'User' && (
+                            <label className="flex items-center gap-1 text-xs text-slate-500 whitespace-nowrap cursor-pointer" title="Visível apenas para a equipe de TI">
+                                <input type="checkbox" checked={internalNote} onChange={e => setInternalNote(e.target.checked)} />
+                                🔒 Interna
+                            </label>
+                        )}
                         <button type="submit" className="bg-indigo-600 hover:bg-indigo-700 text-white px-4 py-2 rounded-xl font-medium transition disabled:opacity-50">
                             Enviar
                         </button>
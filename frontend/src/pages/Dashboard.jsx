@@ -115,9 +115,19 @@ const Dashboard = () => {
 
     useEffect(() => {
         loadDashboardData();
-        // Polling a cada 15 segundos
-        const interval = setInterval(loadDashboardData, 15000);
-        return () => clearInterval(interval);
+        // Recarrega quando um chamado muda (stream de eventos), no máximo a cada 5 segundos
+        let pending = null;
+        const unsubscribe = api.subscribeEvents((type) => {
+            if (type === 'kpi_changed' || pending) return;
+            pending = setTimeout(() => {
+                pending = null;
+                loadDashboardData();
+            }, 5000);
+        });
+        return () => {
+            clearTimeout(pending);
+            unsubscribe();
+        };
     }, []);
 
     return (
@@ -133,7 +143,7 @@ const Dashboard = () => {
                         <span className="animate-ping absolute inline-flex h-full w-full rounded-full bg-emerald-400 opacity-75"></span>
                         <span className="relative inline-flex rounded-full h-2 w-2 bg-emerald-500"></span>
                     </span>
-                    Atualização em tempo real (15s)
+                    Atualização em tempo real
                 </div>
             </div>
 
@@ -1,4 +1,4 @@
-import React, { useState } from 'react';
+import React, { useEffect, useState } from 'react';
 import { useNavigate } from 'react-router-dom';
 import { Lock, User } from 'lucide-react';
 import { api } from '../services/api';
@@ -8,31 +8,131 @@ export default function Login() {
     const [credentials, setCredentials] = useState({ username: '', password: '' });
     const [error, setError] = useState('');
     const [loading, setLoading] = useState(false);
+    const [mfaToken, setMfaToken] = useState('');
+    const [mfaCode, setMfaCode] = useState('');
+    const [oidc, setOidc] = useState({ enabled: false });
+    const [pendingLogin, setPendingLogin] = useState(null); // Login aguardando troca de senha obrigatória
+    const [newPassword, setNewPassword] = useState({ current: '', password: '', confirm: '' });
+    const [reset, setReset] = useState(null); // Recuperação de senha: { token?, login, password, confirm }
+    const [info, setInfo] = useState('');
+
+    const finishLogin = (data) => {
+        if (data.token && data.user) {
+            localStorage.setItem('token', data.token);
+            localStorage.setItem('refresh_token', data.refresh_token);
+            localStorage.setItem('user', JSON.stringify(data.user));
+            console.log('[Login] Usuário salvo no localStorage:', data.user);
+
+            // Senha provisória ou expirada: trocar antes de entrar
+            if (data.password_change_required) {
+                setPendingLogin(data);
+                setNewPassword({ current: credentials.password, password: '', confirm: '' });
+                return;
+            }
+
+            if (data.user.role === 'User') {
+                navigate('/tickets');
+            } else {
+                navigate('/');
+            }
+        } else {
+            setError('Falha ao obter token');
+        }
+    };
+
+    useEffect(() => {
+        api.getOIDCConfig().then(setOidc).catch(() => {});
+
+        // Retorno do login SSO (OIDC): resultado vem no fragmento da URL
+        const params = new URLSearchParams(window.location.hash.slice(1));
+        if (![...params.keys()].length) return;
+        window.history.replaceState(null, '', window.location.pathname);
+
+        if (params.get('reset_token')) {
+            setReset({ token: params.get('reset_token'), login: '', password: '', confirm: '' });
+        } else if (params.get('oidc_error')) {
+            setError(params.get('oidc_error'));
+        } else if (params.get('mfa_token')) {
+            setMfaToken(params.get('mfa_token'));
+        } else if (params.get('refresh_token')) {
+            setLoading(true);
+            api.completeOIDCLogin(params.get('refresh_token'))
+                .then(finishLogin)
+                .catch(() => setError('Falha no login via SSO'))
+                .finally(() => setLoading(false));
+        }
+    }, []);
+
+    const handleChangePassword = async () => {
+        if (newPassword.password !== newPassword.confirm) {
+            setError('As senhas não conferem');
+            return;
+        }
+        try {
+            const res = await api.changePassword({ current_password: newPassword.current, new_password: newPassword.password });
+            setPendingLogin(null);
+            finishLogin({ ...pendingLogin, user: res.user, password_change_required: false });
+        } catch (err) {
+            setError(err.message);
+        }
+    };
+
+    const handleReset = async (e) => {
+        e.preventDefault();
+        setError('');
+        setInfo('');
+        if (reset.token && reset.password !== reset.confirm) {
+            setError('As senhas não conferem');
+            return;
+        }
+        setLoading(true);
+        try {
+            if (reset.token) {
+                const res = await api.confirmPasswordReset({ token: reset.token, new_password: reset.password });
+                setReset(null);
+                setInfo(res.message);
+            } else {
+                const res = await api.requestPasswordReset({ login: reset.login });
+                setInfo(res.message);
+            }
+        } catch (err) {
+            setError(err.message);
+        } finally {
+            setLoading(false);
+        }
+    };
 
     const handleLogin = async (e) => {
         e.preventDefault();
         setError('');
+        setInfo('');
         setLoading(true);
 
+        if (pendingLogin) {
+            await handleChangePassword();
+            setLoading(false);
+            return;
+        }
+
         try {
-            const data = await api.login(credentials);
+            const data = mfaToken
+                ? await api.loginSecondFactor({ mfa_token: mfaToken, code: mfaCode })
+                : await api.login(credentials);
             console.log('[Login] Resposta da API:', data);
 
-            if (data.token && data.user) {
-                localStorage.setItem('token', data.token);
-                localStorage.setItem('user', JSON.stringify(data.user));
-                console.log('[Login] Usuário salvo no localStorage:', data.user);
+            // Usuário com 2FA: pedir o código do aplicativo autenticador
+            if (data.two_factor_required) {
+                setMfaToken(data.mfa_token);
+                return;
+            }
 
-                if (data.user.role === 'User') {
-                    navigate('/tickets');
-                } else {
-                    navigate('/');
-                }
+            finishLogin(data);
+        } catch (err) {
+            if (err.message && err.message !== 'Login failed') {
+                setError(err.message); // Bloqueio por excesso de tentativas
             } else {
-                setError('Falha ao obter token');
+                setError(mfaToken ? 'Código inválido ou expirado' : 'Usuário ou senha inválidos');
             }
-        } catch (err) {
-            setError('Usuário ou senha inválidos');
         } finally {
             setLoading(false);
         }
@@ -56,7 +156,117 @@ export default function Login() {
                         </div>
                     )}
 
+                    {info && (
+                        <div className="mb-6 p-4 bg-green-50 dark:bg-green-900/20 text-green-700 dark:text-green-400 text-sm rounded-xl text-center font-medium">
+                            {info}
+                        </div>
+                    )}
+
+                    {reset ? (
+                    <form onSubmit={handleReset} className="space-y-5">
+                        {reset.token ? (<>
+                        <div className="space-y-1">
+                            <label className="text-sm font-medium text-slate-700 dark:text-slate-300">Nova senha</label>
+                            <input
+                                type="password"
+                                required
+                                autoFocus
+                                value={reset.password}
+                                onChange={(e) => setReset({ ...reset, password: e.target.value })}
+                                className="w-full px-4 py-3 bg-slate-50 dark:bg-slate-900 border border-slate-200 dark:border-slate-800 rounded-xl outline-none focus:ring-2 focus:ring-blue-500 dark:text-white transition"
+                            />
+                        </div>
+                        <div className="space-y-1">
+                            <label className="text-sm font-medium text-slate-700 dark:text-slate-300">Confirmar nova senha</label>
+                            <input
+                                type="password"
+                                required
+                                value={reset.confirm}
+                                onChange={(e) => setReset({ ...reset, confirm: e.target.value })}
+                                className="w-full px-4 py-3 bg-slate-50 dark:bg-slate-900 border border-slate-200 dark:border-slate-800 rounded-xl outline-none focus:ring-2 focus:ring-blue-500 dark:text-white transition"
+                            />
+                        </div>
+                        </>) : (
+                        <div className="space-y-1">
+                            <label className="text-sm font-medium text-slate-700 dark:text-slate-300">Usuário ou e-mail</label>
+                            <input
+                                type="text"
+                                required
+                                autoFocus
+                                value={reset.login}
+                                onChange={(e) => setReset({ ...reset, login: e.target.value })}
+                                className="w-full px-4 py-3 bg-slate-50 dark:bg-slate-900 border border-slate-200 dark:border-slate-800 rounded-xl outline-none focus:ring-2 focus:ring-blue-500 dark:text-white transition"
+                            />
+                        </div>
+                        )}
+
+                        <button
+                            type="submit"
+                            disabled={loading}
+                            className="w-full py-3 bg-blue-600 hover:bg-blue-700 text-white font-bold rounded-xl shadow-lg shadow-blue-500/30 transition disabled:opacity-50 disabled:cursor-not-allowed"
+                        >
+                            {reset.token ? 'Redefinir senha' : 'Enviar link por e-mail'}
+                        </button>
+                        <button
+                            type="button"
+                            onClick={() => { setReset(null); setError(''); }}
+                            className="block w-full text-sm text-slate-500 hover:text-blue-600 transition"
+                        >
+                            Voltar ao login
+                        </button>
+                    </form>
+                    ) : (
                     <form onSubmit={handleLogin} className="space-y-5">
+                        {pendingLogin ? (<>
+                        <p className="text-sm text-slate-600 dark:text-slate-400">Sua senha é provisória ou expirou. Defina uma nova senha para continuar.</p>
+                        {!newPassword.current && (
+                        <div className="space-y-1">
+                            <label className="text-sm font-medium text-slate-700 dark:text-slate-300">Senha atual</label>
+                            <input
+                                type="password"
+                                required
+                                value={newPassword.current}
+                                onChange={(e) => setNewPassword({ ...newPassword, current: e.target.value })}
+                                className="w-full px-4 py-3 bg-slate-50 dark:bg-slate-900 border border-slate-200 dark:border-slate-800 rounded-xl outline-none focus:ring-2 focus:ring-blue-500 dark:text-white transition"
+                            />
+                        </div>
+                        )}
+                        <div className="space-y-1">
+                            <label className="text-sm font-medium text-slate-700 dark:text-slate-300">Nova senha</label>
+                            <input
+                                type="password"
+                                required
+                                autoFocus
+                                value={newPassword.password}
+                                onChange={(e) => setNewPassword({ ...newPassword, password: e.target.value })}
+                                className="w-full px-4 py-3 bg-slate-50 dark:bg-slate-900 border border-slate-200 dark:border-slate-800 rounded-xl outline-none focus:ring-2 focus:ring-blue-500 dark:text-white transition"
+                            />
+                        </div>
+                        <div className="space-y-1">
+                            <label className="text-sm font-medium text-slate-700 dark:text-slate-300">Confirmar nova senha</label>
+                            <input
+                                type="password"
+                                required
+                                value={newPassword.confirm}
+                                onChange={(e) => setNewPassword({ ...newPassword, confirm: e.target.value })}
+                                className="w-full px-4 py-3 bg-slate-50 dark:bg-slate-900 border border-slate-200 dark:border-slate-800 rounded-xl outline-none focus:ring-2 focus:ring-blue-500 dark:text-white transition"
+                            />
+                        </div>
+                        </>) : mfaToken ? (
+                        <div className="space-y-1">
+                            <label className="text-sm font-medium text-slate-700 dark:text-slate-300">Código de verificação (2FA)</label>
+                            <input
+                                type="text"
+                                required
+                                autoFocus
+                                value={mfaCode}
+                                onChange={(e) => setMfaCode(e.target.value)}
+                                className="w-full px-4 py-3 bg-slate-50 dark:bg-slate-900 border border-slate-200 dark:border-slate-800 rounded-xl outline-none focus:ring-2 focus:ring-blue-500 dark:text-white transition tracking-widest text-center"
+                                placeholder="000000"
+                            />
+                            <p className="text-xs text-slate-500">Informe o código do aplicativo autenticador ou um código de recuperação.</p>
+                        </div>
+                        ) : (<>
                         <div className="space-y-1">
                             <label className="text-sm font-medium text-slate-700 dark:text-slate-300">Usuário</label>
                             <div className="relative">
@@ -86,15 +296,36 @@ export default function Login() {
                                 />
                             </div>
                         </div>
+                        </>)}
 
                         <button
                             type="submit"
                             disabled={loading}
                             className="w-full py-3 bg-blue-600 hover:bg-blue-700 text-white font-bold rounded-xl shadow-lg shadow-blue-500/30 transition disabled:opacity-50 disabled:cursor-not-allowed"
                         >
-                            {loading ? 'Entrando...' : 'Entrar'}
+                            {loading ? 'Entrando...' : pendingLogin ? 'Alterar senha' : 'Entrar'}
                         </button>
+
+                        {oidc.enabled && !mfaToken && !pendingLogin && (
+                            <a
+                                href="/api/v1/auth/oidc/login"
+                                className="block w-full py-3 text-center bg-white dark:bg-slate-900 border border-slate-200 dark:border-slate-800 hover:bg-slate-50 dark:hover:bg-slate-800 text-slate-700 dark:text-slate-200 font-bold rounded-xl transition"
+                            >
+                                {oidc.label}
+                            </a>
+                        )}
+
+                        {!mfaToken && !pendingLogin && (
+                            <button
+                                type="button"
+                                onClick={() => { setReset({ login: credentials.username, password: '', confirm: '' }); setError(''); setInfo(''); }}
+                                className="block w-full text-sm text-slate-500 hover:text-blue-600 transition"
+                            >
+                                Esqueci minha senha
+                            </button>
+                        )}
                     </form>
+                    )}
                 </div>
                 <div className="bg-slate-50 dark:bg-slate-900 p-4 text-center border-t border-slate-100 dark:border-slate-800">
                     <p className="text-xs text-slate-500">
@@ -1,5 +1,5 @@
 import React, { useState, useEffect } from 'react';
-import { Save, Trash2, Download, Database, Monitor, AlertTriangle, Layers, Edit2, Plus, X, Server, MessageSquare } from 'lucide-react';
+import { Save, Trash2, Download, Database, Monitor, AlertTriangle, Layers, Edit2, Plus, X, Server, MessageSquare, Mail, RotateCcw, Inbox, Webhook } from 'lucide-react';
 import { api } from '../services/api';
 
 export default function Settings() {
@@ -461,6 +461,20 @@ export default function Settings() {
                 </div>
             )}
 
+            {/* Notificações por E-mail (Admin Only) */}
+            {userRole === 'Admin' && (
+                <EmailNotificationsPanel
+                    enabled={systemSettings.find(s => s.key === 'email_notifications_enabled')?.value !== 'false'}
+                    onToggle={() => handleToggleSetting('email_notifications_enabled', systemSettings.find(s => s.key === 'email_notifications_enabled')?.value || 'true')}
+                />
+            )}
+
+            {/* Webhooks (Admin Only) */}
+            {userRole === 'Admin' && <WebhooksPanel />}
+
+            {/* Chamados por E-mail (Admin Only) */}
+            {userRole === 'Admin' && <MailIntakePanel />}
+
             {/* Atualização de Sistema (Admin Only) */}
             {userRole === 'Admin' && (
                 <div className="bg-white dark:bg-slate-950 p-6 rounded-xl border border-slate-100 dark:border-slate-800 shadow-sm mt-8 border-l-4 border-l-purple-500">
@@ -502,3 +516,345 @@ export default function Settings() {
         </div>
     );
 }
+
+// Modelos dos e-mails de aviso e fila de envio
+function EmailNotificationsPanel({ enabled, onToggle }) {
+    const [templates, setTemplates] = useState([]);
+    const [kinds, setKinds] = useState([]);
+    const [variables, setVariables] = useState([]);
+    const [selectedKind, setSelectedKind] = useState('');
+    const [form, setForm] = useState({ subject: '', body: '' });
+    const [outbox, setOutbox] = useState([]);
+
+    const loadTemplates = async () => {
+        const data = await api.getNotificationTemplates();
+        setTemplates(data.templates || []);
+        setKinds(data.kinds || []);
+        setVariables(data.variables || []);
+        return data.templates || [];
+    };
+
+    const loadOutbox = () => api.getEmailOutbox().then(setOutbox).catch(() => setOutbox([]));
+
+    useEffect(() => {
+        loadTemplates().then(list => {
+            if (list.length > 0) selectKind(list[0].kind, list);
+        }).catch(() => { });
+        loadOutbox();
+    }, []);
+
+    const selectKind = (kind, list = templates) => {
+        const tmpl = list.find(t => t.kind === kind);
+        setSelectedKind(kind);
+        setForm({ subject: tmpl?.subject || '', body: tmpl?.body || '' });
+    };
+
+    const handleSave = async () => {
+        try {
+            await api.updateNotificationTemplate(selectedKind, form);
+            await loadTemplates();
+            alert("Modelo salvo!");
+        } catch (e) {
+            alert("Erro ao salvar modelo: " + e.message);
+        }
+    };
+
+    const handleReset = async () => {
+        if (!window.confirm("Restaurar o texto padrão deste modelo?")) return;
+        try {
+            const tmpl = await api.resetNotificationTemplate(selectedKind);
+            setForm({ subject: tmpl.subject, body: tmpl.body });
+            await loadTemplates();
+        } catch (e) {
+            alert("Erro ao restaurar modelo: " + e.message);
+        }
+    };
+
+    const handleRetry = async (id) => {
+        try {
+            await api.retryEmailOutbox(id);
+            setTimeout(loadOutbox, 1500);
+        } catch (e) {
+            alert("Erro ao reenviar: " + e.message);
+        }
+    };
+
+    const statusLabel = { pending: 'Na fila', sent: 'Enviado', failed: 'Falhou' };
+    const inputClass = "w-full px-3 py-2 bg-slate-50 dark:bg-slate-900 border border-slate-200 dark:border-slate-800 rounded-lg outline-none focus:ring-2 focus:ring-indigo-500 dark:text-white";
+
+    return (
+        <div className="bg-white dark:bg-slate-950 p-6 rounded-xl border border-slate-100 dark:border-slate-800 shadow-sm mt-8 border-l-4 border-l-sky-500">
+            <h3 className="text-lg font-semibold text-slate-800 dark:text-white mb-4 flex items-center gap-2">
+                <Mail className="w-5 h-5 text-sky-600" /> Notificações por E-mail
+            </h3>
+
+            <label className="flex items-center gap-2 text-sm text-slate-700 dark:text-slate-300 mb-4">
+                <input type="checkbox" checked={enabled} onChange={onToggle} />
+                Enviar avisos de chamados por e-mail (requer SMTP configurado)
+            </label>
+
+            <div className="space-y-3">
+                <select className={inputClass} value={selectedKind} onChange={(e) => selectKind(e.target.value)}>
+                    {kinds.map(k => <option key={k.kind} value={k.kind}>{k.label}</option>)}
+                </select>
+                <input className={inputClass} value={form.subject} onChange={(e) => setForm({ ...form, subject: e.target.value })} placeholder="Assunto" />
+                <textarea className={`${inputClass} font-mono text-sm`} rows="8" value={form.body} onChange={(e) => setForm({ ...form, body: e.target.value })} />
+                <p className="text-xs text-slate-500">
+                    Variáveis: {variables.map(v => `{{.${v}}}`).join(' ')}. Mantenha "[Chamado #{'{{.TicketID}}'}]" no assunto para que respostas sejam associadas ao chamado.
+                </p>
+                <div className="flex gap-2 justify-end">
+                    <button onClick={handleReset} className="px-3 py-2 text-sm text-slate-600 dark:text-slate-300 hover:bg-slate-100 dark:hover:bg-slate-800 rounded-lg flex items-center gap-1">
+                        <RotateCcw className="w-4 h-4" /> Restaurar padrão
+                    </button>
+                    <button onClick={handleSave} className="px-4 py-2 text-sm bg-sky-600 hover:bg-sky-700 text-white rounded-lg flex items-center gap-1">
+                        <Save className="w-4 h-4" /> Salvar modelo
+                    </button>
+                </div>
+            </div>
+
+            <div className="border-t border-slate-100 dark:border-slate-800 mt-6 pt-4">
+                <div className="flex items-center justify-between mb-2">
+                    <h4 className="font-medium text-slate-900 dark:text-white">Fila de Envio</h4>
+                    <button onClick={loadOutbox} className="text-xs text-sky-600 hover:underline">Atualizar</button>
+                </div>
+                <div className="max-h-64 overflow-y-auto divide-y divide-slate-100 dark:divide-slate-800 text-sm">
+                    {outbox.length === 0 && <p className="text-slate-500 text-sm py-2">Nenhum e-mail na fila.</p>}
+                    {outbox.map(item => (
+                        <div key={item.id} className="py-2 flex items-start justify-between gap-3">
+                            <div className="min-w-0">
+                                <div className="text-slate-800 dark:text-slate-200 truncate">{item.subject}</div>
+                                <div className="text-xs text-slate-500">
+                                    {item.to} • {new Date(item.created_at).toLocaleString()} • {statusLabel[item.status] || item.status}
+                                    {item.attempts > 0 && ` • ${item.attempts} tentativa(s)`}
+                                </div>
+                                {item.last_error && <div className="text-xs text-red-500 truncate">{item.last_error}</div>}
+                            </div>
+                            {item.status !== 'sent' && (
+                                <button onClick={() => handleRetry(item.id)} className="text-xs text-sky-600 hover:underline whitespace-nowrap">Reenviar</button>
+                            )}
+                        </div>
+                    ))}
+                </div>
+            </div>
+        </div>
+    );
+}
+
+// Últimas mensagens lidas da caixa de suporte e o que foi feito com cada uma
+function MailIntakePanel() {
+    const [entries, setEntries] = useState([]);
+    const [running, setRunning] = useState(false);
+
+    const load = () => api.getMailIntakeLog().then(setEntries).catch(() => setEntries([]));
+
+    useEffect(() => { load(); }, []);
+
+    const handleRun = async () => {
+        setRunning(true);
+        try {
+            const result = await api.runMailIntake();
+            alert(`${result.processed} mensagem(ns) processada(s).`);
+        } catch (e) {
+            alert("Erro ao ler a caixa: " + e.message);
+        } finally {
+            setRunning(false);
+            load();
+        }
+    };
+
+    const resultLabel = { ticket: 'Chamado aberto', comment: 'Comentário', ignored: 'Ignorada', error: 'Erro' };
+
+    return (
+        <div className="bg-white dark:bg-slate-950 p-6 rounded-xl border border-slate-100 dark:border-slate-800 shadow-sm mt-8 border-l-4 border-l-teal-500">
+            <div className="flex items-center justify-between mb-2">
+                <h3 className="text-lg font-semibold text-slate-800 dark:text-white flex items-center gap-2">
+                    <Inbox className="w-5 h-5 text-teal-600" /> Chamados por E-mail
+                </h3>
+                <button onClick={handleRun} disabled={running} className="px-3 py-2 text-sm bg-teal-600 hover:bg-teal-700 disabled:opacity-50 text-white rounded-lg">
+                    {running ? 'Lendo...' : 'Ler caixa agora'}
+                </button>
+            </div>
+            <p className="text-sm text-slate-500 mb-4">
+                E-mails enviados à caixa de suporte abrem chamados em nome do remetente cadastrado; respostas com "[Chamado #N]" no assunto viram comentários.
+                Configure em mail_intake_* e imap_*. Só são aceitos remetentes verificados: informe o servidor de e-mail confiável
+                (mail_intake_trusted_authserv_id) e/ou os domínios autorizados (mail_intake_allowed_domains).
+            </p>
+            <div className="max-h-64 overflow-y-auto divide-y divide-slate-100 dark:divide-slate-800 text-sm">
+                {entries.length === 0 && <p className="text-slate-500 py-2">Nenhuma mensagem processada.</p>}
+                {entries.map(e => (
+                    <div key={e.id} className="py-2">
+                        <div className="text-slate-800 dark:text-slate-200 truncate">{e.subject || '(sem assunto)'}</div>
+                        <div className="text-xs text-slate-500">
+                            {e.from} • {new Date(e.created_at).toLocaleString()} • {resultLabel[e.result] || e.result}
+                            {e.ticket_id && ` • #${e.ticket_id}`}
+                        </div>
+                        {e.reason && <div className={`text-xs ${e.result === 'error' ? 'text-red-500' : 'text-slate-400'}`}>{e.reason}</div>}
+                    </div>
+                ))}
+            </div>
+        </div>
+    );
+}
+
+// Assinaturas de webhooks (integrações como Teams/Telegram e intranet) e registro de entregas
+function WebhooksPanel() {
+    const emptyForm = { id: null, name: '', url: '', events: [], include_internal: false, active: true };
+    const [hooks, setHooks] = useState([]);
+    const [events, setEvents] = useState([]);
+    const [form, setForm] = useState(emptyForm);
+    const [secret, setSecret] = useState(''); // Exibido uma única vez, após criar ou trocar
+    const [deliveries, setDeliveries] = useState([]);
+    const [selected, setSelected] = useState(null);
+
+    const load = () => api.getWebhooks().then(data => {
+        setHooks(data.webhooks || []);
+        setEvents(data.events || []);
+    }).catch(() => { });
+
+    const loadDeliveries = (hookId) => {
+        setSelected(hookId);
+        api.getWebhookDeliveries(hookId).then(setDeliveries).catch(() => setDeliveries([]));
+    };
+
+    useEffect(() => { load(); }, []);
+
+    const toggleEvent = (event) => setForm({
+        ...form,
+        events: form.events.includes(event) ? form.events.filter(e => e !== event) : [...form.events, event]
+    });
+
+    const handleSave = async (e) => {
+        e.preventDefault();
+        try {
+            const payload = { name: form.name, url: form.url, events: form.events, include_internal: form.include_internal, active: form.active };
+            const result = form.id ? await api.updateWebhook(form.id, payload) : await api.createWebhook(payload);
+            if (result.secret) setSecret(result.secret);
+            setForm(emptyForm);
+            load();
+        } catch (err) {
+            alert("Erro ao salvar webhook: " + err.message);
+        }
+    };
+
+    const handleRotate = async (hook) => {
+        if (!window.confirm(`Gerar um novo segredo para "${hook.name}"? O receptor precisará ser atualizado.`)) return;
+        try {
+            const result = await api.updateWebhook(hook.id, { name: hook.name, url: hook.url, events: hook.events.split(','), include_internal: hook.include_internal, rotate_secret: true });
+            setSecret(result.secret);
+        } catch (err) {
+            alert("Erro ao trocar segredo: " + err.message);
+        }
+    };
+
+    const handleDelete = async (hook) => {
+        if (!window.confirm(`Remover o webhook "${hook.name}" e seu registro de entregas?`)) return;
+        await api.deleteWebhook(hook.id).catch(err => alert(err.message));
+        if (selected === hook.id) setSelected(null);
+        load();
+    };
+
+    const handleTest = async (hook) => {
+        await api.testWebhook(hook.id).catch(err => alert(err.message));
+        setTimeout(() => loadDeliveries(hook.id), 1500);
+    };
+
+    const handleRedeliver = async (delivery) => {
+        await api.redeliverWebhook(delivery.id).catch(err => alert(err.message));
+        setTimeout(() => loadDeliveries(selected), 1500);
+    };
+
+    const statusStyle = { sent: 'text-emerald-600', pending: 'text-amber-600', failed: 'text-red-600' };
+    const statusLabel = { sent: 'Entregue', pending: 'Pendente', failed: 'Falhou' };
+
+    return (
+        <div className="bg-white dark:bg-slate-950 p-6 rounded-xl border border-slate-100 dark:border-slate-800 shadow-sm mt-8 border-l-4 border-l-violet-500">
+            <h3 className="text-lg font-semibold text-slate-800 dark:text-white mb-2 flex items-center gap-2">
+                <Webhook className="w-5 h-5 text-violet-600" /> Webhooks
+            </h3>
+            <p className="text-sm text-slate-500 mb-4">
+                Envia os eventos de chamados por POST (JSON) assinado com HMAC-SHA256 no cabeçalho X-Webhook-Signature.
+                Entregas com falha são repetidas com espera crescente.
+            </p>
+
+            {secret && (
+                <div className="mb-4 p-3 rounded-lg bg-amber-50 dark:bg-amber-900/20 text-sm text-amber-800 dark:text-amber-300">
+                    Segredo do webhook (copie agora, ele não será exibido novamente):
+                    <code className="block mt-1 font-mono break-all select-all">{secret}</code>
+                    <button onClick={() => setSecret('')} className="mt-2 text-xs underline">Fechar</button>
+                </div>
+            )}
+
+            <form onSubmit={handleSave} className="grid grid-cols-1 md:grid-cols-2 gap-3 mb-6">
+                <input required value={form.name} onChange={e => setForm({ ...form, name: e.target.value })} placeholder="Nome (ex: Ponte Teams)"
+                    className="px-3 py-2 bg-slate-50 dark:bg-slate-900 border border-slate-200 dark:border-slate-800 rounded-lg text-sm text-slate-900 dark:text-white" />
+                <input required value={form.url} onChange={e => setForm({ ...form, url: e.target.value })} placeholder="https://intranet/webhooks/chamados"
+                    className="px-3 py-2 bg-slate-50 dark:bg-slate-900 border border-slate-200 dark:border-slate-800 rounded-lg text-sm text-slate-900 dark:text-white" />
+                <div className="md:col-span-2 flex flex-wrap gap-4 text-sm text-slate-600 dark:text-slate-400">
+                    {events.map(ev => (
+                        <label key={ev.event} className="flex items-center gap-2">
+                            <input type="checkbox" checked={form.events.includes(ev.event)} onChange={() => toggleEvent(ev.event)} />
+                            {ev.label}
+                        </label>
+                    ))}
+                    <label className="flex items-center gap-2">
+                        <input type="checkbox" checked={form.include_internal} onChange={e => setForm({ ...form, include_internal: e.target.checked })} />
+                        Incluir notas internas
+                    </label>
+                    <label className="flex items-center gap-2">
+                        <input type="checkbox" checked={form.active} onChange={e => setForm({ ...form, active: e.target.checked })} />
+                        Ativo
+                    </label>
+                </div>
+                <div className="md:col-span-2 flex gap-2">
+                    <button type="submit" className="px-4 py-2 text-sm bg-violet-600 hover:bg-violet-700 text-white rounded-lg">
+                        {form.id ? 'Salvar alterações' : 'Adicionar webhook'}
+                    </button>
+                    {form.id && (
+                        <button type="button" onClick={() => setForm(emptyForm)} className="px-4 py-2 text-sm text-slate-600 hover:bg-slate-100 dark:hover:bg-slate-800 rounded-lg">Cancelar</button>
+                    )}
+                </div>
+            </form>
+
+            <div className="divide-y divide-slate-100 dark:divide-slate-800 text-sm">
+                {hooks.length === 0 && <p className="text-slate-500 py-2">Nenhum webhook cadastrado.</p>}
+                {hooks.map(hook => (
+                    <div key={hook.id} className="py-3 flex flex-col md:flex-row md:items-center justify-between gap-2">
+                        <div className="min-w-0">
+                            <div className="font-medium text-slate-800 dark:text-slate-200">
+                                {hook.name} {!hook.active && <span className="text-xs text-slate-400">(inativo)</span>}
+                            </div>
+                            <div className="text-xs text-slate-500 truncate">{hook.url} • {hook.events}</div>
+                        </div>
+                        <div className="flex gap-2 text-xs shrink-0">
+                            <button onClick={() => loadDeliveries(hook.id)} className="px-2 py-1 rounded bg-slate-100 dark:bg-slate-800">Entregas</button>
+                            <button onClick={() => handleTest(hook)} className="px-2 py-1 rounded bg-slate-100 dark:bg-slate-800">Testar</button>
+                            <button onClick={() => setForm({ id: hook.id, name: hook.name, url: hook.url, events: hook.events.split(','), include_internal: hook.include_internal, active: hook.active })} className="px-2 py-1 rounded bg-slate-100 dark:bg-slate-800">Editar</button>
+                            <button onClick={() => handleRotate(hook)} className="px-2 py-1 rounded bg-slate-100 dark:bg-slate-800">Novo segredo</button>
+                            <button onClick={() => handleDelete(hook)} className="px-2 py-1 rounded bg-red-50 text-red-600 dark:bg-red-900/20">Remover</button>
+                        </div>
+                    </div>
+                ))}
+            </div>
+
+            {selected && (
+                <div className="mt-4">
+                    <h4 className="text-sm font-semibold text-slate-700 dark:text-slate-300 mb-2">Últimas entregas</h4>
+                    <div className="max-h-64 overflow-y-auto divide-y divide-slate-100 dark:divide-slate-800 text-xs">
+                        {deliveries.length === 0 && <p className="text-slate-500 py-2">Nenhuma entrega registrada.</p>}
+                        {deliveries.map(d => (
+                            <div key={d.id} className="py-2 flex items-center justify-between gap-2">
+                                <div className="min-w-0">
+                                    <span className={statusStyle[d.status]}>{statusLabel[d.status] || d.status}</span>
+                                    {' '}• #{d.id} {d.event}{d.ticket_id && ` (chamado #${d.ticket_id})`} • {new Date(d.created_at).toLocaleString()}
+                                    {' '}• {d.attempts} tentativa(s){d.status_code > 0 && ` • HTTP ${d.status_code}`}
+                                    {d.last_error && <div className="text-red-500 truncate">{d.last_error}</div>}
+                                </div>
+                                <button onClick={() => handleRedeliver(d)} className="px-2 py-1 rounded bg-slate-100 dark:bg-slate-800 shrink-0">Reenviar</button>
+                            </div>
+                        ))}
+                    </div>
+                </div>
+            )}
+        </div>
+    );
+}
@@ -1,4 +1,5 @@
-import React, { useEffect, useState } from 'react';
+import React, { useEffect, useRef, useState } from 'react';
+import { useLocation } from 'react-router-dom';
 import { Plus, Search, Ticket, AlertCircle, CheckCircle, Clock } from 'lucide-react';
 import { api } from '../services/api';
 import TicketDetailModal, { PriorityBadge, StatusBadge } from '../components/TicketDetailModal';
@@ -19,6 +20,7 @@ export default function Tickets() {
 
     const [patrimonyHistory, setPatrimonyHistory] = useState([]);
     const [usersList, setUsersList] = useState([]); // Para Techs selecionarem quem pediu
+    const [files, setFiles] = useState([]); // Anexos (prints de erro, PDFs)
 
     // Form State
     const [formData, setFormData] = useState({
@@ -43,6 +45,48 @@ export default function Tickets() {
         loadData();
     }, []);
 
+    // Tempo real: a lista e o chamado aberto acompanham as mudanças sem recarregar tudo
+    useEffect(() => api.subscribeEvents((type, data) => {
+        if (type === 'reconnected') {
+            loadData(); // Eventos podem ter se perdido enquanto a conexão estava fora
+            return;
+        }
+        if (type === 'ticket_deleted') {
+            setTickets(list => list.filter(t => t.id !== data.ticket_id));
+            setViewTicket(current => (current && current.id === data.ticket_id ? null : current));
+            return;
+        }
+        if (!data.ticket) return;
+
+        // O evento não traz os comentários: mantém os já carregados e inclui o novo
+        const merge = (old) => {
+            const comments = old?.comments || [];
+            const merged = { ...old, ...data.ticket, comments };
+            if (data.comment && !comments.some(cm => cm.id === data.comment.id)) {
+                merged.comments = [...comments, data.comment];
+            }
+            return merged;
+        };
+        setTickets(list => (list.some(t => t.id === data.ticket.id)
+            ? list.map(t => (t.id === data.ticket.id ? merge(t) : t))
+            : [merge(null), ...list]));
+        setViewTicket(current => (current && current.id === data.ticket.id ? merge(current) : current));
+    }), []);
+
+    // Já na tela de chamados: o link de uma notificação (/tickets?id=123) abre o chamado sem recarregar a lista
+    const location = useLocation();
+    const firstLocation = useRef(true);
+    useEffect(() => {
+        if (firstLocation.current) {
+            firstLocation.current = false; // Na primeira carga quem abre é o loadData
+            return;
+        }
+        const linkedId = parseInt(new URLSearchParams(location.search).get('id'));
+        if (linkedId) {
+            api.getTicket(linkedId).then(setViewTicket).catch(() => { });
+        }
+    }, [location.search]);
+
     const loadData = async () => {
         try {
             setLoading(true);
@@ -52,6 +96,13 @@ export default function Tickets() {
                 api.getCategories()
             ]);
             setTickets(Array.isArray(ticketsData) ? ticketsData : []);
+
+            // Link de e-mail (/tickets?id=123) abre o chamado direto
+            const linkedId = parseInt(new URLSearchParams(window.location.search).get('id'));
+            if (linkedId && Array.isArray(ticketsData)) {
+                const linked = ticketsData.find(t => t.id === linkedId);
+                if (linked) setViewTicket(linked);
+            }
             setAssets(Array.isArray(assetsData) ? assetsData : []);
             setCategories(Array.isArray(categoriesData) ? categoriesData : []);
 
@@ -77,7 +128,7 @@ export default function Tickets() {
                 category_id: formData.category_id ? parseInt(formData.category_id) : null,
                 requester_id: formData.requester_id ? parseInt(formData.requester_id) : null,
             };
-            await api.createTicket(payload);
+            await api.createTicket(payload, files);
 
             // Save to history
             if (formData.sector && !sectorHistory.includes(formData.sector)) {
@@ -97,9 +148,10 @@ export default function Tickets() {
 
             setIsModalNewOpen(false);
             setFormData({ title: '', description: '', priority: 'Media', asset_id: '', category_id: '', sector: '', patrimony: '' });
+            setFiles([]);
             loadData();
         } catch (error) {
-            alert('Erro ao criar chamado');
+            alert(error.message || 'Erro ao criar chamado');
         }
     };
 
@@ -265,6 +317,17 @@ export default function Tickets() {
                                 ></textarea>
                             </div>
 
+                            <div>
+                                <label className="block text-sm font-medium text-slate-700 dark:text-slate-300 mb-1">Anexos (Opcional)</label>
+                                <input
+                                    type="file"
+                                    multiple
+                                    onChange={e => setFiles(Array.from(e.target.files))}
+                                    className="w-full text-sm text-slate-600 dark:text-slate-400 file:mr-3 file:px-3 file:py-1.5 file:rounded-lg file:border-0 file:bg-indigo-50 file:text-indigo-700 hover:file:bg-indigo-100"
+                                />
+                                <p className="text-xs text-slate-500 mt-1">Prints da tela de erro, PDFs ou documentos.</p>
+                            </div>
+
                             <div className="grid grid-cols-2 gap-4">
                                 <div>
                                     <label className="block text-sm font-medium text-slate-700 dark:text-slate-300 mb-1">Prioridade</label>
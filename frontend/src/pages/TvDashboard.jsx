@@ -30,35 +30,51 @@ export default function TvDashboard() {
         return () => clearInterval(timer);
     }, []);
 
-    // Auto Refresh dos dados (30s)
+    // Indicadores chegam pelo stream de eventos (kpi_changed); o aviso do sistema é consultado a cada minuto
     useEffect(() => {
         loadData();
-        const interval = setInterval(loadData, 30000);
-        return () => clearInterval(interval);
+        const unsubscribe = api.subscribeEvents((type, data) => {
+            if (type === 'kpi_changed') applyKPIs(data);
+            if (type === 'reconnected') loadData();
+        });
+        const interval = setInterval(loadNotice, 60000);
+        return () => {
+            unsubscribe();
+            clearInterval(interval);
+        };
     }, []);
 
-    const loadData = async () => {
-        try {
-            const data = await api.getDashboardKPIs();
-            if (data && data.stats) {
-                setStats({
-                    open: data.stats.open,
-                    critical: data.stats.critical,
-                    today: data.stats.today,
-                    slaBreach: data.stats.sla_breach
-                });
-            }
-            if (data && data.critical_tickets) {
-                setCriticalTickets(data.critical_tickets);
-            }
+    const applyKPIs = (data) => {
+        if (data && data.stats) {
+            setStats({
+                open: data.stats.open,
+                critical: data.stats.critical,
+                today: data.stats.today,
+                slaBreach: data.stats.sla_breach
+            });
+        }
+        if (data && data.critical_tickets) {
+            setCriticalTickets(data.critical_tickets);
+        }
+    };
 
+    const loadNotice = async () => {
+        try {
             const settingsData = await api.getSettings();
             const notice = settingsData.find(s => s.key === 'system_notice')?.value;
             setSystemNotice(notice);
+        } catch (e) {
+            console.error("Erro dashboard TV", e);
+        }
+    };
 
+    const loadData = async () => {
+        try {
+            applyKPIs(await api.getDashboardKPIs());
         } catch (e) {
             console.error("Erro dashboard TV", e);
         }
+        loadNotice();
     };
 
     const isSystemHealthy = stats.critical === 0 && stats.slaBreach === 0;
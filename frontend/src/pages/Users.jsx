@@ -1,17 +1,19 @@
 import React, { useEffect, useState } from 'react';
-import { Plus, Search, User, Trash2, Edit2, Shield, ShieldCheck, Users as UsersIcon, Download } from 'lucide-react';
+import { Plus, Search, User, UserX, UserCheck, Eye, Edit2, Shield, ShieldCheck, Users as UsersIcon, Download } from 'lucide-react';
 import { api } from '../services/api';
 
 export default function Users() {
     const [users, setUsers] = useState([]);
     const [loading, setLoading] = useState(true);
     const [isModalOpen, setIsModalOpen] = useState(false);
+    const [roles, setRoles] = useState([]);
 
     // Form State
     const [formData, setFormData] = useState({
         id: null,
         username: '',
         password: '',
+        email: '',
         role: 'Tech' // Admin, Tech
     });
     const [isEditing, setIsEditing] = useState(false);
@@ -30,6 +32,7 @@ export default function Users() {
 
     useEffect(() => {
         loadData();
+        api.getRoles().then(data => setRoles(Array.isArray(data) ? data : [])).catch(() => {});
     }, []);
 
     const handleSubmit = async (e) => {
@@ -39,6 +42,7 @@ export default function Users() {
                 // Update
                 const payload = { role: formData.role };
                 if (formData.password) payload.password = formData.password;
+                if (formData.email) payload.email = formData.email;
                 await api.updateUser(formData.id, payload);
             } else {
                 // Create
@@ -52,14 +56,61 @@ export default function Users() {
         }
     };
 
-    const handleDelete = async (id) => {
-        if (window.confirm('Tem certeza que deseja excluir este usuário?')) {
-            try {
-                await api.deleteUser(id);
-                loadData();
-            } catch (error) {
-                alert('Erro ao excluir: ' + error.message);
+    // Desativação guiada: mostra os chamados abertos e pergunta para quem redistribuí-los
+    const handleDeactivate = async (user) => {
+        try {
+            const work = await api.getUserOpenWork(user.id);
+            let reassignTo = null;
+            if (work.tickets.length > 0 || work.categories.length > 0) {
+                const options = work.candidates.map(c => `${c.id} - ${c.full_name || c.username}`).join('\n');
+                const answer = window.prompt(
+                    `${user.username} tem ${work.tickets.length} chamado(s) aberto(s) e é responsável em ${work.categories.length} categoria(s).\n` +
+                    `Informe o ID do novo responsável (vazio = devolver os chamados à fila):\n\n${options}`
+                );
+                if (answer === null) return;
+                reassignTo = answer.trim() ? Number(answer) : null;
+            } else if (!window.confirm(`Desativar ${user.username}? O histórico dos chamados é preservado.`)) {
+                return;
+            }
+
+            const reason = window.prompt('Motivo da desativação (opcional):') || '';
+            await api.deactivateUser(user.id, { reason, reassign_to_id: reassignTo });
+            if (reassignTo === null && work.tickets.length > 0) {
+                await api.reassignUserTickets(user.id, { to_user_id: null });
             }
+            loadData();
+        } catch (error) {
+            alert('Erro ao desativar: ' + error.message);
+        }
+    };
+
+    // "Ver como": guarda a sessão do administrador e entra com o token de personificação
+    const handleImpersonate = async (user) => {
+        const reason = window.prompt(`Motivo para ver o sistema como ${user.username} (ex: nº do chamado):`);
+        if (!reason) return;
+        try {
+            const res = await api.startImpersonation(user.id, { reason });
+            localStorage.setItem('impersonator_session', JSON.stringify({
+                token: localStorage.getItem('token'),
+                refresh_token: localStorage.getItem('refresh_token'),
+                user: localStorage.getItem('user'),
+            }));
+            localStorage.setItem('token', res.token);
+            localStorage.setItem('refresh_token', res.refresh_token);
+            localStorage.setItem('user', JSON.stringify(res.user));
+            localStorage.setItem('impersonation', JSON.stringify(res.impersonation));
+            window.location.href = res.user.role === 'User' ? '/tickets' : '/';
+        } catch (error) {
+            alert('Erro ao personificar: ' + error.message);
+        }
+    };
+
+    const handleReactivate = async (user) => {
+        try {
+            await api.reactivateUser(user.id);
+            loadData();
+        } catch (error) {
+            alert('Erro ao reativar: ' + error.message);
         }
     };
 
@@ -68,6 +119,7 @@ export default function Users() {
             id: user.id,
             username: user.username,
             password: '', // Não mostrar a senha hashada, apenas permitir redefinir
+            email: user.email || '',
             role: user.role
         });
         setIsEditing(true);
@@ -75,7 +127,7 @@ export default function Users() {
     };
 
     const resetForm = () => {
-        setFormData({ id: null, username: '', password: '', role: 'Tech' });
+        setFormData({ id: null, username: '', password: '', email: '', role: 'Tech' });
         setIsEditing(false);
     };
 
@@ -101,7 +153,14 @@ export default function Users() {
         try {
             setLoading(true); // Reusing loading state if available or local
             const res = await api.importUsers(formData);
-            alert(`Importação concluída: ${res.success} sucessos, ${res.errors} erros.`);
+            let message = `Importação concluída: ${res.success} sucessos, ${res.errors} erros.`;
+            if (res.failures?.length) {
+                message += '\n\n' + res.failures.slice(0, 10)
+                    .map(f => `Linha ${f.line}${f.username ? ` (${f.username})` : ''}: ${f.error}`)
+                    .join('\n');
+                if (res.failures.length > 10) message += `\n... e mais ${res.failures.length - 10}`;
+            }
+            alert(message);
             loadData(); // Changed from loadUsers() to loadData() to match existing function name
         } catch (error) {
             alert('Erro na importação: ' + error.message);
@@ -132,7 +191,7 @@ export default function Users() {
                     </label>
                     <button
                         onClick={() => {
-                            setFormData({ id: null, username: '', password: '', role: 'Tech' });
+                            setFormData({ id: null, username: '', password: '', email: '', role: 'Tech' });
                             setIsModalOpen(true);
                         }}
                         className="bg-indigo-600 hover:bg-indigo-700 text-white px-4 py-2 rounded-lg flex items-center gap-2 transition shadow-lg shadow-indigo-500/30"
@@ -164,7 +223,10 @@ export default function Users() {
                                             <div className="p-2 bg-slate-100 dark:bg-slate-800 rounded-lg text-slate-500">
                                                 <User className="w-5 h-5" />
                                             </div>
-                                            <span className="font-medium text-slate-800 dark:text-slate-200">{user.username}</span>
+                                            <span className={`font-medium ${user.active ? 'text-slate-800 dark:text-slate-200' : 'text-slate-400 line-through'}`}>{user.username}</span>
+                                            {!user.active && (
+                                                <span title={user.deactivation_reason} className="px-2 py-0.5 rounded-full text-xs bg-slate-100 dark:bg-slate-800 text-slate-500">Desativado</span>
+                                            )}
                                         </div>
                                     </td>
                                     <td className="px-6 py-4">
@@ -187,13 +249,33 @@ export default function Users() {
                                             >
                                                 <Edit2 className="w-4 h-4" />
                                             </button>
+                                            {user.active && user.role !== 'Admin' && (
                                             <button
-                                                onClick={() => handleDelete(user.id)}
+                                                onClick={() => handleImpersonate(user)}
+                                                title="Ver como este usuário"
+                                                className="p-2 hover:bg-amber-50 dark:hover:bg-slate-800 rounded-lg text-slate-400 hover:text-amber-600 transition"
+                                            >
+                                                <Eye className="w-4 h-4" />
+                                            </button>
+                                            )}
+                                            {user.active ? (
+                                            <button
+                                                onClick={() => handleDeactivate(user)}
+                                                title="Desativar"
                                                 className="p-2 hover:bg-red-50 dark:hover:bg-slate-800 rounded-lg text-slate-400 hover:text-red-600 transition"
                                                 disabled={user.username === 'admin'}
                                             >
-                                                <Trash2 className="w-4 h-4" />
+                                                <UserX className="w-4 h-4" />
+                                            </button>
+                                            ) : (
+                                            <button
+                                                onClick={() => handleReactivate(user)}
+                                                title="Reativar"
+                                                className="p-2 hover:bg-green-50 dark:hover:bg-slate-800 rounded-lg text-slate-400 hover:text-green-600 transition"
+                                            >
+                                                <UserCheck className="w-4 h-4" />
                                             </button>
+                                            )}
                                         </div>
                                     </td>
                                 </tr>
@@ -235,6 +317,16 @@ export default function Users() {
                                     className="w-full px-3 py-2 bg-slate-50 dark:bg-slate-900 border border-slate-200 dark:border-slate-800 rounded-lg outline-none focus:ring-2 focus:ring-indigo-500 dark:text-white"
                                 />
                             </div>
+                            <div>
+                                <label className="block text-sm font-medium text-slate-700 dark:text-slate-300 mb-1">E-mail</label>
+                                <input
+                                    type="email"
+                                    value={formData.email}
+                                    onChange={e => setFormData({ ...formData, email: e.target.value })}
+                                    className="w-full px-3 py-2 bg-slate-50 dark:bg-slate-900 border border-slate-200 dark:border-slate-800 rounded-lg outline-none focus:ring-2 focus:ring-indigo-500 dark:text-white"
+                                    placeholder="usado na recuperação de senha"
+                                />
+                            </div>
                             <div>
                                 <label className="block text-sm font-medium text-slate-700 dark:text-slate-300 mb-1">Permissão</label>
                                 <select
@@ -242,9 +334,9 @@ export default function Users() {
                                     onChange={e => setFormData({ ...formData, role: e.target.value })}
                                     className="w-full px-3 py-2 bg-slate-50 dark:bg-slate-900 border border-slate-200 dark:border-slate-800 rounded-lg outline-none focus:ring-2 focus:ring-indigo-500 dark:text-white"
                                 >
-                                    <option value="Tech">Técnico (Tech)</option>
-                                    <option value="Admin">Administrador (Admin)</option>
-                                    <option value="User">Usuário Final (User)</option>
+                                    {roles.map(r => (
+                                        <option key={r.id} value={r.name}>{r.description && !r.system ? `${r.name} - ${r.description}` : r.name}</option>
+                                    ))}
                                 </select>
                             </div>
 
@@ -9,18 +9,53 @@ const getHeaders = () => {
     };
 };
 
-const request = async (endpoint, options = {}) => {
-    const res = await fetch(`${API_URL}${endpoint}`, {
-        ...options,
-        headers: {
-            ...getHeaders(),
-            ...options.headers,
-        },
-    });
+// Renova o access token usando o refresh token (sessão no servidor)
+let refreshPromise = null;
+const refreshSession = async () => {
+    const refreshToken = localStorage.getItem('refresh_token');
+    if (!refreshToken) return false;
+
+    if (!refreshPromise) {
+        refreshPromise = fetch(`${API_URL}/auth/refresh`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ refresh_token: refreshToken })
+        }).then(async (res) => {
+            if (!res.ok) return false;
+            const data = await res.json();
+            localStorage.setItem('token', data.token);
+            localStorage.setItem('refresh_token', data.refresh_token);
+            return true;
+        }).catch(() => false).finally(() => { refreshPromise = null; });
+    }
+    return refreshPromise;
+};
+
+const request = async (endpoint, options = {}, retried = false) => {
+    const headers = { ...getHeaders(), ...options.headers };
+    // Upload (FormData): o navegador define o Content-Type com o boundary
+    if (options.body instanceof FormData) delete headers['Content-Type'];
+    const res = await fetch(`${API_URL}${endpoint}`, { ...options, headers });
 
     if (res.status === 401) {
-        // Token expirado ou invalido
+        // Access token expirado: tentar renovar uma vez antes de deslogar
+        if (!retried && await refreshSession()) {
+            return request(endpoint, options, true);
+        }
+        // Personificação expirada: voltar à sessão do administrador
+        const original = localStorage.getItem('impersonator_session');
+        if (original) {
+            const session = JSON.parse(original);
+            localStorage.removeItem('impersonation');
+            localStorage.removeItem('impersonator_session');
+            localStorage.setItem('token', session.token || '');
+            localStorage.setItem('refresh_token', session.refresh_token || '');
+            localStorage.setItem('user', session.user || '{}');
+            window.location.href = '/users';
+            throw new Error('Unauthorized');
+        }
         localStorage.removeItem('token');
+        localStorage.removeItem('refresh_token');
         window.location.href = '/login';
         throw new Error('Unauthorized');
     }
@@ -30,7 +65,77 @@ const request = async (endpoint, options = {}) => {
         throw new Error(errorBody.error || 'API Error');
     }
 
-    return res.json();
+    return options.blob ? res.blob() : res.json();
+};
+
+// Monta o corpo multipart com os campos e os anexos (campo "files")
+const formWithFiles = (data, files) => {
+    const form = new FormData();
+    Object.entries(data).forEach(([key, value]) => {
+        if (value !== null && value !== undefined && value !== '') form.append(key, value);
+    });
+    files.forEach(file => form.append('files', file));
+    return form;
+};
+
+// Eventos em tempo real (SSE em /events). Usa fetch em vez de EventSource para enviar o token
+// no cabeçalho. Reconecta sozinho e, depois de uma reconexão, emite "reconnected" para a tela
+// recarregar o que pode ter perdido. Devolve a função que encerra a conexão.
+const subscribeEvents = (onEvent) => {
+    let controller = null;
+    let retryTimer = null;
+    let stopped = false;
+    let connectedOnce = false;
+
+    const dispatch = (block) => {
+        let type = 'message';
+        let data = '';
+        block.split('\n').forEach(line => {
+            if (line.startsWith('event: ')) type = line.slice(7);
+            else if (line.startsWith('data: ')) data += line.slice(6);
+        });
+        if (!data) return; // Comentários (": ping") mantêm a conexão viva
+        if (type === 'ready') {
+            if (connectedOnce) onEvent('reconnected', {});
+            connectedOnce = true;
+            return;
+        }
+        onEvent(type, JSON.parse(data));
+    };
+
+    const connect = async () => {
+        controller = new AbortController();
+        try {
+            const res = await fetch(`${API_URL}/events`, { headers: getHeaders(), signal: controller.signal });
+            // Token expirado: renova e tenta de novo; sem sessão, para (o próximo request leva ao login)
+            if (res.status === 401 && !await refreshSession()) return;
+            if (res.ok && res.body) {
+                const reader = res.body.getReader();
+                const decoder = new TextDecoder();
+                let buffer = '';
+                for (;;) {
+                    const { done, value } = await reader.read();
+                    if (done) break;
+                    buffer += decoder.decode(value, { stream: true });
+                    let end;
+                    while ((end = buffer.indexOf('\n\n')) >= 0) {
+                        dispatch(buffer.slice(0, end));
+                        buffer = buffer.slice(end + 2);
+                    }
+                }
+            }
+        } catch (e) {
+            if (stopped) return;
+        }
+        if (!stopped) retryTimer = setTimeout(connect, 5000);
+    };
+
+    connect();
+    return () => {
+        stopped = true;
+        clearTimeout(retryTimer);
+        if (controller) controller.abort();
+    };
 };
 
 export const api = {
@@ -42,6 +147,39 @@ export const api = {
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify(credentials)
         });
+        if (!res.ok) {
+            const errorBody = await res.json().catch(() => ({}));
+            throw new Error(res.status === 429 ? errorBody.error : 'Login failed');
+        }
+        return res.json();
+    },
+    loginSecondFactor: async (payload) => {
+        const res = await fetch(`${API_URL}/login/2fa`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(payload)
+        });
+        if (!res.ok) {
+            const errorBody = await res.json().catch(() => ({}));
+            throw new Error(res.status === 429 ? errorBody.error : 'Login failed');
+        }
+        return res.json();
+    },
+    logout: () => request('/logout', { method: 'POST' }),
+    changePassword: (data) => request('/auth/change-password', { method: 'POST', body: JSON.stringify(data) }),
+    requestPasswordReset: (data) => request('/auth/password-reset/request', { method: 'POST', body: JSON.stringify(data) }),
+    confirmPasswordReset: (data) => request('/auth/password-reset/confirm', { method: 'POST', body: JSON.stringify(data) }),
+    getOIDCConfig: async () => {
+        const res = await fetch(`${API_URL}/auth/oidc/config`);
+        return res.ok ? res.json() : { enabled: false };
+    },
+    // Login SSO: o retorno do provedor traz um refresh token, trocado aqui pelo access token
+    completeOIDCLogin: async (refreshToken) => {
+        const res = await fetch(`${API_URL}/auth/refresh`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ refresh_token: refreshToken })
+        });
         if (!res.ok) throw new Error('Login failed');
         return res.json();
     },
@@ -55,6 +193,8 @@ export const api = {
 
     // Tickets
     getTickets: () => request('/tickets'),
+    subscribeEvents,
+    getTicket: (id) => request(`/tickets/${id}`),
     getCategories: () => request('/categories'),
     createCategory: (data) => request('/categories/', { method: 'POST', body: JSON.stringify(data) }),
     updateCategory: (id, data) => request(`/categories/${id}`, { method: 'PUT', body: JSON.stringify(data) }),
@@ -63,6 +203,28 @@ export const api = {
     // Settings
     getSettings: () => request('/settings'),
     updateSetting: (key, value) => request(`/settings/${key}`, { method: 'PUT', body: JSON.stringify({ value }) }),
+    getNotificationTemplates: () => request('/notification-templates'),
+    updateNotificationTemplate: (kind, data) => request(`/notification-templates/${kind}`, { method: 'PUT', body: JSON.stringify(data) }),
+    resetNotificationTemplate: (kind) => request(`/notification-templates/${kind}`, { method: 'DELETE' }),
+    getEmailOutbox: (status) => request(`/email-outbox${status ? `?status=${status}` : ''}`),
+    retryEmailOutbox: (id) => request(`/email-outbox/${id}/retry`, { method: 'POST' }),
+    getWebhooks: () => request('/webhooks'),
+    createWebhook: (data) => request('/webhooks', { method: 'POST', body: JSON.stringify(data) }),
+    updateWebhook: (id, data) => request(`/webhooks/${id}`, { method: 'PUT', body: JSON.stringify(data) }),
+    deleteWebhook: (id) => request(`/webhooks/${id}`, { method: 'DELETE' }),
+    testWebhook: (id) => request(`/webhooks/${id}/test`, { method: 'POST' }),
+    getWebhookDeliveries: (webhookId) => request(`/webhook-deliveries${webhookId ? `?webhook_id=${webhookId}` : ''}`),
+    redeliverWebhook: (id) => request(`/webhook-deliveries/${id}/redeliver`, { method: 'POST' }),
+    getMailIntakeLog: (result) => request(`/mail-intake/log${result ? `?result=${result}` : ''}`),
+    runMailIntake: () => request('/mail-intake/run', { method: 'POST' }),
+    getNotificationPreferences: () => request('/auth/notification-preferences'),
+    updateNotificationPreferences: (prefs) => request('/auth/notification-preferences', { method: 'PUT', body: JSON.stringify(prefs) }),
+
+    // Notificações no sistema
+    getNotifications: (unreadOnly) => request(`/notifications${unreadOnly ? '?unread=true' : ''}`),
+    getUnreadNotificationCount: () => request('/notifications/unread-count'),
+    markNotificationRead: (id) => request(`/notifications/${id}/read`, { method: 'POST' }),
+    markAllNotificationsRead: () => request('/notifications/read-all', { method: 'POST' }),
 
     // Audit/Dashboard
     getAuditLogs: (filters) => {
@@ -71,10 +233,29 @@ export const api = {
     },
     getDashboardKPIs: () => request('/dashboard/kpis'),
 
-    createTicket: (data) => request('/tickets', { method: 'POST', body: JSON.stringify(data) }),
-    updateTicketStatus: (id, status) => request(`/tickets/${id}/status`, { method: 'PATCH', body: JSON.stringify({ status }) }),
+    createTicket: (data, files = []) => request('/tickets', { method: 'POST', body: files.length ? formWithFiles(data, files) : JSON.stringify(data) }),
+    updateTicketStatus: (id, status, fields = {}) => request(`/tickets/${id}/status`, { method: 'PATCH', body: JSON.stringify({ status, ...fields }) }),
+    getTicketTransitions: (id) => request(`/tickets/${id}/transitions`),
+    getTicketTimeline: (id) => request(`/tickets/${id}/timeline`),
+    updateTicket: (id, data) => request(`/tickets/${id}`, { method: 'PATCH', body: JSON.stringify(data) }),
+    getWorkflow: () => request('/workflow'),
+    updateWorkflow: (data) => request('/workflow', { method: 'PUT', body: JSON.stringify(data) }),
     assignTicket: (id, techId) => request(`/tickets/${id}/assign`, { method: 'PATCH', body: JSON.stringify({ assigned_to_id: parseInt(techId) }) }),
-    addTicketComment: (id, content) => request(`/tickets/${id}/comments`, { method: 'POST', body: JSON.stringify({ content }) }),
+    addTicketComment: (id, content, files = [], internal = false) => request(`/tickets/${id}/comments`, { method: 'POST', body: files.length ? formWithFiles({ content, internal }, files) : JSON.stringify({ content, internal }) }),
+    updateComment: (id, content) => request(`/comments/${id}`, { method: 'PATCH', body: JSON.stringify({ content }) }),
+    deleteComment: (id) => request(`/comments/${id}`, { method: 'DELETE' }),
+    getCommentRevisions: (id) => request(`/comments/${id}/revisions`),
+    getTicketAttachments: (id) => request(`/tickets/${id}/attachments`),
+    downloadAttachment: (id) => request(`/attachments/${id}`, { blob: true }),
+    deleteAttachment: (id) => request(`/attachments/${id}`, { method: 'DELETE' }),
+    getTicketWatchers: (id) => request(`/tickets/${id}/watchers`),
+    watchTicket: (id) => request(`/tickets/${id}/watch`, { method: 'POST' }),
+    unwatchTicket: (id) => request(`/tickets/${id}/watch`, { method: 'DELETE' }),
+    addTicketWatcher: (id, userId) => request(`/tickets/${id}/watchers`, {
+        method: 'POST',
+        body: JSON.stringify({ user_id: parseInt(userId) })
+    }),
+    removeTicketWatcher: (id, userId) => request(`/tickets/${id}/watchers/${userId}`, { method: 'DELETE' }),
     getReports: (techId) => request(`/reports${techId ? `?tech_id=${techId}` : ''}`),
 
     // Users
@@ -82,11 +263,18 @@ export const api = {
     getUsersList: () => request('/users/list'), // Tech Access
     getTechs: () => request('/users/techs'),
     getUser: (id) => request(`/users/${id}`),
+    getRoles: () => request('/roles'),
     createUser: (data) => request('/users', { method: 'POST', body: JSON.stringify(data) }),
     updateUser: (id, data) => request(`/users/${id}`, { method: 'PUT', body: JSON.stringify(data) }),
     deleteUser: async (id) => {
         return request(`/users/${id}`, { method: 'DELETE' });
     },
+    getUserOpenWork: (id) => request(`/users/${id}/open-work`),
+    deactivateUser: (id, data) => request(`/users/${id}/deactivate`, { method: 'POST', body: JSON.stringify(data) }),
+    reactivateUser: (id) => request(`/users/${id}/reactivate`, { method: 'POST' }),
+    startImpersonation: (id, data) => request(`/users/${id}/impersonate`, { method: 'POST', body: JSON.stringify(data) }),
+    stopImpersonation: () => request('/impersonation/stop', { method: 'POST' }),
+    reassignUserTickets: (id, data) => request(`/users/${id}/reassign`, { method: 'POST', body: JSON.stringify(data) }),
 
     // Import
     importAssets: async (formData) => {
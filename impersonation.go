@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==========================================
+// PERSONIFICAÇÃO ("Ver como usuário")
+// ==========================================
+//
+// Um administrador (user.impersonate) abre uma sessão temporária como outro
+// usuário para reproduzir o que ele vê. A sessão guarda as duas identidades,
+// não é prorrogada pelo refresh e cada requisição feita nela é registrada na
+// auditoria com o administrador como autor. Toda resposta traz o cabeçalho
+// X-Impersonated-By, usado pelo frontend para exibir o aviso de personificação.
+
+const impersonationHeader = "X-Impersonated-By"
+
+// impersonationInfo descreve a personificação para o aviso no frontend (nil fora dela)
+func impersonationInfo(session *UserSession) gin.H {
+	if session == nil || session.ImpersonatorID == nil {
+		return nil
+	}
+	info := gin.H{
+		"active":          true,
+		"impersonator_id": *session.ImpersonatorID,
+		"expires_at":      session.ExpiresAt,
+		"reason":          session.ImpersonationReason,
+	}
+	if session.Impersonator != nil {
+		info["impersonator"] = session.Impersonator.Username
+	}
+	if session.User != nil {
+		info["user"] = session.User.Username
+	}
+	return info
+}
+
+// serveImpersonatedRequest conclui o AuthMiddleware para sessões de personificação
+func serveImpersonatedRequest(c *gin.Context, session *UserSession) {
+	c.Set("userID", session.UserID)
+	c.Set("role", session.User.Role)
+	c.Set("sessionID", session.ID)
+	c.Set("impersonatorID", *session.ImpersonatorID)
+	c.Header(impersonationHeader, session.Impersonator.Username)
+	c.Header("X-Impersonation-Expires", session.ExpiresAt.Format(time.RFC3339))
+
+	// Registrada ao final, inclusive quando bloqueada
+	defer func() {
+		logRequestAction(c, "IMPERSONATED_REQUEST", "Session", session.ID,
+			fmt.Sprintf("Como %s: %s %s -> %d", session.User.Username, c.Request.Method, c.Request.URL.RequestURI(), c.Writer.Status()))
+	}()
+
+	// Credenciais do usuário (senha, 2FA, tokens) não são acessíveis ao administrador
+	if strings.HasPrefix(c.FullPath(), "/api/v1/auth/") {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Indisponível durante a personificação"})
+		return
+	}
+
+	c.Next()
+}
+
+// StartImpersonation abre uma sessão temporária como outro usuário
+func StartImpersonation(c *gin.Context) {
+	var input struct {
+		Reason  string `json:"reason" binding:"required"` // Ex: número do chamado que motivou
+		Minutes int    `json:"minutes"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Informe o motivo da personificação"})
+		return
+	}
+
+	if c.GetUint("impersonatorID") > 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Encerre a personificação atual antes de iniciar outra"})
+		return
+	}
+	if _, ok := c.Get("apiTokenID"); ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Personificação exige login interativo"})
+		return
+	}
+
+	var admin User
+	if err := db.First(&admin, getCurrentUserID(c)).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuário não encontrado"})
+		return
+	}
+	var target User
+	if err := db.First(&target, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+		return
+	}
+	if target.ID == admin.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Não é possível personificar a si mesmo"})
+		return
+	}
+	if !target.Active {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Usuário desativado"})
+		return
+	}
+	if roleHasPermission(target.Role, "user.impersonate") || !canManageRole(c, target.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Não é permitido personificar outro administrador ou um perfil com permissões que você não possui"})
+		return
+	}
+
+	maxMinutes := getSettingInt("impersonation_max_minutes", 30)
+	if input.Minutes <= 0 || input.Minutes > maxMinutes {
+		input.Minutes = maxMinutes
+	}
+
+	session, refreshToken, err := createSession(c, target)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar sessão"})
+		return
+	}
+	session.ImpersonatorID = &admin.ID
+	session.Impersonator = &admin
+	session.User = &target
+	session.ImpersonationReason = input.Reason
+	session.ExpiresAt = time.Now().Add(time.Duration(input.Minutes) * time.Minute)
+	if err := db.Save(&session).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar sessão"})
+		return
+	}
+
+	token, err := issueAccessToken(target, session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gerar token"})
+		return
+	}
+
+	logAction(admin.ID, "IMPERSONATE_START", "User", target.ID,
+		fmt.Sprintf("%s iniciou personificação de %s por %d min. Motivo: %s", admin.Username, target.Username, input.Minutes, input.Reason))
+	c.JSON(http.StatusOK, gin.H{
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int(accessTokenTTL.Seconds()),
+		"user":          target,
+		"permissions":   permissionsForRole(target.Role),
+		"impersonation": impersonationInfo(&session),
+	})
+}
+
+// GetImpersonationStatus informa se a sessão atual é uma personificação
+func GetImpersonationStatus(c *gin.Context) {
+	if c.GetUint("impersonatorID") == 0 {
+		c.JSON(http.StatusOK, gin.H{"active": false})
+		return
+	}
+	session, err := loadActiveSession(c.GetUint("sessionID"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sessão expirada ou revogada"})
+		return
+	}
+	c.JSON(http.StatusOK, impersonationInfo(session))
+}
+
+// StopImpersonation encerra a sessão de personificação atual
+func StopImpersonation(c *gin.Context) {
+	if c.GetUint("impersonatorID") == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A sessão atual não é uma personificação"})
+		return
+	}
+	db.Model(&UserSession{}).Where("id = ? AND revoked_at IS NULL", c.GetUint("sessionID")).Update("revoked_at", time.Now())
+
+	logRequestAction(c, "IMPERSONATE_STOP", "User", getCurrentUserID(c), "Personificação encerrada")
+	c.JSON(http.StatusOK, gin.H{"message": "Personificação encerrada"})
+}
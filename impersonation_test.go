@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestImpersonationCannotChangeCredentials(t *testing.T) {
+	setupTestDB(t)
+	admin := createTestUser(t, "admin", "Admin", "admin@camara.local")
+	target := createTestUser(t, "joana", "User", "joana@camara.local")
+
+	// Sessão de personificação: o userID é o do usuário personificado
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("userID", target.ID)
+		c.Set("role", target.Role)
+		c.Set("impersonatorID", admin.ID)
+	})
+	r.PUT("/users/:id", UpdateUser)
+	update := func(body string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, fmt.Sprintf("/users/%d", target.ID), strings.NewReader(body)))
+		return w.Code
+	}
+
+	if code := update(`{"password":"Nova@Senha456"}`); code != http.StatusForbidden {
+		t.Errorf("troca de senha na personificação: status %d", code)
+	}
+	if code := update(`{"email":"admin-pessoal@example.com"}`); code != http.StatusForbidden {
+		t.Errorf("troca de e-mail na personificação: status %d", code)
+	}
+	if code := update(`{"full_name":"Joana Souza"}`); code != http.StatusOK {
+		t.Errorf("edição do nome na personificação: status %d", code)
+	}
+
+	var stored User
+	db.First(&stored, target.ID)
+	if stored.Email != "joana@camara.local" || bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte("Senha@Teste123")) != nil {
+		t.Errorf("credenciais alteradas durante a personificação: %+v", stored)
+	}
+	if stored.FullName != "Joana Souza" {
+		t.Errorf("nome = %q", stored.FullName)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ==========================================
+// CHAVES DE ASSINATURA JWT (kid + Rotação)
+// ==========================================
+//
+// Origem das chaves (em ordem de precedência para a chave ativa):
+//   1. Arquivo JSON em JWT_KEYS_FILE: {"active": "k2", "keys": {"k1": "segredo1", "k2": "segredo2"}}
+//   2. Variável de ambiente JWT_SECRET (kid definido por JWT_KEY_ID, padrão "env")
+//   3. Sem configuração: chave aleatória no banco, rotacionável pelo painel
+//
+// Com chaves configuradas, a rotação é feita no arquivo/ambiente; chaves do banco
+// que estavam ativas são aposentadas no carregamento. Chaves aposentadas continuam
+// válidas para verificação durante jwtKeyGracePeriod, então uma rotação não derruba
+// ninguém (o refresh token é opaco e não depende da chave).
+
+const jwtKeyGracePeriod = 2 * accessTokenTTL
+
+// SigningKey é uma chave HMAC persistida no banco (gerada por rotação)
+type SigningKey struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	Kid       string     `gorm:"uniqueIndex;not null" json:"kid"`
+	Secret    string     `gorm:"not null" json:"-"`
+	Active    bool       `json:"active"`
+	RetiredAt *time.Time `json:"retired_at"`
+}
+
+type jwtKey struct {
+	Kid       string     `json:"kid"`
+	Source    string     `json:"source"` // database, file, env
+	Active    bool       `json:"active"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+	secret    []byte
+}
+
+var (
+	jwtKeys     = map[string]*jwtKey{}
+	jwtActiveID string
+	jwtKeysMu   sync.RWMutex
+)
+
+// loadSigningKeys (re)carrega o chaveiro a partir do arquivo, ambiente e banco
+func loadSigningKeys() error {
+	keys := map[string]*jwtKey{}
+	active := ""
+
+	// 2. Variável de ambiente
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		kid := os.Getenv("JWT_KEY_ID")
+		if kid == "" {
+			kid = "env"
+		}
+		keys[kid] = &jwtKey{Kid: kid, Source: "env", secret: []byte(secret)}
+		active = kid
+	}
+
+	// 1. Arquivo de chaves
+	if path := os.Getenv("JWT_KEYS_FILE"); path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("falha ao ler JWT_KEYS_FILE: %w", err)
+		}
+		var file struct {
+			Active string            `json:"active"`
+			Keys   map[string]string `json:"keys"`
+		}
+		if err := json.Unmarshal(raw, &file); err != nil {
+			return fmt.Errorf("JWT_KEYS_FILE inválido: %w", err)
+		}
+		for kid, secret := range file.Keys {
+			keys[kid] = &jwtKey{Kid: kid, Source: "file", secret: []byte(secret)}
+		}
+		if file.Active != "" {
+			if _, ok := keys[file.Active]; !ok {
+				return fmt.Errorf("JWT_KEYS_FILE: chave ativa '%s' não encontrada", file.Active)
+			}
+			active = file.Active
+		} else if active == "" && len(file.Keys) > 0 {
+			return fmt.Errorf("JWT_KEYS_FILE: informe a chave ativa em \"active\"")
+		}
+	}
+
+	// 3. Chaves do banco (rotação pelo painel)
+	var stored []SigningKey
+	db.Where("retired_at IS NULL OR retired_at > ?", time.Now().Add(-jwtKeyGracePeriod)).Find(&stored)
+
+	configured := active != ""
+	if configured {
+		// Chaves configuradas prevalecem: a chave ativa do banco fica só para verificação durante a carência
+		now := time.Now()
+		for i := range stored {
+			if stored[i].Active {
+				stored[i].Active = false
+				stored[i].RetiredAt = &now
+				db.Model(&stored[i]).Updates(map[string]interface{}{"active": false, "retired_at": now})
+				fmt.Printf("[JWT] Chave %s do banco aposentada: usando as chaves de JWT_SECRET/JWT_KEYS_FILE\n", stored[i].Kid)
+			}
+		}
+	} else if len(stored) == 0 {
+		// Nenhuma chave configurada: gerar uma aleatória em vez de usar segredo fixo
+		fmt.Println("[JWT] Nenhuma chave configurada (JWT_SECRET/JWT_KEYS_FILE). Gerando chave aleatória no banco.")
+		key, err := createSigningKey()
+		if err != nil {
+			return err
+		}
+		stored = append(stored, key)
+	}
+
+	for _, k := range stored {
+		if existing, ok := keys[k.Kid]; ok && existing.Source != "database" {
+			continue // O mesmo kid configurado em arquivo/ambiente vale mais que o do banco
+		}
+		createdAt := k.CreatedAt
+		keys[k.Kid] = &jwtKey{Kid: k.Kid, Source: "database", CreatedAt: &createdAt, RetiredAt: k.RetiredAt, secret: []byte(k.Secret)}
+		if k.Active && !configured {
+			active = k.Kid
+		}
+	}
+
+	if active == "" {
+		return fmt.Errorf("nenhuma chave JWT ativa")
+	}
+	keys[active].Active = true
+
+	jwtKeysMu.Lock()
+	jwtKeys = keys
+	jwtActiveID = active
+	jwtKeysMu.Unlock()
+
+	fmt.Printf("[JWT] %d chave(s) carregada(s). Ativa: %s\n", len(keys), active)
+	return nil
+}
+
+// createSigningKey gera e persiste uma nova chave ativa
+func createSigningKey() (SigningKey, error) {
+	secret, err := generateRandomToken(32)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	kid, err := generateRandomToken(8)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	key := SigningKey{Kid: kid, Secret: secret, Active: true}
+	if err := db.Create(&key).Error; err != nil {
+		return SigningKey{}, err
+	}
+	return key, nil
+}
+
+// signJWT assina as claims com a chave ativa, informando o "kid" no cabeçalho
+func signJWT(claims jwt.MapClaims) (string, error) {
+	jwtKeysMu.RLock()
+	key := jwtKeys[jwtActiveID]
+	jwtKeysMu.RUnlock()
+	if key == nil {
+		return "", fmt.Errorf("nenhuma chave JWT ativa")
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = key.Kid
+	return token.SignedString(key.secret)
+}
+
+// parseJWT valida a assinatura usando a chave indicada pelo "kid"
+func parseJWT(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		jwtKeysMu.RLock()
+		key := jwtKeys[kid]
+		jwtKeysMu.RUnlock()
+
+		if key == nil {
+			return nil, fmt.Errorf("chave '%s' desconhecida", kid)
+		}
+		if key.RetiredAt != nil && time.Since(*key.RetiredAt) > jwtKeyGracePeriod {
+			return nil, fmt.Errorf("chave '%s' aposentada", kid)
+		}
+		return key.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+}
+
+// GetSigningKeys lista as chaves carregadas (sem os segredos)
+func GetSigningKeys(c *gin.Context) {
+	jwtKeysMu.RLock()
+	list := make([]jwtKey, 0, len(jwtKeys))
+	for _, k := range jwtKeys {
+		list = append(list, *k)
+	}
+	jwtKeysMu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Kid < list[j].Kid })
+	c.JSON(http.StatusOK, list)
+}
+
+// RotateSigningKey gera uma nova chave ativa e aposenta a anterior (que segue válida durante o período de carência)
+func RotateSigningKey(c *gin.Context) {
+	if os.Getenv("JWT_SECRET") != "" || os.Getenv("JWT_KEYS_FILE") != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Chaves definidas por JWT_SECRET/JWT_KEYS_FILE: faça a rotação no arquivo de chaves e reinicie o serviço"})
+		return
+	}
+	now := time.Now()
+
+	// Limpar chaves aposentadas cujo período de carência já terminou
+	db.Where("retired_at IS NOT NULL AND retired_at < ?", now.Add(-jwtKeyGracePeriod)).Delete(&SigningKey{})
+
+	if err := db.Model(&SigningKey{}).Where("active = ?", true).Updates(map[string]interface{}{"active": false, "retired_at": now}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao aposentar chave atual"})
+		return
+	}
+
+	jwtKeysMu.RLock()
+	previous := jwtActiveID
+	jwtKeysMu.RUnlock()
+
+	key, err := createSigningKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gerar nova chave"})
+		return
+	}
+
+	if err := loadSigningKeys(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logRequestAction(c, "ROTATE_KEY", "System", 0, fmt.Sprintf("Chave JWT rotacionada: %s -> %s", previous, key.Kid))
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Chave rotacionada. Tokens emitidos com a chave anterior seguem válidos até expirarem.",
+		"kid":          key.Kid,
+		"previous_kid": previous,
+	})
+}
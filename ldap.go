@@ -0,0 +1,484 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ==========================================
+// AUTENTICAÇÃO AD/LDAP
+// ==========================================
+
+const ldapTimeout = 5 * time.Second
+
+// LDAPUser é o resultado de uma autenticação LDAP bem-sucedida
+type LDAPUser struct {
+	Username   string
+	FullName   string
+	Email      string
+	Department string
+	Phone      string
+	DN         string
+	Groups     []string // memberOf
+	Disabled   bool     // userAccountControl com ACCOUNTDISABLE (0x2)
+}
+
+// ldapConfig agrupa as configurações ldap_* do SystemSetting
+type ldapConfig struct {
+	Host         string
+	Port         string
+	Domain       string
+	BaseDN       string
+	TLSMode      string // none, starttls, ldaps
+	CAFile       string
+	BindDN       string // Conta de serviço (opcional)
+	BindPassword string
+	UserFilter   string // Ex: (&(objectClass=user)(sAMAccountName={username})) ou (uid={username}) no OpenLDAP
+}
+
+func loadLDAPConfig() ldapConfig {
+	return ldapConfig{
+		Host:         getSettingValue("ldap_host", ""),
+		Port:         getSettingValue("ldap_port", "389"),
+		Domain:       getSettingValue("ldap_domain", ""),
+		BaseDN:       getSettingValue("ldap_basedn", ""),
+		TLSMode:      strings.ToLower(getSettingValue("ldap_tls_mode", "none")),
+		CAFile:       getSettingValue("ldap_ca_file", ""),
+		BindDN:       getSettingValue("ldap_bind_dn", ""),
+		BindPassword: getSettingValue("ldap_bind_password", ""),
+		UserFilter:   getSettingValue("ldap_user_filter", "(&(objectClass=user)(sAMAccountName={username}))"),
+	}
+}
+
+// ldapStep registra uma etapa da conexão (usado no teste de conexão do painel)
+type ldapStep struct {
+	Step   string `json:"step"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ldapTrace struct {
+	Steps []ldapStep
+}
+
+func (t *ldapTrace) record(step string, err error, detail string) {
+	if err != nil {
+		fmt.Printf("[LDAP] %s falhou: %v\n", step, err)
+	}
+	if t == nil {
+		return
+	}
+	s := ldapStep{Step: step, OK: err == nil, Detail: detail}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	t.Steps = append(t.Steps, s)
+}
+
+// ldapTLSConfig monta a configuração TLS, incluindo o bundle de CA customizado (ldap_ca_file)
+func ldapTLSConfig(cfg ldapConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: cfg.Host, MinVersion: tls.VersionTLS12}
+	if cfg.CAFile == "" {
+		return tlsConfig, nil
+	}
+
+	pem, err := os.ReadFile(cfg.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("falha ao ler bundle de CA (%s): %w", cfg.CAFile, err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("nenhum certificado válido em %s", cfg.CAFile)
+	}
+	tlsConfig.RootCAs = pool
+	return tlsConfig, nil
+}
+
+// dialLDAP conecta ao servidor conforme ldap_tls_mode (none, starttls ou ldaps)
+func dialLDAP(cfg ldapConfig, trace *ldapTrace) (*ldap.Conn, error) {
+	if cfg.Host == "" || cfg.Port == "" {
+		err := fmt.Errorf("LDAP não configurado corretamente (Host/Port vazios)")
+		trace.record("config", err, "")
+		return nil, err
+	}
+
+	var tlsConfig *tls.Config
+	if cfg.TLSMode == "ldaps" || cfg.TLSMode == "starttls" {
+		var err error
+		if tlsConfig, err = ldapTLSConfig(cfg); err != nil {
+			trace.record("tls_config", err, "")
+			return nil, err
+		}
+	} else if cfg.TLSMode != "none" && cfg.TLSMode != "" {
+		err := fmt.Errorf("ldap_tls_mode inválido: %s (use none, starttls ou ldaps)", cfg.TLSMode)
+		trace.record("config", err, "")
+		return nil, err
+	}
+
+	addr := net.JoinHostPort(cfg.Host, cfg.Port)
+	dialer := &net.Dialer{Timeout: ldapTimeout}
+
+	var conn *ldap.Conn
+	var err error
+	if cfg.TLSMode == "ldaps" {
+		conn, err = ldap.DialURL("ldaps://"+addr, ldap.DialWithDialer(dialer), ldap.DialWithTLSConfig(tlsConfig))
+	} else {
+		conn, err = ldap.DialURL("ldap://"+addr, ldap.DialWithDialer(dialer))
+	}
+	trace.record("connect", err, addr)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(ldapTimeout)
+
+	if cfg.TLSMode == "starttls" {
+		err = conn.StartTLS(tlsConfig)
+		trace.record("starttls", err, "")
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// ldapUserAttributes são os atributos lidos do usuário no diretório
+var ldapUserAttributes = []string{"displayName", "cn", "mail", "department", "telephoneNumber", "memberOf", "userAccountControl"}
+
+// ldapEntryToUser converte uma entrada do diretório nos dados usados pelo sistema
+func ldapEntryToUser(entry *ldap.Entry, username string) *LDAPUser {
+	result := &LDAPUser{Username: username, FullName: username}
+	if entry == nil {
+		return result
+	}
+	result.DN = entry.DN
+	result.Email = entry.GetAttributeValue("mail")
+	result.Department = entry.GetAttributeValue("department")
+	result.Phone = entry.GetAttributeValue("telephoneNumber")
+	result.Groups = entry.GetAttributeValues("memberOf")
+	if dn := entry.GetAttributeValue("displayName"); dn != "" {
+		result.FullName = dn
+	} else if cn := entry.GetAttributeValue("cn"); cn != "" {
+		result.FullName = cn
+	}
+	if uac, err := strconv.Atoi(entry.GetAttributeValue("userAccountControl")); err == nil {
+		result.Disabled = uac&0x2 != 0
+	}
+	return result
+}
+
+// searchLDAPUser localiza a entrada do usuário pelo filtro configurado
+func searchLDAPUser(conn *ldap.Conn, cfg ldapConfig, username string) (*ldap.Entry, error) {
+	if cfg.BaseDN == "" {
+		return nil, fmt.Errorf("ldap_basedn não configurado")
+	}
+	filter := strings.ReplaceAll(cfg.UserFilter, "{username}", ldap.EscapeFilter(username))
+	searchReq := ldap.NewSearchRequest(
+		cfg.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(ldapTimeout.Seconds()), false,
+		filter,
+		ldapUserAttributes,
+		nil,
+	)
+
+	sr, err := conn.Search(searchReq)
+	if err != nil {
+		return nil, err
+	}
+	if len(sr.Entries) == 0 {
+		return nil, fmt.Errorf("usuário não encontrado com o filtro %s", filter)
+	}
+	if len(sr.Entries) > 1 {
+		return nil, fmt.Errorf("filtro %s retornou mais de um usuário", filter)
+	}
+	return sr.Entries[0], nil
+}
+
+func authenticateLDAP(username, password string) (*LDAPUser, error) {
+	return authenticateLDAPTrace(loadLDAPConfig(), username, password, nil)
+}
+
+// authenticateLDAPTrace autentica o usuário registrando cada etapa em trace (pode ser nil).
+// Com conta de serviço (ldap_bind_dn): bind do serviço -> busca do DN -> bind do usuário.
+// Sem conta de serviço: bind direto no formato NetBIOS DOMINIO\usuario.
+func authenticateLDAPTrace(cfg ldapConfig, username, password string, trace *ldapTrace) (*LDAPUser, error) {
+	// Senha vazia faria um "unauthenticated bind", que o servidor aceita sem validar nada
+	if strings.TrimSpace(username) == "" || password == "" {
+		err := fmt.Errorf("usuário e senha são obrigatórios")
+		trace.record("input", err, "")
+		return nil, err
+	}
+
+	conn, err := dialLDAP(cfg, trace)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var entry *ldap.Entry
+	if cfg.BindDN != "" {
+		err = conn.Bind(cfg.BindDN, cfg.BindPassword)
+		trace.record("service_bind", err, cfg.BindDN)
+		if err != nil {
+			return nil, err
+		}
+
+		entry, err = searchLDAPUser(conn, cfg, username)
+		detail := ""
+		if entry != nil {
+			detail = entry.DN
+		}
+		trace.record("user_search", err, detail)
+		if err != nil {
+			return nil, err
+		}
+
+		err = conn.Bind(entry.DN, password)
+		trace.record("user_bind", err, entry.DN)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Bind (Login) usando formato NetBIOS: DOMAIN\Username
+		userPrincipal := fmt.Sprintf("%s\\%s", cfg.Domain, username)
+		err = conn.Bind(userPrincipal, password)
+		trace.record("user_bind", err, userPrincipal)
+		if err != nil {
+			return nil, err
+		}
+
+		// Autenticação Sucesso. Agora tentar buscar os dados do usuário (não bloqueia o login).
+		if cfg.BaseDN != "" {
+			entry, err = searchLDAPUser(conn, cfg, username)
+			trace.record("user_search", err, "")
+		}
+	}
+
+	dirUser := ldapEntryToUser(entry, username)
+	if dirUser.Disabled {
+		err = fmt.Errorf("conta desativada no AD")
+		trace.record("account_status", err, "")
+		return nil, err
+	}
+	return dirUser, nil
+}
+
+// TestLDAPConnection executa a conexão passo a passo e informa exatamente qual etapa falhou (Admin).
+// Sem usuário informado, testa apenas conexão, TLS e bind da conta de serviço.
+func TestLDAPConnection(c *gin.Context) {
+	var input struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cfg := loadLDAPConfig()
+	trace := &ldapTrace{}
+	var err error
+
+	if input.Username != "" {
+		var user *LDAPUser
+		user, err = authenticateLDAPTrace(cfg, input.Username, input.Password, trace)
+		if err == nil {
+			trace.record("result", nil, fmt.Sprintf("Autenticado como %s (%s)", user.FullName, user.DN))
+
+			// Mostrar o que o mapeamento de grupos aplicaria a este usuário
+			if role, ok := mapDirectoryRole("ldap_role_mapping", user.Groups); ok {
+				trace.record("role_mapping", nil, role)
+			}
+			if sector := mapDirectorySector(user.Groups, user.DN); sector != "" {
+				trace.record("sector_mapping", nil, sector)
+			}
+		}
+	} else {
+		var conn *ldap.Conn
+		conn, err = dialLDAP(cfg, trace)
+		if err == nil {
+			defer conn.Close()
+			if cfg.BindDN != "" {
+				err = conn.Bind(cfg.BindDN, cfg.BindPassword)
+				trace.record("service_bind", err, cfg.BindDN)
+			}
+		}
+	}
+
+	logRequestAction(c, "LDAP_TEST", "Setting", 0, fmt.Sprintf("Teste de conexão LDAP (%s): sucesso=%t", cfg.Host, err == nil))
+	c.JSON(http.StatusOK, gin.H{
+		"ok":    err == nil,
+		"steps": trace.Steps,
+	})
+}
+
+// ==========================================
+// MAPEAMENTO DE GRUPOS DO AD -> PERFIL / SETOR
+// ==========================================
+
+// Senha placeholder de contas gerenciadas pelo AD (nunca confere com bcrypt)
+const ldapManagedPassword = "LDAP_MANAGED"
+
+// loadDirectoryMapping lê uma configuração JSON no formato {"grupo ou OU": "valor"}
+func loadDirectoryMapping(key string) map[string]string {
+	mapping := map[string]string{}
+	raw := strings.TrimSpace(getSettingValue(key, ""))
+	if raw == "" {
+		return mapping
+	}
+	if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+		fmt.Printf("[LDAP] Configuração %s inválida: %v\n", key, err)
+	}
+	return mapping
+}
+
+// directoryKeyMatches compara a chave do mapeamento com um grupo (DN completo ou apenas o CN)
+func directoryKeyMatches(key, groupDN string) bool {
+	key = strings.TrimSpace(key)
+	if strings.EqualFold(key, groupDN) {
+		return true
+	}
+	if dn, err := ldap.ParseDN(groupDN); err == nil && len(dn.RDNs) > 0 && len(dn.RDNs[0].Attributes) > 0 {
+		return strings.EqualFold(key, dn.RDNs[0].Attributes[0].Value)
+	}
+	return false
+}
+
+// directoryOUMatches verifica se o DN do usuário está dentro da OU indicada (nome da OU ou DN da OU)
+func directoryOUMatches(key, userDN string) bool {
+	if userDN == "" {
+		return false
+	}
+	if strings.Contains(key, "=") {
+		return strings.HasSuffix(strings.ToLower(userDN), ","+strings.ToLower(strings.TrimSpace(key)))
+	}
+	dn, err := ldap.ParseDN(userDN)
+	if err != nil {
+		return false
+	}
+	for _, rdn := range dn.RDNs {
+		for _, attr := range rdn.Attributes {
+			if strings.EqualFold(attr.Type, "OU") && strings.EqualFold(attr.Value, strings.TrimSpace(key)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mapDirectoryRole devolve o perfil de maior prioridade (Role.Priority) entre os grupos mapeados em
+// mappingKey; sem grupo correspondente, o perfil User ("" e false se não houver mapeamento)
+func mapDirectoryRole(mappingKey string, groups []string) (string, bool) {
+	mapping := loadDirectoryMapping(mappingKey)
+	if len(mapping) == 0 {
+		return "", false
+	}
+
+	best := ""
+	for key, role := range mapping {
+		if !roleExists(role) {
+			continue
+		}
+		for _, group := range groups {
+			if !directoryKeyMatches(key, group) {
+				continue
+			}
+			// Empate: ordem alfabética, para o resultado não depender da ordem do mapa
+			if best == "" || rolePriority(role) > rolePriority(best) || (rolePriority(role) == rolePriority(best) && role < best) {
+				best = role
+			}
+		}
+	}
+	if best == "" {
+		best = "User"
+	}
+	return best, true
+}
+
+// mapDirectorySector devolve o setor do primeiro grupo/OU mapeado que corresponder
+func mapDirectorySector(groups []string, userDN string) string {
+	mapping := loadDirectoryMapping("ldap_sector_mapping")
+	keys := make([]string, 0, len(mapping))
+	for key := range mapping {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) // ordem determinística
+
+	for _, key := range keys {
+		for _, group := range groups {
+			if directoryKeyMatches(key, group) {
+				return mapping[key]
+			}
+		}
+		if directoryOUMatches(key, userDN) {
+			return mapping[key]
+		}
+	}
+	return ""
+}
+
+// applyDirectoryProfile copia os dados cadastrais do AD e aplica os mapeamentos de grupos
+func applyDirectoryProfile(user *User, dirUser *LDAPUser) {
+	user.FullName = dirUser.FullName
+	if dirUser.Email != "" {
+		user.Email = dirUser.Email
+	}
+	if dirUser.Department != "" {
+		user.Department = dirUser.Department
+	}
+	if dirUser.Phone != "" {
+		user.Phone = dirUser.Phone
+	}
+	applyDirectoryMappings(user, dirUser)
+}
+
+// applyDirectoryMappings atualiza perfil e setor de uma conta gerenciada pelo AD
+func applyDirectoryMappings(user *User, dirUser *LDAPUser) {
+	if user.Password != ldapManagedPassword {
+		return // Contas locais (senha própria) não têm o perfil alterado pelo AD
+	}
+	if role, ok := mapDirectoryRole("ldap_role_mapping", dirUser.Groups); ok && role != user.Role {
+		fmt.Printf("[LDAP] Perfil de %s: %s -> %s (grupos do AD)\n", user.Username, user.Role, role)
+		user.Role = role
+	}
+	if sector := mapDirectorySector(dirUser.Groups, dirUser.DN); sector != "" {
+		user.Sector = sector
+	} else if user.Sector == "" {
+		user.Sector = dirUser.Department
+	}
+}
+
+// validateDirectoryMappingSetting valida o JSON de ldap_role_mapping / ldap_sector_mapping / oidc_role_mapping antes de salvar
+func validateDirectoryMappingSetting(key, value string) error {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	mapping := map[string]string{}
+	if err := json.Unmarshal([]byte(value), &mapping); err != nil {
+		return fmt.Errorf("JSON inválido. Use o formato {\"CN=Grupo,OU=...\": \"valor\"}")
+	}
+	if key == "ldap_role_mapping" || key == "oidc_role_mapping" {
+		for group, role := range mapping {
+			if !roleExists(role) {
+				return fmt.Errorf("perfil inválido para o grupo %s: %s", group, role)
+			}
+		}
+	}
+	return nil
+}
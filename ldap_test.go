@@ -0,0 +1,293 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// fakeLDAPServer responde a bind e busca como um OpenLDAP mínimo (apenas o necessário para o login)
+type fakeLDAPServer struct {
+	listener  net.Listener
+	passwords map[string]string // DN -> senha
+	entries   map[string]fakeLDAPEntry
+
+	mu      sync.Mutex
+	filters []string
+}
+
+type fakeLDAPEntry struct {
+	DN    string
+	Attrs map[string][]string
+}
+
+func newFakeLDAPServer(t *testing.T) *fakeLDAPServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeLDAPServer{listener: l, passwords: map[string]string{}, entries: map[string]fakeLDAPEntry{}}
+	go s.serve()
+	t.Cleanup(func() { l.Close() })
+	return s
+}
+
+func (s *fakeLDAPServer) port() string {
+	return strings.TrimPrefix(s.listener.Addr().String(), "127.0.0.1:")
+}
+
+func (s *fakeLDAPServer) receivedFilters() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.filters...)
+}
+
+func (s *fakeLDAPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeLDAPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Value.(string)
+			password := string(op.Children[2].Data.Bytes())
+			code, msg := int64(ldap.LDAPResultSuccess), ""
+			if expected, ok := s.passwords[dn]; !ok || expected != password {
+				code, msg = ldap.LDAPResultInvalidCredentials, "invalid credentials"
+			}
+			conn.Write(ldapMessage(id, ldap.ApplicationBindResponse, ldapResult(code, msg)...).Bytes())
+
+		case ldap.ApplicationSearchRequest:
+			filter, err := ldap.DecompileFilter(op.Children[6])
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.filters = append(s.filters, filter)
+			s.mu.Unlock()
+
+			if entry, ok := s.entries[filter]; ok {
+				attrs := ber.NewSequence("attributes")
+				for name, values := range entry.Attrs {
+					attr := ber.NewSequence("attribute")
+					attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+					set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+					for _, v := range values {
+						set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+					}
+					attr.AppendChild(set)
+					attrs.AppendChild(attr)
+				}
+				dn := ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "")
+				conn.Write(ldapMessage(id, ldap.ApplicationSearchResultEntry, dn, attrs).Bytes())
+			}
+			conn.Write(ldapMessage(id, ldap.ApplicationSearchResultDone, ldapResult(ldap.LDAPResultSuccess, "")...).Bytes())
+
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func ldapMessage(id int64, tag ber.Tag, children ...*ber.Packet) *ber.Packet {
+	envelope := ber.NewSequence("LDAP Response")
+	envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	for _, child := range children {
+		op.AppendChild(child)
+	}
+	envelope.AppendChild(op)
+	return envelope
+}
+
+func ldapResult(code int64, message string) []*ber.Packet {
+	return []*ber.Packet{
+		ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "resultCode"),
+		ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"),
+		ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "diagnosticMessage"),
+	}
+}
+
+const testUserDN = "uid=joana,ou=TI,dc=camara,dc=local"
+
+func testLDAPConfig(s *fakeLDAPServer) ldapConfig {
+	return ldapConfig{
+		Host:         "127.0.0.1",
+		Port:         s.port(),
+		BaseDN:       "dc=camara,dc=local",
+		TLSMode:      "none",
+		BindDN:       "cn=svc,dc=camara,dc=local",
+		BindPassword: "svc-pass",
+		UserFilter:   "(uid={username})",
+	}
+}
+
+func newDirectoryWithJoana(t *testing.T, accountControl string) *fakeLDAPServer {
+	s := newFakeLDAPServer(t)
+	s.passwords["cn=svc,dc=camara,dc=local"] = "svc-pass"
+	s.passwords[testUserDN] = "senha-da-rede"
+	s.entries["(uid=joana)"] = fakeLDAPEntry{DN: testUserDN, Attrs: map[string][]string{
+		"displayName":        {"Joana Lima"},
+		"mail":               {"joana@camara.local"},
+		"department":         {"Informática"},
+		"memberOf":           {"cn=Suporte,ou=Grupos,dc=camara,dc=local"},
+		"userAccountControl": {accountControl},
+	}}
+	return s
+}
+
+func traceSteps(trace *ldapTrace) string {
+	var steps []string
+	for _, s := range trace.Steps {
+		status := "ok"
+		if !s.OK {
+			status = "falha"
+		}
+		steps = append(steps, s.Step+":"+status)
+	}
+	return strings.Join(steps, " ")
+}
+
+func TestAuthenticateLDAPWithServiceAccount(t *testing.T) {
+	s := newDirectoryWithJoana(t, "512")
+	trace := &ldapTrace{}
+
+	user, err := authenticateLDAPTrace(testLDAPConfig(s), "joana", "senha-da-rede", trace)
+	if err != nil {
+		t.Fatalf("autenticação falhou: %v (%s)", err, traceSteps(trace))
+	}
+	if user.DN != testUserDN || user.FullName != "Joana Lima" || user.Email != "joana@camara.local" || user.Department != "Informática" {
+		t.Errorf("dados do diretório incorretos: %+v", user)
+	}
+	if len(user.Groups) != 1 || !directoryKeyMatches("Suporte", user.Groups[0]) {
+		t.Errorf("grupos incorretos: %v", user.Groups)
+	}
+	if got, want := traceSteps(trace), "connect:ok service_bind:ok user_search:ok user_bind:ok"; got != want {
+		t.Errorf("etapas = %q, esperado %q", got, want)
+	}
+}
+
+func TestAuthenticateLDAPWrongPassword(t *testing.T) {
+	s := newDirectoryWithJoana(t, "512")
+	trace := &ldapTrace{}
+
+	if _, err := authenticateLDAPTrace(testLDAPConfig(s), "joana", "errada", trace); err == nil {
+		t.Fatal("senha incorreta foi aceita")
+	}
+	if got, want := traceSteps(trace), "connect:ok service_bind:ok user_search:ok user_bind:falha"; got != want {
+		t.Errorf("etapas = %q, esperado %q", got, want)
+	}
+}
+
+func TestAuthenticateLDAPDisabledAccount(t *testing.T) {
+	s := newDirectoryWithJoana(t, "514") // NORMAL_ACCOUNT | ACCOUNTDISABLE
+
+	_, err := authenticateLDAPTrace(testLDAPConfig(s), "joana", "senha-da-rede", nil)
+	if err == nil || !strings.Contains(err.Error(), "desativada") {
+		t.Fatalf("conta desativada no AD deveria ser recusada, erro: %v", err)
+	}
+}
+
+func TestAuthenticateLDAPEscapesFilter(t *testing.T) {
+	s := newDirectoryWithJoana(t, "512")
+
+	if _, err := authenticateLDAPTrace(testLDAPConfig(s), "*)(uid=joana", "senha-da-rede", nil); err == nil {
+		t.Fatal("usuário com caracteres de filtro foi autenticado")
+	}
+	filters := s.receivedFilters()
+	if len(filters) != 1 || filters[0] != `(uid=\2a\29\28uid=joana)` {
+		t.Errorf("filtro enviado ao servidor = %v", filters)
+	}
+}
+
+func TestAuthenticateLDAPRejectsEmptyPassword(t *testing.T) {
+	s := newDirectoryWithJoana(t, "512")
+	trace := &ldapTrace{}
+
+	if _, err := authenticateLDAPTrace(testLDAPConfig(s), "joana", "", trace); err == nil {
+		t.Fatal("senha vazia (bind anônimo) foi aceita")
+	}
+	if got := traceSteps(trace); got != "input:falha" {
+		t.Errorf("não deveria conectar ao servidor, etapas: %q", got)
+	}
+}
+
+func TestDialLDAPRejectsUnknownTLSMode(t *testing.T) {
+	s := newFakeLDAPServer(t)
+	cfg := testLDAPConfig(s)
+	cfg.TLSMode = "ssl"
+
+	if _, err := dialLDAP(cfg, nil); err == nil || !strings.Contains(err.Error(), "ldap_tls_mode") {
+		t.Fatalf("modo TLS inválido deveria ser recusado, erro: %v", err)
+	}
+}
+
+func TestDirectoryOUMatches(t *testing.T) {
+	cases := []struct {
+		key, dn string
+		want    bool
+	}{
+		{"TI", testUserDN, true},
+		{"ti", testUserDN, true},
+		{"RH", testUserDN, false},
+		{"ou=TI,dc=camara,dc=local", testUserDN, true},
+		{"ou=RH,dc=camara,dc=local", testUserDN, false},
+		{"TI", "", false},
+	}
+	for _, tc := range cases {
+		if got := directoryOUMatches(tc.key, tc.dn); got != tc.want {
+			t.Errorf("directoryOUMatches(%q, %q) = %t", tc.key, tc.dn, got)
+		}
+	}
+}
+
+func TestMapDirectoryRoleUsesRolePriority(t *testing.T) {
+	setupTestDB(t)
+	if err := db.Create(&Role{Name: "Coordenador", Priority: 25}).Error; err != nil {
+		t.Fatal(err)
+	}
+	loadRolePermissions()
+	setTestSetting(t, "ldap_role_mapping", `{"TI-Tecnicos": "Tech", "TI-Coordenacao": "Coordenador", "TI-Chefia": "Supervisor"}`)
+
+	cases := []struct {
+		groups []string
+		want   string
+	}{
+		{[]string{"CN=TI-Tecnicos,OU=Grupos,DC=camara,DC=local"}, "Tech"},
+		{[]string{"CN=TI-Tecnicos,OU=Grupos,DC=camara,DC=local", "CN=TI-Coordenacao,OU=Grupos,DC=camara,DC=local"}, "Coordenador"},
+		{[]string{"CN=TI-Coordenacao,OU=Grupos,DC=camara,DC=local", "CN=TI-Chefia,OU=Grupos,DC=camara,DC=local"}, "Supervisor"},
+		{[]string{"CN=Financeiro,OU=Grupos,DC=camara,DC=local"}, "User"},
+	}
+	for _, tc := range cases {
+		if got, ok := mapDirectoryRole("ldap_role_mapping", tc.groups); !ok || got != tc.want {
+			t.Errorf("grupos %v: perfil %q, esperado %q", tc.groups, got, tc.want)
+		}
+	}
+
+	if err := validateDirectoryMappingSetting("oidc_role_mapping", `{"ti-coord": "Coordenador"}`); err != nil {
+		t.Errorf("perfil personalizado recusado no mapeamento: %v", err)
+	}
+	if err := validateDirectoryMappingSetting("oidc_role_mapping", `{"ti-coord": "Inexistente"}`); err == nil {
+		t.Error("perfil inexistente aceito no mapeamento")
+	}
+}
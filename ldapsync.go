@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ==========================================
+// SINCRONIZAÇÃO AGENDADA COM O AD
+// ==========================================
+//
+// Importa todos os usuários de ldap_basedn (nome, e-mail, departamento, telefone e
+// mapeamentos de grupo) usando a conta de serviço. Assim técnicos podem abrir chamados
+// em nome de quem nunca fez login. Contas desabilitadas ou removidas do AD são
+// desativadas localmente; contas locais (senha própria) nunca são alteradas.
+
+const (
+	ldapSyncDisabledReason = "Desativado no AD"
+	ldapSyncRemovedReason  = "Removido do AD"
+)
+
+// LDAPSyncReport registra o resultado de cada execução da sincronização
+type LDAPSyncReport struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	StartedAt     time.Time  `json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at"`
+	Trigger       string     `json:"trigger"` // schedule, manual
+	TriggeredByID uint       `json:"triggered_by_id"`
+	Success       bool       `json:"success"`
+	Found         int        `json:"found"`
+	Created       int        `json:"created"`
+	Updated       int        `json:"updated"`
+	Disabled      int        `json:"disabled"`
+	Reactivated   int        `json:"reactivated"`
+	Skipped       int        `json:"skipped"`
+	Message       string     `json:"message"`
+	Details       string     `gorm:"type:text" json:"details"` // Uma linha por alteração
+}
+
+var ldapSyncMu sync.Mutex
+
+// fetchDirectoryUsers lista todos os usuários do diretório (busca paginada)
+func fetchDirectoryUsers(cfg ldapConfig) ([]*LDAPUser, error) {
+	if cfg.BindDN == "" {
+		return nil, fmt.Errorf("a sincronização exige a conta de serviço (ldap_bind_dn)")
+	}
+	if cfg.BaseDN == "" {
+		return nil, fmt.Errorf("ldap_basedn não configurado")
+	}
+
+	conn, err := dialLDAP(cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+		return nil, fmt.Errorf("falha no bind da conta de serviço: %w", err)
+	}
+
+	usernameAttr := getSettingValue("ldap_username_attribute", "sAMAccountName")
+	searchReq := ldap.NewSearchRequest(
+		cfg.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		getSettingValue("ldap_sync_filter", "(&(objectClass=user)(objectCategory=person))"),
+		append([]string{usernameAttr}, ldapUserAttributes...),
+		nil,
+	)
+	sr, err := conn.SearchWithPaging(searchReq, 500)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]*LDAPUser, 0, len(sr.Entries))
+	for _, entry := range sr.Entries {
+		username := entry.GetAttributeValue(usernameAttr)
+		if username == "" {
+			continue // Objetos sem login (ex.: contatos)
+		}
+		users = append(users, ldapEntryToUser(entry, username))
+	}
+	return users, nil
+}
+
+// runLDAPSync executa a sincronização e grava o relatório
+func runLDAPSync(trigger string, triggeredBy uint) (*LDAPSyncReport, error) {
+	if !ldapSyncMu.TryLock() {
+		return nil, fmt.Errorf("sincronização já em andamento")
+	}
+	defer ldapSyncMu.Unlock()
+
+	report := &LDAPSyncReport{StartedAt: time.Now(), Trigger: trigger, TriggeredByID: triggeredBy}
+	db.Create(report)
+
+	var details []string
+	note := func(format string, args ...interface{}) {
+		details = append(details, fmt.Sprintf(format, args...))
+	}
+
+	dirUsers, err := fetchDirectoryUsers(loadLDAPConfig())
+	if err != nil {
+		report.Message = err.Error()
+	} else {
+		report.Found = len(dirUsers)
+		seen := map[string]bool{}
+
+		for _, dirUser := range dirUsers {
+			key := strings.ToLower(dirUser.Username)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			var user User
+			if err := db.Where("LOWER(username) = ?", key).First(&user).Error; err != nil {
+				if dirUser.Disabled {
+					continue // Não importar contas que já estão desabilitadas no AD
+				}
+				user = User{Username: dirUser.Username, Role: "User", Password: ldapManagedPassword, Active: true}
+				applyDirectoryProfile(&user, dirUser)
+				if err := db.Create(&user).Error; err != nil {
+					note("ERRO ao criar %s: %v", dirUser.Username, err)
+					continue
+				}
+				report.Created++
+				note("Criado: %s (%s)", user.Username, user.FullName)
+				continue
+			}
+
+			if user.Password != ldapManagedPassword {
+				report.Skipped++ // Conta local com mesmo nome: não mexer
+				continue
+			}
+
+			before := user
+			applyDirectoryProfile(&user, dirUser)
+
+			switch {
+			case dirUser.Disabled && user.Active:
+				deactivateUserAccount(&user, ldapSyncDisabledReason)
+				report.Disabled++
+				note("Desativado: %s (%s)", user.Username, ldapSyncDisabledReason)
+			case !dirUser.Disabled && !user.Active && isLDAPSyncDeactivation(user.DeactivationReason):
+				// Só reativa o que a própria sincronização desativou
+				user.Active = true
+				user.DeactivatedAt = nil
+				user.DeactivationReason = ""
+				report.Reactivated++
+				note("Reativado: %s", user.Username)
+			case directoryProfileChanged(before, user):
+				report.Updated++
+				note("Atualizado: %s", user.Username)
+			}
+			db.Save(&user)
+		}
+
+		// Contas do AD que sumiram da busca. Resultado vazio indica filtro/base errados, não remoção em massa.
+		if len(seen) > 0 {
+			var managed []User
+			db.Where("password = ? AND active = ?", ldapManagedPassword, true).Find(&managed)
+			for _, user := range managed {
+				if seen[strings.ToLower(user.Username)] {
+					continue
+				}
+				deactivateUserAccount(&user, ldapSyncRemovedReason)
+				db.Save(&user)
+				report.Disabled++
+				note("Desativado: %s (%s)", user.Username, ldapSyncRemovedReason)
+			}
+		}
+
+		report.Success = true
+		report.Message = fmt.Sprintf("%d encontrados, %d criados, %d atualizados, %d desativados, %d reativados, %d ignorados",
+			report.Found, report.Created, report.Updated, report.Disabled, report.Reactivated, report.Skipped)
+	}
+
+	finished := time.Now()
+	report.FinishedAt = &finished
+	report.Details = strings.Join(details, "\n")
+	db.Save(report)
+
+	logAction(triggeredBy, "LDAP_SYNC", "System", report.ID, report.Message)
+	fmt.Printf("[LDAP SYNC] %s\n", report.Message)
+
+	if !report.Success {
+		return report, fmt.Errorf("%s", report.Message)
+	}
+	return report, nil
+}
+
+func isLDAPSyncDeactivation(reason string) bool {
+	return reason == ldapSyncDisabledReason || reason == ldapSyncRemovedReason
+}
+
+func directoryProfileChanged(a, b User) bool {
+	return a.FullName != b.FullName || a.Email != b.Email || a.Department != b.Department ||
+		a.Phone != b.Phone || a.Role != b.Role || a.Sector != b.Sector
+}
+
+// runLDAPSyncScheduler verifica a cada hora se a sincronização está vencida
+func runLDAPSyncScheduler() {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if getSettingValue("ldap_enabled", "false") != "true" || getSettingValue("ldap_sync_enabled", "false") != "true" {
+			continue
+		}
+		interval := time.Duration(getSettingInt("ldap_sync_interval_hours", 24)) * time.Hour
+
+		var last LDAPSyncReport
+		if err := db.Where(&LDAPSyncReport{Trigger: "schedule"}).Order("started_at desc").First(&last).Error; err == nil && time.Since(last.StartedAt) < interval {
+			continue
+		}
+		runLDAPSync("schedule", 0)
+	}
+}
+
+// TriggerLDAPSync executa a sincronização imediatamente e devolve o relatório (Admin)
+func TriggerLDAPSync(c *gin.Context) {
+	if getSettingValue("ldap_enabled", "false") != "true" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "LDAP desabilitado"})
+		return
+	}
+
+	report, err := runLDAPSync("manual", getCurrentUserID(c))
+	if report == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "report": report})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// GetLDAPSyncReports lista as últimas execuções da sincronização (Admin)
+func GetLDAPSyncReports(c *gin.Context) {
+	var reports []LDAPSyncReport
+	if err := db.Omit("details").Order("started_at desc").Limit(50).Find(&reports).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar relatórios"})
+		return
+	}
+	c.JSON(http.StatusOK, reports)
+}
+
+// GetLDAPSyncReport retorna o relatório completo de uma execução (Admin)
+func GetLDAPSyncReport(c *gin.Context) {
+	var report LDAPSyncReport
+	if err := db.First(&report, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Relatório não encontrado"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
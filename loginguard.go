@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==========================================
+// PROTEÇÃO CONTRA FORÇA BRUTA (Login)
+// ==========================================
+//
+// Falhas são contadas por usuário ("user:<username>") e por IP ("ip:<endereço>").
+// Cada falha impõe um atraso progressivo antes da próxima tentativa e, ao atingir
+// o limite configurado, a chave fica bloqueada por alguns minutos. O bloqueio é
+// verificado ANTES de consultar o banco ou o AD, evitando travar contas no domínio.
+
+// LoginThrottle acumula falhas de login de um usuário ou IP
+type LoginThrottle struct {
+	Key           string     `gorm:"primaryKey" json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+}
+
+var loginThrottleMu sync.Mutex
+
+func userThrottleKey(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+func getSettingInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(getSettingValue(key, "")); err == nil {
+		return v
+	}
+	return fallback
+}
+
+// loginThrottleWait devolve quanto tempo falta para a chave poder tentar novamente
+func loginThrottleWait(t LoginThrottle, now time.Time) (time.Duration, bool) {
+	if t.LockedUntil != nil && now.Before(*t.LockedUntil) {
+		return t.LockedUntil.Sub(now), true
+	}
+	if t.Failures == 0 {
+		return 0, false
+	}
+
+	// Atraso progressivo: passo * 2^(falhas-1), limitado a 1 minuto
+	step := time.Duration(getSettingInt("login_delay_step_seconds", 1)) * time.Second
+	delay := time.Duration(float64(step) * math.Pow(2, float64(t.Failures-1)))
+	if delay > time.Minute {
+		delay = time.Minute
+	}
+	if wait := t.LastFailureAt.Add(delay).Sub(now); wait > 0 {
+		return wait, false
+	}
+	return 0, false
+}
+
+// checkLoginThrottle verifica se usuário e IP podem tentar login agora
+func checkLoginThrottle(username, ip string) (time.Duration, string) {
+	loginThrottleMu.Lock()
+	defer loginThrottleMu.Unlock()
+
+	now := time.Now()
+	window := time.Duration(getSettingInt("login_failure_window_minutes", 15)) * time.Minute
+
+	var throttles []LoginThrottle
+	db.Where("key IN ?", []string{userThrottleKey(username), ipThrottleKey(ip)}).Find(&throttles)
+
+	for _, t := range throttles {
+		// Falhas antigas (fora da janela e sem bloqueio vigente) são esquecidas
+		if (t.LockedUntil == nil || now.After(*t.LockedUntil)) && now.Sub(t.LastFailureAt) > window {
+			db.Delete(&t)
+			continue
+		}
+		wait, locked := loginThrottleWait(t, now)
+		if locked {
+			return wait, fmt.Sprintf("Acesso temporariamente bloqueado por excesso de tentativas. Tente novamente em %d minuto(s).", int(math.Ceil(wait.Minutes())))
+		}
+		if wait > 0 {
+			return wait, fmt.Sprintf("Muitas tentativas. Aguarde %d segundo(s).", int(math.Ceil(wait.Seconds())))
+		}
+	}
+	return 0, ""
+}
+
+// registerLoginFailure contabiliza a falha e aplica o bloqueio quando o limite é atingido
+func registerLoginFailure(username, ip string) {
+	loginThrottleMu.Lock()
+	defer loginThrottleMu.Unlock()
+
+	now := time.Now()
+	lockout := time.Duration(getSettingInt("login_lockout_minutes", 15)) * time.Minute
+	limits := map[string]int{
+		userThrottleKey(username): getSettingInt("login_max_attempts_user", 5),
+		ipThrottleKey(ip):         getSettingInt("login_max_attempts_ip", 20),
+	}
+
+	for key, max := range limits {
+		var t LoginThrottle
+		if err := db.First(&t, "key = ?", key).Error; err != nil {
+			t = LoginThrottle{Key: key}
+		}
+		// Bloqueio anterior já expirado: recomeçar a contagem
+		if t.LockedUntil != nil && now.After(*t.LockedUntil) {
+			t.Failures = 0
+			t.LockedUntil = nil
+		}
+		t.Failures++
+		t.LastFailureAt = now
+
+		if max > 0 && t.Failures >= max && t.LockedUntil == nil {
+			until := now.Add(lockout)
+			t.LockedUntil = &until
+
+			// Auditoria do bloqueio (UserID = conta afetada, se existir localmente)
+			var user User
+			var userID uint
+			if strings.HasPrefix(key, "user:") && db.Where("LOWER(username) = ?", strings.TrimPrefix(key, "user:")).First(&user).Error == nil {
+				userID = user.ID
+			}
+			logAction(userID, "LOCKOUT", "Login", userID, fmt.Sprintf("%s bloqueado até %s após %d falhas (IP %s)", key, until.Format("15:04:05"), t.Failures, ip))
+		}
+		db.Save(&t)
+	}
+}
+
+// registerLoginSuccess zera o contador do usuário (o contador do IP expira sozinho)
+func registerLoginSuccess(username string) {
+	loginThrottleMu.Lock()
+	defer loginThrottleMu.Unlock()
+	db.Delete(&LoginThrottle{}, "key = ?", userThrottleKey(username))
+}
+
+// rejectThrottledLogin responde 429 se a tentativa estiver bloqueada/atrasada
+func rejectThrottledLogin(c *gin.Context, username string) bool {
+	wait, msg := checkLoginThrottle(username, c.ClientIP())
+	if wait <= 0 {
+		return false
+	}
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": msg, "retry_after": seconds})
+	return true
+}
+
+// GetLoginLockouts lista contadores de falha e bloqueios vigentes (Admin)
+func GetLoginLockouts(c *gin.Context) {
+	var throttles []LoginThrottle
+	if err := db.Order("last_failure_at desc").Find(&throttles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar bloqueios"})
+		return
+	}
+	c.JSON(http.StatusOK, throttles)
+}
+
+// UnlockLogin remove o bloqueio de uma chave (usuário ou IP) (Admin)
+func UnlockLogin(c *gin.Context) {
+	var input struct {
+		Key string `json:"key" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	loginThrottleMu.Lock()
+	result := db.Delete(&LoginThrottle{}, "key = ?", input.Key)
+	loginThrottleMu.Unlock()
+
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bloqueio não encontrado"})
+		return
+	}
+	logRequestAction(c, "UNLOCK", "Login", 0, fmt.Sprintf("Bloqueio removido: %s", input.Key))
+	c.JSON(http.StatusOK, gin.H{"message": "Bloqueio removido"})
+}
+
+// UnlockUser remove o bloqueio de login de um usuário específico (Admin)
+func UnlockUser(c *gin.Context) {
+	var user User
+	if err := db.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+		return
+	}
+
+	registerLoginSuccess(user.Username)
+	logRequestAction(c, "UNLOCK", "User", user.ID, fmt.Sprintf("Bloqueio de login de %s removido", user.Username))
+	c.JSON(http.StatusOK, gin.H{"message": "Usuário desbloqueado"})
+}
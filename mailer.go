@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==========================================
+// ENVIO DE E-MAIL (SMTP)
+// ==========================================
+//
+// Servidor configurável em smtp_*. Para testes, qualquer "SMTP catcher" local
+// (MailHog, smtp4dev) em smtp_tls_mode=none funciona sem autenticação.
+
+type smtpConfig struct {
+	Enabled  bool
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	TLSMode  string // none, starttls ou tls
+}
+
+func loadSMTPConfig() smtpConfig {
+	return smtpConfig{
+		Enabled:  getSettingValue("smtp_enabled", "false") == "true",
+		Host:     getSettingValue("smtp_host", ""),
+		Port:     getSettingValue("smtp_port", "25"),
+		Username: getSettingValue("smtp_username", ""),
+		Password: getSettingValue("smtp_password", ""),
+		From:     getSettingValue("smtp_from", ""),
+		TLSMode:  getSettingValue("smtp_tls_mode", "none"),
+	}
+}
+
+// mailMessage é um e-mail em texto puro
+type mailMessage struct {
+	To      []string
+	Subject string
+	Body    string
+	Headers map[string]string // Cabeçalhos extras (ex: Auto-Submitted)
+}
+
+// buildMailMessage monta o e-mail em UTF-8 (quoted-printable)
+func buildMailMessage(from *mail.Address, msg mailMessage) []byte {
+	var buf bytes.Buffer
+	host := from.Address[strings.LastIndex(from.Address, "@")+1:]
+	id, _ := generateRandomToken(12)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", id, host)
+	for k, v := range msg.Headers {
+		fmt.Fprintf(&buf, "%s: %s\r\n", k, v)
+	}
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	qp.Write([]byte(strings.ReplaceAll(msg.Body, "\n", "\r\n")))
+	qp.Close()
+	return buf.Bytes()
+}
+
+// sendMail envia um e-mail pelo servidor SMTP configurado
+func sendMail(msg mailMessage) error {
+	cfg := loadSMTPConfig()
+	if !cfg.Enabled || cfg.Host == "" {
+		return fmt.Errorf("envio de e-mail não configurado (smtp_enabled/smtp_host)")
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return fmt.Errorf("remetente inválido (smtp_from): %w", err)
+	}
+	if len(msg.To) == 0 {
+		return fmt.Errorf("e-mail sem destinatário")
+	}
+
+	addr := net.JoinHostPort(cfg.Host, cfg.Port)
+	tlsConfig := &tls.Config{ServerName: cfg.Host, MinVersion: tls.VersionTLS12}
+
+	var conn net.Conn
+	if cfg.TLSMode == "tls" {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, 10*time.Second)
+	}
+	if err != nil {
+		return fmt.Errorf("falha ao conectar ao SMTP %s: %w", addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("falha no handshake SMTP: %w", err)
+	}
+	defer client.Close()
+
+	if cfg.TLSMode == "starttls" {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("falha no STARTTLS: %w", err)
+		}
+	}
+	if cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return fmt.Errorf("falha na autenticação SMTP: %w", err)
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("remetente recusado: %w", err)
+	}
+	for _, to := range msg.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("destinatário %s recusado: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buildMailMessage(from, msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("mensagem recusada pelo SMTP: %w", err)
+	}
+	return client.Quit()
+}
+
+// validEmail confere se o texto é um endereço de e-mail simples (sem nome)
+func validEmail(address string) bool {
+	parsed, err := mail.ParseAddress(address)
+	return err == nil && parsed.Address == address
+}
+
+// appBaseURL devolve o endereço público do sistema para links em e-mails (vazio se não configurado).
+// Nunca é derivado de Host/X-Forwarded-*: quem controla a requisição escolheria o destino do link.
+func appBaseURL() string {
+	return strings.TrimRight(getSettingValue("app_base_url", ""), "/")
+}
+
+// TestSMTP envia um e-mail de teste para validar a configuração
+func TestSMTP(c *gin.Context) {
+	var input struct {
+		To string `json:"to" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	body := "Este é um e-mail de teste enviado pelo CâmaraGestão.\nSe você o recebeu, o envio de e-mails está configurado corretamente."
+	warning := ""
+	if base := appBaseURL(); base != "" {
+		body += "\n\nEndereço do sistema: " + base + "/"
+	} else {
+		warning = "app_base_url não configurado: e-mails sairão sem links e a recuperação de senha fica desativada"
+	}
+
+	err := sendMail(mailMessage{
+		To:      []string{input.To},
+		Subject: "CâmaraGestão - Teste de e-mail",
+		Body:    body,
+	})
+	logRequestAction(c, "SMTP_TEST", "Setting", 0, fmt.Sprintf("Teste de SMTP para %s: sucesso=%t", input.To, err == nil))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"ok": false, "error": err.Error(), "warning": warning})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "warning": warning})
+}
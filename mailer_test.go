@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// smtpCatcher é um servidor SMTP mínimo que guarda as mensagens recebidas (como o MailHog)
+type smtpCatcher struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	messages []caughtMail
+}
+
+type caughtMail struct {
+	From string
+	To   []string
+	Data string
+}
+
+func newSMTPCatcher(t *testing.T) *smtpCatcher {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpCatcher{listener: l}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+	return s
+}
+
+func (s *smtpCatcher) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 catcher ESMTP")
+	var current caughtMail
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 catcher")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			current = caughtMail{From: strings.Trim(line[len("MAIL FROM:"):], "<> ")}
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			current.To = append(current.To, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 end with .")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			current.Data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, current)
+			s.mu.Unlock()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (s *smtpCatcher) caught() []caughtMail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]caughtMail(nil), s.messages...)
+}
+
+func setupSMTPCatcher(t *testing.T) *smtpCatcher {
+	s := newSMTPCatcher(t)
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	setTestSetting(t, "smtp_enabled", "true")
+	setTestSetting(t, "smtp_host", host)
+	setTestSetting(t, "smtp_port", port)
+	setTestSetting(t, "smtp_from", "CâmaraGestão <chamados@camara.local>")
+	setTestSetting(t, "smtp_tls_mode", "none")
+	return s
+}
+
+// readCaughtMail interpreta a mensagem recebida, devolvendo o assunto e o corpo decodificados
+func readCaughtMail(t *testing.T, m caughtMail) (*mail.Message, string, string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(m.Data))
+	if err != nil {
+		t.Fatalf("mensagem malformada: %v\n%s", err, m.Data)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg, subject, strings.ReplaceAll(string(body), "\r\n", "\n")
+}
+
+func TestSendMailDeliversToSMTPServer(t *testing.T) {
+	setupTestDB(t)
+	catcher := setupSMTPCatcher(t)
+
+	err := sendMail(mailMessage{
+		To:      []string{"joana@camara.local", "ti@camara.local"},
+		Subject: "Chamado #12 atribuído a você",
+		Body:    "Olá, Joana.\nO chamado \"Impressora sem toner\" foi atribuído a você.",
+		Headers: map[string]string{"Auto-Submitted": "auto-generated"},
+	})
+	if err != nil {
+		t.Fatalf("envio falhou: %v", err)
+	}
+
+	caught := catcher.caught()
+	if len(caught) != 1 {
+		t.Fatalf("%d mensagens recebidas, esperado 1", len(caught))
+	}
+	if caught[0].From != "chamados@camara.local" || strings.Join(caught[0].To, ",") != "joana@camara.local,ti@camara.local" {
+		t.Errorf("envelope incorreto: %+v", caught[0])
+	}
+	msg, subject, body := readCaughtMail(t, caught[0])
+	if subject != "Chamado #12 atribuído a você" {
+		t.Errorf("assunto = %q", subject)
+	}
+	if !strings.Contains(body, "\"Impressora sem toner\" foi atribuído a você") {
+		t.Errorf("corpo = %q", body)
+	}
+	if msg.Header.Get("Auto-Submitted") != "auto-generated" || !strings.Contains(msg.Header.Get("Content-Type"), "UTF-8") {
+		t.Errorf("cabeçalhos incorretos: %v", msg.Header)
+	}
+	if !strings.HasSuffix(msg.Header.Get("Message-ID"), "@camara.local>") {
+		t.Errorf("Message-ID = %q", msg.Header.Get("Message-ID"))
+	}
+}
+
+func TestSendMailRequiresConfiguration(t *testing.T) {
+	setupTestDB(t)
+	if err := sendMail(mailMessage{To: []string{"joana@camara.local"}, Subject: "x", Body: "x"}); err == nil {
+		t.Fatal("envio aceito com o SMTP desabilitado")
+	}
+
+	setupSMTPCatcher(t)
+	setTestSetting(t, "smtp_from", "sem-arroba")
+	if err := sendMail(mailMessage{To: []string{"joana@camara.local"}, Subject: "x", Body: "x"}); err == nil {
+		t.Fatal("remetente inválido aceito")
+	}
+}
+
+func requestPasswordReset(r *gin.Engine, host string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/password-reset/request", strings.NewReader(`{"login":"joana"}`))
+	req.Host = host
+	req.Header.Set("X-Forwarded-Proto", "https")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestPasswordResetLinkUsesConfiguredBaseURL(t *testing.T) {
+	setupTestDB(t)
+	catcher := setupSMTPCatcher(t)
+	createTestUser(t, "joana", "User", "joana@camara.local")
+	r := gin.New()
+	r.POST("/api/v1/auth/password-reset/request", RequestPasswordReset)
+
+	// Sem app_base_url o link dependeria do Host enviado pelo cliente: recusar
+	if w := requestPasswordReset(r, "atacante.example"); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("sem app_base_url: status %d", w.Code)
+	}
+	if n := len(catcher.caught()); n != 0 {
+		t.Fatalf("%d e-mails enviados sem app_base_url", n)
+	}
+
+	setTestSetting(t, "app_base_url", "https://chamados.camara.local/")
+	if w := requestPasswordReset(r, "atacante.example"); w.Code != http.StatusOK {
+		t.Fatalf("pedido recusado: %d %s", w.Code, w.Body.String())
+	}
+	caught := catcher.caught()
+	if len(caught) != 1 {
+		t.Fatalf("%d e-mails enviados, esperado 1", len(caught))
+	}
+	_, _, body := readCaughtMail(t, caught[0])
+	if !strings.Contains(body, "https://chamados.camara.local/login#reset_token=") || strings.Contains(body, "atacante.example") {
+		t.Errorf("link de redefinição incorreto:\n%s", body)
+	}
+}
@@ -0,0 +1,650 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/encoding/charmap"
+	"gorm.io/gorm"
+)
+
+// ==========================================
+// ABERTURA DE CHAMADOS POR E-MAIL
+// ==========================================
+//
+// Lê a caixa de suporte (IMAP ou Maildir, ver mailsource.go) periodicamente.
+// O remetente é associado ao User pelo e-mail; mensagens com "[Chamado #id]" no
+// assunto viram comentários no chamado, as demais abrem um chamado novo, e os
+// anexos são gravados como os enviados pelo portal. Respostas automáticas,
+// devoluções, mensagens do próprio sistema e remetentes da lista de ignorados
+// são descartadas, com limite de mensagens por remetente para evitar loops.
+//
+// O cabeçalho From é escrito por quem envia, então não basta para identificar o
+// usuário. A confiança fica no MTA da Câmara: com mail_intake_trusted_authserv_id,
+// a mensagem só é aceita se o cabeçalho Authentication-Results gravado por esse
+// MTA trouxer DMARC, DKIM ou SPF aprovados para o domínio do remetente (o MTA deve
+// remover cabeçalhos com o mesmo authserv-id vindos de fora). Com
+// mail_intake_allowed_domains, só remetentes desses domínios são aceitos, o que
+// pressupõe que o MTA recusa mensagens externas que se passam por eles (DMARC
+// p=reject). Sem nenhuma das duas configurações, nenhum e-mail é aceito.
+
+// Resultado do processamento de cada mensagem
+const (
+	intakeResultTicket  = "ticket"
+	intakeResultComment = "comment"
+	intakeResultIgnored = "ignored"
+	intakeResultError   = "error"
+)
+
+// Mensagem repetida (mesmo Message-ID): descartada sem novo registro no log
+const intakeReasonDuplicate = "Mensagem já processada"
+
+// MailIntakeLog registra o que foi feito com cada e-mail recebido
+type MailIntakeLog struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	MessageID string    `gorm:"index" json:"message_id"`
+	From      string    `gorm:"column:from_address;index" json:"from"`
+	Subject   string    `json:"subject"`
+	Result    string    `json:"result"`
+	Reason    string    `json:"reason"`
+	TicketID  *uint     `json:"ticket_id"`
+	CommentID *uint     `json:"comment_id"`
+}
+
+// ticketReferencePattern encontra a referência usada nos assuntos dos e-mails enviados (ver emailnotify.go)
+var ticketReferencePattern = regexp.MustCompile(`(?i)\[Chamado #(\d+)\]`)
+
+// --- Leitura da mensagem ---
+
+type mailAttachment struct {
+	FileName    string
+	ContentType string
+	Data        []byte
+}
+
+type parsedMail struct {
+	Header      mail.Header
+	MessageID   string
+	From        string // Endereço em minúsculas
+	FromName    string
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []mailAttachment
+}
+
+// charsetDecoder converte os charsets comuns em e-mails brasileiros para UTF-8
+func charsetDecoder(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return input, nil
+	case "iso-8859-1", "latin1", "iso8859-1":
+		return charmap.ISO8859_1.NewDecoder().Reader(input), nil
+	case "iso-8859-15":
+		return charmap.ISO8859_15.NewDecoder().Reader(input), nil
+	case "windows-1252", "cp1252":
+		return charmap.Windows1252.NewDecoder().Reader(input), nil
+	}
+	return nil, fmt.Errorf("charset não suportado: %s", charset)
+}
+
+func decodeCharset(data []byte, charset string) string {
+	r, err := charsetDecoder(charset, bytes.NewReader(data))
+	if err != nil {
+		return string(bytes.ToValidUTF8(data, []byte("?")))
+	}
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		return string(bytes.ToValidUTF8(data, []byte("?")))
+	}
+	return string(decoded)
+}
+
+func parseMail(raw []byte) (*parsedMail, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("mensagem inválida: %w", err)
+	}
+	dec := &mime.WordDecoder{CharsetReader: charsetDecoder}
+	p := &parsedMail{Header: msg.Header, MessageID: strings.TrimSpace(msg.Header.Get("Message-Id"))}
+
+	if subject, err := dec.DecodeHeader(msg.Header.Get("Subject")); err == nil {
+		p.Subject = strings.Join(strings.Fields(subject), " ")
+	} else {
+		p.Subject = msg.Header.Get("Subject")
+	}
+	parser := mail.AddressParser{WordDecoder: dec}
+	from, err := parser.Parse(msg.Header.Get("From"))
+	if err != nil {
+		return nil, fmt.Errorf("remetente inválido: %w", err)
+	}
+	p.From, p.FromName = strings.ToLower(from.Address), from.Name
+
+	if err := walkMailPart(p, textproto.MIMEHeader(msg.Header), msg.Body, 0); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(p.Text) == "" && p.HTML != "" {
+		p.Text = htmlToText(p.HTML)
+	}
+	p.Text = strings.TrimSpace(strings.ReplaceAll(p.Text, "\r\n", "\n"))
+	return p, nil
+}
+
+// walkMailPart percorre as partes MIME guardando o texto e os anexos
+func walkMailPart(p *parsedMail, header textproto.MIMEHeader, body io.Reader, depth int) error {
+	if depth > 10 {
+		return nil
+	}
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("partes MIME inválidas: %w", err)
+			}
+			if err := walkMailPart(p, part.Header, part, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	var reader io.Reader = body
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		reader = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		reader = quotedprintable.NewReader(body)
+	}
+	data, err := io.ReadAll(io.LimitReader(reader, maxIncomingMail))
+	if err != nil {
+		return fmt.Errorf("conteúdo inválido: %w", err)
+	}
+
+	disposition, dispParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	fileName := dispParams["filename"]
+	if fileName == "" {
+		fileName = params["name"]
+	}
+	if decoded, err := (&mime.WordDecoder{CharsetReader: charsetDecoder}).DecodeHeader(fileName); err == nil {
+		fileName = decoded
+	}
+
+	switch {
+	case fileName != "" && (disposition == "attachment" || !strings.HasPrefix(mediaType, "text/")):
+		p.Attachments = append(p.Attachments, mailAttachment{FileName: fileName, ContentType: mediaType, Data: data})
+	case mediaType == "text/plain" && p.Text == "":
+		p.Text = decodeCharset(data, params["charset"])
+	case mediaType == "text/html" && p.HTML == "":
+		p.HTML = decodeCharset(data, params["charset"])
+	}
+	return nil
+}
+
+var (
+	htmlBlockPattern = regexp.MustCompile(`(?is)<(style|script|head)[^>]*>.*?</(style|script|head)>`)
+	htmlBreakPattern = regexp.MustCompile(`(?i)<(br|/p|/div|/tr|/li|/h[1-6])[^>]*>`)
+	htmlTagPattern   = regexp.MustCompile(`(?s)<[^>]+>`)
+	blankLinePattern = regexp.MustCompile(`\n[ \t]*\n([ \t]*\n)+`)
+)
+
+// htmlToText extrai um texto legível de e-mails enviados só em HTML
+func htmlToText(body string) string {
+	body = htmlBlockPattern.ReplaceAllString(body, "")
+	body = htmlBreakPattern.ReplaceAllString(body, "\n")
+	body = htmlTagPattern.ReplaceAllString(body, "")
+	body = html.UnescapeString(body)
+	return strings.TrimSpace(blankLinePattern.ReplaceAllString(body, "\n\n"))
+}
+
+// Linhas que marcam o início do texto citado numa resposta
+var quotedReplyPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^>`),
+	regexp.MustCompile(`(?i)^-+ ?(mensagem original|original message|mensagem encaminhada|forwarded message) ?-+`),
+	regexp.MustCompile(`^_{10,}\s*$`),
+	regexp.MustCompile(`(?i)^(em|on) .*(escreveu|wrote):\s*$`),
+	regexp.MustCompile(`(?i)^(de|from): .+`),
+}
+
+// stripQuotedReply mantém só o texto novo de uma resposta por e-mail
+func stripQuotedReply(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		for _, pattern := range quotedReplyPatterns {
+			if pattern.MatchString(trimmed) {
+				if result := strings.TrimSpace(strings.Join(lines[:i], "\n")); result != "" {
+					return result
+				}
+				return strings.TrimSpace(text)
+			}
+		}
+	}
+	return strings.TrimSpace(text)
+}
+
+// --- Proteção contra loops ---
+
+// ignoredMailReason devolve o motivo para descartar a mensagem (vazio = processar)
+func ignoredMailReason(m *parsedMail) string {
+	h := m.Header
+	if v := strings.ToLower(strings.TrimSpace(h.Get("Auto-Submitted"))); v != "" && v != "no" {
+		return "Mensagem automática (Auto-Submitted: " + v + ")"
+	}
+	switch strings.ToLower(strings.TrimSpace(h.Get("Precedence"))) {
+	case "bulk", "junk", "list", "auto_reply":
+		return "Mensagem em massa ou resposta automática (Precedence)"
+	}
+	for _, name := range []string{"X-Autoreply", "X-Autorespond", "X-Auto-Reply"} {
+		if h.Get(name) != "" {
+			return "Resposta automática (" + name + ")"
+		}
+	}
+	if h.Get("X-Chamado-ID") != "" {
+		return "Aviso enviado pelo próprio sistema"
+	}
+	if strings.TrimSpace(h.Get("Return-Path")) == "<>" {
+		return "Devolução de e-mail (remetente vazio)"
+	}
+	if own, err := mail.ParseAddress(getSettingValue("smtp_from", "")); err == nil && strings.EqualFold(own.Address, m.From) {
+		return "Remetente é o próprio sistema"
+	}
+
+	from, subject := strings.ToLower(m.From), strings.ToLower(m.Subject)
+	for _, pattern := range splitList(strings.ToLower(getSettingValue("mail_intake_ignore", ""))) {
+		if strings.Contains(from, pattern) || strings.Contains(subject, pattern) {
+			return "Lista de ignorados: " + pattern
+		}
+	}
+
+	var recent int64
+	db.Model(&MailIntakeLog{}).Where("from_address = ? AND result IN ? AND created_at > ?",
+		m.From, []string{intakeResultTicket, intakeResultComment}, time.Now().Add(-1*time.Hour)).Count(&recent)
+	if limit := getSettingInt("mail_intake_max_per_hour", 20); recent >= int64(limit) {
+		return fmt.Sprintf("Limite de %d mensagens por hora do remetente", limit)
+	}
+	return ""
+}
+
+// --- Verificação do remetente ---
+
+var authResultsCommentPattern = regexp.MustCompile(`\([^()]*\)`)
+
+// mailDomain devolve o domínio de um endereço (ou o próprio texto, se já for um domínio)
+func mailDomain(address string) string {
+	address = strings.ToLower(strings.Trim(strings.TrimSpace(address), "<>"))
+	return address[strings.LastIndex(address, "@")+1:]
+}
+
+// domainsAligned aplica o alinhamento relaxado do DMARC: um domínio igual ou subdomínio do outro
+func domainsAligned(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	return a == b || strings.HasSuffix(a, "."+b) || strings.HasSuffix(b, "."+a)
+}
+
+// authResultsPass verifica se o Authentication-Results do MTA confiável aprova o domínio do remetente.
+// Os cabeçalhos são lidos de cima para baixo, então o primeiro com o authserv-id é o do nosso MTA.
+func authResultsPass(h mail.Header, authservID, fromDomain string) bool {
+	for _, value := range h["Authentication-Results"] {
+		value = authResultsCommentPattern.ReplaceAllString(value, "")
+		parts := strings.Split(value, ";")
+		if id := strings.Fields(parts[0]); len(id) == 0 || !strings.EqualFold(id[0], authservID) {
+			continue // Cabeçalho de outro servidor (pode ter sido escrito pelo próprio remetente)
+		}
+		for _, result := range parts[1:] {
+			fields := strings.Fields(strings.ToLower(result))
+			if len(fields) == 0 {
+				continue
+			}
+			props := map[string]string{}
+			for _, f := range fields[1:] {
+				if k, v, ok := strings.Cut(f, "="); ok {
+					props[k] = v
+				}
+			}
+			switch fields[0] {
+			case "dmarc=pass":
+				if from, ok := props["header.from"]; !ok || domainsAligned(mailDomain(from), fromDomain) {
+					return true
+				}
+			case "dkim=pass":
+				if domainsAligned(props["header.d"], fromDomain) || domainsAligned(mailDomain(props["header.i"]), fromDomain) {
+					return true
+				}
+			case "spf=pass":
+				if domainsAligned(mailDomain(props["smtp.mailfrom"]), fromDomain) {
+					return true
+				}
+			}
+		}
+		return false // Só vale o cabeçalho mais recente do MTA (os de baixo vieram com a mensagem)
+	}
+	return false
+}
+
+// unverifiedSenderReason devolve o motivo para recusar o remetente (vazio = remetente verificado)
+func unverifiedSenderReason(m *parsedMail) string {
+	domain := mailDomain(m.From)
+	allowed := splitList(strings.ToLower(getSettingValue("mail_intake_allowed_domains", "")))
+	authservID := strings.TrimSpace(getSettingValue("mail_intake_trusted_authserv_id", ""))
+	if len(allowed) == 0 && authservID == "" {
+		return "Remetente não verificável: configure mail_intake_trusted_authserv_id ou mail_intake_allowed_domains"
+	}
+	if len(allowed) > 0 {
+		ok := false
+		for _, d := range allowed {
+			if domain == d || strings.HasSuffix(domain, "."+d) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return "Domínio do remetente não autorizado: " + domain
+		}
+	}
+	if authservID != "" && !authResultsPass(m.Header, authservID, domain) {
+		return "Remetente não autenticado pelo servidor de e-mail (SPF/DKIM/DMARC)"
+	}
+	return ""
+}
+
+// --- Processamento ---
+
+// processIncomingMail abre um chamado ou comenta a partir da mensagem; retry indica falha temporária
+func processIncomingMail(raw []byte) (entry MailIntakeLog, retry bool) {
+	m, err := parseMail(raw)
+	if err != nil {
+		entry.Result, entry.Reason = intakeResultError, err.Error()
+		return entry, false
+	}
+	entry.MessageID, entry.From, entry.Subject = m.MessageID, m.From, m.Subject
+
+	if m.MessageID != "" {
+		var count int64
+		db.Model(&MailIntakeLog{}).Where("message_id = ? AND result <> ?", m.MessageID, intakeResultError).Count(&count)
+		if count > 0 {
+			entry.Result, entry.Reason = intakeResultIgnored, intakeReasonDuplicate
+			return entry, false
+		}
+	}
+	if reason := ignoredMailReason(m); reason != "" {
+		entry.Result, entry.Reason = intakeResultIgnored, reason
+		return entry, false
+	}
+	if reason := unverifiedSenderReason(m); reason != "" {
+		entry.Result, entry.Reason = intakeResultIgnored, reason
+		return entry, false
+	}
+
+	var user User
+	if err := db.Where("LOWER(email) = ?", m.From).First(&user).Error; err != nil || !user.Active {
+		entry.Result, entry.Reason = intakeResultIgnored, "Remetente não cadastrado ou desativado"
+		return entry, false
+	}
+
+	uploads, skipped := mailUploads(m.Attachments)
+
+	if match := ticketReferencePattern.FindStringSubmatch(m.Subject); match != nil {
+		id, _ := strconv.ParseUint(match[1], 10, 64)
+		var ticket Ticket
+		if err := db.First(&ticket, id).Error; err == nil {
+			if !userCanViewTicket(user, ticket) {
+				entry.Result, entry.Reason = intakeResultIgnored, fmt.Sprintf("Remetente sem acesso ao chamado #%d", ticket.ID)
+				return entry, false
+			}
+			err := commentFromMail(&entry, user, ticket, m, uploads)
+			entry.Reason = joinDetails(entry.Reason, skipped)
+			return entry, err != nil
+		}
+	}
+
+	err = ticketFromMail(&entry, user, m, uploads)
+	entry.Reason = joinDetails(entry.Reason, skipped)
+	return entry, err != nil
+}
+
+// mailUploads aplica aos anexos do e-mail as mesmas regras do portal; os recusados são descritos
+func mailUploads(attachments []mailAttachment) ([]pendingUpload, string) {
+	limits := loadAttachmentLimits()
+	var uploads []pendingUpload
+	var skipped []string
+	for _, a := range attachments {
+		if len(uploads) >= limits.MaxFiles {
+			skipped = append(skipped, a.FileName+" (limite de anexos)")
+			continue
+		}
+		up, err := validateUpload(a.FileName, a.Data, limits)
+		if err != nil {
+			skipped = append(skipped, err.Error())
+			continue
+		}
+		uploads = append(uploads, up)
+	}
+	if len(skipped) == 0 {
+		return uploads, ""
+	}
+	return uploads, "Anexos recusados: " + strings.Join(skipped, "; ")
+}
+
+// ticketFromMail abre um chamado em nome do remetente
+func ticketFromMail(entry *MailIntakeLog, user User, m *parsedMail, uploads []pendingUpload) error {
+	title := m.Subject
+	if title == "" {
+		title = "(sem assunto)"
+	}
+	if len([]rune(title)) > 200 {
+		title = string([]rune(title)[:200])
+	}
+	description := m.Text
+	if description == "" {
+		description = "(mensagem sem texto)"
+	}
+
+	ticket := Ticket{
+		Title:       title,
+		Description: description,
+		Priority:    getSettingValue("mail_intake_priority", "Media"),
+		Status:      initialTicketStatus(),
+		CreatorID:   user.ID,
+		Sector:      user.Sector,
+	}
+	if catID := uint(getSettingInt("mail_intake_category_id", 0)); catID > 0 {
+		var cat ServiceCategory
+		if err := db.First(&cat, catID).Error; err == nil {
+			ticket.CategoryID = &cat.ID
+			ticket.AssignedToID = categoryDefaultAssignee(db, cat)
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&ticket).Error; err != nil {
+			return err
+		}
+		recordUserTicketEvent(tx, user, ticket.ID, ticketEventCreated, "", ticket.Status, "Aberto por e-mail")
+		addTicketWatcher(tx, ticket.ID, user.ID, watchReasonCreator, nil)
+		recordAssignmentChange(tx, nil, ticket.ID, nil, ticket.AssignedToID, "Responsável padrão da categoria")
+		return nil
+	})
+	if err != nil {
+		entry.Result, entry.Reason = intakeResultError, "Erro ao abrir chamado: "+err.Error()
+		return err
+	}
+	if _, err := storeAttachments(user.ID, ticket.ID, nil, uploads); err != nil {
+		// O chamado fica aberto; os anexos que faltaram são registrados no log
+		entry.Reason = "Erro ao gravar anexos: " + err.Error()
+	}
+
+	entry.Result, entry.TicketID = intakeResultTicket, &ticket.ID
+	logAction(user.ID, "CREATE", "Ticket", ticket.ID, fmt.Sprintf("Título: %s | Aberto por e-mail (%s)", ticket.Title, m.From))
+
+	notice := ticketNotice{
+		Kind:      noticeTicketCreated,
+		TicketID:  ticket.ID,
+		ActorID:   user.ID,
+		ActorName: displayName(user),
+		Title:     fmt.Sprintf("Chamado #%d aberto: %s", ticket.ID, ticket.Title),
+		Message:   ticket.Description,
+		NewValue:  ticket.Status,
+	}
+	notice.Recipients = append([]uint{user.ID}, noticeRecipients(notice, ticketWatcherIDs(ticket.ID), user.ID)...)
+	publishTicketNotice(notice)
+	publishTicketChange(streamTicketCreated, ticket.ID)
+	return nil
+}
+
+// commentFromMail registra a resposta do e-mail como comentário do chamado
+func commentFromMail(entry *MailIntakeLog, user User, ticket Ticket, m *parsedMail, uploads []pendingUpload) error {
+	content := stripQuotedReply(m.Text)
+	if content == "" {
+		if len(uploads) == 0 {
+			entry.Result, entry.Reason = intakeResultIgnored, "Resposta sem texto nem anexos"
+			return nil
+		}
+		content = "📎 Anexo enviado"
+	}
+
+	comment := Comment{
+		TicketID:   ticket.ID,
+		AuthorID:   &user.ID,
+		Author:     displayName(user),
+		AuthorType: commentAuthorUser,
+		Content:    content,
+	}
+	if err := db.Create(&comment).Error; err != nil {
+		entry.Result, entry.Reason = intakeResultError, "Erro ao registrar comentário: "+err.Error()
+		return err
+	}
+	if _, err := storeAttachments(user.ID, ticket.ID, &comment.ID, uploads); err != nil {
+		entry.Reason = "Erro ao gravar anexos: " + err.Error()
+	}
+
+	entry.Result, entry.TicketID, entry.CommentID = intakeResultComment, &ticket.ID, &comment.ID
+	logAction(user.ID, "COMMENT", "Ticket", ticket.ID, "Resposta recebida por e-mail ("+m.From+")")
+
+	notifyTicketWatchers(ticketNotice{
+		Kind:      noticeTicketComment,
+		TicketID:  ticket.ID,
+		ActorID:   user.ID,
+		ActorName: displayName(user),
+		Title:     fmt.Sprintf("%s comentou no chamado #%d", comment.Author, ticket.ID),
+		Message:   comment.Content,
+	})
+	publishTicketComment(ticket.ID, comment)
+	return nil
+}
+
+// --- Leitura periódica ---
+
+var (
+	mailIntakeMu      sync.Mutex
+	mailIntakeLastRun time.Time
+)
+
+// pollMailbox processa as mensagens novas da caixa configurada
+func pollMailbox() (int, error) {
+	if !mailIntakeMu.TryLock() {
+		return 0, fmt.Errorf("leitura da caixa de e-mail já em andamento")
+	}
+	defer mailIntakeMu.Unlock()
+	mailIntakeLastRun = time.Now()
+
+	source, err := openMailSource()
+	if err != nil {
+		return 0, err
+	}
+	defer source.Close()
+
+	messages, err := source.Fetch(getSettingInt("mail_intake_batch_size", 50))
+	processed := 0
+	for _, msg := range messages {
+		var entry MailIntakeLog
+		var retry bool
+		if msg.TooLarge {
+			// Marcada como lida mesmo assim, para não travar a fila nas próximas leituras
+			entry.Result, entry.Reason = intakeResultIgnored, fmt.Sprintf("Mensagem acima de %d MB", maxIncomingMail>>20)
+		} else {
+			entry, retry = processIncomingMail(msg.Raw)
+		}
+		if entry.Reason != intakeReasonDuplicate {
+			db.Create(&entry)
+		}
+		if retry {
+			continue // Falha temporária: a mensagem continua na caixa para a próxima leitura
+		}
+		if err := source.Done(msg.ID); err != nil {
+			return processed, fmt.Errorf("falha ao marcar mensagem como lida: %w", err)
+		}
+		processed++
+	}
+	return processed, err
+}
+
+// runMailIntakeScheduler lê a caixa a cada mail_intake_interval_minutes
+func runMailIntakeScheduler() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if getSettingValue("mail_intake_enabled", "false") != "true" {
+			continue
+		}
+		interval := time.Duration(getSettingInt("mail_intake_interval_minutes", 2)) * time.Minute
+		if time.Since(mailIntakeLastRun) < interval {
+			continue
+		}
+		if n, err := pollMailbox(); err != nil {
+			fmt.Printf("[EMAIL-ENTRADA] Erro ao ler caixa: %v\n", err)
+		} else if n > 0 {
+			fmt.Printf("[EMAIL-ENTRADA] %d mensagem(ns) processada(s)\n", n)
+		}
+	}
+}
+
+// --- Handlers (settings.manage) ---
+
+// TriggerMailIntake lê a caixa de e-mail imediatamente
+func TriggerMailIntake(c *gin.Context) {
+	processed, err := pollMailbox()
+	logRequestAction(c, "MAIL_INTAKE", "Setting", 0, fmt.Sprintf("Leitura manual da caixa: %d mensagem(ns)", processed))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "processed": processed})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"processed": processed})
+}
+
+// GetMailIntakeLog lista as últimas mensagens recebidas e o que foi feito com elas
+func GetMailIntakeLog(c *gin.Context) {
+	query := db.Order("id desc").Limit(200)
+	if result := c.Query("result"); result != "" {
+		query = query.Where("result = ?", result)
+	}
+	var entries []MailIntakeLog
+	query.Find(&entries)
+	c.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseMailDecodesCharsetsAndAttachments(t *testing.T) {
+	raw := strings.Join([]string{
+		"From: =?ISO-8859-1?Q?Jo=E3o_Ara=FAjo?= <Joao.Araujo@Camara.Local>",
+		"To: suporte@camara.local",
+		"Subject: =?ISO-8859-1?Q?Impressora_n=E3o_imprime?=",
+		"Message-ID: <abc@camara.local>",
+		"MIME-Version: 1.0",
+		`Content-Type: multipart/mixed; boundary="externo"`,
+		"",
+		"--externo",
+		`Content-Type: multipart/alternative; boundary="interno"`,
+		"",
+		"--interno",
+		"Content-Type: text/plain; charset=ISO-8859-1",
+		"Content-Transfer-Encoding: quoted-printable",
+		"",
+		"A impressora do gabinete n=E3o imprime desde ontem.",
+		"--interno",
+		"Content-Type: text/html; charset=ISO-8859-1",
+		"",
+		"<p>HTML ignorado</p>",
+		"--interno--",
+		"--externo",
+		`Content-Type: application/pdf; name="=?UTF-8?Q?relat=C3=B3rio.pdf?="`,
+		"Content-Disposition: attachment",
+		"Content-Transfer-Encoding: base64",
+		"",
+		"JVBERi0xLjQK",
+		"--externo--",
+		"",
+	}, "\r\n")
+
+	m, err := parseMail([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.From != "joao.araujo@camara.local" || m.FromName != "João Araújo" {
+		t.Errorf("remetente = %q <%s>", m.FromName, m.From)
+	}
+	if m.Subject != "Impressora não imprime" || m.MessageID != "<abc@camara.local>" {
+		t.Errorf("assunto = %q, Message-ID = %q", m.Subject, m.MessageID)
+	}
+	if m.Text != "A impressora do gabinete não imprime desde ontem." {
+		t.Errorf("texto = %q", m.Text)
+	}
+	if len(m.Attachments) != 1 || m.Attachments[0].FileName != "relatório.pdf" || string(m.Attachments[0].Data) != "%PDF-1.4\n" {
+		t.Errorf("anexos = %+v", m.Attachments)
+	}
+}
+
+func TestParseMailHTMLOnly(t *testing.T) {
+	raw := "From: maria@camara.local\r\nSubject: Teste\r\nContent-Type: text/html; charset=windows-1252\r\n\r\n" +
+		"<html><head><style>p{}</style></head><body><p>Sem acesso \x96 urgente</p><p>Setor P&amp;D</p></body></html>"
+	m, err := parseMail([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Text != "Sem acesso – urgente\nSetor P&D" {
+		t.Errorf("texto extraído do HTML = %q", m.Text)
+	}
+}
+
+func TestParseMailRejectsInvalidSender(t *testing.T) {
+	if _, err := parseMail([]byte("From: sem endereço\r\nSubject: x\r\n\r\ncorpo")); err == nil {
+		t.Error("remetente inválido aceito")
+	}
+}
+
+func TestStripQuotedReply(t *testing.T) {
+	cases := []struct{ name, text, want string }{
+		{"citação com >", "Funcionou, obrigado!\n\n> Trocamos o toner.\n> Att.", "Funcionou, obrigado!"},
+		{"Gmail em português", "Ainda não resolveu.\n\nEm qua., 15 de mai. de 2024 às 10:00, Suporte <suporte@camara.local> escreveu:\n> texto", "Ainda não resolveu."},
+		{"Outlook", "Pode fechar.\n\n-----Mensagem Original-----\nDe: Suporte\nEnviada em: quarta", "Pode fechar."},
+		{"Outlook sem separador", "Ok.\n\nFrom: Suporte <suporte@camara.local>\nSent: Wednesday", "Ok."},
+		{"só citação", "> tudo citado", "> tudo citado"},
+		{"sem citação", "  Texto simples  ", "Texto simples"},
+	}
+	for _, tc := range cases {
+		if got := stripQuotedReply(tc.text); got != tc.want {
+			t.Errorf("%s: %q, esperado %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestAuthResultsPass(t *testing.T) {
+	cases := []struct {
+		name    string
+		headers []string
+		want    bool
+	}{
+		{"DMARC aprovado", []string{"mx.camara.local; spf=pass smtp.mailfrom=camara.local; dmarc=pass (p=reject) header.from=camara.local"}, true},
+		{"DKIM alinhado", []string{"mx.camara.local 1; dkim=pass header.d=camara.local header.s=sel"}, true},
+		{"SPF alinhado", []string{"mx.camara.local; spf=pass smtp.mailfrom=joana@camara.local"}, true},
+		{"DKIM de outro domínio", []string{"mx.camara.local; dkim=pass header.d=atacante.example"}, false},
+		{"SPF reprovado", []string{"mx.camara.local; spf=fail smtp.mailfrom=camara.local; dmarc=fail header.from=camara.local"}, false},
+		{"outro servidor", []string{"mx.atacante.example; dmarc=pass header.from=camara.local"}, false},
+		// Cabeçalho forjado abaixo do gravado pelo nosso MTA: só o mais recente vale
+		{"forjado abaixo do MTA", []string{"mx.camara.local; dmarc=fail header.from=camara.local", "mx.camara.local; dmarc=pass header.from=camara.local"}, false},
+	}
+	for _, tc := range cases {
+		h := map[string][]string{"Authentication-Results": tc.headers}
+		if got := authResultsPass(h, "mx.camara.local", "camara.local"); got != tc.want {
+			t.Errorf("%s: %t, esperado %t", tc.name, got, tc.want)
+		}
+	}
+}
+
+// writeMaildirMessage entrega uma mensagem em new/, como o MTA faria
+func writeMaildirMessage(t *testing.T, dir, name, raw string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, "new", name), []byte(strings.ReplaceAll(raw, "\n", "\r\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMaildirIntake(t *testing.T) {
+	setupTestDB(t)
+	t.Setenv("ATTACHMENTS_DIR", t.TempDir())
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "new"), 0755)
+	setTestSetting(t, "mail_intake_source", mailSourceMaildir)
+	setTestSetting(t, "mail_intake_maildir", dir)
+	setTestSetting(t, "mail_intake_trusted_authserv_id", "mx.camara.local")
+	joana := createTestUser(t, "joana", "User", "joana@camara.local")
+
+	verified := "Authentication-Results: mx.camara.local; dmarc=pass header.from=camara.local\n"
+	writeMaildirMessage(t, dir, "1.novo", verified+"From: Joana <joana@camara.local>\nSubject: Monitor apagado\nMessage-ID: <1@camara.local>\n\nO monitor não liga.")
+	writeMaildirMessage(t, dir, "2.forjado", "From: Joana <joana@camara.local>\nSubject: Dar acesso de administrador\nMessage-ID: <2@atacante.example>\n\nUrgente.")
+	writeMaildirMessage(t, dir, "3.auto", verified+"From: joana@camara.local\nSubject: Ausente\nAuto-Submitted: auto-replied\nMessage-ID: <3@camara.local>\n\nEstou de férias.")
+
+	processed, err := pollMailbox()
+	if err != nil || processed != 3 {
+		t.Fatalf("processadas %d, erro %v", processed, err)
+	}
+	var tickets []Ticket
+	db.Find(&tickets)
+	if len(tickets) != 1 || tickets[0].Title != "Monitor apagado" || tickets[0].CreatorID != joana.ID || tickets[0].Description != "O monitor não liga." {
+		t.Fatalf("chamados abertos: %+v", tickets)
+	}
+	var forged MailIntakeLog
+	db.First(&forged, "message_id = ?", "<2@atacante.example>")
+	if forged.Result != intakeResultIgnored || !strings.Contains(forged.Reason, "não autenticado") {
+		t.Errorf("e-mail forjado: %+v", forged)
+	}
+
+	// Resposta ao aviso do chamado vira comentário, sem o texto citado
+	writeMaildirMessage(t, dir, "4.resposta", verified+fmt.Sprintf("From: joana@camara.local\nSubject: RE: [Chamado #%d] Aberto: Monitor apagado\nMessage-ID: <4@camara.local>\n\nJá voltou a funcionar.\n\n> O chamado foi aberto.", tickets[0].ID))
+	writeMaildirMessage(t, dir, "5.repetido", verified+"From: Joana <joana@camara.local>\nSubject: Monitor apagado\nMessage-ID: <1@camara.local>\n\nO monitor não liga.")
+	if processed, err := pollMailbox(); err != nil || processed != 2 {
+		t.Fatalf("segunda leitura: processadas %d, erro %v", processed, err)
+	}
+	var comments []Comment
+	db.Where("ticket_id = ?", tickets[0].ID).Find(&comments)
+	if len(comments) != 1 || comments[0].Content != "Já voltou a funcionar." {
+		t.Errorf("comentários: %+v", comments)
+	}
+	var count int64
+	db.Model(&Ticket{}).Count(&count)
+	if count != 1 {
+		t.Errorf("mensagem repetida abriu outro chamado (%d chamados)", count)
+	}
+
+	// Todas as mensagens saem de new/ e vão para cur/ marcadas como lidas
+	if left, _ := os.ReadDir(filepath.Join(dir, "new")); len(left) != 0 {
+		t.Errorf("mensagens ainda em new/: %d", len(left))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cur", "1.novo:2,S")); err != nil {
+		t.Errorf("mensagem não movida para cur/: %v", err)
+	}
+}
+
+func TestMailIntakeRequiresSenderVerification(t *testing.T) {
+	setupTestDB(t)
+	createTestUser(t, "joana", "User", "joana@camara.local")
+	raw := []byte("From: joana@camara.local\r\nSubject: Teste\r\nMessage-ID: <x@camara.local>\r\n\r\nTexto")
+
+	// Sem MTA confiável nem domínios autorizados, nada é aceito
+	if entry, _ := processIncomingMail(raw); entry.Result != intakeResultIgnored || !strings.Contains(entry.Reason, "não verificável") {
+		t.Errorf("sem verificação configurada: %+v", entry)
+	}
+
+	setTestSetting(t, "mail_intake_allowed_domains", "camara.leg.br")
+	if entry, _ := processIncomingMail(raw); entry.Result != intakeResultIgnored || !strings.Contains(entry.Reason, "não autorizado") {
+		t.Errorf("domínio fora da lista: %+v", entry)
+	}
+
+	setTestSetting(t, "mail_intake_allowed_domains", "camara.leg.br, camara.local")
+	if entry, _ := processIncomingMail(raw); entry.Result != intakeResultTicket {
+		t.Errorf("domínio autorizado: %+v", entry)
+	}
+}
+
+func TestMaildirIntakeSkipsOversizedMessage(t *testing.T) {
+	setupTestDB(t)
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "new"), 0755)
+	setTestSetting(t, "mail_intake_source", mailSourceMaildir)
+	setTestSetting(t, "mail_intake_maildir", dir)
+	setTestSetting(t, "mail_intake_allowed_domains", "camara.local")
+	createTestUser(t, "joana", "User", "joana@camara.local")
+
+	writeMaildirMessage(t, dir, "1.grande", "From: joana@camara.local\nSubject: Anexo enorme\n\n")
+	os.Truncate(filepath.Join(dir, "new", "1.grande"), maxIncomingMail+1)
+	writeMaildirMessage(t, dir, "2.normal", "From: joana@camara.local\nSubject: Monitor apagado\nMessage-ID: <2@camara.local>\n\nO monitor não liga.")
+
+	if processed, err := pollMailbox(); err != nil || processed != 2 {
+		t.Fatalf("processadas %d, erro %v", processed, err)
+	}
+	var oversized MailIntakeLog
+	db.First(&oversized, "result = ?", intakeResultIgnored)
+	if !strings.Contains(oversized.Reason, "acima de") {
+		t.Errorf("mensagem grande: %+v", oversized)
+	}
+	var count int64
+	db.Model(&Ticket{}).Count(&count)
+	if count != 1 {
+		t.Errorf("%d chamados abertos, esperado 1", count)
+	}
+	if left, _ := os.ReadDir(filepath.Join(dir, "new")); len(left) != 0 {
+		t.Errorf("mensagens ainda em new/: %d", len(left))
+	}
+}
+
+func TestIMAPFetchDiscardsOversizedLiteral(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		r := bufio.NewReader(server)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			tag, cmd, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+			switch cmd {
+			case "UID SEARCH UNSEEN":
+				fmt.Fprintf(server, "* SEARCH 7 8\r\n%s OK\r\n", tag)
+			case "UID FETCH 7 (BODY.PEEK[])":
+				fmt.Fprintf(server, "* 1 FETCH (UID 7 BODY[] {%d}\r\n", maxIncomingMail+1)
+				server.Write(make([]byte, maxIncomingMail+1))
+				fmt.Fprintf(server, ")\r\n%s OK\r\n", tag)
+			case "UID FETCH 8 (BODY.PEEK[])":
+				fmt.Fprintf(server, "* 2 FETCH (UID 8 BODY[] {10}\r\nSubject: x)\r\n%s OK\r\n", tag)
+			default:
+				fmt.Fprintf(server, "%s OK\r\n", tag)
+			}
+		}
+	}()
+
+	// A mensagem grande é descartada sem dessincronizar a conexão: a seguinte ainda é lida
+	s := &imapSource{conn: client, r: bufio.NewReader(client)}
+	messages, err := s.Fetch(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || !messages[0].TooLarge || messages[0].ID != "7" || messages[1].TooLarge || string(messages[1].Raw) != "Subject: x" {
+		t.Fatalf("mensagens = %+v", messages)
+	}
+	if err := s.Done("7"); err != nil {
+		t.Errorf("STORE \\Seen após a mensagem grande: %v", err)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ==========================================
+// CAIXAS DE E-MAIL (IMAP ou Maildir)
+// ==========================================
+//
+// A leitura de e-mails (mailintake.go) só precisa listar as mensagens novas e
+// marcá-las como processadas. O IMAP fala o mínimo do protocolo (LOGIN, SELECT,
+// SEARCH UNSEEN, FETCH BODY.PEEK[] e STORE \Seen); o Maildir lê os arquivos de
+// new/ e os move para cur/, útil em testes ou quando o MTA entrega localmente.
+
+// incomingMail é uma mensagem bruta (RFC 5322) ainda não processada
+type incomingMail struct {
+	ID       string // UID no IMAP, nome do arquivo no Maildir
+	Raw      []byte
+	TooLarge bool // Acima de maxIncomingMail: o conteúdo foi descartado
+}
+
+type mailSource interface {
+	Fetch(limit int) ([]incomingMail, error)
+	Done(id string) error // Marca como processada (não volta na próxima leitura)
+	Close()
+}
+
+const (
+	mailSourceIMAP    = "imap"
+	mailSourceMaildir = "maildir"
+	maxIncomingMail   = 30 << 20 // Mensagens maiores são descartadas sem processar
+)
+
+// openMailSource conecta à caixa configurada em mail_intake_source
+func openMailSource() (mailSource, error) {
+	switch source := getSettingValue("mail_intake_source", mailSourceIMAP); source {
+	case mailSourceMaildir:
+		dir := getSettingValue("mail_intake_maildir", "")
+		if dir == "" {
+			return nil, fmt.Errorf("Maildir não configurado (mail_intake_maildir)")
+		}
+		if _, err := os.Stat(filepath.Join(dir, "new")); err != nil {
+			return nil, fmt.Errorf("Maildir inválido: %w", err)
+		}
+		return maildirSource{dir: dir}, nil
+	case mailSourceIMAP:
+		return dialIMAP(imapConfig{
+			Host:     getSettingValue("imap_host", ""),
+			Port:     getSettingValue("imap_port", "993"),
+			TLS:      getSettingValue("imap_tls", "true") == "true",
+			Username: getSettingValue("imap_username", ""),
+			Password: getSettingValue("imap_password", ""),
+			Folder:   getSettingValue("imap_folder", "INBOX"),
+		})
+	default:
+		return nil, fmt.Errorf("origem de e-mail desconhecida: %s", source)
+	}
+}
+
+// --- Maildir ---
+
+type maildirSource struct {
+	dir string
+}
+
+func (s maildirSource) Fetch(limit int) ([]incomingMail, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, "new"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	var result []incomingMail
+	for _, e := range entries {
+		if len(result) >= limit {
+			break
+		}
+		if !e.Type().IsRegular() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		if info, err := e.Info(); err == nil && info.Size() > maxIncomingMail {
+			result = append(result, incomingMail{ID: e.Name(), TooLarge: true})
+			continue
+		}
+		f, err := os.Open(filepath.Join(s.dir, "new", e.Name()))
+		if err != nil {
+			return result, err
+		}
+		raw, err := io.ReadAll(io.LimitReader(f, maxIncomingMail))
+		f.Close()
+		if err != nil {
+			return result, err
+		}
+		result = append(result, incomingMail{ID: e.Name(), Raw: raw})
+	}
+	return result, nil
+}
+
+func (s maildirSource) Done(id string) error {
+	if err := os.MkdirAll(filepath.Join(s.dir, "cur"), 0755); err != nil {
+		return err
+	}
+	// Sufixo ":2,S" = lida, conforme a convenção do Maildir
+	return os.Rename(filepath.Join(s.dir, "new", id), filepath.Join(s.dir, "cur", id+":2,S"))
+}
+
+func (s maildirSource) Close() {}
+
+// --- IMAP ---
+
+type imapConfig struct {
+	Host     string
+	Port     string
+	TLS      bool // TLS implícito (porta 993)
+	Username string
+	Password string
+	Folder   string
+}
+
+type imapSource struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+// imapReply é uma resposta não marcada do servidor, com os literais já lidos
+type imapReply struct {
+	Line     string
+	Literals [][]byte
+}
+
+var imapLiteralPattern = regexp.MustCompile(`\{(\d+)\}$`)
+
+func dialIMAP(cfg imapConfig) (*imapSource, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("servidor IMAP não configurado (imap_host)")
+	}
+	addr := net.JoinHostPort(cfg.Host, cfg.Port)
+	dialer := &net.Dialer{Timeout: 15 * time.Second}
+	var conn net.Conn
+	var err error
+	if cfg.TLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: cfg.Host, MinVersion: tls.VersionTLS12})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("falha ao conectar ao IMAP %s: %w", addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Minute))
+
+	s := &imapSource{conn: conn, r: bufio.NewReader(conn)}
+	greeting, _, err := s.readReply()
+	if err != nil || !strings.HasPrefix(greeting, "* OK") {
+		conn.Close()
+		return nil, fmt.Errorf("saudação IMAP inesperada: %q", greeting)
+	}
+	if _, err := s.command("LOGIN " + imapQuote(cfg.Username) + " " + imapQuote(cfg.Password)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("falha no login IMAP: %w", err)
+	}
+	if _, err := s.command("SELECT " + imapQuote(cfg.Folder)); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("pasta IMAP %s: %w", cfg.Folder, err)
+	}
+	return s, nil
+}
+
+// imapQuote monta uma string entre aspas do IMAP
+func imapQuote(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r", "", "\n", "").Replace(value)
+	return `"` + value + `"`
+}
+
+// readReply lê uma resposta completa, incluindo literais {n} que podem ocupar várias linhas.
+// Literais acima de maxIncomingMail são lidos e descartados (ficam nil na lista) para a
+// conexão continuar sincronizada.
+func (s *imapSource) readReply() (string, [][]byte, error) {
+	var line strings.Builder
+	var literals [][]byte
+	for {
+		part, err := s.r.ReadString('\n')
+		if err != nil {
+			return line.String(), literals, err
+		}
+		part = strings.TrimRight(part, "\r\n")
+		line.WriteString(part)
+
+		m := imapLiteralPattern.FindStringSubmatch(part)
+		if m == nil {
+			return line.String(), literals, nil
+		}
+		size, _ := strconv.Atoi(m[1])
+		if size > maxIncomingMail {
+			if _, err := io.CopyN(io.Discard, s.r, int64(size)); err != nil {
+				return line.String(), literals, err
+			}
+			literals = append(literals, nil)
+			continue
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(s.r, data); err != nil {
+			return line.String(), literals, err
+		}
+		literals = append(literals, data)
+	}
+}
+
+// command envia um comando e devolve as respostas não marcadas até a conclusão
+func (s *imapSource) command(cmd string) ([]imapReply, error) {
+	s.tag++
+	tag := fmt.Sprintf("A%03d", s.tag)
+	if _, err := fmt.Fprintf(s.conn, "%s %s\r\n", tag, cmd); err != nil {
+		return nil, err
+	}
+
+	var replies []imapReply
+	for {
+		line, literals, err := s.readReply()
+		if err != nil {
+			return replies, err
+		}
+		if strings.HasPrefix(line, tag+" ") {
+			status := strings.TrimPrefix(line, tag+" ")
+			if !strings.HasPrefix(status, "OK") {
+				return replies, fmt.Errorf("IMAP: %s", status)
+			}
+			return replies, nil
+		}
+		replies = append(replies, imapReply{Line: line, Literals: literals})
+	}
+}
+
+func (s *imapSource) Fetch(limit int) ([]incomingMail, error) {
+	replies, err := s.command("UID SEARCH UNSEEN")
+	if err != nil {
+		return nil, err
+	}
+	var uids []string
+	for _, r := range replies {
+		if strings.HasPrefix(r.Line, "* SEARCH") {
+			uids = append(uids, strings.Fields(strings.TrimPrefix(r.Line, "* SEARCH"))...)
+		}
+	}
+
+	var result []incomingMail
+	for _, uid := range uids {
+		if len(result) >= limit {
+			break
+		}
+		if _, err := strconv.ParseUint(uid, 10, 32); err != nil {
+			continue
+		}
+		// BODY.PEEK não marca como lida: só Done marca, depois de processar
+		replies, err := s.command("UID FETCH " + uid + " (BODY.PEEK[])")
+		if err != nil {
+			return result, err
+		}
+		for _, r := range replies {
+			if strings.Contains(r.Line, " FETCH ") && len(r.Literals) > 0 {
+				result = append(result, incomingMail{ID: uid, Raw: r.Literals[0], TooLarge: r.Literals[0] == nil})
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+func (s *imapSource) Done(id string) error {
+	_, err := s.command("UID STORE " + id + ` +FLAGS.SILENT (\Seen)`)
+	return err
+}
+
+func (s *imapSource) Close() {
+	s.command("LOGOUT")
+	s.conn.Close()
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"sync"
@@ -13,7 +14,6 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/glebarez/sqlite"
-	"github.com/go-ldap/ldap/v3"
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
@@ -42,19 +42,44 @@ type AuditLog struct {
 	Entity    string    `json:"entity"`         // Ticket, User, Asset, Setting
 	EntityID  uint      `json:"entity_id"`
 	Details   string    `json:"details"` // Detalhes da mudança
+
+	// Ação feita durante personificação: UserID é o administrador real
+	ImpersonatedUserID *uint `json:"impersonated_user_id,omitempty"`
+	ImpersonatedUser   *User `json:"impersonated_user,omitempty"`
 }
 
 // Helper para registrar log
 func logAction(userID uint, action, entity string, entityID uint, details string) {
+	recordAudit(AuditLog{
+		UserID:   userID,
+		Action:   action,
+		Entity:   entity,
+		EntityID: entityID,
+		Details:  details,
+	})
+}
+
+// logRequestAction registra a ação do usuário autenticado (em personificação, o autor é o administrador real)
+func logRequestAction(c *gin.Context, action, entity string, entityID uint, details string) {
+	entry := AuditLog{
+		UserID:   getCurrentUserID(c),
+		Action:   action,
+		Entity:   entity,
+		EntityID: entityID,
+		Details:  details,
+	}
+	if impersonatorID := c.GetUint("impersonatorID"); impersonatorID > 0 {
+		target := entry.UserID
+		entry.UserID = impersonatorID
+		entry.ImpersonatedUserID = &target
+	}
+	recordAudit(entry)
+}
+
+func recordAudit(entry AuditLog) {
 	// Rodar em goroutine para não bloquear a request principal
 	go func() {
-		db.Create(&AuditLog{
-			UserID:   userID,
-			Action:   action,
-			Entity:   entity,
-			EntityID: entityID,
-			Details:  details,
-		})
+		db.Create(&entry)
 	}()
 }
 
@@ -100,14 +125,24 @@ func performBackup(dir string) {
 	} else {
 		fmt.Println("[Backup] Sucesso!")
 	}
+
+	// Anexos ficam fora do banco: cópia incremental em <dir>/attachments
+	backupAttachments(dir)
 }
 
 func cleanupOldBackups(dir string) {
 	// Manter apenas ultimos 7 arquivos
-	files, err := os.ReadDir(dir)
+	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return
 	}
+	// Só os arquivos do banco (a pasta de anexos é mantida)
+	var files []os.DirEntry
+	for _, f := range entries {
+		if !f.IsDir() && strings.HasPrefix(f.Name(), "backup_auto_") {
+			files = append(files, f)
+		}
+	}
 
 	if len(files) > 10 {
 		// Simples: deletar os mais antigos se tiver mais de 10
@@ -144,8 +179,31 @@ type User struct {
 	Role      string    `gorm:"default:'Tech'" json:"role"` // Admin, Tech
 	FullName  string    `json:"full_name"`
 	Avatar    string    `json:"avatar"`
+	Sector    string    `json:"sector"` // Setor (preenchido pelo mapeamento do AD ou manualmente)
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// Dados cadastrais (importados do AD pela sincronização)
+	Email      string `json:"email"`
+	Department string `json:"department"`
+	Phone      string `json:"phone"`
+
+	// Conta desativada não faz login (ex.: desabilitada ou removida do AD)
+	Active             bool       `gorm:"default:true" json:"active"`
+	DeactivatedAt      *time.Time `json:"deactivated_at"`
+	DeactivationReason string     `json:"deactivation_reason"`
+
+	// Política de senhas
+	MustChangePassword bool       `json:"must_change_password"`
+	PasswordChangedAt  *time.Time `json:"password_changed_at"`
+
+	// Vínculo com o provedor OpenID Connect (claim "sub")
+	OIDCSubject string `gorm:"column:oidc_subject;index" json:"-"`
+
+	// Autenticação em dois fatores (TOTP)
+	TOTPSecret      string `json:"-"`
+	TOTPEnabled     bool   `json:"totp_enabled"`
+	TOTPLastCounter int64  `json:"-"` // Último código aceito (impede reuso)
 }
 
 // Asset representa um equipamento no inventário
@@ -197,7 +255,7 @@ type Ticket struct {
 
 	Title       string    `gorm:"not null" json:"title"`
 	Description string    `json:"description"`
-	Status      string    `gorm:"default:'Novo'" json:"status"` // Novo, Em Andamento, Resolvido
+	Status      string    `gorm:"default:'Novo'" json:"status"` // Ver TicketStatus (workflow.go)
 	Priority    string    `json:"priority"`                     // Baixa, Media, Alta
 	DueDate     time.Time `json:"due_date"`                     // SLA
 
@@ -219,27 +277,37 @@ type Ticket struct {
 	AssignedToID *uint            `json:"assigned_to_id"`
 	AssignedTo   *User            `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"assigned_to,omitempty"`
 
+	// Nota exigida pelo fluxo ao resolver
+	ResolutionNote string `json:"resolution_note"`
+
 	// Relacionamento: Um Ticket tem muitos Comentários
 	Comments []Comment `json:"comments"`
+
+	// Anexos do chamado e dos comentários (comment_id preenchido)
+	Attachments []Attachment `json:"attachments"`
 }
 
-// BeforeCreate hook for Ticket (SLA Calculation)
-func (t *Ticket) BeforeCreate(tx *gorm.DB) (err error) {
-	// Definição de SLA simples
+// priorityDueDate calcula o prazo do chamado pela prioridade (SLA simples)
+func priorityDueDate(from time.Time, priority string) time.Time {
 	hoursToAdd := 24 // Default (Media)
-	switch t.Priority {
+	switch priority {
 	case "Alta":
 		hoursToAdd = 8
 	case "Baixa":
 		hoursToAdd = 48
 	}
-	t.DueDate = time.Now().Add(time.Duration(hoursToAdd) * time.Hour)
+	return from.Add(time.Duration(hoursToAdd) * time.Hour)
+}
+
+// BeforeCreate hook for Ticket (SLA Calculation)
+func (t *Ticket) BeforeCreate(tx *gorm.DB) (err error) {
+	t.DueDate = priorityDueDate(time.Now(), t.Priority)
 
 	// Lógica de Atribuição Automática baseada na Categoria
 	if t.CategoryID != nil && *t.CategoryID > 0 && (t.AssignedToID == nil || *t.AssignedToID == 0) {
 		var category ServiceCategory
 		if err := tx.First(&category, *t.CategoryID).Error; err == nil {
-			t.AssignedToID = &category.DefaultUserID
+			t.AssignedToID = categoryDefaultAssignee(tx, category) // Responsável desativado não recebe chamados
 		}
 	}
 
@@ -253,9 +321,15 @@ type Comment struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
-	TicketID uint   `json:"ticket_id"`
-	Content  string `gorm:"not null" json:"content" binding:"required"`
-	Author   string `json:"author"` // Por enquanto, string simples (ex: "Tecnico")
+	TicketID   uint       `json:"ticket_id"`
+	Content    string     `gorm:"not null" json:"content"`
+	AuthorID   *uint      `gorm:"index" json:"author_id"`            // Definido pelo token (nulo em mensagens do sistema)
+	Author     string     `json:"author"`                            // Nome exibido no momento da escrita
+	AuthorType string     `gorm:"default:'user'" json:"author_type"` // user ou system (ver comments.go)
+	Internal   bool       `json:"internal"`                          // Nota interna: invisível ao solicitante (ticket.internal_notes)
+	EditedAt   *time.Time `json:"edited_at"`                         // Última edição pelo autor
+
+	Attachments []Attachment `json:"attachments,omitempty"`
 }
 
 // AssetHistory registra alterações nos ativos
@@ -298,11 +372,10 @@ func (a *Asset) BeforeUpdate(tx *gorm.DB) (err error) {
 
 // Variável global para o banco de dados
 var db *gorm.DB
-var jwtSecret = []byte("super_secret_key_change_me_in_prod")
 
 // SystemSetting define configurações globais de permissão
 type SystemSetting struct {
-	Key         string `gorm:"primaryKey" json:"key"` // ex: "user_view_reports"
+	Key         string `gorm:"primaryKey" json:"key"` // ex: "system_notice"
 	Value       string `json:"value"`                 // ex: "true", "false"
 	Description string `json:"description"`
 }
@@ -310,15 +383,98 @@ type SystemSetting struct {
 // Inicializa configurações padrão se não existirem
 func seedSettings() {
 	defaults := []SystemSetting{
-		{Key: "user_view_reports", Value: "false", Description: "Permitir que usuários comuns visualizem relatórios"},
-		{Key: "tech_delete_assets", Value: "false", Description: "Permitir que técnicos excluam ativos"},
-		{Key: "tech_delete_tickets", Value: "false", Description: "Permitir que técnicos excluam chamados"},
+		// Segurança
+		{Key: "totp_required_roles", Value: "", Description: "Perfis com 2FA (TOTP) obrigatório, separados por vírgula (ex: Admin,Supervisor)"},
+		{Key: "login_max_attempts_user", Value: "5", Description: "Falhas de login por usuário antes do bloqueio temporário"},
+		{Key: "login_max_attempts_ip", Value: "20", Description: "Falhas de login por IP antes do bloqueio temporário"},
+		{Key: "login_lockout_minutes", Value: "15", Description: "Duração do bloqueio temporário de login (minutos)"},
+		{Key: "login_delay_step_seconds", Value: "1", Description: "Atraso progressivo entre tentativas com falha (segundos, dobra a cada falha)"},
+		{Key: "login_failure_window_minutes", Value: "15", Description: "Janela em que falhas de login são acumuladas (minutos)"},
+		// Política de senhas
+		{Key: "password_min_length", Value: "8", Description: "Tamanho mínimo da senha"},
+		{Key: "password_require_upper", Value: "true", Description: "Exigir letra maiúscula na senha (true/false)"},
+		{Key: "password_require_lower", Value: "true", Description: "Exigir letra minúscula na senha (true/false)"},
+		{Key: "password_require_digit", Value: "true", Description: "Exigir número na senha (true/false)"},
+		{Key: "password_require_symbol", Value: "false", Description: "Exigir símbolo na senha (true/false)"},
+		{Key: "password_history_count", Value: "5", Description: "Quantidade de senhas anteriores que não podem ser reutilizadas (0 = desativado)"},
+		{Key: "password_max_age_days", Value: "0", Description: "Validade máxima da senha em dias (0 = sem expiração)"},
+		{Key: "password_reset_ttl_minutes", Value: "30", Description: "Validade do link de recuperação de senha enviado por e-mail (minutos)"},
+		{Key: "impersonation_max_minutes", Value: "30", Description: "Duração máxima da personificação de usuários por administradores (minutos)"},
+		{Key: "api_token_max_days", Value: "365", Description: "Validade máxima de tokens de API pessoais em dias (0 = sem limite)"},
 		// Configurações LDAP
 		{Key: "ldap_enabled", Value: "false", Description: "Habilitar autenticação AD/LDAP (true/false)"},
 		{Key: "ldap_host", Value: "192.168.1.5", Description: "IP ou Hostname do servidor LDAP"},
 		{Key: "ldap_port", Value: "389", Description: "Porta do LDAP (padrão 389 ou 636 para SSL)"},
 		{Key: "ldap_basedn", Value: "dc=camara,dc=local", Description: "Base DN para busca de usuários"},
 		{Key: "ldap_domain", Value: "CAMARA", Description: "Domínio (NetBIOS) para login (ex: CAMARA\\user)"},
+		{Key: "ldap_tls_mode", Value: "none", Description: "Criptografia da conexão LDAP: none, starttls ou ldaps"},
+		{Key: "ldap_ca_file", Value: "", Description: "Caminho do bundle de CA (PEM) para validar o certificado do servidor LDAP"},
+		{Key: "ldap_bind_dn", Value: "", Description: "DN da conta de serviço para busca do usuário (vazio = bind direto DOMINIO\\usuario)"},
+		{Key: "ldap_bind_password", Value: "", Description: "Senha da conta de serviço LDAP"},
+		{Key: "ldap_role_mapping", Value: "", Description: "JSON grupo do AD -> perfil, aplicado a cada login; em vários grupos vence o perfil de maior prioridade (ex: {\"CN=TI-Admins,OU=Grupos,DC=camara,DC=local\": \"Admin\", \"TI-Tecnicos\": \"Tech\"})"},
+		{Key: "ldap_sector_mapping", Value: "", Description: "JSON grupo ou OU do AD -> setor do solicitante (ex: {\"OU=Financeiro,DC=camara,DC=local\": \"Financeiro\"})"},
+		{Key: "ldap_user_filter", Value: "(&(objectClass=user)(sAMAccountName={username}))", Description: "Filtro de busca do usuário ({username} é substituído). OpenLDAP: (uid={username})"},
+		{Key: "ldap_sync_enabled", Value: "false", Description: "Sincronizar periodicamente os usuários do AD (requer conta de serviço)"},
+		{Key: "ldap_sync_interval_hours", Value: "24", Description: "Intervalo da sincronização de usuários do AD (horas)"},
+		{Key: "ldap_sync_filter", Value: "(&(objectClass=user)(objectCategory=person))", Description: "Filtro LDAP dos usuários importados pela sincronização. OpenLDAP: (objectClass=inetOrgPerson)"},
+		{Key: "ldap_username_attribute", Value: "sAMAccountName", Description: "Atributo com o login do usuário na sincronização. OpenLDAP: uid"},
+		// OpenID Connect (SSO)
+		{Key: "oidc_enabled", Value: "false", Description: "Habilitar login via OpenID Connect (true/false)"},
+		{Key: "oidc_issuer", Value: "", Description: "URL do emissor OIDC (ex: https://sso.camara.local/realms/camara)"},
+		{Key: "oidc_client_id", Value: "", Description: "Client ID registrado no provedor OIDC"},
+		{Key: "oidc_client_secret", Value: "", Description: "Client secret (vazio para cliente público, apenas PKCE)"},
+		{Key: "oidc_redirect_url", Value: "", Description: "URL de retorno registrada no provedor (vazio = https://<host>/api/v1/auth/oidc/callback)"},
+		{Key: "oidc_scopes", Value: "openid profile email groups", Description: "Escopos solicitados ao provedor OIDC"},
+		{Key: "oidc_username_claim", Value: "preferred_username", Description: "Claim usada como login do usuário (fallback: email, sub)"},
+		{Key: "oidc_groups_claim", Value: "groups", Description: "Claim com os grupos do usuário"},
+		{Key: "oidc_role_mapping", Value: "", Description: "JSON grupo OIDC -> perfil, aplicado a cada login; em vários grupos vence o perfil de maior prioridade (ex: {\"ti-admins\": \"Admin\", \"ti-tecnicos\": \"Tech\"})"},
+		{Key: "oidc_button_label", Value: "Entrar com SSO", Description: "Texto do botão de SSO na tela de login"},
+		// E-mail (SMTP)
+		{Key: "smtp_enabled", Value: "false", Description: "Habilitar envio de e-mails (true/false)"},
+		{Key: "smtp_host", Value: "", Description: "Servidor SMTP (ex: smtp.camara.local)"},
+		{Key: "smtp_port", Value: "25", Description: "Porta do SMTP (25, 587 com STARTTLS ou 465 com TLS)"},
+		{Key: "smtp_tls_mode", Value: "none", Description: "Criptografia da conexão SMTP: none, starttls ou tls"},
+		{Key: "smtp_username", Value: "", Description: "Usuário do SMTP (vazio = sem autenticação)"},
+		{Key: "smtp_password", Value: "", Description: "Senha do SMTP"},
+		{Key: "smtp_from", Value: "", Description: "Remetente dos e-mails (ex: CâmaraGestão <suporte@camara.local>)"},
+		{Key: "app_base_url", Value: "", Description: "Endereço público do sistema usado em links de e-mail, ex: https://chamados.camara.local (obrigatório para a recuperação de senha; vazio = e-mails sem links)"},
+		{Key: "email_notifications_enabled", Value: "true", Description: "Enviar avisos de chamados por e-mail (abertura, atribuição, comentários, status, SLA e menções)"},
+		{Key: "sla_warning_percent", Value: "80", Description: "Avisar o responsável quando o chamado consumir esta porcentagem do SLA (0 = não avisar)"},
+		{Key: "notification_retention_days", Value: "90", Description: "Dias que as notificações já lidas ficam guardadas"},
+		{Key: "webhook_max_attempts", Value: "8", Description: "Tentativas de entrega de cada webhook antes de desistir (espera dobra a cada falha, de 30s até 6h)"},
+		{Key: "webhook_timeout_seconds", Value: "10", Description: "Tempo máximo de resposta do receptor de webhooks"},
+		{Key: "webhook_log_retention_days", Value: "30", Description: "Dias que o registro de entregas de webhooks é mantido"},
+		{Key: "email_max_attempts", Value: "5", Description: "Tentativas de envio de cada e-mail antes de desistir"},
+		// Abertura de chamados por e-mail
+		{Key: "mail_intake_enabled", Value: "false", Description: "Ler a caixa de suporte e abrir chamados a partir dos e-mails (true/false)"},
+		{Key: "mail_intake_source", Value: "imap", Description: "Origem dos e-mails: imap ou maildir"},
+		{Key: "mail_intake_interval_minutes", Value: "2", Description: "Intervalo entre as leituras da caixa (minutos)"},
+		{Key: "mail_intake_batch_size", Value: "50", Description: "Máximo de mensagens processadas por leitura"},
+		{Key: "imap_host", Value: "", Description: "Servidor IMAP da caixa de suporte (ex: mail.camara.local)"},
+		{Key: "imap_port", Value: "993", Description: "Porta do IMAP (993 com TLS, 143 sem)"},
+		{Key: "imap_tls", Value: "true", Description: "Conectar ao IMAP com TLS (true/false)"},
+		{Key: "imap_username", Value: "", Description: "Usuário da caixa de suporte"},
+		{Key: "imap_password", Value: "", Description: "Senha da caixa de suporte"},
+		{Key: "imap_folder", Value: "INBOX", Description: "Pasta lida no IMAP"},
+		{Key: "mail_intake_maildir", Value: "", Description: "Diretório Maildir lido quando a origem é maildir (contém new/ e cur/)"},
+		{Key: "mail_intake_category_id", Value: "0", Description: "Categoria dos chamados abertos por e-mail (0 = sem categoria)"},
+		{Key: "mail_intake_priority", Value: "Media", Description: "Prioridade dos chamados abertos por e-mail (Baixa, Media, Alta)"},
+		{Key: "mail_intake_ignore", Value: "mailer-daemon,postmaster,noreply,no-reply,resposta automática,automatic reply,fora do escritório,out of office,ausência temporária", Description: "Remetentes ou trechos de assunto ignorados (separados por vírgula)"},
+		{Key: "mail_intake_trusted_authserv_id", Value: "", Description: "Identificador (authserv-id) do MTA que grava o Authentication-Results; exige SPF, DKIM ou DMARC aprovado para o domínio do remetente"},
+		{Key: "mail_intake_allowed_domains", Value: "", Description: "Domínios de remetente aceitos, separados por vírgula (ex: camara.local). Pressupõe que o MTA recusa e-mails externos que usam esses domínios. Sem esta opção nem a anterior, nenhum e-mail é aceito"},
+		{Key: "mail_intake_max_per_hour", Value: "20", Description: "Máximo de e-mails aceitos por remetente por hora (proteção contra loops)"},
+		{Key: "comment_edit_window_minutes", Value: "15", Description: "Prazo para o autor editar ou excluir um comentário (minutos)"},
+		// Anexos e armazenamento
+		{Key: "attachment_max_mb", Value: "10", Description: "Tamanho máximo de cada anexo (MB)"},
+		{Key: "attachment_max_files", Value: "5", Description: "Quantidade máxima de anexos por envio"},
+		{Key: "attachment_allowed_extensions", Value: "png,jpg,jpeg,gif,webp,bmp,pdf,txt,log,csv,doc,docx,xls,xlsx,odt,ods,zip", Description: "Extensões de arquivo permitidas em anexos, separadas por vírgula"},
+		{Key: "storage_backend", Value: "local", Description: "Onde gravar anexos novos: local (ATTACHMENTS_DIR) ou s3"},
+		{Key: "s3_endpoint", Value: "", Description: "URL do serviço compatível com S3 (ex: http://minio.camara.local:9000)"},
+		{Key: "s3_region", Value: "us-east-1", Description: "Região do S3"},
+		{Key: "s3_bucket", Value: "", Description: "Bucket dos anexos"},
+		{Key: "s3_access_key", Value: "", Description: "Access key do S3"},
+		{Key: "s3_secret_key", Value: "", Description: "Secret key do S3"},
+		{Key: "s3_path_style", Value: "true", Description: "Bucket no caminho da URL (MinIO) em vez do subdomínio (true/false)"},
 		// Avisos do Sistema
 		{Key: "system_notice", Value: "Bem-vindo ao sistema de gestão! Nenhum aviso importante no momento.", Description: "Aviso exibido no painel da TV e Dashboard"},
 	}
@@ -330,10 +486,24 @@ func seedSettings() {
 	}
 }
 
+// getSettingValue retorna o valor de uma configuração ou o fallback se não existir
+func getSettingValue(key, fallback string) string {
+	var setting SystemSetting
+	if err := db.First(&setting, "key = ?", key).Error; err != nil {
+		return fallback
+	}
+	return setting.Value
+}
+
 // ==========================================
 // 2. CONFIGURAÇÃO E INICIALIZAÇÃO
 // ==========================================
 
+// migrateDatabase cria/atualiza as tabelas de todos os modelos
+func migrateDatabase() error {
+	return db.AutoMigrate(&User{}, &Asset{}, &Ticket{}, &Comment{}, &AssetHistory{}, &ServiceCategory{}, &SystemSetting{}, &AuditLog{}, &UserSession{}, &SigningKey{}, &RecoveryCode{}, &LoginThrottle{}, &LDAPSyncReport{}, &OIDCLoginState{}, &PasswordHistory{}, &Permission{}, &Role{}, &APIToken{}, &PasswordResetToken{}, &TicketStatus{}, &WorkflowTransition{}, &TicketEvent{}, &Attachment{}, &CommentRevision{}, &TicketWatcher{}, &EmailOutbox{}, &NotificationTemplate{}, &NotificationOptOut{}, &MailIntakeLog{}, &Notification{}, &Webhook{}, &WebhookDelivery{})
+}
+
 func initDB() {
 	var err error
 	dbPath := os.Getenv("DB_PATH")
@@ -349,14 +519,22 @@ func initDB() {
 		panic("Falha ao conectar ao banco de dados: " + err.Error())
 	}
 
-	// AutoMigrate
-	err = db.AutoMigrate(&User{}, &Asset{}, &Ticket{}, &Comment{}, &AssetHistory{}, &ServiceCategory{}, &SystemSetting{}, &AuditLog{})
-	if err != nil {
+	if err := migrateDatabase(); err != nil {
 		panic("Falha na migração do banco de dados")
 	}
 
 	seedDatabase()
 	seedSettings()
+	seedRoles()
+	seedWorkflow()
+	seedNotificationTemplates()
+	migrateCommentAuthors()
+	migrateTicketWatchers()
+
+	// Carregar chaves de assinatura JWT
+	if err := loadSigningKeys(); err != nil {
+		panic("Falha ao carregar chaves JWT: " + err.Error())
+	}
 
 	// Iniciar agendador de backups
 	go startBackupScheduler()
@@ -403,10 +581,11 @@ func createSeedUser(username, role, fullName string) User {
 		fmt.Printf("[SEED] Usuário %s não existe, criando...\n", username)
 		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.DefaultCost)
 		user = User{
-			Username: username,
-			Password: string(hashedPassword),
-			Role:     role,
-			FullName: fullName,
+			Username:           username,
+			Password:           string(hashedPassword),
+			Role:               role,
+			FullName:           fullName,
+			MustChangePassword: true, // Senha padrão: trocar no primeiro login
 		}
 		if err := db.Create(&user).Error; err != nil {
 			fmt.Printf("[SEED] ERRO ao criar usuário %s: %v\n", username, err)
@@ -444,13 +623,22 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// 0. Bloqueio por excesso de tentativas (antes de consultar banco/AD)
+	if rejectThrottledLogin(c, input.Username) {
+		return
+	}
+
 	// 1. Tentar Login Local
 	var user User
 	if err := db.Where("username = ?", input.Username).First(&user).Error; err == nil {
 		// Usuário encontrado localmente
 		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err == nil {
-			// Senha correta -> Gerar Token
-			generateTokenAndRespond(c, user)
+			if !user.Active {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Usuário desativado"})
+				return
+			}
+			// Senha correta -> Gerar Token (ou desafio 2FA)
+			completeLogin(c, user)
 			return
 		}
 	}
@@ -470,144 +658,65 @@ func Login(c *gin.Context) {
 				// Cria novo usuário
 				localUser = User{
 					Username: input.Username,
-					FullName: ldapUser.FullName, // Assumindo que authenticateLDAP retorna isso
-					Role:     "User",            // Padrão
-					Password: "LDAP_MANAGED",    // Placeholder
+					Role:     "User",              // Padrão (ajustado pelo mapeamento de grupos)
+					Password: ldapManagedPassword, // Placeholder
+					Active:   true,
 				}
+				applyDirectoryProfile(&localUser, ldapUser)
 				db.Create(&localUser)
 			} else {
-				// Atualiza dados
-				localUser.FullName = ldapUser.FullName
+				if !localUser.Active {
+					c.JSON(http.StatusForbidden, gin.H{"error": "Usuário desativado"})
+					return
+				}
+				// Atualiza dados (perfil e setor seguem os grupos do AD a cada login)
+				applyDirectoryProfile(&localUser, ldapUser)
 				db.Save(&localUser)
 			}
 
-			generateTokenAndRespond(c, localUser)
+			completeLogin(c, localUser)
 			return
 		} else {
 			// fmt.Println("Erro LDAP:", err)
 		}
 	}
 
+	registerLoginFailure(input.Username, c.ClientIP())
 	c.JSON(http.StatusUnauthorized, gin.H{"error": "Credenciais inválidas"})
 }
 
 func generateTokenAndRespond(c *gin.Context, user User) {
-	// Gerar JWT
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userID":   user.ID,
-		"sub":      user.ID, // Adding sub just to be standard compliant
-		"username": user.Username,
-		"role":     user.Role,
-		"exp":      time.Now().Add(time.Hour * 8).Unix(),
-	})
+	// Criar sessão (refresh token) e gerar JWT de acesso vinculado a ela
+	session, refreshToken, err := createSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar sessão"})
+		return
+	}
 
-	tokenString, err := token.SignedString(jwtSecret)
+	tokenString, err := issueAccessToken(user, session)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gerar token"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"token": tokenString,
-		"user":  user,
+		"token":                     tokenString,
+		"refresh_token":             refreshToken,
+		"expires_in":                int(accessTokenTTL.Seconds()),
+		"user":                      user,
+		"two_factor_setup_required": twoFactorRequired(user) && !user.TOTPEnabled,
+		"password_change_required":  passwordChangeRequired(user),
+		"permissions":               permissionsForRole(user.Role),
 	})
 }
 
-// Stub para autenticação LDAP (precisa da lib go-ldap)
-// Retorna um struct temporário com dados do user
-type LDAPUser struct {
-	Username string
-	FullName string
-}
-
-func authenticateLDAP(username, password string) (*LDAPUser, error) {
-	// Carregar configurações
-	var host, port, domain, baseDN SystemSetting
-	db.First(&host, "key = ?", "ldap_host")
-	db.First(&port, "key = ?", "ldap_port")
-	db.First(&domain, "key = ?", "ldap_domain")
-	db.First(&baseDN, "key = ?", "ldap_basedn") // Novo campo para busca
-
-	// Validação básica
-	if host.Value == "" || port.Value == "" {
-		return nil, fmt.Errorf("LDAP não configurado corretamente (Host/Port vazios)")
-	}
-
-	// Conectar ao LDAP
-	ldapURL := fmt.Sprintf("ldap://%s:%s", host.Value, port.Value)
-	conn, err := ldap.DialURL(ldapURL)
-	if err != nil {
-		fmt.Printf("[LDAP] Erro de conexão: %v\n", err)
-		return nil, err
-	}
-	defer conn.Close()
-
-	// Timeout de operação
-	conn.SetTimeout(5 * time.Second)
-
-	// Bind (Login) usando formato NetBIOS: DOMAIN\Username
-	// Isso evita precisar de um "bind user" administrativo para buscar o DN do usuário
-	userPrincipal := fmt.Sprintf("%s\\%s", domain.Value, username)
-
-	fmt.Printf("[LDAP] Tentando bind com: %s\n", userPrincipal)
-	if err := conn.Bind(userPrincipal, password); err != nil {
-		fmt.Printf("[LDAP] Erro no Bind: %v\n", err)
-		return nil, err
-	}
-
-	// Autenticação Sucesso. Agora tentar buscar o nome completo.
-	fullName := username // Fallback
-
-	if baseDN.Value != "" {
-		filter := fmt.Sprintf("(&(objectClass=user)(sAMAccountName=%s))", username)
-		searchReq := ldap.NewSearchRequest(
-			baseDN.Value,
-			ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
-			filter,
-			[]string{"displayName", "cn", "mail"},
-			nil,
-		)
-
-		sr, err := conn.Search(searchReq)
-		if err == nil && len(sr.Entries) > 0 {
-			entry := sr.Entries[0]
-			if dn := entry.GetAttributeValue("displayName"); dn != "" {
-				fullName = dn
-			} else if cn := entry.GetAttributeValue("cn"); cn != "" {
-				fullName = cn
-			}
-			fmt.Printf("[LDAP] Encontrado Nome: %s\n", fullName)
-		} else {
-			fmt.Printf("[LDAP] Busca de nome falhou ou retorno vazio: %v\n", err)
-		}
-	}
-
-	return &LDAPUser{Username: username, FullName: fullName}, nil
-}
-
-// Check Role Middleware
-func RoleMiddleware(allowedRoles ...string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		role, exists := c.Get("role")
-		if !exists {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Permissão negada"})
-			return
-		}
-
-		userRole, ok := role.(string)
-		if !ok {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Role inválido"})
-			return
-		}
-		for _, r := range allowedRoles {
-			if r == userRole {
-				c.Next()
-				return
-			}
-		}
-
-		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Acesso restrito a " + fmt.Sprint(allowedRoles)})
-	}
+// Rotas liberadas enquanto o usuário ainda precisa cadastrar o 2FA obrigatório
+var twoFactorSetupRoutes = map[string]bool{
+	"/api/v1/logout":               true,
+	"/api/v1/auth/2fa/status":      true,
+	"/api/v1/auth/2fa/setup":       true,
+	"/api/v1/auth/2fa/enable":      true,
+	"/api/v1/auth/change-password": true,
 }
 
 // Auth Middleware
@@ -624,9 +733,35 @@ func AuthMiddleware() gin.HandlerFunc {
 			tokenString = tokenString[7:]
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
+		// Token de API pessoal: credencial própria, sem sessão nem restrições de login interativo.
+		// Só alcança as rotas declaradas em apiTokenRouteScopes, com o escopo exigido.
+		if strings.HasPrefix(tokenString, apiTokenPrefix) {
+			apiToken, user, err := authenticateAPIToken(c, tokenString)
+			if err == errAPITokenReadOnly {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			if ok, required := apiTokenRouteAllowed(c, apiToken.ScopeList(), user.Role); !ok {
+				if required == nil {
+					c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Rota indisponível para tokens de API"})
+				} else {
+					c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Escopo do token não cobre esta rota: " + strings.Join(required, " ou ")})
+				}
+				return
+			}
+			c.Set("userID", user.ID)
+			c.Set("role", user.Role)
+			c.Set("apiTokenID", apiToken.ID)
+			c.Set("apiTokenScopes", apiToken.ScopeList())
+			c.Next()
+			return
+		}
+
+		token, err := parseJWT(tokenString)
 
 		if err != nil || !token.Valid {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
@@ -634,21 +769,63 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		claims, ok := token.Claims.(jwt.MapClaims)
-		if ok && token.Valid {
-			// Set user context
-			// Check for both userID and sub to be robust
-			if val, ok := claims["userID"]; ok {
-				c.Set("userID", val)
-			} else {
-				c.Set("userID", claims["sub"])
-			}
-			c.Set("role", claims["role"])
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
+			return
 		}
 
+		// Validar sessão no banco: revogação (logout/admin) vale imediatamente
+		sid, _ := claims["sid"].(float64)
+		session, err := loadActiveSession(uint(sid))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Sessão expirada ou revogada"})
+			return
+		}
+
+		// Personificação: restrições próprias e auditoria de cada requisição
+		if session.ImpersonatorID != nil {
+			serveImpersonatedRequest(c, session)
+			return
+		}
+
+		// Senha provisória ou expirada: liberar apenas a troca de senha
+		if passwordChangeRequired(*session.User) && !passwordChangeRoutes[c.FullPath()] {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Altere sua senha para continuar",
+				"code":  "password_change_required",
+			})
+			return
+		}
+
+		// 2FA obrigatório para o perfil e ainda não cadastrado: liberar apenas o cadastro
+		if twoFactorRequired(*session.User) && !session.User.TOTPEnabled && !twoFactorSetupRoutes[c.FullPath()] {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Cadastre a autenticação em dois fatores para continuar",
+				"code":  "2fa_setup_required",
+			})
+			return
+		}
+
+		// Set user context (role vem do banco para refletir alterações imediatamente)
+		c.Set("userID", session.UserID)
+		c.Set("role", session.User.Role)
+		c.Set("sessionID", session.ID)
+
 		c.Next()
 	}
 }
 
+// getCurrentUserID extrai o ID do usuário autenticado do contexto
+func getCurrentUserID(c *gin.Context) uint {
+	userID, _ := c.Get("userID")
+	if val, ok := userID.(float64); ok {
+		return uint(val)
+	} else if val, ok := userID.(uint); ok {
+		return val
+	}
+	return 0
+}
+
 // --- ASSET HANDLERS ---
 
 func GetAssets(c *gin.Context) {
@@ -657,6 +834,9 @@ func GetAssets(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	for i := range assets {
+		hideAssetFinancials(c, &assets[i])
+	}
 	c.JSON(http.StatusOK, assets)
 }
 
@@ -729,36 +909,20 @@ func GetAssetHistory(c *gin.Context) {
 
 func GetTickets(c *gin.Context) {
 	var tickets []Ticket
-	role, _ := c.Get("role")
-	userID, _ := c.Get("userID")
 
-	query := db.Preload("Asset").Preload("Comments").Preload("Creator").Preload("Category").Preload("AssignedTo")
+	query := preloadVisibleComments(c, db.Preload("Asset")).Preload("Creator").Preload("Category").Preload("AssignedTo")
 
-	// Se for usuário comum, filtrar apenas os seus tickets
-	if role == "User" {
-		query = query.Where("creator_id = ?", userID)
-	}
+	// Escopo conforme permissões (mesmas regras de canViewTicket):
+	// ticket.view_all vê tudo; os demais veem os que abriram, que estão atribuídos a eles ou que acompanham,
+	// e quem tem ticket.view_queue também vê os chamados sem responsável (para pegar)
+	uid := getCurrentUserID(c)
 
-	// Se for técnico, ver tickets atribuídos a ele OU tickets sem atribuição (para pegar)
-	// Também vê tickets onde ele é o criador (caso ele mesmo abra um chamado)
-	// Se for técnico, ver tickets atribuídos a ele OU tickets sem atribuição (para pegar)
-	// Também vê tickets onde ele é o criador (caso ele mesmo abra um chamado)
-	// DEBUG LOGS
-	fmt.Printf("[GetTickets] Request por Role=%v, RawUserID=%v (Type: %T)\n", role, userID, userID)
-
-	if role == "Tech" {
-		var uid uint
-		if val, ok := userID.(float64); ok {
-			uid = uint(val)
-		} else if val, ok := userID.(uint); ok {
-			uid = val
+	if !hasPermission(c, "ticket.view_all") {
+		if hasPermission(c, "ticket.view_queue") {
+			query = query.Where("assigned_to_id = ? OR creator_id = ? OR assigned_to_id IS NULL OR id IN (?)", uid, uid, watchedTicketIDs(uid))
 		} else {
-			fmt.Printf("[GetTickets] ALERTA: UserID type desconhecido: %T\n", userID)
+			query = query.Where("assigned_to_id = ? OR creator_id = ? OR id IN (?)", uid, uid, watchedTicketIDs(uid))
 		}
-
-		fmt.Printf("[GetTickets] Filtrando para Tech ID: %d\n", uid)
-		// Tech vê: Tickets atribuídos a ele, tickets que ele criou, OU tickets não atribuídos (para pegar)
-		query = query.Where("assigned_to_id = ? OR creator_id = ? OR assigned_to_id IS NULL", uid, uid)
 	}
 
 	if err := query.Order("created_at desc").Find(&tickets).Error; err != nil {
@@ -766,12 +930,31 @@ func GetTickets(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	for i := range tickets {
+		hideAssetFinancials(c, tickets[i].Asset)
+	}
 	c.JSON(http.StatusOK, tickets)
 }
 
+// Configurações sensíveis: o valor nunca é devolvido pela API
+var secretSettings = map[string]bool{
+	"ldap_bind_password": true,
+	"oidc_client_secret": true,
+	"smtp_password":      true,
+	"s3_secret_key":      true,
+	"imap_password":      true,
+}
+
+const maskedSettingValue = "********"
+
 func GetSettings(c *gin.Context) {
 	var settings []SystemSetting
 	db.Find(&settings)
+	for i := range settings {
+		if secretSettings[settings[i].Key] && settings[i].Value != "" {
+			settings[i].Value = maskedSettingValue
+		}
+	}
 	c.JSON(http.StatusOK, settings)
 }
 
@@ -782,23 +965,38 @@ func UpdateSetting(c *gin.Context) {
 		return
 	}
 
-	role, _ := c.Get("role")
 	key := c.Param("key")
 
-	// Validação de Permissão: Supervisor só pode alterar system_notice
-	if role == "Supervisor" && key != "system_notice" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Supervisor só pode alterar avisos do sistema"})
+	// Quem tem apenas settings.notice só pode alterar o aviso do sistema
+	if !hasPermission(c, "settings.manage") && key != "system_notice" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Sem permissão para alterar esta configuração"})
 		return
 	}
 
+	if key == "ldap_role_mapping" || key == "ldap_sector_mapping" || key == "oidc_role_mapping" {
+		if err := validateDirectoryMappingSetting(key, input.Value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	// Apenas atualiza o valor, key é fixa
 	var setting SystemSetting
 	if err := db.First(&setting, "key = ?", key).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Configuração não encontrada"})
 		return
 	}
+	// Valor mascarado reenviado pelo painel: manter o segredo atual
+	if secretSettings[key] && input.Value == maskedSettingValue {
+		c.JSON(http.StatusOK, gin.H{"key": key, "value": maskedSettingValue})
+		return
+	}
+
 	setting.Value = input.Value
 	db.Save(&setting)
+	if secretSettings[key] && setting.Value != "" {
+		setting.Value = maskedSettingValue
+	}
 	c.JSON(http.StatusOK, setting)
 }
 
@@ -817,6 +1015,10 @@ func CreateCategory(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !categoryUsersActive(input) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Responsável padrão ou de escalonamento desativado"})
+		return
+	}
 	if err := db.Create(&input).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar categoria"})
 		return
@@ -835,6 +1037,10 @@ func UpdateCategory(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !categoryUsersActive(input) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Responsável padrão ou de escalonamento desativado"})
+		return
+	}
 
 	category.Name = input.Name
 	category.DefaultUserID = input.DefaultUserID
@@ -856,16 +1062,24 @@ func DeleteCategory(c *gin.Context) {
 func CreateTicket(c *gin.Context) {
 	// Estrutura auxiliar para receber o JSON
 	var input struct {
-		Title       string `json:"title" binding:"required"`
-		Description string `json:"description" binding:"required"`
-		Priority    string `json:"priority"`
-		TicketType  string `json:"ticket_type"`
-		AssetID     *uint  `json:"asset_id"` // Opcional
-		CategoryID  *uint  `json:"category_id"`
-		RequesterID *uint  `json:"requester_id"` // Novo campo: se Tech abrir para User
+		Title       string `json:"title" form:"title" binding:"required"`
+		Description string `json:"description" form:"description" binding:"required"`
+		Priority    string `json:"priority" form:"priority"`
+		TicketType  string `json:"ticket_type" form:"ticket_type"`
+		AssetID     *uint  `json:"asset_id" form:"asset_id"` // Opcional
+		CategoryID  *uint  `json:"category_id" form:"category_id"`
+		RequesterID *uint  `json:"requester_id" form:"requester_id"` // Novo campo: se Tech abrir para User
+		Sector      string `json:"sector" form:"sector"`
+		Patrimony   string `json:"patrimony" form:"patrimony"`
+	}
+
+	// JSON ou multipart/form-data (com anexos no campo "files")
+	uploads, err := collectUploads(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-
-	if err := c.ShouldBindJSON(&input); err != nil {
+	if err := c.ShouldBind(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -877,38 +1091,42 @@ func CreateTicket(c *gin.Context) {
 		// TicketType removido pois nao existe na struct
 		AssetID:    input.AssetID,
 		CategoryID: input.CategoryID,
-		Status:     "Novo", // Sempre Novo
+		Status:     initialTicketStatus(), // Sempre o status inicial do fluxo
+		Sector:     input.Sector,
+		Patrimony:  input.Patrimony,
 	}
 
-	currentUserID := uint(0)
-	userRole := ""
-	if userID, exists := c.Get("userID"); exists {
-		if val, ok := userID.(float64); ok {
-			currentUserID = uint(val)
-		} else if val, ok := userID.(uint); ok {
-			currentUserID = val
-		}
-	}
-	if role, exists := c.Get("role"); exists {
-		userRole = role.(string)
-	}
+	currentUserID := getCurrentUserID(c)
 
 	// Lógica para definir CreatorID
-	if userRole != "User" && input.RequesterID != nil && *input.RequesterID > 0 {
-		// Se for Tech/Admin e mandou RequesterID, usa ele
+	if hasPermission(c, "ticket.create_for_others") && input.RequesterID != nil && *input.RequesterID > 0 {
+		// Se puder abrir em nome de outros e mandou RequesterID, usa ele (pode ser um usuário importado do AD que nunca fez login)
+		var requester User
+		if err := db.Select("id", "active").First(&requester, *input.RequesterID).Error; err != nil || !requester.Active {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Solicitante inválido ou desativado"})
+			return
+		}
 		ticket.CreatorID = *input.RequesterID
 	} else {
 		// Senão, o criador é quem está logado
 		ticket.CreatorID = currentUserID
 	}
 
+	// Setor não informado: usar o setor do solicitante (sincronizado com o AD)
+	if ticket.Sector == "" {
+		var requester User
+		if err := db.Select("sector").First(&requester, ticket.CreatorID).Error; err == nil {
+			ticket.Sector = requester.Sector
+		}
+	}
+
 	// Tentativa automática de atribuição (se categoria tiver default e não for o proprio criador técnico criando pra ele mesmo?)
 	// Se for Tech criando, talvez ele queira ja pegar?
 	// Por enquanto mantemos a lógica da categoria (Auto Assign)
 	var cat ServiceCategory
 	if ticket.CategoryID != nil {
-		if err := db.First(&cat, *ticket.CategoryID).Error; err == nil && cat.DefaultUserID > 0 {
-			ticket.AssignedToID = &cat.DefaultUserID
+		if err := db.First(&cat, *ticket.CategoryID).Error; err == nil {
+			ticket.AssignedToID = categoryDefaultAssignee(db, cat)
 		}
 	}
 
@@ -917,120 +1135,152 @@ func CreateTicket(c *gin.Context) {
 		return
 	}
 
-	db.Preload("Asset").Preload("Creator").Preload("Category").Preload("AssignedTo").First(&ticket, ticket.ID)
+	if saved, err := saveAttachments(c, ticket.ID, nil, uploads); err != nil {
+		fmt.Printf("[ANEXOS] Erro ao gravar anexos do chamado %d: %v\n", ticket.ID, err)
+		discardAttachments(saved)
+		db.Delete(&ticket)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gravar anexos. O chamado não foi aberto."})
+		return
+	}
+
+	recordTicketEvent(db, c, ticket.ID, ticketEventCreated, "", ticket.Status, "")
+	addTicketWatcher(db, ticket.ID, ticket.CreatorID, watchReasonCreator, &currentUserID)
+	recordAssignmentChange(db, c, ticket.ID, nil, ticket.AssignedToID, "Responsável padrão da categoria")
+
+	db.Preload("Asset").Preload("Creator").Preload("Category").Preload("AssignedTo").Preload("Attachments").First(&ticket, ticket.ID)
 
 	// Audit
 	details := fmt.Sprintf("Título: %s | Prio: %s", ticket.Title, ticket.Priority)
 	if ticket.CreatorID != currentUserID {
 		details += fmt.Sprintf(" | Aberto para ID: %d", ticket.CreatorID)
 	}
-	logAction(currentUserID, "CREATE", "Ticket", ticket.ID, details)
+	logRequestAction(c, "CREATE", "Ticket", ticket.ID, details)
+
+	// O solicitante recebe a confirmação mesmo quando ele próprio abriu o chamado
+	notice := newTicketNotice(c, noticeTicketCreated, ticket.ID, fmt.Sprintf("Chamado #%d aberto: %s", ticket.ID, ticket.Title))
+	notice.Message = ticket.Description
+	notice.NewValue = ticket.Status
+	notice.Recipients = append([]uint{ticket.CreatorID}, noticeRecipients(notice, ticketWatcherIDs(ticket.ID), ticket.CreatorID)...)
+	publishTicketNotice(notice)
+	publishTicketChange(streamTicketCreated, ticket.ID)
 
 	c.JSON(http.StatusCreated, ticket)
 }
 
 func GetTicketByID(c *gin.Context) {
 	var ticket Ticket
-	if err := db.Preload("Asset").Preload("Comments").Preload("Category").Preload("AssignedTo").First(&ticket, c.Param("id")).Error; err != nil {
+	query := preloadVisibleAttachments(c, preloadVisibleComments(c, db.Preload("Asset")))
+	if err := query.Preload("Comments.Attachments").Preload("Category").Preload("AssignedTo").First(&ticket, c.Param("id")).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
 		return
 	}
-	c.JSON(http.StatusOK, ticket)
-}
-
-func UpdateTicketStatus(c *gin.Context) {
-	var input struct {
-		Status string `json:"status" binding:"required"`
-	}
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !canViewTicket(c, ticket) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Você não tem permissão para ver este chamado"})
 		return
 	}
+	hideAssetFinancials(c, ticket.Asset)
+	c.JSON(http.StatusOK, ticket)
+}
 
+// DeleteTicket remove um chamado (ticket.delete)
+func DeleteTicket(c *gin.Context) {
 	var ticket Ticket
 	if err := db.First(&ticket, c.Param("id")).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
 		return
 	}
 
-	// Verificar permissões
-	userID, _ := c.Get("userID")
-	role, _ := c.Get("role")
-
-	var uid uint
-	if val, ok := userID.(float64); ok {
-		uid = uint(val)
-	} else if val, ok := userID.(uint); ok {
-		uid = val
-	}
-
-	// Tech e Admin podem tudo
-	// User só pode alterar status se for o criador E (geralmente Reabrir ou Cancelar, mas vamos deixar ele reabrir)
-	if role == "User" {
-		if ticket.CreatorID != uid {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Você não tem permissão para alterar este chamado"})
-			return
-		}
-		// Se quiser restringir quais status o User pode setar (ex: apenas "Novo" - reabrir)
-		// if input.Status != "Novo" && input.Status != "Cancelado" { ... }
-	}
-
-	ticket.Status = input.Status
-	db.Save(&ticket)
-
-	logAction(uid, "UPDATE", "Ticket", ticket.ID, fmt.Sprintf("Status alterado para %s", ticket.Status))
-
-	c.JSON(http.StatusOK, ticket)
+	db.Delete(&ticket)
+	logRequestAction(c, "DELETE", "Ticket", ticket.ID, fmt.Sprintf("Chamado excluído: %s", ticket.Title))
+	publishTicketDeleted(ticket)
+	c.JSON(http.StatusOK, gin.H{"message": "Chamado removido com sucesso"})
 }
 
 func AddComment(c *gin.Context) {
-	var input Comment
-	if err := c.ShouldBindJSON(&input); err != nil {
+	// O autor vem do token; o cliente envia só o texto e a visibilidade
+	var input struct {
+		Content  string `json:"content" form:"content"`
+		Internal bool   `json:"internal" form:"internal"`
+	}
+	// JSON ou multipart/form-data (com anexos no campo "files")
+	uploads, err := collectUploads(c)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := c.ShouldBind(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Internal && !canSeeInternalNotes(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Permissão necessária: ticket.internal_notes"})
+		return
+	}
+	if strings.TrimSpace(input.Content) == "" {
+		if len(uploads) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Escreva um comentário ou envie um anexo"})
+			return
+		}
+		input.Content = "📎 Anexo enviado"
+	}
 
-	// Link to ticket from URL param
-	input.TicketID = 0 // will be ignored if using struct binding usually, but let's be safe
-	// In Gin, we can't easily bind param to json struct field automatically in one go without logic
-	// But let's assume the user sends content and author in JSON.
-
-	// We need to set TicketID from param
-	// Using GORM association is better or just setting ID
 	var ticket Ticket
 	if err := db.First(&ticket, c.Param("id")).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
 		return
 	}
-	input.TicketID = ticket.ID
-
-	// AUTO-OPEN Logic: Se Tech/Admin comentar em ticket "Novo", muda para "Em Andamento" e atribui se necessário
-	role, _ := c.Get("role")
-	userID, _ := c.Get("userID")
+	if !canViewTicket(c, ticket) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Você não tem permissão para comentar neste chamado"})
+		return
+	}
+	comment := newUserComment(c, ticket.ID, input.Content)
+	comment.Internal = input.Internal
 
-	// Type Assertion Helper (dirty fix for localized scope)
-	var currentUID uint
-	if val, ok := userID.(float64); ok {
-		currentUID = uint(val)
-	} else if val, ok := userID.(uint); ok {
-		currentUID = val
+	// Comentário e anexos primeiro: se falharem, o chamado fica como estava
+	if err := db.Create(&comment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao registrar comentário"})
+		return
+	}
+	attachments, err := saveAttachments(c, ticket.ID, &comment.ID, uploads)
+	if err != nil {
+		fmt.Printf("[ANEXOS] Erro ao gravar anexos do comentário %d: %v\n", comment.ID, err)
+		discardAttachments(attachments)
+		db.Unscoped().Delete(&comment)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gravar anexos. O comentário não foi enviado."})
+		return
 	}
+	comment.Attachments = attachments
 
-	if (role == "Tech" || role == "Admin") && ticket.Status == "Novo" {
-		ticket.Status = "Em Andamento"
+	// AUTO-OPEN Logic: transição marcada como automática no fluxo (padrão: Novo -> Em Andamento) quando quem atende comenta
+	currentUID := getCurrentUserID(c)
+
+	// Notas internas não contam como resposta ao solicitante
+	if transition, ok := autoCommentTransition(c, ticket); ok && !input.Internal {
+		recordTicketEvent(db, c, ticket.ID, ticketEventStatus, ticket.Status, transition.ToStatus, "Automático ao comentar")
+		ticket.Status = transition.ToStatus
 
 		// Se não tiver dono, o técnico que respondeu assume
-		if ticket.AssignedToID == nil && currentUID > 0 {
+		if ticket.AssignedToID == nil && currentUID > 0 && hasPermission(c, "ticket.assignee") {
+			recordAssignmentChange(db, c, ticket.ID, nil, &currentUID, "Assumido ao comentar")
 			ticket.AssignedToID = &currentUID
 		}
 
 		db.Save(&ticket)
 		// Log de ação automática
-		logAction(currentUID, "UPDATE", "Ticket", ticket.ID, "Status atualizado automaticamente via chat")
+		logRequestAction(c, "UPDATE", "Ticket", ticket.ID, "Status atualizado automaticamente via chat")
 	}
 
-	db.Create(&input)
-	c.JSON(http.StatusCreated, input)
+	// Menções @usuario: o mencionado passa a acompanhar o chamado e é avisado
+	mentioned := processMentions(c, ticket, comment)
+
+	// Demais observadores recebem o aviso de comentário (os mencionados já foram avisados)
+	notice := newTicketNotice(c, noticeTicketComment, ticket.ID, fmt.Sprintf("%s comentou no chamado #%d", comment.Author, ticket.ID))
+	notice.Message = comment.Content
+	notice.Internal = comment.Internal
+	notifyTicketWatchers(notice, mentioned...)
+	publishTicketComment(ticket.ID, comment)
+
+	c.JSON(http.StatusCreated, comment)
 }
 
 // --- USER HANDLERS ---
@@ -1055,7 +1305,7 @@ func GetUsersSimple(c *gin.Context) {
 	var users []User
 	var result []UserSimple
 
-	if err := db.Select("id, full_name, username").Find(&users).Error; err != nil {
+	if err := db.Select("id, full_name, username").Where("active = ?", true).Find(&users).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -1076,30 +1326,57 @@ func GetUserByID(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
 		return
 	}
+	if user.ID != getCurrentUserID(c) && !hasPermission(c, "user.manage") && !hasPermission(c, "user.list") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Sem permissão para ver este usuário"})
+		return
+	}
 	c.JSON(http.StatusOK, user)
 }
 
 func CreateUser(c *gin.Context) {
 	var input struct {
-		Username string `json:"username" binding:"required"`
-		Password string `json:"password" binding:"required"`
-		Role     string `json:"role"`
+		Username           string `json:"username" binding:"required"`
+		Password           string `json:"password" binding:"required"`
+		Role               string `json:"role"`
+		Email              string `json:"email"`
+		MustChangePassword *bool  `json:"must_change_password"` // Padrão: true (senha definida pelo admin)
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao processar senha"})
+	if input.Role == "" {
+		input.Role = "User"
+	}
+	if !roleExists(input.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Perfil desconhecido: " + input.Role})
+		return
+	}
+	if !canManageRole(c, input.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Sem permissão para conceder o perfil " + input.Role})
+		return
+	}
+
+	if input.Email != "" && !validEmail(input.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "E-mail inválido"})
+		return
+	}
+
+	if err := validatePasswordPolicy(input.Password, input.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	user := User{
-		Username: input.Username,
-		Password: string(hashedPassword),
-		Role:     input.Role,
+		Username:           input.Username,
+		Role:               input.Role,
+		Email:              input.Email,
+		MustChangePassword: input.MustChangePassword == nil || *input.MustChangePassword,
+	}
+	if err := setUserPassword(&user, input.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao processar senha"})
+		return
 	}
 
 	if result := db.Create(&user); result.Error != nil {
@@ -1117,59 +1394,92 @@ func UpdateUser(c *gin.Context) {
 	}
 
 	var input struct {
-		Role     string `json:"role"`
-		Password string `json:"password"` // Opcional
-		FullName string `json:"full_name"`
-		Avatar   string `json:"avatar"`
+		Role            string `json:"role"`
+		Password        string `json:"password"`         // Opcional
+		CurrentPassword string `json:"current_password"` // Obrigatória para trocar a própria senha
+		FullName        string `json:"full_name"`
+		Avatar          string `json:"avatar"`
+		Sector          string `json:"sector"`
+		Email           string `json:"email"`
+
+		MustChangePassword *bool `json:"must_change_password"` // Apenas Admin
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	fmt.Printf("[UpdateUser] Atualizando usuário ID %d. Dados recebidos: Role=%s, FullName=%s, Password=%s (len=%d)\n",
-		user.ID, input.Role, input.FullName,
-		func() string {
-			if input.Password != "" {
-				return "***"
-			} else {
-				return "(vazio)"
-			}
-		}(),
-		len(input.Password))
-
 	// Permitir se for Admin OU se for o próprio usuário
 	currentUserID, _ := c.Get("userID")
-	role, _ := c.Get("role")
 
 	// Converte user.ID (uint) para comparar
 	isSelf := fmt.Sprintf("%v", user.ID) == fmt.Sprintf("%v", currentUserID)
-	isAdmin := role == "Admin"
+	isAdmin := hasPermission(c, "user.manage")
 
 	if !isAdmin && !isSelf {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Sem permissão para editar este usuário"})
 		return
 	}
+	// Senha, e-mail e perfil da própria conta só com login interativo
+	if _, viaToken := c.Get("apiTokenID"); viaToken && isSelf {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Tokens de API não alteram a própria conta"})
+		return
+	}
+	// Na personificação o administrador não toca nas credenciais do usuário
+	if c.GetUint("impersonatorID") > 0 && (input.Password != "" || input.Email != "") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Senha e e-mail não podem ser alterados durante a personificação"})
+		return
+	}
+	if !isSelf && !canManageRole(c, user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Sem permissão para editar usuários com o perfil " + user.Role})
+		return
+	}
 
-	// Apenas Admin pode mudar Role
-	if input.Role != "" && isAdmin {
-		fmt.Printf("[UpdateUser] Alterando role de %s para %s\n", user.Role, input.Role)
+	// Apenas quem gerencia usuários pode mudar o perfil, e só para perfis que ele mesmo possui
+	if input.Role != "" && isAdmin && input.Role != user.Role {
+		if !roleExists(input.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Perfil desconhecido: " + input.Role})
+			return
+		}
+		if !canManageRole(c, input.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Sem permissão para conceder o perfil " + input.Role})
+			return
+		}
 		user.Role = input.Role
 	}
 
 	// Atualizar senha apenas se não estiver vazia
 	if input.Password != "" && len(input.Password) > 0 {
-		fmt.Printf("[UpdateUser] Atualizando senha do usuário %s\n", user.Username)
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
-		if err != nil {
+		// A própria senha exige a atual, como em /auth/change-password
+		if isSelf {
+			if !hasLocalPassword(user) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "A senha desta conta é gerenciada pelo AD/SSO"})
+				return
+			}
+			if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.CurrentPassword)) != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Senha atual incorreta"})
+				return
+			}
+		}
+		if err := validatePasswordPolicy(input.Password, user.Username); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := checkPasswordReuse(user, input.Password); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := setUserPassword(&user, input.Password); err != nil {
 			fmt.Printf("[UpdateUser] ERRO ao gerar hash da senha: %v\n", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao processar senha"})
 			return
 		}
-		user.Password = string(hashedPassword)
-		fmt.Printf("[UpdateUser] Senha atualizada com sucesso (hash: %d bytes)\n", len(user.Password))
-	} else {
-		fmt.Printf("[UpdateUser] Senha não foi alterada (campo vazio ou não enviado)\n")
+		// Senha definida pelo admin para outra pessoa é provisória
+		user.MustChangePassword = !isSelf
+	}
+
+	if input.MustChangePassword != nil && isAdmin {
+		user.MustChangePassword = *input.MustChangePassword
 	}
 
 	if input.FullName != "" {
@@ -1180,40 +1490,43 @@ func UpdateUser(c *gin.Context) {
 		user.Avatar = input.Avatar
 	}
 
+	if input.Sector != "" {
+		user.Sector = input.Sector
+	}
+
+	if input.Email != "" {
+		if !validEmail(input.Email) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "E-mail inválido"})
+			return
+		}
+		user.Email = input.Email
+	}
+
 	if err := db.Save(&user).Error; err != nil {
 		fmt.Printf("[UpdateUser] ERRO ao salvar no banco: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar usuário"})
 		return
 	}
 
-	fmt.Printf("[UpdateUser] Usuário %s atualizado com sucesso\n", user.Username)
+	// Troca de senha encerra as demais sessões do usuário
+	if input.Password != "" {
+		exceptID := uint(0)
+		if isSelf {
+			exceptID = c.GetUint("sessionID")
+		}
+		revokeUserSessions(user.ID, exceptID)
+	}
 
 	// Log de auditoria
 	details := fmt.Sprintf("Atualizado: FullName=%s", user.FullName)
 	if input.Password != "" {
 		details += " | Senha alterada"
 	}
-	logAction(user.ID, "UPDATE", "User", user.ID, details)
+	logRequestAction(c, "UPDATE", "User", user.ID, details)
 
 	c.JSON(http.StatusOK, user)
 }
 
-func DeleteUser(c *gin.Context) {
-	var user User
-	if err := db.First(&user, c.Param("id")).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
-		return
-	}
-	// Evitar deletar a si mesmo ou o último admin seria ideal, mas por simplicidade:
-	if user.Username == "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Não é permitido deletar o usuário admin principal"})
-		return
-	}
-
-	db.Delete(&user)
-	c.JSON(http.StatusOK, gin.H{"message": "Usuário removido"})
-}
-
 // ==========================================
 // 4. MAIN FUNCTION (Ponto de Entrada)
 // ==========================================
@@ -1228,6 +1541,33 @@ func main() {
 	// Inicia Job de SLA em background
 	go runSLAMonitor()
 
+	// Limpeza periódica de sessões expiradas
+	go runSessionCleanup()
+
+	// Indicadores do stream de eventos (recalculados mesmo sem mudanças, pois o SLA vence com o tempo)
+	go runEventStreamKPIRefresh()
+
+	// Limpeza periódica de notificações já lidas
+	go runNotificationCleanup()
+
+	// Sincronização agendada de usuários do AD
+	go runLDAPSyncScheduler()
+
+	// Avisos de chamados por e-mail (fila com novas tentativas)
+	registerNoticeHandler(queueNoticeEmails)
+	registerNoticeHandler(createNoticeNotifications)
+
+	// Mudanças de chamados: telas conectadas ao stream de eventos
+	registerTicketChangeHandler(broadcastTicketChange)
+
+	// Webhooks assinados (fila com espera exponencial entre as tentativas)
+	registerTicketChangeHandler(queueTicketWebhooks)
+	go runWebhookQueue()
+	go runEmailOutbox()
+
+	// Leitura da caixa de suporte (chamados por e-mail)
+	go runMailIntakeScheduler()
+
 	// Configura o roteador Gin
 	r := gin.Default()
 
@@ -1236,7 +1576,7 @@ func main() {
 		AllowOriginFunc:  func(origin string) bool { return true }, // Permite qualquer origem dinamicamente
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", impersonationHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -1246,6 +1586,14 @@ func main() {
 	{
 		// Rotas Públicas
 		api.POST("/login", Login)
+		api.POST("/login/2fa", LoginSecondFactor)
+		api.GET("/auth/oidc/config", GetOIDCConfig)
+		api.GET("/auth/password-policy", GetPasswordPolicy)
+		api.POST("/auth/password-reset/request", RequestPasswordReset)
+		api.POST("/auth/password-reset/confirm", ConfirmPasswordReset)
+		api.GET("/auth/oidc/login", StartOIDCLogin)
+		api.GET("/auth/oidc/callback", OIDCCallback)
+		api.POST("/auth/refresh", RefreshSession)
 		api.GET("/debug/users", DebugUsers) // Diagnóstico: listar usuários
 		api.GET("/debug/error", func(c *gin.Context) {
 			LastErrorMu.Lock()
@@ -1265,39 +1613,95 @@ func main() {
 		secure := api.Group("/")
 		secure.Use(AuthMiddleware())
 		{
-			// Assets
-			secure.GET("/assets", GetAssets)
-			secure.GET("/assets/:id/history", GetAssetHistory)
-
-			// Rotas de Ativos Protegidas (Apenas Admin e Tech)
-			assetsGroup := secure.Group("/")
-			assetsGroup.Use(RoleMiddleware("Admin", "Tech"))
-			{
-				assetsGroup.POST("/assets", CreateAsset)
-				assetsGroup.PUT("/assets/:id", UpdateAsset)
-				assetsGroup.DELETE("/assets/:id", DeleteAsset)
-				assetsGroup.POST("/import/assets", ImportAssets)
-				assetsGroup.POST("/import/users", ImportUsers)
-				assetsGroup.POST("/users", CreateUser)
-				assetsGroup.DELETE("/users/:id", DeleteUser)
-			}
+			// Sessão
+			secure.POST("/logout", Logout)
+			secure.POST("/auth/change-password", ChangePassword)
+
+			// Tokens de API pessoais
+			secure.GET("/auth/tokens", GetMyAPITokens)
+			secure.POST("/auth/tokens", CreateAPIToken)
+			secure.DELETE("/auth/tokens/:id", RevokeMyAPIToken)
+
+			// Notificações do próprio usuário (preferências, central e eventos em tempo real)
+			secure.GET("/auth/notification-preferences", GetMyNotificationPreferences)
+			secure.PUT("/auth/notification-preferences", UpdateMyNotificationPreferences)
+			secure.GET("/notifications", GetMyNotifications)
+			secure.GET("/notifications/unread-count", GetUnreadNotificationCount)
+			secure.POST("/notifications/read-all", MarkAllNotificationsRead)
+			secure.POST("/notifications/:id/read", MarkNotificationRead)
+			secure.GET("/events", StreamEvents)
+
+			// Personificação ("ver como usuário")
+			secure.GET("/impersonation", GetImpersonationStatus)
+			secure.POST("/impersonation/stop", StopImpersonation)
+
+			// 2FA (TOTP) do próprio usuário
+			secure.GET("/auth/2fa/status", GetTwoFactorStatus)
+			secure.POST("/auth/2fa/setup", SetupTwoFactor)
+			secure.POST("/auth/2fa/enable", EnableTwoFactor)
+			secure.POST("/auth/2fa/disable", DisableTwoFactor)
+			secure.POST("/auth/2fa/recovery-codes", RegenerateRecoveryCodes)
+
+			// Bloqueios de login
+			secure.GET("/auth/lockouts", PermissionMiddleware("user.manage"), GetLoginLockouts)
+			secure.POST("/auth/lockouts/unlock", PermissionMiddleware("user.manage"), UnlockLogin)
 
-			// Tickets
+			// Assets
+			secure.GET("/assets", PermissionMiddleware("asset.view"), GetAssets)
+			secure.GET("/assets/:id/history", PermissionMiddleware("asset.view"), GetAssetHistory)
+			secure.POST("/assets", PermissionMiddleware("asset.manage"), CreateAsset)
+			secure.PUT("/assets/:id", PermissionMiddleware("asset.manage"), UpdateAsset)
+			secure.DELETE("/assets/:id", PermissionMiddleware("asset.delete"), DeleteAsset)
+			secure.POST("/import/assets", PermissionMiddleware("asset.manage"), ImportAssets)
+
+			// Importação e remoção de usuários
+			secure.POST("/import/users", PermissionMiddleware("user.manage"), ImportUsers)
+			secure.POST("/users", PermissionMiddleware("user.manage"), CreateUser)
+			secure.DELETE("/users/:id", PermissionMiddleware("user.manage"), DeleteUser)
+			secure.GET("/users/:id/tokens", PermissionMiddleware("user.manage"), GetUserAPITokens)
+			secure.DELETE("/users/:id/tokens/:tid", PermissionMiddleware("user.manage"), RevokeUserAPIToken)
+
+			// Tickets (visibilidade verificada nos handlers)
 			secure.GET("/tickets", GetTickets)
 			secure.POST("/tickets", CreateTicket)
 			secure.GET("/tickets/:id", GetTicketByID)
+			secure.PATCH("/tickets/:id", PermissionMiddleware("ticket.assign"), UpdateTicket)
+			secure.GET("/tickets/:id/timeline", GetTicketTimeline)
+			secure.GET("/tickets/:id/attachments", GetTicketAttachments)
+			secure.GET("/attachments/:id", DownloadAttachment)
+			secure.DELETE("/attachments/:id", DeleteAttachment)
+			secure.DELETE("/tickets/:id", PermissionMiddleware("ticket.delete"), DeleteTicket)
 			secure.PATCH("/tickets/:id/status", UpdateTicketStatus)
-			secure.PATCH("/tickets/:id/assign", AssignTicket)
+			secure.PATCH("/tickets/:id/assign", PermissionMiddleware("ticket.assign"), AssignTicket)
 			secure.POST("/tickets/:id/comments", AddComment)
+			secure.GET("/tickets/:id/watchers", GetTicketWatchers)
+			secure.POST("/tickets/:id/watchers", PermissionMiddleware("ticket.assign"), AddTicketWatcher)
+			secure.DELETE("/tickets/:id/watchers/:userId", RemoveTicketWatcher)
+			secure.POST("/tickets/:id/watch", WatchTicket)
+			secure.DELETE("/tickets/:id/watch", UnwatchTicket)
+			secure.GET("/tickets/:id/comment-revisions", PermissionMiddleware("comment.history"), GetTicketCommentRevisions)
+			secure.PATCH("/comments/:id", UpdateComment)
+			secure.DELETE("/comments/:id", DeleteComment)
+			secure.GET("/comments/:id/revisions", PermissionMiddleware("comment.history"), GetCommentRevisions)
+			secure.GET("/tickets/:id/transitions", GetTicketTransitions)
+			secure.GET("/workflow", GetWorkflow)
+			secure.PUT("/workflow", PermissionMiddleware("workflow.manage"), UpdateWorkflow)
 
 			// Reports
-			secure.GET("/reports", RoleMiddleware("Tech", "Admin", "Supervisor"), GetReports)
+			secure.GET("/reports", PermissionMiddleware("report.view"), GetReports)
+
+			// Audit
+			secure.GET("/audit", PermissionMiddleware("audit.view"), GetAuditLogs)
 
-			// Audit (Admin only)
-			secure.GET("/audit", RoleMiddleware("Admin"), GetAuditLogs)
+			// Dashboard KPIs
+			secure.GET("/dashboard/kpis", PermissionMiddleware("dashboard.view"), GetDashboardStats)
 
-			// Dashboard KPIs (Tech/Admin/Supervisor)
-			secure.GET("/dashboard/kpis", RoleMiddleware("Tech", "Admin", "Supervisor"), GetDashboardStats)
+			// Perfis e permissões
+			secure.GET("/permissions", PermissionMiddleware("role.manage", "user.manage"), GetPermissions)
+			secure.GET("/roles", PermissionMiddleware("role.manage", "user.manage"), GetRoles)
+			secure.POST("/roles", PermissionMiddleware("role.manage"), CreateRole)
+			secure.PUT("/roles/:id", PermissionMiddleware("role.manage"), UpdateRole)
+			secure.DELETE("/roles/:id", PermissionMiddleware("role.manage"), DeleteRole)
 
 			// Users
 			// Users Routes
@@ -1307,23 +1711,35 @@ func main() {
 			// GET /users/techs (Public or Auth?) - Auth only (secure group)
 			userGroup.GET("/techs", GetTechs)
 
-			// GET /users/list (Tech/Admin)
-			userGroup.GET("/list", RoleMiddleware("Tech", "Admin"), GetUsersSimple)
+			// GET /users/list (user.list)
+			userGroup.GET("/list", PermissionMiddleware("user.list", "user.manage"), GetUsersSimple)
 
 			// Rotas Parametrizadas (Dynamic)
 			userGroup.GET("/:id", GetUserByID)
+			userGroup.GET("/:id/open-work", PermissionMiddleware("user.manage"), GetUserOpenWork)
+			userGroup.POST("/:id/deactivate", PermissionMiddleware("user.manage"), DeactivateUser)
+			userGroup.POST("/:id/reactivate", PermissionMiddleware("user.manage"), ReactivateUser)
+			userGroup.POST("/:id/reassign", PermissionMiddleware("user.manage"), ReassignUserTickets)
+			userGroup.POST("/:id/impersonate", PermissionMiddleware("user.impersonate"), StartImpersonation)
 			userGroup.PUT("/:id", UpdateUser) // Validação interna de permissão
 
+			// Sessões ativas do usuário (user.manage)
+			userGroup.GET("/:id/sessions", PermissionMiddleware("user.manage"), GetUserSessions)
+			userGroup.DELETE("/:id/sessions", PermissionMiddleware("user.manage"), RevokeAllUserSessions)
+			userGroup.DELETE("/:id/sessions/:sid", PermissionMiddleware("user.manage"), RevokeUserSession)
+			userGroup.DELETE("/:id/2fa", PermissionMiddleware("user.manage"), ResetUserTwoFactor)
+			userGroup.POST("/:id/unlock", PermissionMiddleware("user.manage"), UnlockUser)
+
 			// Rotas Raiz (Root)
-			// GET /users/ (Admin only)
-			userGroup.GET("/", RoleMiddleware("Admin"), GetUsers)
-			// POST /users/ (Admin only)
-			userGroup.POST("/", RoleMiddleware("Admin"), CreateUser)
+			// GET /users/ (user.manage)
+			userGroup.GET("/", PermissionMiddleware("user.manage"), GetUsers)
+			// POST /users/ (user.manage)
+			userGroup.POST("/", PermissionMiddleware("user.manage"), CreateUser)
 
-			// Categories Management (Admin only)
+			// Categories Management (category.manage)
 			secure.GET("/categories", GetCategories)
 			catGroup := secure.Group("/categories")
-			catGroup.Use(RoleMiddleware("Admin"))
+			catGroup.Use(PermissionMiddleware("category.manage"))
 			{
 				catGroup.POST("/", CreateCategory)
 				catGroup.PUT("/:id", UpdateCategory)
@@ -1331,11 +1747,37 @@ func main() {
 			}
 
 			// System Update Trigger
-			secure.POST("/system/update", RoleMiddleware("Admin"), TriggerUpdate)
+			secure.POST("/system/update", PermissionMiddleware("system.manage"), TriggerUpdate)
+
+			// Chaves JWT (system.manage)
+			secure.GET("/system/jwt-keys", PermissionMiddleware("system.manage"), GetSigningKeys)
+			secure.POST("/system/jwt-keys/rotate", PermissionMiddleware("system.manage"), RotateSigningKey)
 
 			// System Settings
 			secure.GET("/settings", GetSettings)
-			secure.PUT("/settings/:key", RoleMiddleware("Admin", "Supervisor"), UpdateSetting)
+			secure.PUT("/settings/:key", PermissionMiddleware("settings.manage", "settings.notice"), UpdateSetting)
+			secure.POST("/settings/ldap/test", PermissionMiddleware("system.manage"), TestLDAPConnection)
+			secure.POST("/settings/oidc/test", PermissionMiddleware("system.manage"), TestOIDCProvider)
+			secure.POST("/settings/smtp/test", PermissionMiddleware("system.manage"), TestSMTP)
+			secure.GET("/notification-templates", PermissionMiddleware("settings.manage"), GetNotificationTemplates)
+			secure.PUT("/notification-templates/:kind", PermissionMiddleware("settings.manage"), UpdateNotificationTemplate)
+			secure.DELETE("/notification-templates/:kind", PermissionMiddleware("settings.manage"), ResetNotificationTemplate)
+			secure.GET("/email-outbox", PermissionMiddleware("settings.manage"), GetEmailOutbox)
+			secure.POST("/email-outbox/:id/retry", PermissionMiddleware("settings.manage"), RetryEmailOutbox)
+			secure.GET("/webhooks", PermissionMiddleware("settings.manage"), GetWebhooks)
+			secure.POST("/webhooks", PermissionMiddleware("settings.manage"), CreateWebhook)
+			secure.PUT("/webhooks/:id", PermissionMiddleware("settings.manage"), UpdateWebhook)
+			secure.DELETE("/webhooks/:id", PermissionMiddleware("settings.manage"), DeleteWebhook)
+			secure.POST("/webhooks/:id/test", PermissionMiddleware("settings.manage"), TestWebhook)
+			secure.GET("/webhook-deliveries", PermissionMiddleware("settings.manage"), GetWebhookDeliveries)
+			secure.POST("/webhook-deliveries/:id/redeliver", PermissionMiddleware("settings.manage"), RedeliverWebhook)
+			secure.GET("/mail-intake/log", PermissionMiddleware("settings.manage"), GetMailIntakeLog)
+			secure.POST("/mail-intake/run", PermissionMiddleware("settings.manage"), TriggerMailIntake)
+
+			// Sincronização de usuários do AD (system.manage)
+			secure.POST("/ldap/sync", PermissionMiddleware("system.manage"), TriggerLDAPSync)
+			secure.GET("/ldap/sync/reports", PermissionMiddleware("system.manage"), GetLDAPSyncReports)
+			secure.GET("/ldap/sync/reports/:id", PermissionMiddleware("system.manage"), GetLDAPSyncReport)
 		}
 	}
 
@@ -1381,7 +1823,7 @@ func main() {
 
 func GetAuditLogs(c *gin.Context) {
 	var logs []AuditLog
-	query := db.Preload("User").Order("created_at desc").Limit(100)
+	query := db.Preload("User").Preload("ImpersonatedUser").Order("created_at desc").Limit(100)
 
 	if entity := c.Query("entity"); entity != "" {
 		query = query.Where("entity = ?", entity)
@@ -1400,6 +1842,11 @@ func GetAuditLogs(c *gin.Context) {
 // --- DASHBOARD HANDLERS ---
 
 func GetDashboardStats(c *gin.Context) {
+	c.JSON(http.StatusOK, dashboardKPIs())
+}
+
+// dashboardKPIs calcula os indicadores do Dashboard/Modo TV (também enviados pelo stream de eventos)
+func dashboardKPIs() gin.H {
 	var stats struct {
 		OpenCount     int64 `json:"open"`
 		CriticalCount int64 `json:"critical"`
@@ -1407,11 +1854,11 @@ func GetDashboardStats(c *gin.Context) {
 		SLABreach     int64 `json:"sla_breach"`
 	}
 
-	// 1. Abertos (Status != Resolvido, Fechado)
-	db.Model(&Ticket{}).Where("status NOT IN ?", []string{"Resolvido", "Fechado"}).Count(&stats.OpenCount)
+	// 1. Abertos (status não encerrado no fluxo)
+	db.Model(&Ticket{}).Where("status NOT IN ?", closedTicketStatuses()).Count(&stats.OpenCount)
 
-	// 2. Críticos (Priority = Alta AND Status != Resolvido/Fechado)
-	db.Model(&Ticket{}).Where("priority = ? AND status NOT IN ?", "Alta", []string{"Resolvido", "Fechado"}).Count(&stats.CriticalCount)
+	// 2. Críticos (Priority = Alta AND status não encerrado)
+	db.Model(&Ticket{}).Where("priority = ? AND status NOT IN ?", "Alta", closedTicketStatuses()).Count(&stats.CriticalCount)
 
 	// 3. Abertos Hoje
 	db.Model(&Ticket{}).Where("created_at >= ?", time.Now().Format("2006-01-02 00:00:00")).Count(&stats.TodayCount)
@@ -1423,7 +1870,7 @@ func GetDashboardStats(c *gin.Context) {
 	// Melhor: Query tickets abertos e checar Go-side para precisão máxima com a lógica do checkSLA
 
 	var openTickets []Ticket
-	db.Preload("Category").Where("status NOT IN ?", []string{"Resolvido", "Fechado"}).Find(&openTickets)
+	db.Preload("Category").Where("status NOT IN ?", closedTicketStatuses()).Find(&openTickets)
 
 	breachCount := 0
 	now := time.Now()
@@ -1442,15 +1889,15 @@ func GetDashboardStats(c *gin.Context) {
 	// Buscar lista de críticos recentes para a lista
 	var criticalList []Ticket
 	db.Preload("Category").Preload("Creator").Preload("AssignedTo").
-		Where("status NOT IN ?", []string{"Resolvido", "Fechado"}).
+		Where("status NOT IN ?", closedTicketStatuses()).
 		Order("CASE WHEN priority = 'Alta' THEN 1 ELSE 2 END, created_at ASC").
 		Limit(10).
 		Find(&criticalList)
 
-	c.JSON(http.StatusOK, gin.H{
+	return gin.H{
 		"stats":            stats,
 		"critical_tickets": criticalList,
-	})
+	}
 }
 
 // --- IMPORT HANDLERS ---
@@ -1537,44 +1984,69 @@ func ImportUsers(c *gin.Context) {
 	defer f.Close()
 
 	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1 // Linhas incompletas são relatadas abaixo, sem abortar o arquivo
 	records, err := reader.ReadAll()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao ler CSV"})
 		return
 	}
 
+	type importFailure struct {
+		Line     int    `json:"line"`
+		Username string `json:"username"`
+		Error    string `json:"error"`
+	}
 	successCount := 0
-	errorCount := 0
+	failures := []importFailure{}
 
 	if len(records) > 0 {
 		records = records[1:]
 	}
 
-	for _, record := range records {
+	for i, record := range records {
+		line := i + 2 // Linha 1 é o cabeçalho
 		// Esperado: Username, Password, Role
+		username := strings.TrimSpace(record[0])
 		if len(record) < 3 {
-			errorCount++
+			failures = append(failures, importFailure{Line: line, Username: username, Error: "Linha incompleta (esperado: usuário, senha, perfil)"})
+			continue
+		}
+		if !roleExists(record[2]) {
+			failures = append(failures, importFailure{Line: line, Username: username, Error: "Perfil desconhecido: " + record[2]})
+			continue
+		}
+		if !canManageRole(c, record[2]) {
+			failures = append(failures, importFailure{Line: line, Username: username, Error: "Sem permissão para conceder o perfil " + record[2]})
+			continue
+		}
+		if err := validatePasswordPolicy(record[1], username); err != nil {
+			failures = append(failures, importFailure{Line: line, Username: username, Error: err.Error()})
 			continue
 		}
 
-		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(record[1]), bcrypt.DefaultCost)
 		user := User{
-			Username: record[0],
-			Password: string(hashedPassword),
-			Role:     record[2],
+			Username:           username,
+			Role:               record[2],
+			MustChangePassword: true, // Senha definida na planilha é provisória
+		}
+		if err := setUserPassword(&user, record[1]); err != nil {
+			failures = append(failures, importFailure{Line: line, Username: username, Error: "Erro ao processar senha"})
+			continue
 		}
 
 		if err := db.Create(&user).Error; err != nil {
-			errorCount++
+			failures = append(failures, importFailure{Line: line, Username: username, Error: "Usuário já existe ou dados inválidos"})
 		} else {
 			successCount++
 		}
 	}
 
+	logRequestAction(c, "IMPORT", "User", 0, fmt.Sprintf("Importação de usuários: %d criados, %d recusados", successCount, len(failures)))
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Importação de usuários concluída",
-		"success": successCount,
-		"errors":  errorCount,
+		"message":  "Importação de usuários concluída",
+		"success":  successCount,
+		"errors":   len(failures),
+		"failures": failures,
 	})
 }
 
@@ -1601,16 +2073,7 @@ type DailyTrend struct {
 }
 
 func GetReports(c *gin.Context) {
-	// Verificar Permissão Dinâmica para 'User'
-	role := c.MustGet("role").(string)
-	if role == "User" {
-		var setting SystemSetting
-		db.First(&setting, "key = ?", "user_view_reports")
-		if setting.Value != "true" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Acesso negado a relatórios"})
-			return
-		}
-	}
+	// Acesso controlado pela permissão report.view (rota)
 
 	var stats ReportStats
 	techID := c.Query("tech_id")
@@ -1626,8 +2089,8 @@ func GetReports(c *gin.Context) {
 
 	// Contagens Básicas
 	filter(db.Model(&Ticket{})).Count(&stats.TotalTickets)
-	filter(db.Model(&Ticket{}).Where("status != ? AND status != ?", "Resolvido", "Fechado")).Count(&stats.OpenTickets)
-	filter(db.Model(&Ticket{}).Where("status = ?", "Resolvido")).Count(&stats.ResolvedTickets)
+	filter(db.Model(&Ticket{}).Where("status NOT IN ?", closedTicketStatuses())).Count(&stats.OpenTickets)
+	filter(db.Model(&Ticket{}).Where("status IN ?", closedTicketStatuses())).Count(&stats.ResolvedTickets)
 
 	// Agrupamento por Categoria
 	// Nota: Join pode precisar de alias ou cuidado se ticket tbm tiver filtro
@@ -1656,9 +2119,9 @@ func GetReports(c *gin.Context) {
 		}
 	}
 
-	// Cálculo MTTR e SLA (Iterar sobre tickets resolvidos)
+	// Cálculo MTTR e SLA (Iterar sobre tickets encerrados, conforme o fluxo)
 	var resolvedTickets []Ticket
-	filter(db.Where("status = ?", "Resolvido")).Find(&resolvedTickets)
+	filter(db.Where("status IN ?", closedTicketStatuses())).Find(&resolvedTickets)
 
 	var totalTimeHours float64
 	var slaMetCount int64
@@ -1710,7 +2173,7 @@ func GetReports(c *gin.Context) {
 
 func GetTechs(c *gin.Context) {
 	var techs []User
-	if err := db.Where("role IN ?", []string{"Tech", "Admin"}).Find(&techs).Error; err != nil {
+	if err := db.Where("role IN ? AND active = ?", rolesWithPermission("ticket.assignee"), true).Find(&techs).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -1730,10 +2193,12 @@ func runSLAMonitor() {
 func checkSLA() {
 	// Buscar tickets não resolvidos que possuam categoria definida
 	var tickets []Ticket
-	if err := db.Preload("Category").Where("status != ? AND status != ? AND category_id IS NOT NULL", "Resolvido", "Fechado").Find(&tickets).Error; err != nil {
+	if err := db.Preload("Category").Where("status NOT IN ? AND category_id IS NOT NULL", closedTicketStatuses()).Find(&tickets).Error; err != nil {
 		return
 	}
 
+	warnPercent := getSettingInt("sla_warning_percent", 80)
+
 	for _, t := range tickets {
 		if t.Category == nil {
 			continue
@@ -1753,30 +2218,71 @@ func checkSLA() {
 			if t.Category.EscalationUserID != nil {
 				escalationID := *t.Category.EscalationUserID
 
-				// Só escalonar se o ticket JÁ NÃO estiver com o usuário de escalonamento
-				if t.AssignedToID == nil || *t.AssignedToID != escalationID {
+				// Só escalonar se o ticket JÁ NÃO estiver com o usuário de escalonamento (e se ele estiver ativo)
+				if (t.AssignedToID == nil || *t.AssignedToID != escalationID) && userIsActive(db, escalationID) {
 					fmt.Printf("SLA Trigger: Escalando Ticket %d para UserID %d\n", t.ID, escalationID)
 
-					oldAssigned := "Ninguém"
-					if t.AssignedToID != nil {
-						oldAssigned = fmt.Sprintf("User %d", *t.AssignedToID)
-					}
+					previous := t.AssignedToID
+					oldAssigned := assigneeName(db, previous)
 
 					t.AssignedToID = &escalationID
 					db.Save(&t)
+					addTicketWatcher(db, t.ID, escalationID, watchReasonAssignee, nil)
+
+					recordTicketEvent(db, nil, t.ID, ticketEventSLAEscalation, oldAssigned, assigneeName(db, t.AssignedToID),
+						fmt.Sprintf("SLA de %dh da categoria %s violado", timeoutHours, t.Category.Name))
 
 					// Comentário de Sistema
-					db.Create(&Comment{
-						TicketID: t.ID,
-						Author:   "System Bot",
-						Content:  fmt.Sprintf("⚠ SLA VIOLADO (%dh): Reatribuído automaticamente de %s para supervisão.", timeoutHours, oldAssigned),
-					})
+					createSystemComment(db, t.ID, fmt.Sprintf("⚠ SLA VIOLADO (%dh): Reatribuído automaticamente de %s para supervisão.", timeoutHours, oldAssigned))
+
+					// Avisa o supervisor que recebeu o chamado e quem estava com ele
+					notice := newTicketNotice(nil, noticeSLAEscalation, t.ID, fmt.Sprintf("SLA violado: chamado #%d escalonado para %s", t.ID, assigneeName(db, t.AssignedToID)))
+					notice.OldValue, notice.NewValue = oldAssigned, assigneeName(db, t.AssignedToID)
+					notice.Message = fmt.Sprintf("SLA de %dh da categoria %s violado", timeoutHours, t.Category.Name)
+					candidates := []uint{escalationID}
+					if previous != nil {
+						candidates = append(candidates, *previous)
+					}
+					notice.Recipients = noticeRecipients(notice, candidates)
+					publishTicketNotice(notice)
+					publishTicketChange(streamTicketUpdated, t.ID)
 				}
 			}
+		} else if warnPercent > 0 && warnPercent < 100 &&
+			time.Now().After(t.CreatedAt.Add(time.Duration(timeoutHours)*time.Hour*time.Duration(warnPercent)/100)) {
+			warnSLADeadline(t, timeoutHours, limitTime)
 		}
 	}
 }
 
+// warnSLADeadline avisa o responsável (ou o usuário de escalonamento, se não houver) uma única vez
+// que o SLA do chamado está perto de vencer
+func warnSLADeadline(t Ticket, timeoutHours int, limitTime time.Time) {
+	var count int64
+	db.Model(&TicketEvent{}).Where("ticket_id = ? AND type = ?", t.ID, ticketEventSLAWarning).Count(&count)
+	if count > 0 {
+		return
+	}
+
+	deadline := limitTime.Format("02/01/2006 15:04")
+	remaining := int(time.Until(limitTime).Round(time.Minute).Minutes())
+	details := fmt.Sprintf("SLA de %dh da categoria %s vence em %dh%02dmin", timeoutHours, t.Category.Name, remaining/60, remaining%60)
+	recordTicketEvent(db, nil, t.ID, ticketEventSLAWarning, "", deadline, details)
+
+	target := t.AssignedToID
+	if target == nil {
+		target = t.Category.EscalationUserID
+	}
+	if target == nil {
+		return
+	}
+	notice := newTicketNotice(nil, noticeSLAWarning, t.ID, fmt.Sprintf("SLA do chamado #%d vence em %s", t.ID, deadline))
+	notice.Message = details
+	notice.NewValue = deadline
+	notice.Recipients = noticeRecipients(notice, []uint{*target})
+	publishTicketNotice(notice)
+}
+
 // TriggerUpdate cria um arquivo de gatilho para o script watcher reiniciar o sistema
 func TriggerUpdate(c *gin.Context) {
 	// Verificar se já existe (debounce)
@@ -1853,10 +2359,11 @@ func SetupInitialAdmin(c *gin.Context) {
 	}
 
 	admin := User{
-		Username: "admin",
-		Password: string(hashedPassword),
-		Role:     "Admin",
-		FullName: "Administrador",
+		Username:           "admin",
+		Password:           string(hashedPassword),
+		Role:               "Admin",
+		FullName:           "Administrador",
+		MustChangePassword: true,
 	}
 
 	if err := db.Create(&admin).Error; err != nil {
@@ -1870,7 +2377,7 @@ func SetupInitialAdmin(c *gin.Context) {
 		"message":  "Usuário admin criado com sucesso!",
 		"username": "admin",
 		"password": "admin123",
-		"note":     "Por favor, altere a senha após o primeiro login.",
+		"note":     "A troca da senha será exigida no primeiro login.",
 	})
 }
 
@@ -1888,12 +2395,29 @@ func AssignTicket(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
 		return
 	}
+	if !canViewTicket(c, ticket) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Você não tem permissão para atribuir este chamado"})
+		return
+	}
 
+	var assignee User
+	if err := db.First(&assignee, input.AssignedToID).Error; err != nil || !assignee.Active || !roleHasPermission(assignee.Role, "ticket.assignee") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Responsável inválido"})
+		return
+	}
+
+	previous := ticket.AssignedToID
+	from := assigneeName(db, previous)
 	ticket.AssignedToID = &input.AssignedToID
 	if err := db.Save(&ticket).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar atribuição"})
 		return
 	}
 
+	recordAssignmentChange(db, c, ticket.ID, previous, ticket.AssignedToID, "")
+	logRequestAction(c, "ASSIGN", "Ticket", ticket.ID, fmt.Sprintf("Responsável alterado de %s para %s", from, displayName(assignee)))
+	notifyAssignment(c, ticket.ID, previous, ticket.AssignedToID)
+	publishTicketChange(streamTicketUpdated, ticket.ID)
+
 	c.JSON(http.StatusOK, ticket)
 }
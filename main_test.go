@@ -0,0 +1,57 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupTestDB abre um banco SQLite temporário com o esquema e as configurações padrão
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	conn, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("falha ao abrir banco de teste: %v", err)
+	}
+	db = conn
+	if err := migrateDatabase(); err != nil {
+		t.Fatalf("falha na migração: %v", err)
+	}
+	seedSettings()
+	seedRoles()
+	seedWorkflow()
+	seedNotificationTemplates()
+
+	t.Cleanup(func() {
+		if sqlDB, err := conn.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+// setTestSetting grava uma configuração no banco de teste
+func setTestSetting(t *testing.T, key, value string) {
+	t.Helper()
+	if err := db.Save(&SystemSetting{Key: key, Value: value}).Error; err != nil {
+		t.Fatalf("falha ao gravar %s: %v", key, err)
+	}
+}
+
+// createTestUser cadastra um usuário ativo com o perfil indicado
+func createTestUser(t *testing.T, username, role, email string) User {
+	t.Helper()
+	user := User{Username: username, FullName: username, Role: role, Email: email, Active: true}
+	if err := setUserPassword(&user, "Senha@Teste123"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("falha ao criar usuário %s: %v", username, err)
+	}
+	return user
+}
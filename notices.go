@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==========================================
+// AVISOS DE CHAMADOS
+// ==========================================
+//
+// Um ticketNotice descreve algo que aconteceu num chamado e quem deve ser
+// avisado. Os canais de entrega (e-mail, notificação no sistema, etc.) se
+// registram com registerNoticeHandler e recebem cada aviso publicado.
+
+// Tipos de aviso
+const (
+	noticeTicketCreated  = "ticket_created"
+	noticeTicketAssigned = "ticket_assigned"
+	noticeTicketComment  = "ticket_comment"
+	noticeTicketStatus   = "ticket_status"
+	noticeSLAWarning     = "sla_warning"
+	noticeSLAEscalation  = "sla_escalation"
+	noticeMention        = "mention"
+)
+
+// noticeKinds descreve os tipos de aviso (ordem de exibição nas preferências)
+var noticeKinds = []struct {
+	Kind  string `json:"kind"`
+	Label string `json:"label"`
+}{
+	{noticeTicketCreated, "Chamado aberto"},
+	{noticeTicketAssigned, "Chamado atribuído a mim"},
+	{noticeTicketComment, "Novo comentário"},
+	{noticeTicketStatus, "Mudança de status"},
+	{noticeSLAWarning, "SLA perto de vencer"},
+	{noticeSLAEscalation, "Escalonamento por SLA"},
+	{noticeMention, "Menção em comentário"},
+}
+
+func isNoticeKind(kind string) bool {
+	for _, k := range noticeKinds {
+		if k.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// ticketNotice é um aviso destinado a usuários específicos
+type ticketNotice struct {
+	Kind       string
+	TicketID   uint
+	ActorID    uint // 0 = sistema
+	ActorName  string
+	Recipients []uint
+	Title      string // Resumo (ex: "Mauro comentou no chamado #12")
+	Message    string // Texto do comentário, nota de resolução etc.
+	OldValue   string
+	NewValue   string
+	Internal   bool // Originado de nota interna
+}
+
+// newTicketNotice preenche o autor do aviso a partir da requisição (c == nil = sistema)
+func newTicketNotice(c *gin.Context, kind string, ticketID uint, title string) ticketNotice {
+	n := ticketNotice{Kind: kind, TicketID: ticketID, ActorName: systemActorName, Title: title}
+	if c != nil {
+		if uid := getCurrentUserID(c); uid > 0 {
+			n.ActorID = uid
+			n.ActorName = currentUserDisplayName(c)
+		}
+	}
+	return n
+}
+
+// noticeRecipients aplica as regras de destinatários: sem repetição, sem o autor,
+// sem os excluídos e, para notas internas, só quem pode lê-las
+func noticeRecipients(n ticketNotice, candidates []uint, exclude ...uint) []uint {
+	skip := map[uint]bool{0: true, n.ActorID: true}
+	for _, id := range exclude {
+		skip[id] = true
+	}
+	var staff map[uint]bool
+	if n.Internal && len(candidates) > 0 {
+		staff = map[uint]bool{}
+		var users []User
+		db.Select("id, role").Where("id IN ?", candidates).Find(&users)
+		for _, u := range users {
+			staff[u.ID] = roleHasPermission(u.Role, "ticket.internal_notes")
+		}
+	}
+
+	var result []uint
+	for _, id := range candidates {
+		if skip[id] || (staff != nil && !staff[id]) {
+			continue
+		}
+		skip[id] = true
+		result = append(result, id)
+	}
+	return result
+}
+
+// notifyTicketWatchers avisa os observadores do chamado (exceto o autor e os excluídos)
+func notifyTicketWatchers(n ticketNotice, exclude ...uint) {
+	n.Recipients = noticeRecipients(n, ticketWatcherIDs(n.TicketID), exclude...)
+	publishTicketNotice(n)
+}
+
+// notifyAssignment avisa o novo responsável, se a atribuição não foi feita por ele mesmo
+func notifyAssignment(c *gin.Context, ticketID uint, from, to *uint) {
+	if to == nil || sameID(from, to) {
+		return
+	}
+	n := newTicketNotice(c, noticeTicketAssigned, ticketID, fmt.Sprintf("Chamado #%d atribuído a você", ticketID))
+	n.OldValue, n.NewValue = assigneeName(db, from), assigneeName(db, to)
+	n.Recipients = noticeRecipients(n, []uint{*to})
+	publishTicketNotice(n)
+}
+
+type noticeHandler func(ticketNotice)
+
+var (
+	noticeHandlersMu sync.RWMutex
+	noticeHandlers   []noticeHandler
+)
+
+// registerNoticeHandler inclui um canal de entrega de avisos
+func registerNoticeHandler(h noticeHandler) {
+	noticeHandlersMu.Lock()
+	defer noticeHandlersMu.Unlock()
+	noticeHandlers = append(noticeHandlers, h)
+}
+
+// publishTicketNotice entrega o aviso a todos os canais, sem bloquear a requisição
+func publishTicketNotice(n ticketNotice) {
+	if len(n.Recipients) == 0 {
+		return
+	}
+
+	noticeHandlersMu.RLock()
+	handlers := append([]noticeHandler(nil), noticeHandlers...)
+	noticeHandlersMu.RUnlock()
+	for _, h := range handlers {
+		go func(h noticeHandler) {
+			defer func() {
+				if r := recover(); r != nil {
+					fmt.Printf("[AVISO] Falha ao entregar aviso do chamado #%d: %v\n", n.TicketID, r)
+				}
+			}()
+			h(n)
+		}(h)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==========================================
+// NOTIFICAÇÕES NO SISTEMA
+// ==========================================
+//
+// Cada aviso de chamado vira uma Notification por destinatário, exibida no sino
+// do cabeçalho. O contador de não lidas é consultado com frequência pelo
+// frontend, por isso usa só o índice (user_id, read_at).
+
+const notificationChannelApp = "app"
+
+// Notification é um aviso exibido para um usuário dentro do sistema
+type Notification struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uint       `gorm:"index:idx_notification_unread;not null" json:"user_id"`
+	ReadAt    *time.Time `gorm:"index:idx_notification_unread" json:"read_at"`
+	Kind      string     `json:"kind"`
+	TicketID  uint       `gorm:"index" json:"ticket_id"`
+	Title     string     `json:"title"`
+	Message   string     `json:"message"`
+	ActorName string     `json:"actor_name"`
+}
+
+// Trecho do comentário guardado na notificação (o texto completo fica no chamado)
+const notificationMessageLimit = 300
+
+// createNoticeNotifications grava o aviso para cada destinatário (canal registrado em main)
+func createNoticeNotifications(n ticketNotice) {
+	var users []uint
+	db.Model(&User{}).Where("id IN ? AND active = ?", n.Recipients, true).Pluck("id", &users)
+	optOuts := notificationOptOuts(users, n.Kind, notificationChannelApp)
+
+	message := []rune(n.Message)
+	if len(message) > notificationMessageLimit {
+		message = append(message[:notificationMessageLimit], '…')
+	}
+
+	var items []Notification
+	for _, id := range users {
+		if optOuts[id] {
+			continue
+		}
+		items = append(items, Notification{
+			UserID:    id,
+			Kind:      n.Kind,
+			TicketID:  n.TicketID,
+			Title:     n.Title,
+			Message:   string(message),
+			ActorName: n.ActorName,
+		})
+	}
+	if len(items) == 0 {
+		return
+	}
+	if err := db.Create(&items).Error; err != nil {
+		fmt.Printf("[NOTIFICAÇÃO] Erro ao gravar aviso do chamado #%d: %v\n", n.TicketID, err)
+	}
+}
+
+// runNotificationCleanup remove periodicamente notificações lidas mais antigas que notification_retention_days
+func runNotificationCleanup() {
+	ticker := time.NewTicker(6 * time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		days := getSettingInt("notification_retention_days", 90)
+		if days <= 0 {
+			continue
+		}
+		limit := time.Now().AddDate(0, 0, -days)
+		db.Where("read_at IS NOT NULL AND created_at < ?", limit).Delete(&Notification{})
+	}
+}
+
+// --- Handlers ---
+
+// GetMyNotifications lista as notificações do usuário, das mais recentes para as mais antigas.
+// Parâmetros: unread=true (só não lidas), before=<id> (página seguinte) e limit (máx. 100)
+func GetMyNotifications(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "30"))
+	if limit <= 0 || limit > 100 {
+		limit = 30
+	}
+	query := db.Where("user_id = ?", getCurrentUserID(c)).Order("id desc").Limit(limit)
+	if c.Query("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+	if before, err := strconv.ParseUint(c.Query("before"), 10, 64); err == nil && before > 0 {
+		query = query.Where("id < ?", before)
+	}
+
+	items := []Notification{}
+	query.Find(&items)
+	c.JSON(http.StatusOK, items)
+}
+
+// GetUnreadNotificationCount devolve só o número de não lidas (consultado pelo badge do cabeçalho)
+func GetUnreadNotificationCount(c *gin.Context) {
+	var count int64
+	db.Model(&Notification{}).Where("user_id = ? AND read_at IS NULL", getCurrentUserID(c)).Count(&count)
+	c.JSON(http.StatusOK, gin.H{"count": count})
+}
+
+// MarkNotificationRead marca uma notificação do usuário como lida
+func MarkNotificationRead(c *gin.Context) {
+	var item Notification
+	if err := db.Where("user_id = ?", getCurrentUserID(c)).First(&item, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notificação não encontrada"})
+		return
+	}
+	if item.ReadAt == nil {
+		now := time.Now()
+		item.ReadAt = &now
+		db.Model(&item).Update("read_at", now)
+	}
+	c.JSON(http.StatusOK, item)
+}
+
+// MarkAllNotificationsRead marca todas as notificações do usuário como lidas
+func MarkAllNotificationsRead(c *gin.Context) {
+	result := db.Model(&Notification{}).
+		Where("user_id = ? AND read_at IS NULL", getCurrentUserID(c)).
+		Update("read_at", time.Now())
+	c.JSON(http.StatusOK, gin.H{"message": "Notificações marcadas como lidas", "updated": result.RowsAffected})
+}
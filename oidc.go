@@ -0,0 +1,511 @@
+package main
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ==========================================
+// LOGIN VIA OPENID CONNECT (Authorization Code + PKCE)
+// ==========================================
+//
+// Fluxo: /auth/oidc/login redireciona ao provedor com state, nonce e code_challenge (S256).
+// O provedor volta em /auth/oidc/callback com o código, que é trocado pelo id_token.
+// O id_token é validado (assinatura via JWKS, iss, aud, exp, nonce) e as claims
+// sub/email/groups são aplicadas ao usuário local (JIT, como no login LDAP).
+// O navegador volta para /login com o refresh token (ou o desafio 2FA) no fragmento da URL.
+// O state também vai num cookie HttpOnly: o callback só é aceito no navegador que iniciou
+// o login, impedindo que um link com o código de outra pessoa a autentique (login CSRF).
+
+const (
+	oidcManagedPassword = "OIDC_MANAGED" // Placeholder de contas criadas pelo SSO (nunca confere com bcrypt)
+	oidcStateTTL        = 10 * time.Minute
+	oidcStateCookie     = "oidc_state"
+	oidcCookiePath      = "/api/v1/auth/oidc"
+)
+
+var oidcHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// OIDCLoginState guarda os dados de uma tentativa de login em andamento (uso único)
+type OIDCLoginState struct {
+	State        string    `gorm:"primaryKey"`
+	CodeVerifier string    `gorm:"not null"`
+	Nonce        string    `gorm:"not null"`
+	RedirectURI  string    `gorm:"not null"`
+	ExpiresAt    time.Time `gorm:"index"`
+}
+
+type oidcConfig struct {
+	Issuer        string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string
+	Scopes        string
+	UsernameClaim string
+	GroupsClaim   string
+}
+
+func loadOIDCConfig() oidcConfig {
+	return oidcConfig{
+		Issuer:        strings.TrimRight(getSettingValue("oidc_issuer", ""), "/"),
+		ClientID:      getSettingValue("oidc_client_id", ""),
+		ClientSecret:  getSettingValue("oidc_client_secret", ""),
+		RedirectURL:   getSettingValue("oidc_redirect_url", ""),
+		Scopes:        getSettingValue("oidc_scopes", "openid profile email groups"),
+		UsernameClaim: getSettingValue("oidc_username_claim", "preferred_username"),
+		GroupsClaim:   getSettingValue("oidc_groups_claim", "groups"),
+	}
+}
+
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcGetJSON busca um documento JSON do provedor
+func oidcGetJSON(rawURL, bearer string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s respondeu %d", rawURL, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// discoverOIDC lê o documento .well-known/openid-configuration do emissor
+func discoverOIDC(cfg oidcConfig) (*oidcProvider, error) {
+	if cfg.Issuer == "" || cfg.ClientID == "" {
+		return nil, fmt.Errorf("oidc_issuer e oidc_client_id são obrigatórios")
+	}
+	var provider oidcProvider
+	if err := oidcGetJSON(cfg.Issuer+"/.well-known/openid-configuration", "", &provider); err != nil {
+		return nil, fmt.Errorf("falha na descoberta do provedor: %w", err)
+	}
+	if strings.TrimRight(provider.Issuer, "/") != cfg.Issuer {
+		return nil, fmt.Errorf("emissor divergente: esperado %s, recebido %s", cfg.Issuer, provider.Issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return nil, fmt.Errorf("documento de descoberta incompleto")
+	}
+	return &provider, nil
+}
+
+// fetchOIDCKeys carrega as chaves RSA públicas do provedor (JWKS), indexadas por kid
+func fetchOIDCKeys(jwksURI string) (map[string]*rsa.PublicKey, error) {
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := oidcGetJSON(jwksURI, "", &jwks); err != nil {
+		return nil, fmt.Errorf("falha ao obter JWKS: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS sem chaves RSA de assinatura")
+	}
+	return keys, nil
+}
+
+// oidcRedirectURI devolve a URL de retorno registrada no provedor (configurada ou derivada da requisição)
+func oidcRedirectURI(c *gin.Context, cfg oidcConfig) string {
+	if cfg.RedirectURL != "" {
+		return cfg.RedirectURL
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/api/v1/auth/oidc/callback", scheme, c.Request.Host)
+}
+
+// oidcFinish devolve o navegador à tela de login com o resultado no fragmento da URL
+func oidcFinish(c *gin.Context, params url.Values) {
+	c.Redirect(http.StatusFound, "/login#"+params.Encode())
+}
+
+// setOIDCStateCookie vincula o login ao navegador (SameSite=Lax: o provedor volta por navegação de topo).
+// O atributo Secure segue o redirect_uri, e não a conexão, para gravar e apagar o cookie
+// com os mesmos atributos também atrás de um proxy que termina o TLS.
+func setOIDCStateCookie(c *gin.Context, value string, maxAge int, redirectURI string) {
+	secure := strings.HasPrefix(redirectURI, "https://")
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     oidcCookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func oidcFail(c *gin.Context, msg string) {
+	fmt.Printf("[OIDC] Falha no login: %s\n", msg)
+	oidcFinish(c, url.Values{"oidc_error": {msg}})
+}
+
+// GetOIDCConfig informa à tela de login se o botão de SSO deve aparecer (público)
+func GetOIDCConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"enabled": getSettingValue("oidc_enabled", "false") == "true",
+		"label":   getSettingValue("oidc_button_label", "Entrar com SSO"),
+	})
+}
+
+// StartOIDCLogin redireciona o navegador ao provedor OIDC
+func StartOIDCLogin(c *gin.Context) {
+	if getSettingValue("oidc_enabled", "false") != "true" {
+		oidcFail(c, "Login via SSO desabilitado")
+		return
+	}
+	cfg := loadOIDCConfig()
+	provider, err := discoverOIDC(cfg)
+	if err != nil {
+		oidcFail(c, err.Error())
+		return
+	}
+
+	state, err1 := generateRandomToken(16)
+	nonce, err2 := generateRandomToken(16)
+	verifier, err3 := generateRandomToken(32)
+	if err1 != nil || err2 != nil || err3 != nil {
+		oidcFail(c, "Erro ao iniciar login")
+		return
+	}
+
+	redirectURI := oidcRedirectURI(c, cfg)
+	db.Where("expires_at < ?", time.Now()).Delete(&OIDCLoginState{})
+	if err := db.Create(&OIDCLoginState{State: state, CodeVerifier: verifier, Nonce: nonce, RedirectURI: redirectURI, ExpiresAt: time.Now().Add(oidcStateTTL)}).Error; err != nil {
+		oidcFail(c, "Erro ao iniciar login")
+		return
+	}
+
+	setOIDCStateCookie(c, state, int(oidcStateTTL.Seconds()), redirectURI)
+
+	challenge := sha256.Sum256([]byte(verifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {cfg.ClientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {cfg.Scopes},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	c.Redirect(http.StatusFound, provider.AuthorizationEndpoint+sep+params.Encode())
+}
+
+// exchangeOIDCCode troca o código de autorização pelos tokens (enviando o code_verifier do PKCE)
+func exchangeOIDCCode(cfg oidcConfig, provider *oidcProvider, code string, state OIDCLoginState) (idToken, accessToken string, err error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {state.RedirectURI},
+		"client_id":     {cfg.ClientID},
+		"code_verifier": {state.CodeVerifier},
+	}
+	req, err := http.NewRequest(http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+	}
+
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("troca do código falhou (%d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var tokens struct {
+		IDToken     string `json:"id_token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return "", "", err
+	}
+	if tokens.IDToken == "" {
+		return "", "", fmt.Errorf("provedor não retornou id_token")
+	}
+	return tokens.IDToken, tokens.AccessToken, nil
+}
+
+// verifyOIDCIDToken valida assinatura, emissor, audiência, expiração e nonce do id_token
+func verifyOIDCIDToken(cfg oidcConfig, provider *oidcProvider, rawToken, nonce string) (jwt.MapClaims, error) {
+	keys, err := fetchOIDCKeys(provider.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if key, ok := keys[kid]; ok {
+			return key, nil
+		}
+		if kid == "" && len(keys) == 1 {
+			for _, key := range keys {
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("chave '%s' não encontrada no JWKS", kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512"}),
+		jwt.WithIssuer(provider.Issuer),
+		jwt.WithAudience(cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("id_token inválido: %w", err)
+	}
+	if claims["nonce"] != nonce {
+		return nil, fmt.Errorf("id_token inválido: nonce divergente")
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, fmt.Errorf("id_token sem claim sub")
+	}
+	return claims, nil
+}
+
+// oidcClaimStrings lê uma claim que pode ser string ou lista de strings (ex.: groups)
+func oidcClaimStrings(claims jwt.MapClaims, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// resolveOIDCUser vincula as claims a um usuário local, criando-o no primeiro acesso (JIT)
+func resolveOIDCUser(cfg oidcConfig, claims jwt.MapClaims) (User, error) {
+	sub, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+	emailVerified, _ := claims["email_verified"].(bool)
+	name, _ := claims["name"].(string)
+	groups := oidcClaimStrings(claims, cfg.GroupsClaim)
+
+	username, _ := claims[cfg.UsernameClaim].(string)
+	if username == "" {
+		username = email
+	}
+	if username == "" {
+		username = sub
+	}
+
+	var user User
+	if err := db.Where("oidc_subject = ?", sub).First(&user).Error; err != nil {
+		if err := db.Where("LOWER(username) = ?", strings.ToLower(username)).First(&user).Error; err == nil {
+			// Conta já existente (local ou do AD): só vincula se o e-mail verificado pelo provedor for o mesmo
+			if user.OIDCSubject != "" || !emailVerified || email == "" || !strings.EqualFold(user.Email, email) {
+				return User{}, fmt.Errorf("Já existe um usuário '%s' não vinculado a este login SSO", username)
+			}
+			user.OIDCSubject = sub
+		} else {
+			user = User{
+				Username:    username,
+				Role:        "User", // Padrão (ajustado pelo mapeamento de grupos)
+				Password:    oidcManagedPassword,
+				OIDCSubject: sub,
+				Active:      true,
+			}
+		}
+	}
+
+	if user.Password == oidcManagedPassword {
+		if name != "" {
+			user.FullName = name
+		} else if user.FullName == "" {
+			user.FullName = username
+		}
+		if email != "" {
+			user.Email = email
+		}
+		// Perfil segue os grupos do provedor a cada login
+		if role, ok := mapDirectoryRole("oidc_role_mapping", groups); ok && role != user.Role {
+			fmt.Printf("[OIDC] Perfil de %s alterado pelo mapeamento de grupos: %s -> %s\n", user.Username, user.Role, role)
+			user.Role = role
+		}
+	}
+
+	if err := db.Save(&user).Error; err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// OIDCCallback recebe o retorno do provedor, valida os tokens e inicia a sessão
+func OIDCCallback(c *gin.Context) {
+	if errCode := c.Query("error"); errCode != "" {
+		oidcFail(c, fmt.Sprintf("Provedor recusou o login: %s %s", errCode, c.Query("error_description")))
+		return
+	}
+
+	if getSettingValue("oidc_enabled", "false") != "true" {
+		oidcFail(c, "Login via SSO desabilitado")
+		return
+	}
+
+	// O state precisa ser o mesmo gravado no cookie deste navegador
+	cfg := loadOIDCConfig()
+	cookie, _ := c.Cookie(oidcStateCookie)
+	setOIDCStateCookie(c, "", -1, oidcRedirectURI(c, cfg))
+	if cookie == "" || c.Query("state") == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(c.Query("state"))) != 1 {
+		oidcFail(c, "Sessão de login inválida ou iniciada em outro navegador. Tente novamente.")
+		return
+	}
+
+	var state OIDCLoginState
+	if err := db.First(&state, "state = ?", c.Query("state")).Error; err != nil {
+		oidcFail(c, "Sessão de login inválida ou expirada. Tente novamente.")
+		return
+	}
+	db.Delete(&state) // Uso único
+	if time.Now().After(state.ExpiresAt) {
+		oidcFail(c, "Sessão de login expirada. Tente novamente.")
+		return
+	}
+
+	provider, err := discoverOIDC(cfg)
+	if err != nil {
+		oidcFail(c, err.Error())
+		return
+	}
+	idToken, accessToken, err := exchangeOIDCCode(cfg, provider, c.Query("code"), state)
+	if err != nil {
+		oidcFail(c, err.Error())
+		return
+	}
+	claims, err := verifyOIDCIDToken(cfg, provider, idToken, state.Nonce)
+	if err != nil {
+		oidcFail(c, err.Error())
+		return
+	}
+
+	// Alguns provedores só entregam email/groups no userinfo
+	if provider.UserinfoEndpoint != "" && accessToken != "" && (claims["email"] == nil || claims[cfg.GroupsClaim] == nil) {
+		var info map[string]interface{}
+		if err := oidcGetJSON(provider.UserinfoEndpoint, accessToken, &info); err == nil && info["sub"] == claims["sub"] {
+			for k, v := range info {
+				if _, exists := claims[k]; !exists {
+					claims[k] = v
+				}
+			}
+		}
+	}
+
+	user, err := resolveOIDCUser(cfg, claims)
+	if err != nil {
+		oidcFail(c, err.Error())
+		return
+	}
+	if !user.Active {
+		oidcFail(c, "Usuário desativado")
+		return
+	}
+
+	// Usuário com 2FA: a tela de login pede o código usando o desafio
+	if user.TOTPEnabled {
+		mfaToken, err := issueSecondFactorChallenge(user)
+		if err != nil {
+			oidcFail(c, "Erro ao gerar desafio 2FA")
+			return
+		}
+		oidcFinish(c, url.Values{"mfa_token": {mfaToken}})
+		return
+	}
+
+	// O refresh token (uso único, rotacionado) é trocado pelo access token em /auth/refresh
+	registerLoginSuccess(user.Username)
+	_, refreshToken, err := createSession(c, user)
+	if err != nil {
+		oidcFail(c, "Erro ao criar sessão")
+		return
+	}
+	oidcFinish(c, url.Values{"refresh_token": {refreshToken}})
+}
+
+// TestOIDCProvider valida descoberta e JWKS do provedor configurado (Admin)
+func TestOIDCProvider(c *gin.Context) {
+	cfg := loadOIDCConfig()
+	trace := &ldapTrace{}
+
+	provider, err := discoverOIDC(cfg)
+	trace.record("discovery", err, cfg.Issuer)
+	if err == nil {
+		var keys map[string]*rsa.PublicKey
+		keys, err = fetchOIDCKeys(provider.JWKSURI)
+		trace.record("jwks", err, fmt.Sprintf("%d chave(s)", len(keys)))
+		trace.record("redirect_uri", nil, oidcRedirectURI(c, cfg))
+	}
+
+	logRequestAction(c, "OIDC_TEST", "Setting", 0, fmt.Sprintf("Teste do provedor OIDC (%s): sucesso=%t", cfg.Issuer, err == nil))
+	c.JSON(http.StatusOK, gin.H{
+		"ok":    err == nil,
+		"steps": trace.Steps,
+	})
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIdP é um provedor OIDC mínimo: descoberta, JWKS e troca de código com PKCE
+type mockIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	// Dados do pedido de autorização em andamento (lidos do redirecionamento)
+	challenge, nonce, redirectURI string
+	claims                        jwt.MapClaims
+}
+
+const mockIdPClientID = "camaragestao"
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{t: t, key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "k1", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	verifier := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if r.Form.Get("code") != "codigo-valido" ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != idp.challenge ||
+		r.Form.Get("redirect_uri") != idp.redirectURI {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   idp.server.URL,
+		"aud":   mockIdPClientID,
+		"exp":   time.Now().Add(5 * time.Minute).Unix(),
+		"nonce": idp.nonce,
+	}
+	for k, v := range idp.claims {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "k1"
+	signed, err := token.SignedString(idp.key)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "access_token": "at"})
+}
+
+func setupOIDCTest(t *testing.T) (*mockIdP, *gin.Engine) {
+	setupTestDB(t)
+	idp := newMockIdP(t)
+	idp.claims = jwt.MapClaims{
+		"sub":                "abc-123",
+		"preferred_username": "joana",
+		"name":               "Joana Lima",
+		"email":              "joana@camara.local",
+		"groups":             []string{"ti-suporte"},
+	}
+	setTestSetting(t, "oidc_enabled", "true")
+	setTestSetting(t, "oidc_issuer", idp.server.URL)
+	setTestSetting(t, "oidc_client_id", mockIdPClientID)
+	setTestSetting(t, "oidc_redirect_url", "http://camaragestao.local/api/v1/auth/oidc/callback")
+	setTestSetting(t, "oidc_role_mapping", `{"ti-suporte": "Tech"}`)
+
+	r := gin.New()
+	r.GET("/api/v1/auth/oidc/login", StartOIDCLogin)
+	r.GET("/api/v1/auth/oidc/callback", OIDCCallback)
+	return idp, r
+}
+
+// startOIDCLogin inicia o login e devolve o state e o cookie que o navegador receberia
+func startOIDCLogin(t *testing.T, idp *mockIdP, r *gin.Engine) (string, *http.Cookie) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("início do login: status %d", w.Code)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil || !strings.HasPrefix(location.String(), idp.server.URL+"/authorize?") {
+		t.Fatalf("redirecionamento inesperado: %s", w.Header().Get("Location"))
+	}
+	q := location.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != mockIdPClientID {
+		t.Fatalf("parâmetros de autorização incorretos: %v", q)
+	}
+	idp.challenge, idp.nonce, idp.redirectURI = q.Get("code_challenge"), q.Get("nonce"), q.Get("redirect_uri")
+
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == oidcStateCookie {
+			if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.Value != q.Get("state") {
+				t.Fatalf("cookie de state inseguro: %+v", cookie)
+			}
+			return q.Get("state"), cookie
+		}
+	}
+	t.Fatal("cookie de state não enviado")
+	return "", nil
+}
+
+func oidcCallback(r *gin.Engine, state string, cookie *http.Cookie) url.Values {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/callback?code=codigo-valido&state="+url.QueryEscape(state), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	fragment, _ := url.ParseQuery(strings.TrimPrefix(w.Header().Get("Location"), "/login#"))
+	return fragment
+}
+
+func TestOIDCLoginProvisionsUser(t *testing.T) {
+	idp, r := setupOIDCTest(t)
+	state, cookie := startOIDCLogin(t, idp, r)
+
+	result := oidcCallback(r, state, cookie)
+	if result.Get("refresh_token") == "" {
+		t.Fatalf("login não concluído: %v", result)
+	}
+
+	var user User
+	if err := db.Where("oidc_subject = ?", "abc-123").First(&user).Error; err != nil {
+		t.Fatalf("usuário não provisionado: %v", err)
+	}
+	if user.Username != "joana" || user.FullName != "Joana Lima" || user.Role != "Tech" || user.Password != oidcManagedPassword {
+		t.Errorf("usuário provisionado incorretamente: %+v", user)
+	}
+
+	// State de uso único
+	if again := oidcCallback(r, state, cookie); again.Get("oidc_error") == "" {
+		t.Errorf("state reutilizado foi aceito: %v", again)
+	}
+}
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	idp, r := setupOIDCTest(t)
+	state, _ := startOIDCLogin(t, idp, r)
+
+	// Link enviado por um atacante: o navegador da vítima não tem o cookie desse login
+	if result := oidcCallback(r, state, nil); result.Get("oidc_error") == "" || result.Get("refresh_token") != "" {
+		t.Fatalf("callback sem cookie foi aceito: %v", result)
+	}
+	other := &http.Cookie{Name: oidcStateCookie, Value: "state-de-outro-login"}
+	if result := oidcCallback(r, state, other); result.Get("oidc_error") == "" {
+		t.Fatalf("callback com cookie de outro login foi aceito: %v", result)
+	}
+}
+
+func TestOIDCCallbackRejectsWrongNonce(t *testing.T) {
+	idp, r := setupOIDCTest(t)
+	state, cookie := startOIDCLogin(t, idp, r)
+	idp.claims["nonce"] = "outro-nonce"
+
+	if result := oidcCallback(r, state, cookie); !strings.Contains(result.Get("oidc_error"), "nonce") {
+		t.Fatalf("id_token com nonce divergente foi aceito: %v", result)
+	}
+}
+
+func TestOIDCCallbackWhenDisabled(t *testing.T) {
+	idp, r := setupOIDCTest(t)
+	state, cookie := startOIDCLogin(t, idp, r)
+	setTestSetting(t, "oidc_enabled", "false")
+
+	if result := oidcCallback(r, state, cookie); result.Get("oidc_error") == "" {
+		t.Fatalf("callback aceito com o SSO desabilitado: %v", result)
+	}
+}
+
+func TestOIDCStateCookieClearedWithSameAttributes(t *testing.T) {
+	idp, r := setupOIDCTest(t)
+	// TLS terminado no proxy: a conexão com o backend é HTTP, mas o redirect_uri é HTTPS
+	setTestSetting(t, "oidc_redirect_url", "https://camaragestao.local/api/v1/auth/oidc/callback")
+	state, cookie := startOIDCLogin(t, idp, r)
+	if !cookie.Secure {
+		t.Fatalf("cookie de state sem Secure: %+v", cookie)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/callback?code=codigo-valido&state="+url.QueryEscape(state), nil)
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	for _, cleared := range w.Result().Cookies() {
+		if cleared.Name == oidcStateCookie {
+			if cleared.MaxAge >= 0 || cleared.Secure != cookie.Secure || cleared.Path != cookie.Path || cleared.SameSite != cookie.SameSite {
+				t.Errorf("cookie apagado com atributos diferentes: %+v (gravado: %+v)", cleared, cookie)
+			}
+			return
+		}
+	}
+	t.Error("cookie de state não foi apagado")
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ==========================================
+// POLÍTICA DE SENHAS (Complexidade, Histórico, Validade)
+// ==========================================
+//
+// Regras configuráveis em password_*. Contas criadas com senha escolhida pelo
+// administrador (seed, setup inicial, cadastro, importação) nascem com
+// MustChangePassword: o AuthMiddleware libera apenas a troca de senha até lá.
+// Contas do AD/SSO não têm senha local e ficam fora da política.
+
+// PasswordHistory guarda hashes de senhas anteriores para impedir reuso
+type PasswordHistory struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index;not null"`
+	Hash      string `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+// Rotas liberadas enquanto o usuário precisa trocar a senha
+var passwordChangeRoutes = map[string]bool{
+	"/api/v1/logout":               true,
+	"/api/v1/auth/change-password": true,
+}
+
+// hasLocalPassword indica se a conta usa senha própria (não gerenciada pelo AD/SSO)
+func hasLocalPassword(user User) bool {
+	return user.Password != ldapManagedPassword && user.Password != oidcManagedPassword
+}
+
+// validatePasswordPolicy confere tamanho e classes de caracteres exigidos
+func validatePasswordPolicy(password, username string) error {
+	minLength := getSettingInt("password_min_length", 8)
+	if len([]rune(password)) < minLength {
+		return fmt.Errorf("A senha deve ter pelo menos %d caracteres", minLength)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	var missing []string
+	if getSettingValue("password_require_upper", "true") == "true" && !upper {
+		missing = append(missing, "letra maiúscula")
+	}
+	if getSettingValue("password_require_lower", "true") == "true" && !lower {
+		missing = append(missing, "letra minúscula")
+	}
+	if getSettingValue("password_require_digit", "true") == "true" && !digit {
+		missing = append(missing, "número")
+	}
+	if getSettingValue("password_require_symbol", "false") == "true" && !symbol {
+		missing = append(missing, "símbolo")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("A senha deve conter: %s", strings.Join(missing, ", "))
+	}
+
+	if username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return fmt.Errorf("A senha não pode conter o nome de usuário")
+	}
+	return nil
+}
+
+// checkPasswordReuse impede repetir a senha atual ou as últimas password_history_count
+func checkPasswordReuse(user User, password string) error {
+	count := getSettingInt("password_history_count", 5)
+	if count <= 0 || user.ID == 0 {
+		return nil
+	}
+	if hasLocalPassword(user) && bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) == nil {
+		return fmt.Errorf("A nova senha deve ser diferente da atual")
+	}
+
+	var history []PasswordHistory
+	db.Where("user_id = ?", user.ID).Order("created_at desc").Limit(count).Find(&history)
+	for _, h := range history {
+		if bcrypt.CompareHashAndPassword([]byte(h.Hash), []byte(password)) == nil {
+			return fmt.Errorf("A senha não pode repetir nenhuma das últimas %d senhas", count)
+		}
+	}
+	return nil
+}
+
+// setUserPassword grava o novo hash, arquivando o anterior no histórico (não salva o usuário)
+func setUserPassword(user *User, password string) error {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	if user.ID > 0 && hasLocalPassword(*user) && user.Password != "" {
+		db.Create(&PasswordHistory{UserID: user.ID, Hash: user.Password})
+
+		// Manter apenas as entradas necessárias para a verificação de reuso
+		keep := getSettingInt("password_history_count", 5)
+		var stale []uint
+		db.Model(&PasswordHistory{}).Where("user_id = ?", user.ID).Order("created_at desc").Offset(keep).Pluck("id", &stale)
+		if len(stale) > 0 {
+			db.Delete(&PasswordHistory{}, stale)
+		}
+	}
+
+	now := time.Now()
+	user.Password = string(hashed)
+	user.PasswordChangedAt = &now
+	return nil
+}
+
+// passwordExpired indica se a senha local ultrapassou password_max_age_days (0 = sem validade)
+func passwordExpired(user User) bool {
+	maxAge := getSettingInt("password_max_age_days", 0)
+	if maxAge <= 0 || !hasLocalPassword(user) {
+		return false
+	}
+	changedAt := user.CreatedAt
+	if user.PasswordChangedAt != nil {
+		changedAt = *user.PasswordChangedAt
+	}
+	return time.Since(changedAt) > time.Duration(maxAge)*24*time.Hour
+}
+
+// passwordChangeRequired indica se o usuário só pode trocar a senha
+func passwordChangeRequired(user User) bool {
+	return (user.MustChangePassword && hasLocalPassword(user)) || passwordExpired(user)
+}
+
+// ChangePassword troca a senha do próprio usuário, exigindo a senha atual
+func ChangePassword(c *gin.Context) {
+	var input struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user User
+	if err := db.First(&user, getCurrentUserID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+		return
+	}
+	if !hasLocalPassword(user) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A senha desta conta é gerenciada pelo AD/SSO"})
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.CurrentPassword)) != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Senha atual incorreta"})
+		return
+	}
+	if err := validatePasswordPolicy(input.NewPassword, user.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkPasswordReuse(user, input.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := setUserPassword(&user, input.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao processar senha"})
+		return
+	}
+	user.MustChangePassword = false
+	if err := db.Save(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar senha"})
+		return
+	}
+
+	// As demais sessões são encerradas; a atual continua válida
+	revokeUserSessions(user.ID, c.GetUint("sessionID"))
+	logAction(user.ID, "CHANGE_PASSWORD", "User", user.ID, "Senha alterada pelo próprio usuário")
+	c.JSON(http.StatusOK, gin.H{"message": "Senha alterada com sucesso", "user": user})
+}
+
+// GetPasswordPolicy descreve as regras atuais para exibição no formulário de troca (público)
+func GetPasswordPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"min_length":     getSettingInt("password_min_length", 8),
+		"require_upper":  getSettingValue("password_require_upper", "true") == "true",
+		"require_lower":  getSettingValue("password_require_lower", "true") == "true",
+		"require_digit":  getSettingValue("password_require_digit", "true") == "true",
+		"require_symbol": getSettingValue("password_require_symbol", "false") == "true",
+		"history_count":  getSettingInt("password_history_count", 5),
+		"max_age_days":   getSettingInt("password_max_age_days", 0),
+	})
+}
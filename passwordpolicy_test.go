@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// userUpdateRouter expõe PUT /users/:id autenticado como o usuário informado
+func userUpdateRouter(user User) *gin.Engine {
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("userID", user.ID)
+		c.Set("role", user.Role)
+	})
+	r.PUT("/users/:id", UpdateUser)
+	return r
+}
+
+func putUser(r *gin.Engine, id uint, body string) int {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, fmt.Sprintf("/users/%d", id), strings.NewReader(body)))
+	return w.Code
+}
+
+func TestUpdateUserOwnPasswordRequiresCurrentPassword(t *testing.T) {
+	setupTestDB(t)
+	joana := createTestUser(t, "joana", "User", "")
+	admin := createTestUser(t, "admin", "Admin", "")
+	passwordIs := func(user User, password string) bool {
+		db.First(&user, user.ID)
+		return bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) == nil
+	}
+
+	// Sessão roubada sem a senha atual não troca a senha
+	r := userUpdateRouter(joana)
+	if code := putUser(r, joana.ID, `{"password":"Nova@Senha456"}`); code != http.StatusUnauthorized {
+		t.Errorf("sem senha atual: status %d", code)
+	}
+	if code := putUser(r, joana.ID, `{"password":"Nova@Senha456","current_password":"errada"}`); code != http.StatusUnauthorized {
+		t.Errorf("senha atual incorreta: status %d", code)
+	}
+	if !passwordIs(joana, "Senha@Teste123") {
+		t.Fatal("senha trocada sem confirmar a atual")
+	}
+	if code := putUser(r, joana.ID, `{"password":"Nova@Senha456","current_password":"Senha@Teste123"}`); code != http.StatusOK {
+		t.Errorf("com senha atual: status %d", code)
+	}
+	if !passwordIs(joana, "Nova@Senha456") {
+		t.Error("senha não trocada com a senha atual correta")
+	}
+
+	// O administrador define a senha de outra pessoa sem conhecê-la (senha provisória)
+	if code := putUser(userUpdateRouter(admin), joana.ID, `{"password":"Provisoria@789"}`); code != http.StatusOK {
+		t.Errorf("senha definida pelo admin: status %d", code)
+	}
+	var stored User
+	db.First(&stored, joana.ID)
+	if !passwordIs(joana, "Provisoria@789") || !stored.MustChangePassword {
+		t.Errorf("senha provisória não aplicada: %+v", stored)
+	}
+}
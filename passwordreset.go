@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==========================================
+// RECUPERAÇÃO DE SENHA (Link por E-mail)
+// ==========================================
+//
+// "Esqueci minha senha": o usuário informa login ou e-mail e recebe um link de
+// uso único (/login#reset_token=...) válido por password_reset_ttl_minutes.
+// A resposta é a mesma para contas inexistentes, evitando enumeração de usuários;
+// só contas do AD/SSO recebem recusa explícita, pois a senha não é gerenciada aqui.
+// O link é montado com app_base_url; sem ele a recuperação fica desativada.
+
+// PasswordResetToken é um pedido de redefinição de senha (guarda apenas o hash)
+type PasswordResetToken struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UserID      uint       `gorm:"index;not null" json:"user_id"`
+	TokenHash   string     `gorm:"uniqueIndex;not null" json:"-"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	UsedAt      *time.Time `json:"used_at"`
+	RequestedIP string     `gorm:"index" json:"requested_ip"`
+}
+
+const (
+	passwordResetCooldown     = 2 * time.Minute // Intervalo mínimo entre pedidos do mesmo usuário
+	passwordResetMaxPerIPHour = 10
+)
+
+const passwordResetGenericMessage = "Se o usuário existir e tiver e-mail cadastrado, enviaremos um link para redefinir a senha."
+
+// RequestPasswordReset envia o link de redefinição por e-mail (público)
+func RequestPasswordReset(c *gin.Context) {
+	var input struct {
+		Login string `json:"login" binding:"required"` // Usuário ou e-mail
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Sem app_base_url não há como montar o link com segurança
+	if cfg := loadSMTPConfig(); !cfg.Enabled || cfg.Host == "" || appBaseURL() == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Recuperação de senha indisponível: procure o suporte de TI"})
+		return
+	}
+
+	var recent int64
+	db.Model(&PasswordResetToken{}).Where("requested_ip = ? AND created_at > ?", c.ClientIP(), time.Now().Add(-time.Hour)).Count(&recent)
+	if recent >= passwordResetMaxPerIPHour {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Muitas solicitações. Tente novamente mais tarde."})
+		return
+	}
+
+	login := strings.TrimSpace(input.Login)
+	var user User
+	if err := db.Where("username = ? OR (email <> '' AND LOWER(email) = LOWER(?))", login, login).First(&user).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"message": passwordResetGenericMessage})
+		return
+	}
+
+	switch user.Password {
+	case ldapManagedPassword:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Esta conta usa a senha da rede (AD). Altere-a pelo Windows ou procure o suporte de TI."})
+		return
+	case oidcManagedPassword:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Esta conta entra via SSO. Redefina a senha no provedor de login único."})
+		return
+	}
+	if !user.Active || user.Email == "" {
+		c.JSON(http.StatusOK, gin.H{"message": passwordResetGenericMessage})
+		return
+	}
+
+	// Evitar disparos repetidos para o mesmo usuário
+	var last PasswordResetToken
+	if db.Where("user_id = ?", user.ID).Order("created_at desc").First(&last).Error == nil && time.Since(last.CreatedAt) < passwordResetCooldown {
+		c.JSON(http.StatusOK, gin.H{"message": passwordResetGenericMessage})
+		return
+	}
+
+	raw, err := generateRandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gerar link"})
+		return
+	}
+	ttl := getSettingInt("password_reset_ttl_minutes", 30)
+
+	// Um novo pedido invalida os links anteriores ainda não usados
+	now := time.Now()
+	db.Model(&PasswordResetToken{}).Where("user_id = ? AND used_at IS NULL", user.ID).Update("used_at", now)
+	reset := PasswordResetToken{
+		UserID:      user.ID,
+		TokenHash:   hashToken(raw),
+		ExpiresAt:   now.Add(time.Duration(ttl) * time.Minute),
+		RequestedIP: c.ClientIP(),
+	}
+	if err := db.Create(&reset).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao registrar pedido"})
+		return
+	}
+
+	link := appBaseURL() + "/login#reset_token=" + raw
+	err = sendMail(mailMessage{
+		To:      []string{user.Email},
+		Subject: "CâmaraGestão - Redefinição de senha",
+		Body: fmt.Sprintf("Olá, %s.\n\nRecebemos um pedido para redefinir a senha do usuário %s.\n"+
+			"Para criar uma nova senha, acesse o link abaixo (válido por %d minutos, uso único):\n\n%s\n\n"+
+			"Se você não fez este pedido, ignore este e-mail: sua senha atual continua válida.",
+			user.FullName, user.Username, ttl, link),
+		Headers: map[string]string{"Auto-Submitted": "auto-generated"},
+	})
+	if err != nil {
+		fmt.Printf("[RESET] Falha ao enviar e-mail para %s: %v\n", user.Username, err)
+		db.Delete(&reset)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Não foi possível enviar o e-mail. Tente novamente ou procure o suporte de TI."})
+		return
+	}
+
+	logAction(user.ID, "PASSWORD_RESET_REQUEST", "User", user.ID, fmt.Sprintf("Link de redefinição enviado (IP %s)", c.ClientIP()))
+	c.JSON(http.StatusOK, gin.H{"message": passwordResetGenericMessage})
+}
+
+// ConfirmPasswordReset define a nova senha a partir do link recebido (público)
+func ConfirmPasswordReset(c *gin.Context) {
+	var input struct {
+		Token       string `json:"token" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var reset PasswordResetToken
+	if err := db.Where("token_hash = ?", hashToken(input.Token)).First(&reset).Error; err != nil ||
+		reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Link inválido ou expirado. Solicite uma nova redefinição."})
+		return
+	}
+
+	var user User
+	if err := db.First(&user, reset.UserID).Error; err != nil || !user.Active {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Link inválido ou expirado. Solicite uma nova redefinição."})
+		return
+	}
+	if !hasLocalPassword(user) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A senha desta conta é gerenciada pelo AD/SSO"})
+		return
+	}
+	if err := validatePasswordPolicy(input.NewPassword, user.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkPasswordReuse(user, input.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := setUserPassword(&user, input.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao processar senha"})
+		return
+	}
+	user.MustChangePassword = false
+	if err := db.Save(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar senha"})
+		return
+	}
+
+	// Link consumido; sessões abertas (possivelmente de um invasor) são encerradas
+	now := time.Now()
+	reset.UsedAt = &now
+	db.Save(&reset)
+	revokeUserSessions(user.ID, 0)
+	registerLoginSuccess(user.Username)
+
+	logAction(user.ID, "PASSWORD_RESET", "User", user.ID, fmt.Sprintf("Senha redefinida via link de recuperação (IP %s)", c.ClientIP()))
+	c.JSON(http.StatusOK, gin.H{"message": "Senha redefinida. Entre com a nova senha."})
+}
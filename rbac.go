@@ -0,0 +1,536 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==========================================
+// PERFIS E PERMISSÕES (RBAC)
+// ==========================================
+//
+// Um perfil (Role) é um conjunto de permissões nomeadas. User.Role guarda o nome
+// do perfil; as rotas exigem permissões via PermissionMiddleware e os handlers
+// consultam hasPermission para regras de escopo (ex.: quais chamados enxergar).
+// O perfil Admin é de sistema e sempre possui todas as permissões.
+
+const adminRoleName = "Admin"
+
+// Permission é uma ação autorizável do sistema
+type Permission struct {
+	Key         string `gorm:"primaryKey" json:"key"`
+	Description string `json:"description"`
+}
+
+// Role agrupa permissões; perfis de sistema não podem ser excluídos
+type Role struct {
+	ID          uint         `gorm:"primaryKey" json:"id"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+	Name        string       `gorm:"uniqueIndex;not null" json:"name"`
+	Description string       `json:"description"`
+	System      bool         `json:"system"`
+	Priority    int          `gorm:"not null;default:0" json:"priority"` // Precedência no mapeamento de grupos do AD/SSO (maior vence)
+	Permissions []Permission `gorm:"many2many:role_permissions;" json:"permissions"`
+}
+
+// permissionCatalog lista todas as permissões conhecidas
+var permissionCatalog = []Permission{
+	{Key: "ticket.view_all", Description: "Ver todos os chamados"},
+	{Key: "ticket.view_queue", Description: "Ver chamados sem responsável (fila) além dos próprios"},
+	{Key: "ticket.create_for_others", Description: "Abrir chamado em nome de outro usuário"},
+	{Key: "ticket.update_status", Description: "Alterar status de chamados de terceiros"},
+	{Key: "ticket.assign", Description: "Atribuir chamados"},
+	{Key: "ticket.assignee", Description: "Pode ser responsável por chamados"},
+	{Key: "ticket.delete", Description: "Excluir chamados"},
+	{Key: "comment.history", Description: "Ver versões anteriores de comentários editados ou excluídos"},
+	{Key: "ticket.internal_notes", Description: "Ver e escrever notas internas (não visíveis ao solicitante)"},
+	{Key: "asset.view", Description: "Ver inventário de ativos"},
+	{Key: "asset.view_financial", Description: "Ver dados financeiros dos ativos (valor, nota fiscal, fornecedor)"},
+	{Key: "asset.manage", Description: "Cadastrar, editar e importar ativos"},
+	{Key: "asset.delete", Description: "Excluir ativos"},
+	{Key: "user.list", Description: "Listar usuários para seleção (solicitante, responsável)"},
+	{Key: "user.manage", Description: "Gerenciar usuários (cadastro, importação, sessões, 2FA, bloqueios)"},
+	{Key: "user.impersonate", Description: "Acessar o sistema como outro usuário (personificação auditada)"},
+	{Key: "role.manage", Description: "Gerenciar perfis e permissões"},
+	{Key: "category.manage", Description: "Gerenciar categorias de serviço"},
+	{Key: "workflow.manage", Description: "Editar o fluxo de status dos chamados (status e transições)"},
+	{Key: "report.view", Description: "Ver relatórios"},
+	{Key: "dashboard.view", Description: "Ver indicadores do painel"},
+	{Key: "audit.view", Description: "Ver log de auditoria"},
+	{Key: "settings.manage", Description: "Alterar configurações do sistema"},
+	{Key: "settings.notice", Description: "Alterar o aviso do sistema"},
+	{Key: "system.manage", Description: "Administração do sistema (atualização, chaves JWT, AD/SSO)"},
+}
+
+// defaultRolePermissions define os perfis de sistema (equivalentes às regras fixas anteriores)
+var defaultRolePermissions = map[string][]string{
+	"Supervisor": {"ticket.view_all", "ticket.update_status", "ticket.assign", "ticket.internal_notes", "asset.view", "asset.view_financial", "user.list", "report.view", "dashboard.view", "settings.notice"},
+	"Tech":       {"ticket.view_queue", "ticket.create_for_others", "ticket.update_status", "ticket.assign", "ticket.assignee", "ticket.internal_notes", "asset.view", "asset.manage", "user.list", "report.view", "dashboard.view"},
+	"User":       {"asset.view"},
+}
+
+// defaultRolePriority é a precedência inicial dos perfis de sistema no mapeamento de grupos
+var defaultRolePriority = map[string]int{adminRoleName: 100, "Supervisor": 30, "Tech": 20, "User": 10}
+
+// Configurações booleanas substituídas por permissões (migradas uma única vez)
+var legacyPermissionSettings = []struct {
+	Setting, Role, Permission string
+}{
+	{"user_view_reports", "User", "report.view"},
+	{"tech_delete_assets", "Tech", "asset.delete"},
+	{"tech_delete_tickets", "Tech", "ticket.delete"},
+}
+
+var (
+	rolePermissions   = map[string]map[string]bool{}
+	rolePriorities    = map[string]int{}
+	rolePermissionsMu sync.RWMutex
+)
+
+// seedRoles cria permissões e perfis de sistema; permissões novas do catálogo são
+// concedidas aos perfis de sistema que as tenham por padrão
+func seedRoles() {
+	var existing []string
+	db.Model(&Permission{}).Pluck("key", &existing)
+	known := map[string]bool{}
+	for _, k := range existing {
+		known[k] = true
+	}
+	for _, p := range permissionCatalog {
+		db.Save(&p)
+	}
+
+	// Bancos anteriores à coluna priority: mesma ordem da precedência fixa antiga
+	var prioritized int64
+	db.Model(&Role{}).Where("priority <> 0").Count(&prioritized)
+	if prioritized == 0 {
+		for name, priority := range defaultRolePriority {
+			db.Model(&Role{}).Where("name = ?", name).Update("priority", priority)
+		}
+	}
+
+	for _, name := range []string{adminRoleName, "Supervisor", "Tech", "User"} {
+		var role Role
+		created := false
+		if err := db.Where("name = ?", name).First(&role).Error; err != nil {
+			role = Role{Name: name, System: true, Description: "Perfil padrão do sistema", Priority: defaultRolePriority[name]}
+			db.Create(&role)
+			created = true
+		}
+
+		var grant []Permission
+		for _, key := range defaultRolePermissions[name] {
+			if created || !known[key] {
+				grant = append(grant, Permission{Key: key})
+			}
+		}
+		if len(grant) > 0 {
+			db.Model(&role).Association("Permissions").Append(grant)
+		}
+	}
+
+	// Migrar as antigas chaves booleanas para permissões do perfil correspondente
+	for _, legacy := range legacyPermissionSettings {
+		var setting SystemSetting
+		if err := db.First(&setting, "key = ?", legacy.Setting).Error; err != nil {
+			continue
+		}
+		if setting.Value == "true" {
+			var role Role
+			if db.Where("name = ?", legacy.Role).First(&role).Error == nil {
+				db.Model(&role).Association("Permissions").Append(&Permission{Key: legacy.Permission})
+			}
+		}
+		db.Delete(&setting)
+		fmt.Printf("[RBAC] Configuração %s migrada para a permissão %s do perfil %s\n", legacy.Setting, legacy.Permission, legacy.Role)
+	}
+
+	if err := loadRolePermissions(); err != nil {
+		fmt.Printf("[RBAC] Erro ao carregar perfis: %v\n", err)
+	}
+}
+
+// loadRolePermissions recarrega o cache perfil -> permissões
+func loadRolePermissions() error {
+	var roles []Role
+	if err := db.Preload("Permissions").Find(&roles).Error; err != nil {
+		return err
+	}
+	cache := map[string]map[string]bool{}
+	priorities := map[string]int{}
+	for _, role := range roles {
+		perms := map[string]bool{}
+		for _, p := range role.Permissions {
+			perms[p.Key] = true
+		}
+		cache[role.Name] = perms
+		priorities[role.Name] = role.Priority
+	}
+
+	rolePermissionsMu.Lock()
+	rolePermissions = cache
+	rolePriorities = priorities
+	rolePermissionsMu.Unlock()
+	return nil
+}
+
+// rolePriority devolve a precedência do perfil no mapeamento de grupos do AD/SSO
+func rolePriority(role string) int {
+	rolePermissionsMu.RLock()
+	defer rolePermissionsMu.RUnlock()
+	return rolePriorities[role]
+}
+
+// roleExists indica se o perfil está cadastrado
+func roleExists(name string) bool {
+	rolePermissionsMu.RLock()
+	defer rolePermissionsMu.RUnlock()
+	_, ok := rolePermissions[name]
+	return ok
+}
+
+// roleHasPermission consulta o cache de permissões do perfil
+func roleHasPermission(role, permission string) bool {
+	if role == adminRoleName {
+		return true
+	}
+	rolePermissionsMu.RLock()
+	defer rolePermissionsMu.RUnlock()
+	return rolePermissions[role][permission]
+}
+
+// permissionsForRole lista as permissões efetivas do perfil (para o frontend)
+func permissionsForRole(role string) []string {
+	perms := []string{}
+	for _, p := range permissionCatalog {
+		if roleHasPermission(role, p.Key) {
+			perms = append(perms, p.Key)
+		}
+	}
+	return perms
+}
+
+// rolesWithPermission lista os perfis que possuem a permissão
+func rolesWithPermission(permission string) []string {
+	rolePermissionsMu.RLock()
+	names := make([]string, 0, len(rolePermissions))
+	for name := range rolePermissions {
+		names = append(names, name)
+	}
+	rolePermissionsMu.RUnlock()
+
+	var result []string
+	for _, name := range names {
+		if roleHasPermission(name, permission) {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// hasPermission verifica a permissão do usuário autenticado (limitada aos escopos, se autenticado por token de API)
+func hasPermission(c *gin.Context, permission string) bool {
+	if !roleHasPermission(c.GetString("role"), permission) {
+		return false
+	}
+	if scopes, ok := c.Get("apiTokenScopes"); ok {
+		return tokenScopeAllows(scopes.([]string), permission)
+	}
+	return true
+}
+
+// PermissionMiddleware libera a rota se o perfil do usuário tiver alguma das permissões
+func PermissionMiddleware(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, p := range permissions {
+			if hasPermission(c, p) {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Permissão necessária: " + strings.Join(permissions, " ou ")})
+	}
+}
+
+// --- Concessão de perfis ---
+
+// canManageRole indica se o usuário autenticado pode conceder o perfil ou administrar contas
+// que o possuem: é preciso ter todas as permissões do perfil, e só um Admin gerencia
+// administradores. Sem isso, quem tem user.manage poderia se promover ou trocar a senha
+// de uma conta com mais privilégios.
+func canManageRole(c *gin.Context, role string) bool {
+	if role == adminRoleName && c.GetString("role") != adminRoleName {
+		return false
+	}
+	for _, p := range permissionCatalog {
+		if roleHasPermission(role, p.Key) && !hasPermission(c, p.Key) {
+			return false
+		}
+	}
+	return true
+}
+
+// --- Escopo de chamados ---
+
+// canViewTicket aplica as regras de visibilidade de um chamado
+func canViewTicket(c *gin.Context, ticket Ticket) bool {
+	uid := getCurrentUserID(c)
+	if hasPermission(c, "ticket.view_all") || ticket.CreatorID == uid {
+		return true
+	}
+	if ticket.AssignedToID != nil && *ticket.AssignedToID == uid {
+		return true
+	}
+	if ticket.AssignedToID == nil && hasPermission(c, "ticket.view_queue") {
+		return true
+	}
+	return isTicketWatcher(ticket.ID, uid)
+}
+
+// userCanViewTicket aplica as mesmas regras de canViewTicket fora de uma requisição (ex: e-mail recebido)
+func userCanViewTicket(user User, ticket Ticket) bool {
+	if roleHasPermission(user.Role, "ticket.view_all") || ticket.CreatorID == user.ID {
+		return true
+	}
+	if ticket.AssignedToID != nil && *ticket.AssignedToID == user.ID {
+		return true
+	}
+	if ticket.AssignedToID == nil && roleHasPermission(user.Role, "ticket.view_queue") {
+		return true
+	}
+	return isTicketWatcher(ticket.ID, user.ID)
+}
+
+// --- Dados financeiros de ativos ---
+
+// hideAssetFinancials remove valores financeiros para quem não tem asset.view_financial
+func hideAssetFinancials(c *gin.Context, asset *Asset) {
+	if asset == nil || hasPermission(c, "asset.view_financial") {
+		return
+	}
+	clearAssetFinancials(asset)
+}
+
+func clearAssetFinancials(asset *Asset) {
+	asset.Price = 0
+	asset.InvoiceNumber = ""
+	asset.Supplier = ""
+	asset.PurchaseDate = time.Time{}
+}
+
+// --- Notas internas ---
+
+// canSeeInternalNotes indica se o usuário vê comentários internos (ticket.internal_notes)
+func canSeeInternalNotes(c *gin.Context) bool {
+	return hasPermission(c, "ticket.internal_notes")
+}
+
+// preloadVisibleComments carrega os comentários do chamado, sem as notas internas para quem não pode vê-las
+func preloadVisibleComments(c *gin.Context, query *gorm.DB) *gorm.DB {
+	if canSeeInternalNotes(c) {
+		return query.Preload("Comments")
+	}
+	return query.Preload("Comments", "internal = ?", false)
+}
+
+// preloadVisibleAttachments carrega os anexos do chamado, sem os das notas internas para quem não pode vê-las
+func preloadVisibleAttachments(c *gin.Context, query *gorm.DB) *gorm.DB {
+	if canSeeInternalNotes(c) {
+		return query.Preload("Attachments")
+	}
+	return query.Preload("Attachments", "comment_id IS NULL OR comment_id NOT IN (?)", internalCommentIDs())
+}
+
+// internalCommentIDs é a subconsulta dos comentários internos
+func internalCommentIDs() *gorm.DB {
+	return db.Unscoped().Model(&Comment{}).Select("id").Where("internal = ?", true)
+}
+
+// --- API de perfis (role.manage) ---
+
+// GetPermissions lista o catálogo de permissões
+func GetPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, permissionCatalog)
+}
+
+// GetRoles lista os perfis com suas permissões
+func GetRoles(c *gin.Context) {
+	var roles []Role
+	if err := db.Preload("Permissions").Order("system desc, name").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar perfis"})
+		return
+	}
+	for i := range roles {
+		if roles[i].Name == adminRoleName {
+			roles[i].Permissions = permissionCatalog
+		}
+	}
+	c.JSON(http.StatusOK, roles)
+}
+
+// resolvePermissions valida as chaves informadas contra o catálogo
+func resolvePermissions(keys []string) ([]Permission, error) {
+	valid := map[string]bool{}
+	for _, p := range permissionCatalog {
+		valid[p.Key] = true
+	}
+	perms := make([]Permission, 0, len(keys))
+	for _, k := range keys {
+		if !valid[k] {
+			return nil, fmt.Errorf("Permissão desconhecida: %s", k)
+		}
+		perms = append(perms, Permission{Key: k})
+	}
+	return perms, nil
+}
+
+// ungrantablePermission devolve a primeira permissão informada que o usuário autenticado não possui ("" se todas)
+func ungrantablePermission(c *gin.Context, keys []string) string {
+	for _, k := range keys {
+		if !hasPermission(c, k) {
+			return k
+		}
+	}
+	return ""
+}
+
+// CreateRole cria um perfil personalizado
+func CreateRole(c *gin.Context) {
+	var input struct {
+		Name        string   `json:"name" binding:"required"`
+		Description string   `json:"description"`
+		Priority    int      `json:"priority"`
+		Permissions []string `json:"permissions"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Informe o nome do perfil"})
+		return
+	}
+	if roleExists(input.Name) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Já existe um perfil com este nome"})
+		return
+	}
+	perms, err := resolvePermissions(input.Permissions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Ninguém concede permissões que não possui
+	if key := ungrantablePermission(c, input.Permissions); key != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Sem permissão para conceder " + key})
+		return
+	}
+
+	role := Role{Name: input.Name, Description: input.Description, Priority: input.Priority, Permissions: perms}
+	if err := db.Create(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar perfil"})
+		return
+	}
+	loadRolePermissions()
+
+	logRequestAction(c, "CREATE", "Role", role.ID, fmt.Sprintf("Perfil %s criado: %s", role.Name, strings.Join(input.Permissions, ", ")))
+	c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRole altera descrição e permissões de um perfil (o nome é fixo; Admin não é editável)
+func UpdateRole(c *gin.Context) {
+	var role Role
+	if err := db.First(&role, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Perfil não encontrado"})
+		return
+	}
+	if role.Name == adminRoleName {
+		c.JSON(http.StatusForbidden, gin.H{"error": "O perfil Admin sempre possui todas as permissões"})
+		return
+	}
+	// O próprio perfil só é alterado pelo Admin; perfis com permissões que o usuário não possui, nunca
+	if role.Name == c.GetString("role") && c.GetString("role") != adminRoleName {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Não é possível alterar o próprio perfil"})
+		return
+	}
+	if !canManageRole(c, role.Name) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Sem permissão para alterar o perfil " + role.Name})
+		return
+	}
+
+	var input struct {
+		Description *string  `json:"description"`
+		Priority    *int     `json:"priority"`
+		Permissions []string `json:"permissions"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	perms, err := resolvePermissions(input.Permissions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Ninguém concede permissões que não possui
+	if key := ungrantablePermission(c, input.Permissions); key != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Sem permissão para conceder " + key})
+		return
+	}
+
+	if input.Description != nil || input.Priority != nil {
+		if input.Description != nil {
+			role.Description = *input.Description
+		}
+		if input.Priority != nil {
+			role.Priority = *input.Priority
+		}
+		db.Save(&role)
+	}
+	if input.Permissions != nil {
+		if err := db.Model(&role).Association("Permissions").Replace(perms); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar permissões"})
+			return
+		}
+	}
+	loadRolePermissions()
+
+	sort.Strings(input.Permissions)
+	logRequestAction(c, "UPDATE", "Role", role.ID, fmt.Sprintf("Perfil %s: %s", role.Name, strings.Join(input.Permissions, ", ")))
+	db.Preload("Permissions").First(&role, role.ID)
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole exclui um perfil personalizado sem usuários vinculados
+func DeleteRole(c *gin.Context) {
+	var role Role
+	if err := db.First(&role, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Perfil não encontrado"})
+		return
+	}
+	if role.System {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Perfis de sistema não podem ser excluídos"})
+		return
+	}
+	var count int64
+	db.Model(&User{}).Where("role = ?", role.Name).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Perfil em uso por %d usuário(s)", count)})
+		return
+	}
+
+	db.Model(&role).Association("Permissions").Clear()
+	db.Delete(&role)
+	loadRolePermissions()
+
+	logRequestAction(c, "DELETE", "Role", role.ID, fmt.Sprintf("Perfil %s excluído", role.Name))
+	c.JSON(http.StatusOK, gin.H{"message": "Perfil excluído"})
+}
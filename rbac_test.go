@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRoleManagementCannotEscalate(t *testing.T) {
+	setupTestDB(t)
+	var perms []Permission
+	db.Where("key IN ?", []string{"role.manage", "ticket.view_all"}).Find(&perms)
+	manager := Role{Name: "Gestor de perfis", Permissions: perms}
+	db.Create(&manager)
+	loadRolePermissions()
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("role", manager.Name) })
+	r.POST("/roles", CreateRole)
+	r.PUT("/roles/:id", UpdateRole)
+	send := func(method, path, body string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w.Code
+	}
+
+	if code := send(http.MethodPost, "/roles", `{"name":"Atalho","permissions":["settings.manage"]}`); code != http.StatusForbidden {
+		t.Errorf("perfil novo com permissão não possuída: status %d", code)
+	}
+	if code := send(http.MethodPost, "/roles", `{"name":"   ","permissions":[]}`); code != http.StatusBadRequest {
+		t.Errorf("perfil sem nome: status %d", code)
+	}
+	if code := send(http.MethodPost, "/roles", `{"name":"Consulta","permissions":["ticket.view_all"]}`); code != http.StatusCreated {
+		t.Errorf("perfil com permissões possuídas: status %d", code)
+	}
+
+	own := fmt.Sprintf("/roles/%d", manager.ID)
+	if code := send(http.MethodPut, own, `{"permissions":["role.manage","ticket.view_all","user.impersonate"]}`); code != http.StatusForbidden {
+		t.Errorf("alteração do próprio perfil: status %d", code)
+	}
+	var supervisor Role
+	db.First(&supervisor, "name = ?", "Supervisor")
+	if code := send(http.MethodPut, fmt.Sprintf("/roles/%d", supervisor.ID), `{"permissions":["ticket.view_all"]}`); code != http.StatusForbidden {
+		t.Errorf("alteração de perfil com permissões não possuídas: status %d", code)
+	}
+
+	if roleHasPermission(manager.Name, "user.impersonate") || roleExists("Atalho") || roleExists("") {
+		t.Error("escalonamento de privilégio aplicado")
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ==========================================
+// SESSÕES (Access Token curto + Refresh Token)
+// ==========================================
+
+const (
+	accessTokenTTL  = 15 * time.Minute   // JWT de acesso (curta duração)
+	refreshTokenTTL = 7 * 24 * time.Hour // Sessão renovável via refresh token
+)
+
+// UserSession representa um login ativo. O refresh token é guardado apenas como hash.
+type UserSession struct {
+	ID               uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	UserID           uint       `gorm:"index;not null" json:"user_id"`
+	User             *User      `json:"user,omitempty"`
+	RefreshTokenHash string     `gorm:"uniqueIndex;not null" json:"-"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	LastUsedAt       time.Time  `json:"last_used_at"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+	IPAddress        string     `json:"ip_address"`
+	UserAgent        string     `json:"user_agent"`
+
+	// Personificação: sessão aberta por um administrador "como" o usuário
+	ImpersonatorID      *uint  `gorm:"index" json:"impersonator_id"`
+	Impersonator        *User  `json:"impersonator,omitempty"`
+	ImpersonationReason string `json:"impersonation_reason,omitempty"`
+}
+
+// IsActive indica se a sessão ainda pode ser usada
+func (s *UserSession) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// generateRandomToken gera um token aleatório em hexadecimal
+func generateRandomToken(nBytes int) (string, error) {
+	buf := make([]byte, nBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// hashToken retorna o SHA-256 (hex) de um token opaco para armazenamento
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// createSession registra uma nova sessão e devolve o refresh token em texto puro (mostrado uma única vez)
+func createSession(c *gin.Context, user User) (UserSession, string, error) {
+	refreshToken, err := generateRandomToken(32)
+	if err != nil {
+		return UserSession{}, "", err
+	}
+
+	now := time.Now()
+	session := UserSession{
+		UserID:           user.ID,
+		RefreshTokenHash: hashToken(refreshToken),
+		ExpiresAt:        now.Add(refreshTokenTTL),
+		LastUsedAt:       now,
+		IPAddress:        c.ClientIP(),
+		UserAgent:        c.Request.UserAgent(),
+	}
+	if err := db.Create(&session).Error; err != nil {
+		return UserSession{}, "", err
+	}
+	return session, refreshToken, nil
+}
+
+// issueAccessToken gera o JWT de acesso vinculado à sessão (claim "sid")
+func issueAccessToken(user User, session UserSession) (string, error) {
+	claims := jwt.MapClaims{
+		"userID":   user.ID,
+		"sub":      user.ID, // Adding sub just to be standard compliant
+		"sid":      session.ID,
+		"username": user.Username,
+		"role":     user.Role,
+		"exp":      time.Now().Add(accessTokenTTL).Unix(),
+	}
+	// Token de personificação carrega as duas identidades
+	if session.ImpersonatorID != nil {
+		claims["imp"] = *session.ImpersonatorID
+		if session.Impersonator != nil {
+			claims["imp_username"] = session.Impersonator.Username
+		}
+	}
+	return signJWT(claims)
+}
+
+// loadActiveSession busca a sessão e valida se ainda está ativa
+func loadActiveSession(sessionID uint) (*UserSession, error) {
+	var session UserSession
+	if err := db.Preload("User").Preload("Impersonator").First(&session, sessionID).Error; err != nil {
+		return nil, err
+	}
+	if !session.IsActive() || session.User == nil || !session.User.Active {
+		return nil, fmt.Errorf("sessão expirada ou revogada")
+	}
+	if session.ImpersonatorID != nil && (session.Impersonator == nil || !session.Impersonator.Active) {
+		return nil, fmt.Errorf("administrador da personificação desativado")
+	}
+	return &session, nil
+}
+
+// revokeUserSessions revoga todas as sessões ativas de um usuário (exceto exceptID, se informado)
+func revokeUserSessions(userID uint, exceptID uint) int64 {
+	query := db.Model(&UserSession{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if exceptID > 0 {
+		query = query.Where("id <> ?", exceptID)
+	}
+	result := query.Update("revoked_at", time.Now())
+	return result.RowsAffected
+}
+
+// RefreshSession troca um refresh token válido por um novo par de tokens (rotação)
+func RefreshSession(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var session UserSession
+	if err := db.Preload("User").Preload("Impersonator").Where("refresh_token_hash = ?", hashToken(input.RefreshToken)).First(&session).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sessão inválida"})
+		return
+	}
+	if !session.IsActive() || session.User == nil || !session.User.Active {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sessão expirada ou revogada"})
+		return
+	}
+
+	// Rotacionar refresh token: o anterior deixa de valer imediatamente
+	newRefresh, err := generateRandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao renovar sessão"})
+		return
+	}
+	now := time.Now()
+	session.RefreshTokenHash = hashToken(newRefresh)
+	session.LastUsedAt = now
+	if session.ImpersonatorID == nil {
+		session.ExpiresAt = now.Add(refreshTokenTTL) // Personificação mantém o prazo fixo
+	}
+	session.IPAddress = c.ClientIP()
+	if err := db.Save(&session).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao renovar sessão"})
+		return
+	}
+
+	accessToken, err := issueAccessToken(*session.User, session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gerar token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         accessToken,
+		"refresh_token": newRefresh,
+		"expires_in":    int(accessTokenTTL.Seconds()),
+		"user":          session.User,
+		"impersonation": impersonationInfo(&session),
+	})
+}
+
+// Logout revoga a sessão atual
+func Logout(c *gin.Context) {
+	sessionID := c.GetUint("sessionID")
+	if sessionID > 0 {
+		db.Model(&UserSession{}).Where("id = ? AND revoked_at IS NULL", sessionID).Update("revoked_at", time.Now())
+	}
+	logRequestAction(c, "LOGOUT", "User", getCurrentUserID(c), "Sessão encerrada pelo usuário")
+	c.JSON(http.StatusOK, gin.H{"message": "Sessão encerrada"})
+}
+
+// GetUserSessions lista as sessões ativas de um usuário (Admin)
+func GetUserSessions(c *gin.Context) {
+	var sessions []UserSession
+	if err := db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", c.Param("id"), time.Now()).
+		Order("last_used_at desc").Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar sessões"})
+		return
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeUserSession encerra uma sessão específica de um usuário (Admin)
+func RevokeUserSession(c *gin.Context) {
+	var session UserSession
+	if err := db.Where("id = ? AND user_id = ?", c.Param("sid"), c.Param("id")).First(&session).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sessão não encontrada"})
+		return
+	}
+	if session.RevokedAt == nil {
+		now := time.Now()
+		session.RevokedAt = &now
+		db.Save(&session)
+	}
+
+	logRequestAction(c, "REVOKE_SESSION", "User", session.UserID, fmt.Sprintf("Sessão %d encerrada por administrador", session.ID))
+	c.JSON(http.StatusOK, gin.H{"message": "Sessão encerrada"})
+}
+
+// RevokeAllUserSessions encerra todas as sessões de um usuário (Admin)
+func RevokeAllUserSessions(c *gin.Context) {
+	var user User
+	if err := db.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+		return
+	}
+
+	count := revokeUserSessions(user.ID, 0)
+	logRequestAction(c, "REVOKE_SESSION", "User", user.ID, fmt.Sprintf("%d sessões encerradas por administrador", count))
+	c.JSON(http.StatusOK, gin.H{"message": "Sessões encerradas", "revoked": count})
+}
+
+// runSessionCleanup remove periodicamente sessões expiradas ou revogadas há mais de 30 dias
+func runSessionCleanup() {
+	ticker := time.NewTicker(6 * time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		limit := time.Now().Add(-30 * 24 * time.Hour)
+		db.Where("expires_at < ? OR (revoked_at IS NOT NULL AND revoked_at < ?)", limit, limit).Delete(&UserSession{})
+	}
+}
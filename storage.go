@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ==========================================
+// ARMAZENAMENTO DE ARQUIVOS (Disco local ou S3)
+// ==========================================
+//
+// Anexos são gravados por um fileStore. O disco local (ATTACHMENTS_DIR) é o
+// padrão; storage_backend=s3 usa qualquer serviço compatível com S3 (AWS, MinIO,
+// Ceph), assinando as requisições com AWS Signature V4. Cada anexo guarda o
+// backend em que foi gravado, então trocar a configuração não quebra arquivos antigos.
+
+// fileStore grava e lê objetos por chave (ex: "2024/05/ab12...")
+type fileStore interface {
+	Name() string
+	Put(key string, data []byte, contentType string) error
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+const (
+	storageBackendLocal = "local"
+	storageBackendS3    = "s3"
+)
+
+// activeFileStore devolve o backend configurado para novos anexos
+func activeFileStore() (fileStore, error) {
+	return fileStoreByName(getSettingValue("storage_backend", storageBackendLocal))
+}
+
+// fileStoreByName devolve o backend pelo nome gravado no anexo
+func fileStoreByName(name string) (fileStore, error) {
+	switch name {
+	case "", storageBackendLocal:
+		return localFileStore{dir: attachmentsDir()}, nil
+	case storageBackendS3:
+		store := loadS3FileStore()
+		if store.Endpoint == "" || store.Bucket == "" {
+			return nil, fmt.Errorf("armazenamento S3 não configurado (s3_endpoint/s3_bucket)")
+		}
+		return store, nil
+	}
+	return nil, fmt.Errorf("backend de armazenamento desconhecido: %s", name)
+}
+
+func attachmentsDir() string {
+	if dir := os.Getenv("ATTACHMENTS_DIR"); dir != "" {
+		return dir
+	}
+	return "attachments"
+}
+
+// --- Disco local ---
+
+type localFileStore struct {
+	dir string
+}
+
+func (s localFileStore) Name() string { return storageBackendLocal }
+
+func (s localFileStore) path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if clean == "." || filepath.IsAbs(clean) || strings.HasPrefix(clean, "..") {
+		return "", fmt.Errorf("chave de arquivo inválida: %s", key)
+	}
+	return filepath.Join(s.dir, clean), nil
+}
+
+func (s localFileStore) Put(key string, data []byte, _ string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// Grava em arquivo temporário e renomeia: nunca deixa anexo pela metade
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s localFileStore) Get(key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (s localFileStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// --- S3 compatível (Signature V4) ---
+
+type s3FileStore struct {
+	Endpoint  string // ex: https://s3.amazonaws.com ou http://minio.camara.local:9000
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool // bucket no caminho (MinIO) em vez do subdomínio
+}
+
+func loadS3FileStore() s3FileStore {
+	return s3FileStore{
+		Endpoint:  strings.TrimRight(getSettingValue("s3_endpoint", ""), "/"),
+		Region:    getSettingValue("s3_region", "us-east-1"),
+		Bucket:    getSettingValue("s3_bucket", ""),
+		AccessKey: getSettingValue("s3_access_key", ""),
+		SecretKey: getSettingValue("s3_secret_key", ""),
+		PathStyle: getSettingValue("s3_path_style", "true") == "true",
+	}
+}
+
+func (s s3FileStore) Name() string { return storageBackendS3 }
+
+// objectURL monta a URL do objeto no estilo configurado
+func (s s3FileStore) objectURL(key string) (*url.URL, error) {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("s3_endpoint inválido: %s", s.Endpoint)
+	}
+	// Path guarda a chave original e RawPath a forma codificada pelo SigV4 (evita codificar duas vezes)
+	if s.PathStyle {
+		u.Path = "/" + s.Bucket + "/" + key
+		u.RawPath = "/" + s.Bucket + "/" + s3EscapePath(key)
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path = "/" + key
+		u.RawPath = "/" + s3EscapePath(key)
+	}
+	return u, nil
+}
+
+func (s s3FileStore) do(method, key string, body []byte, contentType string) (*http.Response, error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	signS3Request(req, body, s.AccessKey, s.SecretKey, s.Region, time.Now().UTC())
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("falha ao acessar S3: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("S3 respondeu %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+func (s s3FileStore) Put(key string, data []byte, contentType string) error {
+	resp, err := s.do(http.MethodPut, key, data, contentType)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s s3FileStore) Get(key string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s s3FileStore) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// s3EscapePath codifica cada segmento da chave conforme a especificação do SigV4
+func s3EscapePath(key string) string {
+	parts := strings.Split(key, "/")
+	for i, p := range parts {
+		parts[i] = s3Escape(p)
+	}
+	return strings.Join(parts, "/")
+}
+
+func s3Escape(value string) string {
+	var b strings.Builder
+	for _, c := range []byte(value) {
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// signS3Request assina a requisição com AWS Signature Version 4 (serviço s3)
+func signS3Request(req *http.Request, body []byte, accessKey, secretKey, region string, now time.Time) {
+	payloadHash := sha256.Sum256(body)
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	// Cabeçalhos assinados: host, content-type (se houver) e todos os x-amz-*
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") || lower == "range" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	// Query string canônica (chaves e valores codificados, em ordem)
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, k := range keys {
+		vals := query[k]
+		sort.Strings(vals)
+		for _, v := range vals {
+			pairs = append(pairs, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		strings.Join(pairs, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := day + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==========================================
+// EVENTOS EM TEMPO REAL (Server-Sent Events)
+// ==========================================
+//
+// GET /events mantém a conexão aberta e envia as mudanças de chamados assim que
+// os handlers as publicam, no lugar do polling da lista de chamados, do Dashboard
+// e do Modo TV. Cada conexão filtra os eventos com as regras de canViewTicket, e
+// os indicadores (kpi_changed) são calculados uma vez só e repassados a todos os
+// painéis conectados.
+
+// Tipos de evento enviados ao navegador
+const (
+	streamTicketCreated   = "ticket_created"
+	streamTicketUpdated   = "ticket_updated"
+	streamTicketCommented = "ticket_commented"
+	streamTicketDeleted   = "ticket_deleted"
+	streamKPIChanged      = "kpi_changed"
+)
+
+const (
+	streamMaxPerUser   = 5                // Conexões simultâneas por usuário (abas, TVs)
+	streamBuffer       = 32               // Eventos pendentes por conexão antes de desconectá-la
+	streamHeartbeat    = 25 * time.Second // Mantém proxies sem cortar a conexão e revalida a sessão
+	streamKPIDebounce  = 2 * time.Second  // Agrupa rajadas de mudanças num único cálculo
+	streamKPIRefreshAt = 1 * time.Minute  // Recalcula mesmo sem mudanças (SLA vence com o tempo)
+)
+
+// streamEvent é um evento publicado; Ticket e Internal definem quem pode recebê-lo
+type streamEvent struct {
+	Type     string
+	Ticket   *Ticket
+	Internal bool
+	Payload  []byte // JSON já serializado
+}
+
+type streamHub struct {
+	mu      sync.Mutex
+	clients map[chan streamEvent]uint // canal -> usuário
+	perUser map[uint]int
+
+	kpiMu    sync.Mutex
+	kpiTimer *time.Timer
+	lastKPI  []byte
+}
+
+var eventStream = &streamHub{clients: map[chan streamEvent]uint{}, perUser: map[uint]int{}}
+
+func (h *streamHub) subscribe(userID uint) (chan streamEvent, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.perUser[userID] >= streamMaxPerUser {
+		return nil, false
+	}
+	ch := make(chan streamEvent, streamBuffer)
+	h.clients[ch] = userID
+	h.perUser[userID]++
+	return ch, true
+}
+
+// unsubscribe remove a conexão (sem efeito se o hub já a desconectou)
+func (h *streamHub) unsubscribe(ch chan streamEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(ch)
+}
+
+func (h *streamHub) remove(ch chan streamEvent) {
+	userID, ok := h.clients[ch]
+	if !ok {
+		return
+	}
+	delete(h.clients, ch)
+	if h.perUser[userID]--; h.perUser[userID] <= 0 {
+		delete(h.perUser, userID)
+	}
+	close(ch)
+}
+
+func (h *streamHub) empty() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients) == 0
+}
+
+// broadcast entrega o evento a todas as conexões. Uma conexão que não acompanha o
+// ritmo é desconectada: o navegador reconecta e recarrega os dados, em vez de
+// ficar com a tela desatualizada por ter perdido eventos.
+func (h *streamHub) broadcast(ev streamEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.clients {
+		select {
+		case ch <- ev:
+		default:
+			h.remove(ch)
+		}
+	}
+}
+
+// --- Publicação (chamada pelos handlers) ---
+
+// ticketChange é uma mudança de chamado publicada pelos handlers. O stream de eventos
+// e os webhooks se registram com registerTicketChangeHandler e recebem cada mudança.
+type ticketChange struct {
+	Kind    string // streamTicketCreated, streamTicketUpdated...
+	Ticket  Ticket // Com Asset, Creator, Category e AssignedTo (sem comentários)
+	Comment *Comment
+}
+
+type ticketChangeHandler func(ticketChange)
+
+var (
+	ticketChangeHandlersMu sync.RWMutex
+	ticketChangeHandlers   []ticketChangeHandler
+)
+
+// registerTicketChangeHandler inclui um destino para as mudanças de chamados
+func registerTicketChangeHandler(h ticketChangeHandler) {
+	ticketChangeHandlersMu.Lock()
+	defer ticketChangeHandlersMu.Unlock()
+	ticketChangeHandlers = append(ticketChangeHandlers, h)
+}
+
+// publishTicketChange publica o estado atual do chamado
+func publishTicketChange(kind string, ticketID uint) {
+	go func() {
+		var ticket Ticket
+		if err := db.Preload("Asset").Preload("Creator").Preload("Category").Preload("AssignedTo").First(&ticket, ticketID).Error; err != nil {
+			return
+		}
+		dispatchTicketChange(ticketChange{Kind: kind, Ticket: ticket})
+	}()
+}
+
+// publishTicketComment publica o chamado e o novo comentário
+func publishTicketComment(ticketID uint, comment Comment) {
+	go func() {
+		var ticket Ticket
+		if err := db.Preload("Asset").Preload("Creator").Preload("Category").Preload("AssignedTo").First(&ticket, ticketID).Error; err != nil {
+			return
+		}
+		dispatchTicketChange(ticketChange{Kind: streamTicketCommented, Ticket: ticket, Comment: &comment})
+	}()
+}
+
+// publishTicketDeleted publica a exclusão (com os dados de antes de excluir)
+func publishTicketDeleted(ticket Ticket) {
+	go dispatchTicketChange(ticketChange{Kind: streamTicketDeleted, Ticket: ticket})
+}
+
+func dispatchTicketChange(change ticketChange) {
+	ticketChangeHandlersMu.RLock()
+	handlers := append([]ticketChangeHandler(nil), ticketChangeHandlers...)
+	ticketChangeHandlersMu.RUnlock()
+	for _, h := range handlers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					fmt.Printf("[EVENTOS] Falha ao publicar mudança do chamado #%d: %v\n", change.Ticket.ID, r)
+				}
+			}()
+			h(change)
+		}()
+	}
+}
+
+// broadcastTicketChange envia a mudança às telas conectadas (destino registrado em main)
+func broadcastTicketChange(change ticketChange) {
+	if eventStream.empty() {
+		return
+	}
+	var data gin.H
+	if change.Kind == streamTicketDeleted {
+		data = gin.H{"ticket_id": change.Ticket.ID}
+	} else {
+		// O mesmo evento vai para todos: sem os valores do ativo (cópia, o chamado é compartilhado)
+		ticket := change.Ticket
+		if ticket.Asset != nil {
+			asset := *ticket.Asset
+			clearAssetFinancials(&asset)
+			ticket.Asset = &asset
+		}
+		data = gin.H{"ticket": ticket}
+		if change.Comment != nil {
+			data["comment"] = change.Comment
+		}
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	ticket := change.Ticket
+	eventStream.broadcast(streamEvent{Type: change.Kind, Ticket: &ticket, Internal: change.Comment != nil && change.Comment.Internal, Payload: payload})
+	eventStream.kpiChanged()
+}
+
+// kpiChanged agenda o recálculo dos indicadores, agrupando mudanças próximas
+func (h *streamHub) kpiChanged() {
+	h.kpiMu.Lock()
+	defer h.kpiMu.Unlock()
+	if h.kpiTimer == nil {
+		h.kpiTimer = time.AfterFunc(streamKPIDebounce, h.publishKPIs)
+	}
+}
+
+// publishKPIs calcula os indicadores e os envia aos painéis, se mudaram desde o último envio
+func (h *streamHub) publishKPIs() {
+	h.kpiMu.Lock()
+	h.kpiTimer = nil
+	h.kpiMu.Unlock()
+	if h.empty() {
+		return
+	}
+
+	payload, err := json.Marshal(dashboardKPIs())
+	if err != nil {
+		return
+	}
+	h.kpiMu.Lock()
+	changed := !bytes.Equal(payload, h.lastKPI)
+	h.lastKPI = payload
+	h.kpiMu.Unlock()
+	if changed {
+		h.broadcast(streamEvent{Type: streamKPIChanged, Payload: payload})
+	}
+}
+
+// runEventStreamKPIRefresh recalcula periodicamente os indicadores enquanto há telas conectadas
+func runEventStreamKPIRefresh() {
+	ticker := time.NewTicker(streamKPIRefreshAt)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !eventStream.empty() {
+			eventStream.kpiChanged()
+		}
+	}
+}
+
+// --- Handler ---
+
+// streamEventVisible aplica as regras de visibilidade do usuário da conexão
+func streamEventVisible(c *gin.Context, ev streamEvent) bool {
+	if ev.Type == streamKPIChanged {
+		return hasPermission(c, "dashboard.view")
+	}
+	if ev.Ticket == nil || !canViewTicket(c, *ev.Ticket) {
+		return false
+	}
+	return !ev.Internal || canSeeInternalNotes(c)
+}
+
+// streamStillAuthorized revalida a credencial da conexão (logout, revogação ou mudança de perfil)
+func streamStillAuthorized(c *gin.Context) bool {
+	if sid := c.GetUint("sessionID"); sid > 0 {
+		session, err := loadActiveSession(sid)
+		if err != nil {
+			return false
+		}
+		c.Set("role", session.User.Role)
+		return true
+	}
+	if tid := c.GetUint("apiTokenID"); tid > 0 {
+		var token APIToken
+		var user User
+		if db.First(&token, tid).Error != nil || !token.IsActive() || db.First(&user, token.UserID).Error != nil || !user.Active {
+			return false
+		}
+		c.Set("role", user.Role)
+		return true
+	}
+	return false
+}
+
+// StreamEvents mantém a conexão SSE do usuário aberta, enviando os eventos que ele pode ver
+func StreamEvents(c *gin.Context) {
+	uid := getCurrentUserID(c)
+	events, ok := eventStream.subscribe(uid)
+	if !ok {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("Limite de %d conexões de eventos por usuário", streamMaxPerUser)})
+		return
+	}
+	defer eventStream.unsubscribe(events)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // nginx: não segurar os eventos no buffer
+	c.Status(http.StatusOK)
+	fmt.Fprint(c.Writer, "retry: 5000\n\nevent: ready\ndata: {}\n\n")
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if !streamStillAuthorized(c) {
+				fmt.Fprint(c.Writer, "event: unauthorized\ndata: {}\n\n")
+				c.Writer.Flush()
+				return
+			}
+			fmt.Fprint(c.Writer, ": ping\n\n")
+			c.Writer.Flush()
+		case ev, open := <-events:
+			if !open {
+				return // Conexão lenta desconectada pelo hub
+			}
+			if !streamEventVisible(c, ev) {
+				continue
+			}
+			fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", ev.Type, ev.Payload)
+			c.Writer.Flush()
+		}
+	}
+}
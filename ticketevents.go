@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==========================================
+// HISTÓRICO DO CHAMADO (Linha do Tempo)
+// ==========================================
+//
+// Cada mudança relevante do chamado (abertura, status, responsável, prioridade,
+// categoria e escalonamento por SLA) gera um TicketEvent com valor anterior,
+// novo valor e autor. GET /tickets/:id/timeline intercala esses eventos com os
+// comentários em ordem cronológica.
+
+// Tipos de evento
+const (
+	ticketEventCreated       = "created"
+	ticketEventStatus        = "status"
+	ticketEventAssignment    = "assignment"
+	ticketEventPriority      = "priority"
+	ticketEventCategory      = "category"
+	ticketEventSLAWarning    = "sla_warning"
+	ticketEventSLAEscalation = "sla_escalation"
+)
+
+// systemActorName identifica ações automáticas (SLA, redistribuições) na linha do tempo
+const systemActorName = "Sistema"
+
+// TicketEvent é uma mudança registrada no chamado
+type TicketEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	TicketID  uint      `gorm:"index;not null" json:"ticket_id"`
+	Type      string    `gorm:"index" json:"type"`
+	OldValue  string    `json:"old_value"`
+	NewValue  string    `json:"new_value"`
+	ActorID   *uint     `json:"actor_id"` // Nulo = ação automática do sistema
+	ActorName string    `json:"actor_name"`
+	Details   string    `json:"details"`
+}
+
+// recordTicketEvent grava um evento; c == nil indica ação do sistema
+func recordTicketEvent(tx *gorm.DB, c *gin.Context, ticketID uint, kind, oldValue, newValue, details string) {
+	event := TicketEvent{
+		TicketID:  ticketID,
+		Type:      kind,
+		OldValue:  oldValue,
+		NewValue:  newValue,
+		ActorName: systemActorName,
+		Details:   details,
+	}
+	if c != nil {
+		if uid := getCurrentUserID(c); uid > 0 {
+			event.ActorID = &uid
+			event.ActorName = currentUserDisplayName(c)
+		}
+		// Ação feita em personificação: o autor real também fica registrado
+		if impID := c.GetUint("impersonatorID"); impID > 0 {
+			var admin User
+			if db.Select("id, username").First(&admin, impID).Error == nil {
+				event.Details = joinDetails(event.Details, "Executado por "+admin.Username+" (personificação)")
+			}
+		}
+	}
+	saveTicketEvent(tx, event)
+}
+
+// recordUserTicketEvent grava um evento feito por um usuário fora de uma requisição (ex: e-mail recebido)
+func recordUserTicketEvent(tx *gorm.DB, user User, ticketID uint, kind, oldValue, newValue, details string) {
+	saveTicketEvent(tx, TicketEvent{
+		TicketID:  ticketID,
+		Type:      kind,
+		OldValue:  oldValue,
+		NewValue:  newValue,
+		ActorID:   &user.ID,
+		ActorName: displayName(user),
+		Details:   details,
+	})
+}
+
+func saveTicketEvent(tx *gorm.DB, event TicketEvent) {
+	if err := tx.Create(&event).Error; err != nil {
+		fmt.Printf("[TIMELINE] Erro ao registrar evento do chamado %d: %v\n", event.TicketID, err)
+	}
+}
+
+func joinDetails(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + " | " + b
+}
+
+// assigneeName descreve o responsável para a linha do tempo
+func assigneeName(tx *gorm.DB, id *uint) string {
+	if id == nil || *id == 0 {
+		return "Ninguém"
+	}
+	var user User
+	if err := tx.Select("id, username, full_name").First(&user, *id).Error; err != nil {
+		return fmt.Sprintf("Usuário %d", *id)
+	}
+	return displayName(user)
+}
+
+// categoryName descreve a categoria para a linha do tempo
+func categoryName(tx *gorm.DB, id *uint) string {
+	if id == nil || *id == 0 {
+		return "Sem Categoria"
+	}
+	var cat ServiceCategory
+	if err := tx.Select("id, name").First(&cat, *id).Error; err != nil {
+		return fmt.Sprintf("Categoria %d", *id)
+	}
+	return cat.Name
+}
+
+func sameID(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// recordAssignmentChange registra a troca de responsável, se houve; o novo responsável passa a acompanhar o chamado
+func recordAssignmentChange(tx *gorm.DB, c *gin.Context, ticketID uint, from, to *uint, details string) {
+	if sameID(from, to) {
+		return
+	}
+	if to != nil {
+		addTicketWatcher(tx, ticketID, *to, watchReasonAssignee, nil)
+	}
+	recordTicketEvent(tx, c, ticketID, ticketEventAssignment, assigneeName(tx, from), assigneeName(tx, to), details)
+}
+
+// TimelineEntry é um item da linha do tempo: evento ou comentário
+type TimelineEntry struct {
+	Kind      string       `json:"kind"` // event ou comment
+	CreatedAt time.Time    `json:"created_at"`
+	Event     *TicketEvent `json:"event,omitempty"`
+	Comment   *Comment     `json:"comment,omitempty"`
+}
+
+// GetTicketTimeline devolve eventos e comentários do chamado em ordem cronológica
+func GetTicketTimeline(c *gin.Context) {
+	var ticket Ticket
+	if err := db.First(&ticket, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		return
+	}
+	if !canViewTicket(c, ticket) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Você não tem permissão para ver este chamado"})
+		return
+	}
+
+	var events []TicketEvent
+	db.Where("ticket_id = ?", ticket.ID).Order("created_at, id").Find(&events)
+	var comments []Comment
+	commentQuery := db.Preload("Attachments").Where("ticket_id = ?", ticket.ID)
+	if !canSeeInternalNotes(c) {
+		commentQuery = commentQuery.Where("internal = ?", false)
+	}
+	commentQuery.Order("created_at, id").Find(&comments)
+
+	timeline := make([]TimelineEntry, 0, len(events)+len(comments))
+	for i := range events {
+		timeline = append(timeline, TimelineEntry{Kind: "event", CreatedAt: events[i].CreatedAt, Event: &events[i]})
+	}
+	for i := range comments {
+		timeline = append(timeline, TimelineEntry{Kind: "comment", CreatedAt: comments[i].CreatedAt, Comment: &comments[i]})
+	}
+	// Estável: no mesmo instante, o evento (ex: mudança de status) vem antes do comentário que o acompanha
+	sort.SliceStable(timeline, func(i, j int) bool {
+		return timeline[i].CreatedAt.Before(timeline[j].CreatedAt)
+	})
+
+	c.JSON(http.StatusOK, timeline)
+}
+
+// UpdateTicket altera a classificação do chamado (prioridade e categoria)
+func UpdateTicket(c *gin.Context) {
+	var input struct {
+		Priority   *string `json:"priority"`
+		CategoryID *uint   `json:"category_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var ticket Ticket
+	if err := db.First(&ticket, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		return
+	}
+	if !canViewTicket(c, ticket) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Você não tem permissão para alterar este chamado"})
+		return
+	}
+
+	var changes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if input.Priority != nil && *input.Priority != ticket.Priority {
+			switch *input.Priority {
+			case "Baixa", "Media", "Alta":
+			default:
+				return fmt.Errorf("Prioridade inválida: %s", *input.Priority)
+			}
+			recordTicketEvent(tx, c, ticket.ID, ticketEventPriority, ticket.Priority, *input.Priority, "")
+			changes = append(changes, fmt.Sprintf("prioridade %s -> %s", ticket.Priority, *input.Priority))
+			ticket.Priority = *input.Priority
+			ticket.DueDate = priorityDueDate(ticket.CreatedAt, ticket.Priority)
+		}
+		if input.CategoryID != nil {
+			newCat := input.CategoryID
+			if *newCat == 0 {
+				newCat = nil
+			} else if err := tx.Select("id").First(&ServiceCategory{}, *newCat).Error; err != nil {
+				return fmt.Errorf("Categoria inválida")
+			}
+			if !sameID(ticket.CategoryID, newCat) {
+				oldName, newName := categoryName(tx, ticket.CategoryID), categoryName(tx, newCat)
+				recordTicketEvent(tx, c, ticket.ID, ticketEventCategory, oldName, newName, "")
+				changes = append(changes, fmt.Sprintf("categoria %s -> %s", oldName, newName))
+				ticket.CategoryID = newCat
+			}
+		}
+		return tx.Select("priority", "due_date", "category_id").Save(&ticket).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(changes) > 0 {
+		logRequestAction(c, "UPDATE", "Ticket", ticket.ID, "Classificação alterada: "+strings.Join(changes, "; "))
+		publishTicketChange(streamTicketUpdated, ticket.ID)
+	}
+	db.Preload("Asset").Preload("Creator").Preload("Category").Preload("AssignedTo").First(&ticket, ticket.ID)
+	hideAssetFinancials(c, ticket.Asset)
+	c.JSON(http.StatusOK, ticket)
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ==========================================
+// AUTENTICAÇÃO EM DOIS FATORES (TOTP - RFC 6238)
+// ==========================================
+
+const (
+	totpIssuer        = "CâmaraGestão"
+	totpPeriod        = 30 // segundos
+	totpDigits        = 6
+	totpSkew          = 1 // aceita 1 janela antes/depois (relógio do celular)
+	mfaChallengeTTL   = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+// RecoveryCode é um código de recuperação de uso único (guardado como hash)
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	CodeHash  string     `gorm:"not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateTOTPSecret gera um segredo de 160 bits em Base32
+func generateTOTPSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+// totpCode calcula o código para um contador (HOTP/RFC 4226 com SHA-1)
+func totpCode(secret string, counter int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// verifyTOTP valida o código e devolve o contador usado (para impedir reuso do mesmo código)
+func verifyTOTP(secret, code string, lastCounter int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := time.Now().Unix() / totpPeriod
+	for delta := int64(-totpSkew); delta <= totpSkew; delta++ {
+		counter := current + delta
+		if counter <= lastCounter {
+			continue
+		}
+		expected, err := totpCode(secret, counter)
+		if err == nil && hmac.Equal([]byte(expected), []byte(code)) {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// totpProvisioningURI monta a URI otpauth:// usada para gerar o QR Code no app autenticador
+func totpProvisioningURI(username, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(totpIssuer + ":" + username)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// twoFactorRequired indica se o perfil do usuário exige 2FA (configuração totp_required_roles)
+func twoFactorRequired(user User) bool {
+	for _, role := range strings.Split(getSettingValue("totp_required_roles", ""), ",") {
+		if strings.EqualFold(strings.TrimSpace(role), user.Role) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeRecoveryCode remove separadores e padroniza maiúsculas
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// generateRecoveryCodes substitui os códigos de recuperação do usuário e devolve os novos em texto puro
+func generateRecoveryCodes(userID uint) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		raw := totpEncoding.EncodeToString(buf) // 8 caracteres
+		codes = append(codes, raw[:4]+"-"+raw[4:])
+		records = append(records, RecoveryCode{UserID: userID, CodeHash: hashToken(raw)})
+	}
+
+	db.Where("user_id = ?", userID).Delete(&RecoveryCode{})
+	if err := db.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// useRecoveryCode consome um código de recuperação válido
+func useRecoveryCode(userID uint, code string) bool {
+	now := time.Now()
+	result := db.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashToken(normalizeRecoveryCode(code))).
+		Update("used_at", now)
+	return result.Error == nil && result.RowsAffected > 0
+}
+
+// verifySecondFactor aceita um código TOTP ou um código de recuperação
+func verifySecondFactor(user *User, code string) bool {
+	if counter, ok := verifyTOTP(user.TOTPSecret, code, user.TOTPLastCounter); ok {
+		user.TOTPLastCounter = counter
+		db.Model(user).Update("totp_last_counter", counter)
+		return true
+	}
+	if useRecoveryCode(user.ID, code) {
+		logAction(user.ID, "2FA_RECOVERY", "User", user.ID, "Login com código de recuperação")
+		return true
+	}
+	return false
+}
+
+// issueSecondFactorChallenge gera o token curto que autoriza apenas a etapa do código 2FA
+func issueSecondFactorChallenge(user User) (string, error) {
+	return signJWT(jwt.MapClaims{
+		"purpose": "2fa",
+		"uid":     user.ID,
+		"exp":     time.Now().Add(mfaChallengeTTL).Unix(),
+	})
+}
+
+// completeLogin finaliza o login após a senha: se o usuário tiver 2FA, emite apenas um desafio
+func completeLogin(c *gin.Context, user User) {
+	if !user.TOTPEnabled {
+		registerLoginSuccess(user.Username)
+		generateTokenAndRespond(c, user)
+		return
+	}
+
+	mfaToken, err := issueSecondFactorChallenge(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gerar desafio 2FA"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"two_factor_required": true,
+		"mfa_token":           mfaToken,
+	})
+}
+
+// LoginSecondFactor é a segunda etapa do login: valida o código e devolve o JWT
+func LoginSecondFactor(c *gin.Context) {
+	var input struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := parseJWT(input.MFAToken)
+	if err != nil || !token.Valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Desafio 2FA expirado. Faça login novamente."})
+		return
+	}
+	claims, _ := token.Claims.(jwt.MapClaims)
+	uid, _ := claims["uid"].(float64)
+	if claims["purpose"] != "2fa" || uid == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Desafio 2FA inválido"})
+		return
+	}
+
+	var user User
+	if err := db.First(&user, uint(uid)).Error; err != nil || !user.TOTPEnabled || !user.Active {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Desafio 2FA inválido"})
+		return
+	}
+
+	// Códigos errados também contam para o bloqueio por força bruta
+	if rejectThrottledLogin(c, user.Username) {
+		return
+	}
+	if !verifySecondFactor(&user, input.Code) {
+		registerLoginFailure(user.Username, c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Código inválido"})
+		return
+	}
+
+	registerLoginSuccess(user.Username)
+	generateTokenAndRespond(c, user)
+}
+
+// GetTwoFactorStatus informa a situação do 2FA do usuário logado
+func GetTwoFactorStatus(c *gin.Context) {
+	var user User
+	if err := db.First(&user, getCurrentUserID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+		return
+	}
+
+	var remaining int64
+	db.Model(&RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&remaining)
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  user.TOTPEnabled,
+		"required":                 twoFactorRequired(user),
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// SetupTwoFactor gera um novo segredo (ainda não ativo) e a URI para o QR Code
+func SetupTwoFactor(c *gin.Context) {
+	var user User
+	if err := db.First(&user, getCurrentUserID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "2FA já está ativo. Desative antes de cadastrar um novo dispositivo."})
+		return
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gerar segredo"})
+		return
+	}
+	user.TOTPSecret = secret
+	user.TOTPLastCounter = 0
+	db.Save(&user)
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_url": totpProvisioningURI(user.Username, secret),
+	})
+}
+
+// EnableTwoFactor confirma o cadastro com o primeiro código e gera os códigos de recuperação
+func EnableTwoFactor(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user User
+	if err := db.First(&user, getCurrentUserID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "2FA já está ativo"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Inicie o cadastro do 2FA antes de confirmar"})
+		return
+	}
+
+	counter, ok := verifyTOTP(user.TOTPSecret, input.Code, 0)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Código inválido"})
+		return
+	}
+
+	codes, err := generateRecoveryCodes(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gerar códigos de recuperação"})
+		return
+	}
+
+	user.TOTPEnabled = true
+	user.TOTPLastCounter = counter
+	db.Save(&user)
+
+	logAction(user.ID, "2FA_ENABLE", "User", user.ID, "Autenticação em dois fatores ativada")
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "2FA ativado. Guarde os códigos de recuperação em local seguro.",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor desativa o 2FA do próprio usuário (exige um código válido)
+func DisableTwoFactor(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user User
+	if err := db.First(&user, getCurrentUserID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "2FA não está ativo"})
+		return
+	}
+	if twoFactorRequired(user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "2FA é obrigatório para o seu perfil"})
+		return
+	}
+	if !verifySecondFactor(&user, input.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Código inválido"})
+		return
+	}
+
+	disableTwoFactor(&user)
+	logAction(user.ID, "2FA_DISABLE", "User", user.ID, "Autenticação em dois fatores desativada pelo usuário")
+	c.JSON(http.StatusOK, gin.H{"message": "2FA desativado"})
+}
+
+// RegenerateRecoveryCodes invalida os códigos antigos e gera novos (exige código TOTP)
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user User
+	if err := db.First(&user, getCurrentUserID(c)).Error; err != nil || !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "2FA não está ativo"})
+		return
+	}
+	counter, ok := verifyTOTP(user.TOTPSecret, input.Code, user.TOTPLastCounter)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Código inválido"})
+		return
+	}
+	db.Model(&user).Update("totp_last_counter", counter)
+
+	codes, err := generateRecoveryCodes(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gerar códigos de recuperação"})
+		return
+	}
+	logAction(user.ID, "2FA_RECOVERY_CODES", "User", user.ID, "Códigos de recuperação regenerados")
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// ResetUserTwoFactor remove o 2FA de outro usuário (Admin) - ex: celular perdido
+func ResetUserTwoFactor(c *gin.Context) {
+	var user User
+	if err := db.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+		return
+	}
+	if !canManageRole(c, user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Sem permissão para redefinir o 2FA de usuários com o perfil " + user.Role})
+		return
+	}
+
+	disableTwoFactor(&user)
+	revokeUserSessions(user.ID, 0)
+
+	logRequestAction(c, "2FA_RESET", "User", user.ID, fmt.Sprintf("2FA de %s redefinido por administrador", user.Username))
+	c.JSON(http.StatusOK, gin.H{"message": "2FA redefinido. O usuário deverá cadastrar novamente no próximo login, se obrigatório."})
+}
+
+func disableTwoFactor(user *User) {
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	user.TOTPLastCounter = 0
+	db.Save(user)
+	db.Where("user_id = ?", user.ID).Delete(&RecoveryCode{})
+}
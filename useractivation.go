@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==========================================
+// DESATIVAÇÃO DE USUÁRIOS (em vez de exclusão)
+// ==========================================
+//
+// Chamados, comentários e auditoria referenciam o usuário, então a conta nunca
+// é apagada: fica inativa (sem login, fora das listas de seleção e da atribuição
+// automática) e pode ser reativada. Os chamados abertos dela são redistribuídos
+// pelo fluxo guiado de /users/:id/open-work e /users/:id/reassign.
+
+const adminDeactivationReason = "Desativado pelo administrador"
+
+// deactivateUserAccount marca a conta como desativada e encerra suas sessões (não salva o usuário)
+func deactivateUserAccount(user *User, reason string) {
+	now := time.Now()
+	user.Active = false
+	user.DeactivatedAt = &now
+	user.DeactivationReason = reason
+	revokeUserSessions(user.ID, 0)
+}
+
+// userIsActive indica se o usuário existe e está ativo
+func userIsActive(tx *gorm.DB, id uint) bool {
+	var count int64
+	tx.Model(&User{}).Where("id = ? AND active = ?", id, true).Count(&count)
+	return count > 0
+}
+
+// categoryDefaultAssignee devolve o responsável padrão da categoria, se estiver ativo
+func categoryDefaultAssignee(tx *gorm.DB, cat ServiceCategory) *uint {
+	if cat.DefaultUserID == 0 || !userIsActive(tx, cat.DefaultUserID) {
+		return nil
+	}
+	id := cat.DefaultUserID
+	return &id
+}
+
+// categoryUsersActive confere se os responsáveis configurados na categoria estão ativos
+func categoryUsersActive(cat ServiceCategory) bool {
+	if cat.DefaultUserID > 0 && !userIsActive(db, cat.DefaultUserID) {
+		return false
+	}
+	return cat.EscalationUserID == nil || *cat.EscalationUserID == 0 || userIsActive(db, *cat.EscalationUserID)
+}
+
+// userOpenWork reúne o que ainda depende do usuário: chamados abertos e categorias
+func userOpenWork(userID uint) ([]Ticket, []ServiceCategory) {
+	var tickets []Ticket
+	db.Preload("Creator").Preload("Category").
+		Where("assigned_to_id = ? AND status NOT IN ?", userID, closedTicketStatuses()).
+		Order("created_at").Find(&tickets)
+
+	var categories []ServiceCategory
+	db.Where("default_user_id = ? OR escalation_user_id = ?", userID, userID).Find(&categories)
+	return tickets, categories
+}
+
+// GetUserOpenWork lista o que precisa ser redistribuído antes/depois de desativar o usuário
+func GetUserOpenWork(c *gin.Context) {
+	var user User
+	if err := db.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+		return
+	}
+
+	tickets, categories := userOpenWork(user.ID)
+
+	// Sugestões de destino: responsáveis ativos, exceto o próprio usuário
+	var candidates []User
+	db.Where("role IN ? AND active = ? AND id <> ?", rolesWithPermission("ticket.assignee"), true, user.ID).
+		Order("full_name").Find(&candidates)
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":       user,
+		"tickets":    tickets,
+		"categories": categories,
+		"candidates": candidates,
+	})
+}
+
+// DeactivateUser desativa a conta; opcionalmente já redistribui o trabalho aberto
+func DeactivateUser(c *gin.Context) {
+	var input struct {
+		Reason       string `json:"reason"`
+		ReassignToID *uint  `json:"reassign_to_id"` // Opcional: novo responsável por tudo
+	}
+	// Corpo opcional
+	c.ShouldBindJSON(&input)
+	deactivateUserByID(c, c.Param("id"), input.Reason, input.ReassignToID)
+}
+
+// DeleteUser mantido por compatibilidade: desativa em vez de apagar
+func DeleteUser(c *gin.Context) {
+	deactivateUserByID(c, c.Param("id"), "", nil)
+}
+
+func deactivateUserByID(c *gin.Context, id string, reason string, reassignToID *uint) {
+	var user User
+	if err := db.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+		return
+	}
+	if user.Username == "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Não é permitido desativar o usuário admin principal"})
+		return
+	}
+	if user.ID == getCurrentUserID(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Você não pode desativar a própria conta"})
+		return
+	}
+	if !canManageRole(c, user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Sem permissão para desativar usuários com o perfil " + user.Role})
+		return
+	}
+	if !user.Active {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Usuário já está desativado"})
+		return
+	}
+
+	var target *User
+	if reassignToID != nil {
+		var err error
+		if target, err = reassignmentTarget(*reassignToID, user.ID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if reason == "" {
+		reason = adminDeactivationReason
+	}
+	deactivateUserAccount(&user, reason)
+	if err := db.Save(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao desativar usuário"})
+		return
+	}
+	logRequestAction(c, "DEACTIVATE_USER", "User", user.ID, fmt.Sprintf("Usuário %s desativado: %s", user.Username, reason))
+
+	moved := 0
+	if target != nil {
+		moved = reassignOpenWork(c, user, target, nil, true)
+	}
+
+	tickets, categories := userOpenWork(user.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"message":            "Usuário desativado",
+		"user":               user,
+		"reassigned_tickets": moved,
+		// Pendências para o fluxo guiado de redistribuição
+		"open_tickets": len(tickets),
+		"categories":   categories,
+	})
+}
+
+// ReactivateUser reativa uma conta desativada
+func ReactivateUser(c *gin.Context) {
+	var user User
+	if err := db.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+		return
+	}
+	if user.Active {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Usuário já está ativo"})
+		return
+	}
+	if !canManageRole(c, user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Sem permissão para reativar usuários com o perfil " + user.Role})
+		return
+	}
+
+	user.Active = true
+	user.DeactivatedAt = nil
+	user.DeactivationReason = ""
+	if err := db.Save(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao reativar usuário"})
+		return
+	}
+
+	logRequestAction(c, "REACTIVATE_USER", "User", user.ID, fmt.Sprintf("Usuário %s reativado", user.Username))
+	c.JSON(http.StatusOK, gin.H{"message": "Usuário reativado", "user": user})
+}
+
+// ReassignUserTickets redistribui chamados abertos (e categorias) de um usuário
+func ReassignUserTickets(c *gin.Context) {
+	var input struct {
+		ToUserID   *uint  `json:"to_user_id"` // Vazio = devolver à fila (sem responsável)
+		TicketIDs  []uint `json:"ticket_ids"` // Vazio = todos os chamados abertos
+		Categories bool   `json:"categories"` // Também substituir nas categorias (padrão/escalonamento)
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user User
+	if err := db.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+		return
+	}
+
+	var target *User
+	if input.ToUserID != nil {
+		var err error
+		if target, err = reassignmentTarget(*input.ToUserID, user.ID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	} else if input.Categories {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Informe o novo responsável para as categorias"})
+		return
+	}
+
+	moved := reassignOpenWork(c, user, target, input.TicketIDs, input.Categories)
+	tickets, categories := userOpenWork(user.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"reassigned_tickets": moved,
+		"open_tickets":       len(tickets),
+		"categories":         categories,
+	})
+}
+
+// reassignmentTarget valida o novo responsável: ativo e apto a receber chamados
+func reassignmentTarget(id, fromID uint) (*User, error) {
+	var target User
+	if err := db.First(&target, id).Error; err != nil || !target.Active || !roleHasPermission(target.Role, "ticket.assignee") {
+		return nil, fmt.Errorf("Novo responsável inválido ou desativado")
+	}
+	if target.ID == fromID {
+		return nil, fmt.Errorf("O novo responsável deve ser outro usuário")
+	}
+	return &target, nil
+}
+
+// reassignOpenWork move os chamados abertos de user para target (nil = fila) e, se pedido, as categorias
+func reassignOpenWork(c *gin.Context, user User, target *User, ticketIDs []uint, categories bool) int {
+	query := db.Where("assigned_to_id = ? AND status NOT IN ?", user.ID, closedTicketStatuses())
+	if len(ticketIDs) > 0 {
+		query = query.Where("id IN ?", ticketIDs)
+	}
+	var tickets []Ticket
+	query.Find(&tickets)
+
+	toName := "fila (sem responsável)"
+	var toID *uint
+	if target != nil {
+		toName = displayName(*target)
+		toID = &target.ID
+	}
+
+	for _, t := range tickets {
+		previous := t.AssignedToID
+		t.AssignedToID = toID
+		db.Save(&t)
+		recordAssignmentChange(db, c, t.ID, previous, toID, "Redistribuição de chamados de "+user.Username)
+		createSystemComment(db, t.ID, fmt.Sprintf("Chamado reatribuído de %s para %s (redistribuição de chamados do usuário).", displayName(user), toName))
+		notifyAssignment(c, t.ID, previous, toID)
+		publishTicketChange(streamTicketUpdated, t.ID)
+	}
+
+	details := fmt.Sprintf("%d chamado(s) de %s movidos para %s", len(tickets), user.Username, toName)
+	if categories && target != nil {
+		r1 := db.Model(&ServiceCategory{}).Where("default_user_id = ?", user.ID).Update("default_user_id", target.ID)
+		r2 := db.Model(&ServiceCategory{}).Where("escalation_user_id = ?", user.ID).Update("escalation_user_id", target.ID)
+		details += fmt.Sprintf("; %d categoria(s) atualizadas", r1.RowsAffected+r2.RowsAffected)
+	}
+	logRequestAction(c, "REASSIGN_USER_TICKETS", "User", user.ID, details)
+	return len(tickets)
+}
+
+// displayName devolve o nome completo ou, na falta dele, o login
+func displayName(u User) string {
+	if u.FullName != "" {
+		return u.FullName
+	}
+	return u.Username
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ==========================================
+// OBSERVADORES E MENÇÕES
+// ==========================================
+//
+// Observadores acompanham o chamado sem serem responsáveis por ele (ex: um
+// segundo técnico ou o chefe do setor) e passam a poder visualizá-lo. Solicitante
+// e responsáveis entram automaticamente; menções @usuario em comentários incluem
+// o mencionado e o avisam.
+
+// Motivos de acompanhamento
+const (
+	watchReasonCreator  = "creator"
+	watchReasonAssignee = "assignee"
+	watchReasonManual   = "manual"
+	watchReasonMention  = "mention"
+)
+
+// TicketWatcher é um usuário que acompanha o chamado
+type TicketWatcher struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	TicketID  uint      `gorm:"uniqueIndex:idx_ticket_watcher;not null" json:"ticket_id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_ticket_watcher;index;not null" json:"user_id"`
+	User      *User     `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"user,omitempty"`
+	Reason    string    `json:"reason"`
+	AddedByID *uint     `json:"added_by_id"`
+}
+
+// addTicketWatcher inclui o usuário como observador (sem efeito se já for)
+func addTicketWatcher(tx *gorm.DB, ticketID, userID uint, reason string, addedBy *uint) bool {
+	if userID == 0 {
+		return false
+	}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&TicketWatcher{
+		TicketID:  ticketID,
+		UserID:    userID,
+		Reason:    reason,
+		AddedByID: addedBy,
+	})
+	return result.Error == nil && result.RowsAffected > 0
+}
+
+// isTicketWatcher indica se o usuário acompanha o chamado
+func isTicketWatcher(ticketID, userID uint) bool {
+	var count int64
+	db.Model(&TicketWatcher{}).Where("ticket_id = ? AND user_id = ?", ticketID, userID).Count(&count)
+	return count > 0
+}
+
+// watchedTicketIDs é a subconsulta dos chamados acompanhados pelo usuário
+func watchedTicketIDs(userID uint) *gorm.DB {
+	return db.Model(&TicketWatcher{}).Select("ticket_id").Where("user_id = ?", userID)
+}
+
+// ticketWatcherIDs lista os observadores do chamado
+func ticketWatcherIDs(ticketID uint) []uint {
+	var ids []uint
+	db.Model(&TicketWatcher{}).Where("ticket_id = ?", ticketID).Pluck("user_id", &ids)
+	return ids
+}
+
+// migrateTicketWatchers inclui solicitante e responsável dos chamados criados antes dos observadores
+func migrateTicketWatchers() {
+	var count int64
+	db.Model(&TicketWatcher{}).Count(&count)
+	if count > 0 {
+		return
+	}
+	var tickets []Ticket
+	db.Select("id, creator_id, assigned_to_id").Find(&tickets)
+	for _, t := range tickets {
+		addTicketWatcher(db, t.ID, t.CreatorID, watchReasonCreator, nil)
+		if t.AssignedToID != nil {
+			addTicketWatcher(db, t.ID, *t.AssignedToID, watchReasonAssignee, nil)
+		}
+	}
+}
+
+// --- Menções ---
+
+var mentionPattern = regexp.MustCompile(`(^|[^\w@.])@([A-Za-z0-9][A-Za-z0-9._-]*)`)
+
+// mentionedUsernames extrai os @usuario citados no texto (sem repetição)
+func mentionedUsernames(text string) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		name := strings.TrimRight(m[2], "._-") // Pontuação no fim da frase
+		if name != "" && !seen[strings.ToLower(name)] {
+			seen[strings.ToLower(name)] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// processMentions inclui os mencionados como observadores, os avisa e devolve quem foi avisado
+func processMentions(c *gin.Context, ticket Ticket, comment Comment) []uint {
+	names := mentionedUsernames(comment.Content)
+	if len(names) == 0 {
+		return nil
+	}
+	var users []User
+	db.Where("username IN ? AND active = ?", names, true).Find(&users)
+
+	n := newTicketNotice(c, noticeMention, ticket.ID, fmt.Sprintf("%s mencionou você no chamado #%d", comment.Author, ticket.ID))
+	n.Message = comment.Content
+	n.Internal = comment.Internal
+
+	var candidates []uint
+	for _, u := range users {
+		candidates = append(candidates, u.ID)
+	}
+	// Nota interna: só menciona quem pode lê-la
+	n.Recipients = noticeRecipients(n, candidates)
+	for _, id := range n.Recipients {
+		addTicketWatcher(db, ticket.ID, id, watchReasonMention, &n.ActorID)
+	}
+	publishTicketNotice(n)
+	return n.Recipients
+}
+
+// --- Handlers ---
+
+func loadVisibleTicket(c *gin.Context) (*Ticket, bool) {
+	var ticket Ticket
+	if err := db.First(&ticket, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		return nil, false
+	}
+	if !canViewTicket(c, ticket) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Você não tem permissão para ver este chamado"})
+		return nil, false
+	}
+	return &ticket, true
+}
+
+// GetTicketWatchers lista os observadores do chamado
+func GetTicketWatchers(c *gin.Context) {
+	ticket, ok := loadVisibleTicket(c)
+	if !ok {
+		return
+	}
+	var watchers []TicketWatcher
+	db.Preload("User", func(tx *gorm.DB) *gorm.DB {
+		return tx.Select("id, username, full_name, sector, role, active")
+	}).Where("ticket_id = ?", ticket.ID).Order("created_at").Find(&watchers)
+	c.JSON(http.StatusOK, watchers)
+}
+
+// AddTicketWatcher inclui outro usuário como observador (ticket.assign)
+func AddTicketWatcher(c *gin.Context) {
+	var input struct {
+		UserID uint `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ticket, ok := loadVisibleTicket(c)
+	if !ok {
+		return
+	}
+	var user User
+	if err := db.First(&user, input.UserID).Error; err != nil || !user.Active {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Usuário inválido ou desativado"})
+		return
+	}
+
+	uid := getCurrentUserID(c)
+	if addTicketWatcher(db, ticket.ID, user.ID, watchReasonManual, &uid) {
+		logRequestAction(c, "WATCHER_ADD", "Ticket", ticket.ID, fmt.Sprintf("%s incluído como observador", user.Username))
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Observador incluído"})
+}
+
+// RemoveTicketWatcher remove um observador (ticket.assign ou o próprio usuário)
+func RemoveTicketWatcher(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("userId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Usuário inválido"})
+		return
+	}
+	ticket, ok := loadVisibleTicket(c)
+	if !ok {
+		return
+	}
+	if uint(userID) != getCurrentUserID(c) && !hasPermission(c, "ticket.assign") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Permissão necessária: ticket.assign"})
+		return
+	}
+	removeTicketWatcher(c, *ticket, uint(userID))
+}
+
+// WatchTicket inscreve o usuário atual no chamado
+func WatchTicket(c *gin.Context) {
+	ticket, ok := loadVisibleTicket(c)
+	if !ok {
+		return
+	}
+	uid := getCurrentUserID(c)
+	if addTicketWatcher(db, ticket.ID, uid, watchReasonManual, &uid) {
+		logRequestAction(c, "WATCHER_ADD", "Ticket", ticket.ID, "Passou a acompanhar o chamado")
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Você está acompanhando este chamado"})
+}
+
+// UnwatchTicket cancela a inscrição do usuário atual
+func UnwatchTicket(c *gin.Context) {
+	ticket, ok := loadVisibleTicket(c)
+	if !ok {
+		return
+	}
+	removeTicketWatcher(c, *ticket, getCurrentUserID(c))
+}
+
+func removeTicketWatcher(c *gin.Context, ticket Ticket, userID uint) {
+	result := db.Where("ticket_id = ? AND user_id = ?", ticket.ID, userID).Delete(&TicketWatcher{})
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não acompanha este chamado"})
+		return
+	}
+	logRequestAction(c, "WATCHER_REMOVE", "Ticket", ticket.ID, fmt.Sprintf("Observador %d removido", userID))
+	c.JSON(http.StatusOK, gin.H{"message": "Observador removido"})
+}
@@ -0,0 +1,566 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==========================================
+// WEBHOOKS (integrações externas)
+// ==========================================
+//
+// Cada mudança de chamado publicada pelos handlers (ver stream.go) vira uma
+// WebhookDelivery para as assinaturas interessadas; runWebhookQueue envia em
+// segundo plano com espera exponencial entre as tentativas. O corpo é assinado
+// com HMAC-SHA256 do segredo da assinatura:
+//
+//	X-Webhook-Signature: sha256=hex(HMAC(segredo, X-Webhook-Timestamp + "." + corpo))
+//
+// O receptor recalcula a assinatura e descarta timestamps antigos (replay).
+
+// Eventos enviados (webhookEventPing só pelo botão "Testar")
+const (
+	webhookEventPing = "ping"
+	webhookAllEvents = "*"
+)
+
+var webhookEvents = []struct {
+	Event string `json:"event"`
+	Label string `json:"label"`
+}{
+	{"ticket.created", "Chamado aberto"},
+	{"ticket.updated", "Chamado alterado (status, responsável, classificação, SLA)"},
+	{"ticket.commented", "Novo comentário"},
+	{"ticket.deleted", "Chamado excluído"},
+}
+
+// webhookEventFor traduz o tipo de mudança para o nome do evento do webhook
+var webhookEventFor = map[string]string{
+	streamTicketCreated:   "ticket.created",
+	streamTicketUpdated:   "ticket.updated",
+	streamTicketCommented: "ticket.commented",
+	streamTicketDeleted:   "ticket.deleted",
+}
+
+func isWebhookEvent(event string) bool {
+	for _, e := range webhookEvents {
+		if e.Event == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Situação das entregas
+const (
+	deliveryPending = "pending"
+	deliverySent    = "sent"
+	deliveryFailed  = "failed"
+)
+
+const (
+	webhookRetryBase     = 30 * time.Second // Espera após a 1ª falha; dobra a cada tentativa
+	webhookRetryMax      = 6 * time.Hour
+	webhookResponseLimit = 1024 // Trecho da resposta guardado no registro
+)
+
+// Webhook é uma assinatura de eventos de chamados
+type Webhook struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	Name            string    `gorm:"not null" json:"name"`
+	URL             string    `gorm:"not null" json:"url"`
+	Events          string    `json:"events"` // Separados por vírgula ("*" = todos)
+	Secret          string    `json:"-"`
+	Active          bool      `gorm:"default:true" json:"active"`
+	IncludeInternal bool      `json:"include_internal"` // Enviar também notas internas
+	CreatedByID     uint      `json:"created_by_id"`
+}
+
+// EventList devolve os eventos assinados
+func (w Webhook) EventList() []string {
+	if w.Events == "" {
+		return nil
+	}
+	return strings.Split(w.Events, ",")
+}
+
+// Wants indica se a assinatura recebe o evento
+func (w Webhook) Wants(event string) bool {
+	for _, e := range w.EventList() {
+		if e == webhookAllEvents || e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery é um envio (pendente, entregue ou desistido) com o resultado da última tentativa
+type WebhookDelivery struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt      time.Time  `gorm:"index" json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	WebhookID      uint       `gorm:"index;not null" json:"webhook_id"`
+	Event          string     `json:"event"`
+	TicketID       *uint      `gorm:"index" json:"ticket_id"`
+	Payload        string     `json:"payload"`
+	Status         string     `gorm:"index;default:'pending'" json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `gorm:"index" json:"next_attempt_at"`
+	StatusCode     int        `json:"status_code"`
+	LastError      string     `json:"last_error"`
+	Response       string     `json:"response"`
+	DurationMs     int64      `json:"duration_ms"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	RedeliveryOfID *uint      `json:"redelivery_of_id"` // Reenvio manual de outra entrega
+}
+
+// webhookTicket é o chamado no corpo do webhook (só dados de exibição, sem objetos internos)
+type webhookTicket struct {
+	ID          uint      `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Status      string    `json:"status"`
+	Priority    string    `json:"priority"`
+	Category    string    `json:"category"`
+	Requester   string    `json:"requester"`
+	AssignedTo  string    `json:"assigned_to"`
+	Sector      string    `json:"sector"`
+	Link        string    `json:"link"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type webhookComment struct {
+	ID        uint      `json:"id"`
+	Author    string    `json:"author"`
+	Content   string    `json:"content"`
+	Internal  bool      `json:"internal"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type webhookPayload struct {
+	Event      string          `json:"event"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Ticket     *webhookTicket  `json:"ticket,omitempty"`
+	Comment    *webhookComment `json:"comment,omitempty"`
+}
+
+func newWebhookTicket(t Ticket) *webhookTicket {
+	wt := &webhookTicket{
+		ID:          t.ID,
+		Title:       t.Title,
+		Description: t.Description,
+		Status:      t.Status,
+		Priority:    t.Priority,
+		Category:    "Sem Categoria",
+		AssignedTo:  "Ninguém",
+		Sector:      t.Sector,
+		Link:        ticketLink(t.ID),
+		CreatedAt:   t.CreatedAt,
+		UpdatedAt:   t.UpdatedAt,
+	}
+	if t.Category != nil {
+		wt.Category = t.Category.Name
+	}
+	if t.Creator != nil {
+		wt.Requester = displayName(*t.Creator)
+	}
+	if t.AssignedTo != nil {
+		wt.AssignedTo = displayName(*t.AssignedTo)
+	}
+	return wt
+}
+
+// queueTicketWebhooks cria as entregas da mudança para as assinaturas ativas (destino registrado em main)
+func queueTicketWebhooks(change ticketChange) {
+	event, ok := webhookEventFor[change.Kind]
+	if !ok {
+		return
+	}
+	var hooks []Webhook
+	db.Where("active = ?", true).Find(&hooks)
+
+	payload := webhookPayload{Event: event, OccurredAt: time.Now()}
+	if change.Kind == streamTicketDeleted {
+		payload.Ticket = &webhookTicket{ID: change.Ticket.ID, Title: change.Ticket.Title}
+	} else {
+		payload.Ticket = newWebhookTicket(change.Ticket)
+	}
+	internal := false
+	if c := change.Comment; c != nil {
+		internal = c.Internal
+		payload.Comment = &webhookComment{ID: c.ID, Author: c.Author, Content: c.Content, Internal: c.Internal, CreatedAt: c.CreatedAt}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	queued := 0
+	for _, hook := range hooks {
+		if !hook.Wants(event) || (internal && !hook.IncludeInternal) {
+			continue
+		}
+		if queueWebhookDelivery(hook.ID, event, &change.Ticket.ID, string(body), nil) == nil {
+			queued++
+		}
+	}
+	if queued > 0 {
+		wakeWebhookQueue()
+	}
+}
+
+func queueWebhookDelivery(hookID uint, event string, ticketID *uint, payload string, redeliveryOf *uint) error {
+	delivery := WebhookDelivery{
+		WebhookID:      hookID,
+		Event:          event,
+		TicketID:       ticketID,
+		Payload:        payload,
+		Status:         deliveryPending,
+		NextAttemptAt:  time.Now(),
+		RedeliveryOfID: redeliveryOf,
+	}
+	if err := db.Create(&delivery).Error; err != nil {
+		fmt.Printf("[WEBHOOK] Erro ao enfileirar %s para o webhook %d: %v\n", event, hookID, err)
+		return err
+	}
+	return nil
+}
+
+// signWebhookPayload calcula a assinatura enviada em X-Webhook-Signature
+func signWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookRetryDelay é a espera antes da próxima tentativa (30s, 1min, 2min... até 6h)
+func webhookRetryDelay(attempts int) time.Duration {
+	delay := webhookRetryBase
+	for i := 1; i < attempts && delay < webhookRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > webhookRetryMax {
+		delay = webhookRetryMax
+	}
+	return delay
+}
+
+// --- Envio em segundo plano ---
+
+var webhookQueueWake = make(chan struct{}, 1)
+
+// wakeWebhookQueue pede o processamento imediato da fila (sem bloquear)
+func wakeWebhookQueue() {
+	select {
+	case webhookQueueWake <- struct{}{}:
+	default:
+	}
+}
+
+// runWebhookQueue processa a fila a cada 15 segundos ou quando novas entregas chegam
+func runWebhookQueue() {
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+
+	lastCleanup := time.Time{}
+	for {
+		processWebhookQueue()
+		if time.Since(lastCleanup) > 6*time.Hour {
+			pruneWebhookDeliveries()
+			lastCleanup = time.Now()
+		}
+		select {
+		case <-ticker.C:
+		case <-webhookQueueWake:
+		}
+	}
+}
+
+// processWebhookQueue envia as entregas vencidas; só roda na goroutine de runWebhookQueue
+func processWebhookQueue() {
+	maxAttempts := getSettingInt("webhook_max_attempts", 8)
+	timeout := time.Duration(getSettingInt("webhook_timeout_seconds", 10)) * time.Second
+	client := &http.Client{Timeout: timeout}
+
+	var batch []WebhookDelivery
+	db.Where("status = ? AND next_attempt_at <= ?", deliveryPending, time.Now()).Order("id").Limit(50).Find(&batch)
+
+	hooks := map[uint]*Webhook{}
+	for _, item := range batch {
+		hook, ok := hooks[item.WebhookID]
+		if !ok {
+			var w Webhook
+			if db.First(&w, item.WebhookID).Error == nil {
+				hook = &w
+			}
+			hooks[item.WebhookID] = hook
+		}
+		if hook == nil || !hook.Active {
+			item.Status, item.LastError = deliveryFailed, "Webhook excluído ou desativado"
+			db.Select("status", "last_error").Save(&item)
+			continue
+		}
+
+		code, response, duration, err := deliverWebhook(client, *hook, item)
+		item.Attempts++
+		item.StatusCode, item.Response, item.DurationMs = code, response, duration.Milliseconds()
+		if err == nil {
+			now := time.Now()
+			item.Status = deliverySent
+			item.DeliveredAt = &now
+			item.LastError = ""
+		} else {
+			item.LastError = err.Error()
+			if item.Attempts >= maxAttempts {
+				item.Status = deliveryFailed
+				fmt.Printf("[WEBHOOK] Desistindo da entrega %d (%s) para %s após %d tentativas: %v\n", item.ID, item.Event, hook.URL, item.Attempts, err)
+			} else {
+				item.NextAttemptAt = time.Now().Add(webhookRetryDelay(item.Attempts))
+			}
+		}
+		db.Select("attempts", "status", "status_code", "response", "duration_ms", "delivered_at", "last_error", "next_attempt_at").Save(&item)
+	}
+}
+
+// deliverWebhook faz o POST assinado; respostas fora de 2xx contam como falha
+func deliverWebhook(client *http.Client, hook Webhook, item WebhookDelivery) (int, string, time.Duration, error) {
+	body := []byte(item.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "CamaraGestao-Webhook/1.0")
+	req.Header.Set("X-Webhook-Event", item.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(item.ID), 10))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", signWebhookPayload(hook.Secret, timestamp, body))
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	duration := time.Since(start)
+	if err != nil {
+		return 0, "", duration, err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, string(snippet), duration, fmt.Errorf("resposta HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, string(snippet), duration, nil
+}
+
+// pruneWebhookDeliveries remove entregas concluídas mais antigas que webhook_log_retention_days
+func pruneWebhookDeliveries() {
+	days := getSettingInt("webhook_log_retention_days", 30)
+	if days <= 0 {
+		return
+	}
+	limit := time.Now().AddDate(0, 0, -days)
+	db.Where("status <> ? AND created_at < ?", deliveryPending, limit).Delete(&WebhookDelivery{})
+}
+
+// --- Handlers (settings.manage) ---
+
+type webhookInput struct {
+	Name            string   `json:"name" binding:"required"`
+	URL             string   `json:"url" binding:"required"`
+	Events          []string `json:"events" binding:"required"`
+	Active          *bool    `json:"active"`
+	IncludeInternal bool     `json:"include_internal"`
+	Secret          string   `json:"secret"`        // Vazio na criação = gerado automaticamente
+	RotateSecret    bool     `json:"rotate_secret"` // Na alteração: gera um novo segredo
+}
+
+func (in webhookInput) validate() error {
+	u, err := url.Parse(in.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("URL inválida: use http:// ou https://")
+	}
+	if len(in.Events) == 0 {
+		return fmt.Errorf("Selecione ao menos um evento")
+	}
+	for _, e := range in.Events {
+		if e != webhookAllEvents && !isWebhookEvent(e) {
+			return fmt.Errorf("Evento desconhecido: %s", e)
+		}
+	}
+	if in.Secret != "" && len(in.Secret) < 16 {
+		return fmt.Errorf("O segredo deve ter ao menos 16 caracteres")
+	}
+	return nil
+}
+
+// GetWebhooks lista as assinaturas e os eventos disponíveis
+func GetWebhooks(c *gin.Context) {
+	hooks := []Webhook{}
+	db.Order("id").Find(&hooks)
+	c.JSON(http.StatusOK, gin.H{"webhooks": hooks, "events": webhookEvents})
+}
+
+// CreateWebhook cadastra uma assinatura; o segredo só é mostrado nesta resposta
+func CreateWebhook(c *gin.Context) {
+	var input webhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := input.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	secret := input.Secret
+	if secret == "" {
+		var err error
+		if secret, err = generateRandomToken(32); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gerar segredo"})
+			return
+		}
+	}
+
+	hook := Webhook{
+		Name:            input.Name,
+		URL:             input.URL,
+		Events:          strings.Join(input.Events, ","),
+		Secret:          secret,
+		Active:          input.Active == nil || *input.Active,
+		IncludeInternal: input.IncludeInternal,
+		CreatedByID:     getCurrentUserID(c),
+	}
+	if err := db.Create(&hook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar webhook"})
+		return
+	}
+	logRequestAction(c, "CREATE", "Webhook", hook.ID, fmt.Sprintf("Webhook %s -> %s [%s]", hook.Name, hook.URL, hook.Events))
+	c.JSON(http.StatusCreated, gin.H{"webhook": hook, "secret": secret})
+}
+
+// UpdateWebhook altera a assinatura; com rotate_secret (ou secret) o segredo é trocado e devolvido
+func UpdateWebhook(c *gin.Context) {
+	var hook Webhook
+	if err := db.First(&hook, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook não encontrado"})
+		return
+	}
+	var input webhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := input.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hook.Name, hook.URL, hook.Events = input.Name, input.URL, strings.Join(input.Events, ",")
+	hook.IncludeInternal = input.IncludeInternal
+	if input.Active != nil {
+		hook.Active = *input.Active
+	}
+	newSecret := input.Secret
+	if newSecret == "" && input.RotateSecret {
+		var err error
+		if newSecret, err = generateRandomToken(32); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gerar segredo"})
+			return
+		}
+	}
+	details := fmt.Sprintf("Webhook %s -> %s [%s], ativo: %t", hook.Name, hook.URL, hook.Events, hook.Active)
+	if newSecret != "" {
+		hook.Secret = newSecret
+		details += " (segredo trocado)"
+	}
+	if err := db.Save(&hook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar webhook"})
+		return
+	}
+	logRequestAction(c, "UPDATE", "Webhook", hook.ID, details)
+
+	response := gin.H{"webhook": hook}
+	if newSecret != "" {
+		response["secret"] = newSecret
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteWebhook remove a assinatura e seu registro de entregas
+func DeleteWebhook(c *gin.Context) {
+	var hook Webhook
+	if err := db.First(&hook, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook não encontrado"})
+		return
+	}
+	db.Where("webhook_id = ?", hook.ID).Delete(&WebhookDelivery{})
+	db.Delete(&hook)
+	logRequestAction(c, "DELETE", "Webhook", hook.ID, fmt.Sprintf("Webhook %s -> %s removido", hook.Name, hook.URL))
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook removido"})
+}
+
+// TestWebhook enfileira um evento "ping" para conferir URL e assinatura no receptor
+func TestWebhook(c *gin.Context) {
+	var hook Webhook
+	if err := db.First(&hook, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook não encontrado"})
+		return
+	}
+	body, _ := json.Marshal(webhookPayload{Event: webhookEventPing, OccurredAt: time.Now()})
+	if err := queueWebhookDelivery(hook.ID, webhookEventPing, nil, string(body), nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao enfileirar teste"})
+		return
+	}
+	wakeWebhookQueue()
+	c.JSON(http.StatusOK, gin.H{"message": "Evento de teste enfileirado"})
+}
+
+// GetWebhookDeliveries lista as últimas entregas (filtros: webhook_id, status)
+func GetWebhookDeliveries(c *gin.Context) {
+	query := db.Order("id desc").Limit(200)
+	if id := c.Query("webhook_id"); id != "" {
+		query = query.Where("webhook_id = ?", id)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	items := []WebhookDelivery{}
+	query.Find(&items)
+	c.JSON(http.StatusOK, items)
+}
+
+// RedeliverWebhook reenvia uma entrega (mesmo corpo, nova assinatura) como uma nova entrada no registro
+func RedeliverWebhook(c *gin.Context) {
+	var item WebhookDelivery
+	if err := db.First(&item, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Entrega não encontrada"})
+		return
+	}
+	var hook Webhook
+	if err := db.First(&hook, item.WebhookID).Error; err != nil || !hook.Active {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Webhook excluído ou desativado"})
+		return
+	}
+	if err := queueWebhookDelivery(hook.ID, item.Event, item.TicketID, item.Payload, &item.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao enfileirar reenvio"})
+		return
+	}
+	wakeWebhookQueue()
+	logRequestAction(c, "WEBHOOK_REDELIVER", "Webhook", hook.ID, fmt.Sprintf("Entrega %d (%s) reenviada para %s", item.ID, item.Event, hook.URL))
+	c.JSON(http.StatusOK, gin.H{"message": "Entrega recolocada na fila"})
+}
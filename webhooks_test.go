@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	// Valor de referência calculado fora do Go: HMAC-SHA256("segredo-do-webhook", "1700000000." + corpo)
+	got := signWebhookPayload("segredo-do-webhook", "1700000000", []byte(`{"event":"ping"}`))
+	if want := "sha256=30679fb11eab47c44991de2f39b494cb6b3df9a4286a9199e1b1665e069b1f6f"; got != want {
+		t.Errorf("assinatura = %s, esperado %s", got, want)
+	}
+	// O timestamp faz parte da assinatura: reenviar o corpo com outro horário não reaproveita a assinatura
+	if signWebhookPayload("segredo-do-webhook", "1700000001", []byte(`{"event":"ping"}`)) == got {
+		t.Error("assinatura não depende do timestamp")
+	}
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	cases := map[int]time.Duration{
+		0:  30 * time.Second,
+		1:  30 * time.Second,
+		2:  time.Minute,
+		3:  2 * time.Minute,
+		8:  64 * time.Minute,
+		10: 256 * time.Minute,
+		11: webhookRetryMax,
+		50: webhookRetryMax,
+	}
+	for attempts, want := range cases {
+		if got := webhookRetryDelay(attempts); got != want {
+			t.Errorf("webhookRetryDelay(%d) = %v, esperado %v", attempts, got, want)
+		}
+	}
+}
+
+// webhookReceiver confere a assinatura como um receptor faria e responde com os códigos programados
+type webhookReceiver struct {
+	secret string
+
+	mu        sync.Mutex
+	responses []int
+	received  []map[string]interface{}
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	timestamp := req.Header.Get("X-Webhook-Timestamp")
+	if ts, err := strconv.ParseInt(timestamp, 10, 64); err != nil || time.Since(time.Unix(ts, 0)) > 5*time.Minute {
+		http.Error(w, "timestamp inválido", http.StatusBadRequest)
+		return
+	}
+	expected := signWebhookPayload(r.secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(req.Header.Get("X-Webhook-Signature"))) {
+		http.Error(w, "assinatura inválida", http.StatusUnauthorized)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	code := http.StatusOK
+	if len(r.responses) > 0 {
+		code, r.responses = r.responses[0], r.responses[1:]
+	}
+	if code == http.StatusOK {
+		var payload map[string]interface{}
+		json.Unmarshal(body, &payload)
+		payload["header_event"] = req.Header.Get("X-Webhook-Event")
+		r.received = append(r.received, payload)
+	}
+	w.WriteHeader(code)
+	io.WriteString(w, "ok")
+}
+
+func TestWebhookQueueSignsAndRetries(t *testing.T) {
+	setupTestDB(t)
+	receiver := &webhookReceiver{secret: "segredo-do-webhook", responses: []int{http.StatusInternalServerError}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	db.Create(&Webhook{Name: "Integração", URL: server.URL, Events: "ticket.commented", Secret: receiver.secret, Active: true})
+	db.Create(&Webhook{Name: "Só abertura", URL: server.URL, Events: "ticket.created", Secret: receiver.secret, Active: true})
+	user := createTestUser(t, "joana", "User", "")
+	ticket := createTestTicket(t, "Impressora sem toner", "Novo", user.ID)
+
+	queueTicketWebhooks(ticketChange{Kind: streamTicketCommented, Ticket: ticket, Comment: &Comment{ID: 1, Content: "Toner trocado"}})
+	// Nota interna não sai para assinaturas sem include_internal
+	queueTicketWebhooks(ticketChange{Kind: streamTicketCommented, Ticket: ticket, Comment: &Comment{ID: 2, Content: "Nota", Internal: true}})
+
+	var deliveries []WebhookDelivery
+	db.Find(&deliveries)
+	if len(deliveries) != 1 {
+		t.Fatalf("%d entregas na fila, esperado 1", len(deliveries))
+	}
+
+	// 1ª tentativa: o receptor responde 500 e a entrega é reagendada
+	processWebhookQueue()
+	var delivery WebhookDelivery
+	db.First(&delivery, deliveries[0].ID)
+	if delivery.Status != deliveryPending || delivery.Attempts != 1 || delivery.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("falha não reagendada: %+v", delivery)
+	}
+	if wait := time.Until(delivery.NextAttemptAt); wait < 25*time.Second || wait > webhookRetryBase {
+		t.Errorf("próxima tentativa em %v, esperado %v", wait, webhookRetryBase)
+	}
+
+	// Antes do horário agendado nada é reenviado
+	processWebhookQueue()
+	db.First(&delivery, delivery.ID)
+	if delivery.Attempts != 1 {
+		t.Fatalf("entrega reenviada antes da hora: %+v", delivery)
+	}
+
+	db.Model(&delivery).Update("next_attempt_at", time.Now())
+	processWebhookQueue()
+	db.First(&delivery, delivery.ID)
+	if delivery.Status != deliverySent || delivery.Attempts != 2 || delivery.DeliveredAt == nil {
+		t.Fatalf("entrega não concluída: %+v", delivery)
+	}
+	if len(receiver.received) != 1 || receiver.received[0]["event"] != "ticket.commented" || receiver.received[0]["header_event"] != "ticket.commented" {
+		t.Errorf("payload recebido: %v", receiver.received)
+	}
+}
+
+func TestWebhookQueueGivesUpAfterMaxAttempts(t *testing.T) {
+	setupTestDB(t)
+	setTestSetting(t, "webhook_max_attempts", "2")
+	// Segredo diferente do receptor: toda entrega é recusada com 401
+	receiver := &webhookReceiver{secret: "outro-segredo-qualquer"}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	hook := Webhook{Name: "Integração", URL: server.URL, Events: "*", Secret: "segredo-do-webhook", Active: true}
+	db.Create(&hook)
+	queueWebhookDelivery(hook.ID, webhookEventPing, nil, `{"event":"ping"}`, nil)
+
+	var delivery WebhookDelivery
+	for i := 0; i < 2; i++ {
+		db.Model(&WebhookDelivery{}).Where("status = ?", deliveryPending).Update("next_attempt_at", time.Now())
+		processWebhookQueue()
+	}
+	db.First(&delivery)
+	if delivery.Status != deliveryFailed || delivery.Attempts != 2 || delivery.StatusCode != http.StatusUnauthorized {
+		t.Errorf("entrega deveria ser abandonada após 2 tentativas: %+v", delivery)
+	}
+}
@@ -0,0 +1,546 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==========================================
+// FLUXO DE STATUS DOS CHAMADOS (Máquina de Estados)
+// ==========================================
+//
+// Os status válidos e as transições entre eles ficam no banco e podem ser
+// editados pela API (workflow.manage). Cada transição define quais perfis podem
+// executá-la, se o solicitante também pode e quais campos são obrigatórios.
+// Movimentos fora do fluxo são recusados com 422.
+
+// TicketStatus é um status válido de chamado
+type TicketStatus struct {
+	Name        string `gorm:"primaryKey" json:"name"`
+	Description string `json:"description"`
+	Initial     bool   `json:"initial"` // Status de abertura (exatamente um)
+	Closed      bool   `json:"closed"`  // Encerra o chamado (fora de SLA, painéis e filas)
+	SortOrder   int    `json:"sort_order"`
+}
+
+// WorkflowTransition é um movimento permitido entre dois status
+type WorkflowTransition struct {
+	ID             uint   `gorm:"primaryKey" json:"id"`
+	FromStatus     string `gorm:"index;not null" json:"from_status"`
+	ToStatus       string `gorm:"not null" json:"to_status"`
+	Label          string `json:"label"`           // Texto do botão (ex: "Resolver")
+	Roles          string `json:"roles"`           // Perfis autorizados, separados por vírgula (Admin sempre pode)
+	AllowRequester bool   `json:"allow_requester"` // O solicitante do chamado também pode executar
+	RequiredFields string `json:"required_fields"` // Campos exigidos, separados por vírgula (ver workflowFields)
+	AutoOnComment  bool   `json:"auto_on_comment"` // Aplicada automaticamente quando um perfil autorizado comenta
+}
+
+// Campos que uma transição pode exigir
+var workflowFields = map[string]string{
+	"resolution_note": "Nota de resolução",
+	"comment":         "Justificativa (registrada como comentário)",
+	"assigned_to":     "Responsável definido",
+}
+
+// Fluxo padrão, equivalente às regras anteriores do sistema
+var defaultTicketStatuses = []TicketStatus{
+	{Name: "Novo", Description: "Aguardando atendimento", Initial: true, SortOrder: 1},
+	{Name: "Em Andamento", Description: "Em atendimento", SortOrder: 2},
+	{Name: "Resolvido", Description: "Solução aplicada, aguardando confirmação", Closed: true, SortOrder: 3},
+	{Name: "Fechado", Description: "Encerrado", Closed: true, SortOrder: 4},
+}
+
+var defaultWorkflowTransitions = []WorkflowTransition{
+	{FromStatus: "Novo", ToStatus: "Em Andamento", Label: "Iniciar atendimento", Roles: "Supervisor,Tech", AutoOnComment: true},
+	{FromStatus: "Novo", ToStatus: "Resolvido", Label: "Resolver", Roles: "Supervisor,Tech", RequiredFields: "resolution_note"},
+	{FromStatus: "Em Andamento", ToStatus: "Resolvido", Label: "Resolver", Roles: "Supervisor,Tech", RequiredFields: "resolution_note"},
+	{FromStatus: "Resolvido", ToStatus: "Fechado", Label: "Fechar", Roles: "Supervisor,Tech", AllowRequester: true},
+	{FromStatus: "Resolvido", ToStatus: "Em Andamento", Label: "Reabrir", Roles: "Supervisor,Tech", AllowRequester: true, RequiredFields: "comment"},
+}
+
+// Cache do fluxo (consultado em toda listagem/SLA)
+var (
+	workflowMu          sync.RWMutex
+	workflowStatuses    []TicketStatus
+	workflowTransitions []WorkflowTransition
+)
+
+// Grafias usadas antes do fluxo configurável (o status era texto livre), já normalizadas
+// por statusKey, e o status padrão correspondente
+var legacyTicketStatusAliases = map[string]string{
+	"aberto":         "Novo",
+	"open":           "Novo",
+	"new":            "Novo",
+	"andamento":      "Em Andamento",
+	"em atendimento": "Em Andamento",
+	"em progresso":   "Em Andamento",
+	"in progress":    "Em Andamento",
+	"resolved":       "Resolvido",
+	"solucionado":    "Resolvido",
+	"concluido":      "Resolvido",
+	"fechado":        "Fechado",
+	"closed":         "Fechado",
+	"encerrado":      "Fechado",
+	"finalizado":     "Fechado",
+}
+
+var statusKeyReplacer = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a", "é", "e", "ê", "e", "í", "i",
+	"ó", "o", "ô", "o", "õ", "o", "ú", "u", "ç", "c", "_", " ", "-", " ",
+)
+
+// statusKey normaliza o nome do status para comparação (caixa, acentos e separadores)
+func statusKey(name string) string {
+	return strings.Join(strings.Fields(statusKeyReplacer.Replace(strings.ToLower(name))), " ")
+}
+
+// seedWorkflow cria o fluxo padrão na primeira execução e ajusta chamados com status legados
+func seedWorkflow() {
+	var count int64
+	db.Model(&TicketStatus{}).Count(&count)
+	if count == 0 {
+		db.Create(&defaultTicketStatuses)
+		db.Create(&defaultWorkflowTransitions)
+	}
+	if err := loadWorkflow(); err != nil {
+		fmt.Printf("[WORKFLOW] Erro ao carregar fluxo: %v\n", err)
+		return
+	}
+	for _, status := range normalizeLegacyTicketStatuses() {
+		fmt.Printf("[WORKFLOW] AVISO: chamados com status '%s' fora do fluxo; ajuste-os manualmente ou cadastre o status\n", status)
+	}
+}
+
+// normalizeLegacyTicketStatuses converte status gravados com outra grafia para o nome do fluxo
+// e devolve os que não puderam ser mapeados
+func normalizeLegacyTicketStatuses() []string {
+	var used []string
+	db.Model(&Ticket{}).Distinct("status").Pluck("status", &used)
+
+	workflowMu.RLock()
+	known := map[string]string{}
+	for _, s := range workflowStatuses {
+		known[statusKey(s.Name)] = s.Name
+	}
+	workflowMu.RUnlock()
+
+	unmapped := []string{}
+	for _, status := range used {
+		key := statusKey(status)
+		target, ok := known[key]
+		if !ok {
+			if alias, isLegacy := legacyTicketStatusAliases[key]; isLegacy {
+				target, ok = known[statusKey(alias)]
+			}
+		}
+		if target == status {
+			continue
+		}
+		if !ok {
+			unmapped = append(unmapped, status)
+			continue
+		}
+		result := db.Model(&Ticket{}).Where("status = ?", status).Update("status", target)
+		if result.Error != nil {
+			fmt.Printf("[WORKFLOW] Erro ao converter status '%s': %v\n", status, result.Error)
+			continue
+		}
+		fmt.Printf("[WORKFLOW] %d chamado(s) com status '%s' convertidos para '%s'\n", result.RowsAffected, status, target)
+	}
+	return unmapped
+}
+
+// loadWorkflow recarrega o cache do fluxo
+func loadWorkflow() error {
+	var statuses []TicketStatus
+	var transitions []WorkflowTransition
+	if err := db.Order("sort_order, name").Find(&statuses).Error; err != nil {
+		return err
+	}
+	if err := db.Order("id").Find(&transitions).Error; err != nil {
+		return err
+	}
+	workflowMu.Lock()
+	workflowStatuses, workflowTransitions = statuses, transitions
+	workflowMu.Unlock()
+	return nil
+}
+
+// initialTicketStatus devolve o status de abertura
+func initialTicketStatus() string {
+	workflowMu.RLock()
+	defer workflowMu.RUnlock()
+	for _, s := range workflowStatuses {
+		if s.Initial {
+			return s.Name
+		}
+	}
+	return "Novo"
+}
+
+// closedTicketStatuses lista os status que encerram o chamado
+func closedTicketStatuses() []string {
+	workflowMu.RLock()
+	defer workflowMu.RUnlock()
+	closed := []string{}
+	for _, s := range workflowStatuses {
+		if s.Closed {
+			closed = append(closed, s.Name)
+		}
+	}
+	if len(closed) == 0 {
+		closed = append(closed, "") // Evita "NOT IN ()" vazio
+	}
+	return closed
+}
+
+// findTransition busca a transição entre dois status
+func findTransition(from, to string) (WorkflowTransition, bool) {
+	workflowMu.RLock()
+	defer workflowMu.RUnlock()
+	for _, t := range workflowTransitions {
+		if t.FromStatus == from && t.ToStatus == to {
+			return t, true
+		}
+	}
+	return WorkflowTransition{}, false
+}
+
+func ticketStatusExists(name string) bool {
+	workflowMu.RLock()
+	defer workflowMu.RUnlock()
+	for _, s := range workflowStatuses {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// canPerformTransition verifica perfil/solicitante para a transição
+func canPerformTransition(c *gin.Context, t WorkflowTransition, ticket Ticket) bool {
+	role := c.GetString("role")
+	if role == adminRoleName {
+		return true
+	}
+	if t.AllowRequester && ticket.CreatorID == getCurrentUserID(c) {
+		return true
+	}
+	// Chamados de terceiros continuam exigindo ticket.update_status
+	for _, r := range splitList(t.Roles) {
+		if r == role {
+			return hasPermission(c, "ticket.update_status") && canViewTicket(c, ticket)
+		}
+	}
+	return false
+}
+
+// availableTransitions lista as transições que o usuário pode executar no chamado
+func availableTransitions(c *gin.Context, ticket Ticket) []WorkflowTransition {
+	workflowMu.RLock()
+	candidates := make([]WorkflowTransition, 0)
+	for _, t := range workflowTransitions {
+		if t.FromStatus == ticket.Status {
+			candidates = append(candidates, t)
+		}
+	}
+	workflowMu.RUnlock()
+
+	result := make([]WorkflowTransition, 0, len(candidates))
+	for _, t := range candidates {
+		if canPerformTransition(c, t, ticket) {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// autoCommentTransition devolve a transição automática ao comentar, se o usuário puder aplicá-la
+func autoCommentTransition(c *gin.Context, ticket Ticket) (WorkflowTransition, bool) {
+	for _, t := range availableTransitions(c, ticket) {
+		if t.AutoOnComment && t.RequiredFields == "" {
+			return t, true
+		}
+	}
+	return WorkflowTransition{}, false
+}
+
+// --- Handlers ---
+
+// UpdateTicketStatus aplica uma transição do fluxo ao chamado
+func UpdateTicketStatus(c *gin.Context) {
+	var input struct {
+		Status         string `json:"status" binding:"required"`
+		ResolutionNote string `json:"resolution_note"`
+		Comment        string `json:"comment"`
+		AssignedToID   *uint  `json:"assigned_to_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var ticket Ticket
+	if err := db.First(&ticket, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		return
+	}
+	if ticket.CreatorID != getCurrentUserID(c) && !canViewTicket(c, ticket) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Você não tem permissão para alterar este chamado"})
+		return
+	}
+
+	if !ticketStatusExists(input.Status) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Status desconhecido: " + input.Status})
+		return
+	}
+	transition, ok := findTransition(ticket.Status, input.Status)
+	if !ok {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":       fmt.Sprintf("Transição não permitida: %s → %s", ticket.Status, input.Status),
+			"transitions": availableTransitions(c, ticket),
+		})
+		return
+	}
+	if !canPerformTransition(c, transition, ticket) {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Seu perfil não pode executar a transição %s → %s", ticket.Status, input.Status)})
+		return
+	}
+
+	// Campos obrigatórios da transição
+	if input.AssignedToID != nil {
+		var assignee User
+		if err := db.First(&assignee, *input.AssignedToID).Error; err != nil || !assignee.Active || !roleHasPermission(assignee.Role, "ticket.assignee") {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Responsável inválido"})
+			return
+		}
+		if !hasPermission(c, "ticket.assign") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Permissão necessária: ticket.assign"})
+			return
+		}
+	}
+	var missing []string
+	for _, field := range splitList(transition.RequiredFields) {
+		switch field {
+		case "resolution_note":
+			if strings.TrimSpace(input.ResolutionNote) == "" {
+				missing = append(missing, field)
+			}
+		case "comment":
+			if strings.TrimSpace(input.Comment) == "" {
+				missing = append(missing, field)
+			}
+		case "assigned_to":
+			if input.AssignedToID == nil && ticket.AssignedToID == nil {
+				missing = append(missing, field)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":          "Campos obrigatórios para esta transição: " + strings.Join(missing, ", "),
+			"missing_fields": missing,
+		})
+		return
+	}
+
+	from, previousAssignee := ticket.Status, ticket.AssignedToID
+	ticket.Status = input.Status
+	if input.AssignedToID != nil {
+		ticket.AssignedToID = input.AssignedToID
+	}
+	if input.ResolutionNote != "" {
+		ticket.ResolutionNote = input.ResolutionNote
+	}
+
+	var comments []Comment
+	if input.ResolutionNote != "" {
+		comments = append(comments, newUserComment(c, ticket.ID, "Resolução: "+input.ResolutionNote))
+	}
+	if input.Comment != "" {
+		comments = append(comments, newUserComment(c, ticket.ID, input.Comment))
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&ticket).Error; err != nil {
+			return err
+		}
+		recordTicketEvent(tx, c, ticket.ID, ticketEventStatus, from, ticket.Status, transition.Label)
+		recordAssignmentChange(tx, c, ticket.ID, previousAssignee, ticket.AssignedToID, "")
+		for i := range comments {
+			if err := tx.Create(&comments[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar chamado"})
+		return
+	}
+
+	logRequestAction(c, "UPDATE", "Ticket", ticket.ID, fmt.Sprintf("Status alterado de %s para %s", from, ticket.Status))
+
+	notice := newTicketNotice(c, noticeTicketStatus, ticket.ID, fmt.Sprintf("Chamado #%d: %s → %s", ticket.ID, from, ticket.Status))
+	notice.OldValue, notice.NewValue = from, ticket.Status
+	var texts []string
+	for _, comment := range comments {
+		texts = append(texts, comment.Content)
+	}
+	notice.Message = strings.Join(texts, "\n\n")
+	notifyTicketWatchers(notice)
+	notifyAssignment(c, ticket.ID, previousAssignee, ticket.AssignedToID)
+	publishTicketChange(streamTicketUpdated, ticket.ID)
+
+	c.JSON(http.StatusOK, ticket)
+}
+
+// currentUserDisplayName devolve o nome do usuário autenticado para comentários
+func currentUserDisplayName(c *gin.Context) string {
+	var user User
+	if err := db.Select("id, username, full_name").First(&user, getCurrentUserID(c)).Error; err != nil {
+		return "Usuário"
+	}
+	return displayName(user)
+}
+
+// GetTicketTransitions lista as transições disponíveis para o usuário no chamado
+func GetTicketTransitions(c *gin.Context) {
+	var ticket Ticket
+	if err := db.First(&ticket, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		return
+	}
+	if ticket.CreatorID != getCurrentUserID(c) && !canViewTicket(c, ticket) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Você não tem permissão para ver este chamado"})
+		return
+	}
+	c.JSON(http.StatusOK, availableTransitions(c, ticket))
+}
+
+// GetWorkflow devolve o fluxo atual (status, transições e campos exigíveis)
+func GetWorkflow(c *gin.Context) {
+	workflowMu.RLock()
+	defer workflowMu.RUnlock()
+	c.JSON(http.StatusOK, gin.H{
+		"statuses":    workflowStatuses,
+		"transitions": workflowTransitions,
+		"fields":      workflowFields,
+	})
+}
+
+// UpdateWorkflow substitui o fluxo inteiro após validá-lo
+func UpdateWorkflow(c *gin.Context) {
+	var input struct {
+		Statuses    []TicketStatus       `json:"statuses" binding:"required"`
+		Transitions []WorkflowTransition `json:"transitions" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateWorkflow(input.Statuses, input.Transitions); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Status removidos não podem estar em uso por chamados
+	names := make([]string, 0, len(input.Statuses))
+	for _, s := range input.Statuses {
+		names = append(names, s.Name)
+	}
+	var orphan []string
+	db.Model(&Ticket{}).Where("status NOT IN ?", names).Distinct().Pluck("status", &orphan)
+	if len(orphan) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Status em uso por chamados não podem ser removidos: " + strings.Join(orphan, ", ")})
+		return
+	}
+
+	for i := range input.Transitions {
+		input.Transitions[i].ID = 0
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&WorkflowTransition{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("1 = 1").Delete(&TicketStatus{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&input.Statuses).Error; err != nil {
+			return err
+		}
+		if len(input.Transitions) > 0 {
+			return tx.Create(&input.Transitions).Error
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar fluxo"})
+		return
+	}
+	loadWorkflow()
+
+	logRequestAction(c, "UPDATE", "Workflow", 0, fmt.Sprintf("Fluxo de status atualizado: %d status, %d transições", len(input.Statuses), len(input.Transitions)))
+	GetWorkflow(c)
+}
+
+// validateWorkflow confere consistência de status, perfis e campos
+func validateWorkflow(statuses []TicketStatus, transitions []WorkflowTransition) error {
+	known := map[string]bool{}
+	initial := 0
+	for _, s := range statuses {
+		if strings.TrimSpace(s.Name) == "" {
+			return fmt.Errorf("Status sem nome")
+		}
+		if known[s.Name] {
+			return fmt.Errorf("Status duplicado: %s", s.Name)
+		}
+		known[s.Name] = true
+		if s.Initial {
+			initial++
+		}
+	}
+	if initial != 1 {
+		return fmt.Errorf("O fluxo deve ter exatamente um status inicial")
+	}
+
+	seen := map[string]bool{}
+	for _, t := range transitions {
+		if !known[t.FromStatus] || !known[t.ToStatus] {
+			return fmt.Errorf("Transição com status desconhecido: %s → %s", t.FromStatus, t.ToStatus)
+		}
+		if t.FromStatus == t.ToStatus {
+			return fmt.Errorf("Transição sem mudança de status: %s", t.FromStatus)
+		}
+		key := t.FromStatus + "\x00" + t.ToStatus
+		if seen[key] {
+			return fmt.Errorf("Transição duplicada: %s → %s", t.FromStatus, t.ToStatus)
+		}
+		seen[key] = true
+		for _, r := range splitList(t.Roles) {
+			if !roleExists(r) {
+				return fmt.Errorf("Perfil desconhecido na transição %s → %s: %s", t.FromStatus, t.ToStatus, r)
+			}
+		}
+		for _, f := range splitList(t.RequiredFields) {
+			if _, ok := workflowFields[f]; !ok {
+				return fmt.Errorf("Campo obrigatório desconhecido na transição %s → %s: %s", t.FromStatus, t.ToStatus, f)
+			}
+		}
+	}
+	return nil
+}
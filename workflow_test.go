@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func createTestTicket(t *testing.T, title, status string, creator uint) Ticket {
+	t.Helper()
+	ticket := Ticket{Title: title, Status: status, CreatorID: creator}
+	if err := db.Create(&ticket).Error; err != nil {
+		t.Fatalf("falha ao criar chamado %s: %v", title, err)
+	}
+	return ticket
+}
+
+func TestNormalizeLegacyTicketStatuses(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "joana", "User", "")
+	legacy := map[string]string{
+		"em andamento": "Em Andamento",
+		"Aberto":       "Novo",
+		"Concluído":    "Resolvido",
+		"FECHADO":      "Fechado",
+		"Novo":         "Novo",
+	}
+	ids := map[string]uint{}
+	for status := range legacy {
+		ids[status] = createTestTicket(t, "Chamado "+status, status, user.ID).ID
+	}
+	createTestTicket(t, "Chamado cancelado", "Cancelado", user.ID)
+
+	unmapped := normalizeLegacyTicketStatuses()
+	if strings.Join(unmapped, ",") != "Cancelado" {
+		t.Errorf("status não mapeados = %v, esperado [Cancelado]", unmapped)
+	}
+	for status, want := range legacy {
+		var ticket Ticket
+		db.First(&ticket, ids[status])
+		if ticket.Status != want {
+			t.Errorf("status %q convertido para %q, esperado %q", status, ticket.Status, want)
+		}
+	}
+
+	var remaining []string
+	db.Model(&Ticket{}).Distinct("status").Pluck("status", &remaining)
+	sort.Strings(remaining)
+	if got := strings.Join(remaining, ","); got != "Cancelado,Em Andamento,Fechado,Novo,Resolvido" {
+		t.Errorf("status após a conversão: %s", got)
+	}
+}
+
+func TestReportsCountWorkflowClosedStatuses(t *testing.T) {
+	setupTestDB(t)
+	// Fluxo personalizado: "Concluído" substitui "Resolvido" como status final
+	db.Create(&TicketStatus{Name: "Concluído", Closed: true, SortOrder: 5})
+	db.Model(&TicketStatus{}).Where("name = ?", "Resolvido").Update("closed", false)
+	if err := loadWorkflow(); err != nil {
+		t.Fatal(err)
+	}
+	user := createTestUser(t, "joana", "User", "")
+	for _, status := range []string{"Novo", "Resolvido", "Concluído", "Fechado"} {
+		createTestTicket(t, "Chamado "+status, status, user.ID)
+	}
+
+	r := gin.New()
+	r.GET("/reports", GetReports)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/reports", nil))
+	var stats ReportStats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("resposta inválida: %v (%s)", err, w.Body.String())
+	}
+	if stats.TotalTickets != 4 || stats.OpenTickets != 2 || stats.ResolvedTickets != 2 {
+		t.Errorf("total=%d abertos=%d encerrados=%d, esperado 4/2/2", stats.TotalTickets, stats.OpenTickets, stats.ResolvedTickets)
+	}
+}